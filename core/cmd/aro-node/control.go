@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/control"
+	"aro-ext-app/core/internal/heartbeat"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// logFile 前台进程的日志文件，供控制接口 /logs 读取
+const logFile = "aro-node.log"
+
+// controlTimeout 控制请求超时（nat 检测需要访问多个 STUN 服务器）
+const controlTimeout = 30 * time.Second
+
+// setupLogging 日志同时输出到标准错误和日志文件
+func setupLogging() {
+	log.SetOutput(io.MultiWriter(os.Stderr, &lumberjack.Logger{
+		Filename:   logFile,
+		MaxSize:    10, // MB
+		MaxBackups: 1,
+	}))
+}
+
+// startControl 启动本地控制服务，ctx 结束时关闭；hb 为空时 /status 不包含心跳状态
+func startControl(ctx context.Context, clientID string, hb *heartbeat.Service) error {
+	opts := control.Options{
+		LogFile: logFile,
+		NodeInfo: func() interface{} {
+			return map[string]string{"client_id": clientID}
+		},
+	}
+	if hb != nil {
+		opts.Heartbeat = func() interface{} { return hb.Status() }
+	}
+	server, err := control.NewServer(opts)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := server.Serve(); err != nil {
+			log.Printf("Control API stopped: %v", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	return nil
+}
+
+// callControl 调用正在运行的节点的控制接口
+func callControl(method, path string, body, out interface{}) error {
+	client, err := control.NewClient("", "", "")
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controlTimeout)
+	defer cancel()
+	return client.Do(ctx, method, path, body, out)
+}
+
+// cmdStatus 输出正在运行的节点状态
+func cmdStatus(args []string) error {
+	flag.NewFlagSet("status", flag.ExitOnError).Parse(args)
+	var status control.Status
+	if err := callControl(http.MethodGet, "/status", nil, &status); err != nil {
+		return err
+	}
+	return printJSON(status)
+}
+
+// cmdLogs 输出正在运行的节点最近的日志
+func cmdLogs(args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	lines := fs.Int("n", 200, "number of lines")
+	fs.Parse(args)
+
+	var out []string
+	if err := callControl(http.MethodGet, "/logs?lines="+strconv.Itoa(*lines), nil, &out); err != nil {
+		return err
+	}
+	for _, line := range out {
+		os.Stdout.WriteString(line + "\n")
+	}
+	return nil
+}
+
+// cmdReload 通知正在运行的节点重新加载配置，输出变化的配置项；新配置无效时节点保留之前的配置并返回错误
+func cmdReload(args []string) error {
+	flag.NewFlagSet("reload", flag.ExitOnError).Parse(args)
+	var changes []config.Change
+	if err := callControl(http.MethodPost, "/config/reload", nil, &changes); err != nil {
+		return err
+	}
+	return printJSON(map[string]interface{}{"reloaded": true, "changes": changes})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"aro-ext-app/core/internal/events"
+	"aro-ext-app/core/internal/ledger"
+	"aro-ext-app/core/internal/netcheck"
+	"aro-ext-app/core/internal/speedtest"
+)
+
+// cmdNat 通过 STUN 探测 NAT 类型和公网地址，结束后发布 NAT 探测的 task.completed 事件
+func cmdNat(args []string) error {
+	fs := flag.NewFlagSet("nat", flag.ExitOnError)
+	servers := fs.String("servers", strings.Join(netcheck.DefaultServers, ","), "comma separated STUN servers")
+	timeout := fs.Duration("timeout", netcheck.DefaultTimeout, "timeout per STUN server")
+	fs.Parse(args)
+
+	var list []string
+	for _, s := range strings.Split(*servers, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	result, err := netcheck.Detect(context.Background(), list, *timeout)
+	completed := events.TaskEvent{Kind: ledger.TaskNATProbe, Success: err == nil}
+	if err != nil {
+		completed.Error = err.Error()
+	}
+	events.Publish(events.TaskCompleted, completed)
+	if err != nil {
+		return err
+	}
+	return printJSON(result)
+}
+
+// cmdSpeedtest 执行带宽测试任务，任务格式与调度下发的 bandwidth test 消息相同
+func cmdSpeedtest(args []string) error {
+	fs := flag.NewFlagSet("speedtest", flag.ExitOnError)
+	taskPath := fs.String("task", "", "bandwidth test task (JSON file, '-' for stdin)")
+	fs.Parse(args)
+
+	if *taskPath == "" {
+		return fmt.Errorf("-task is required")
+	}
+	var data []byte
+	var err error
+	if *taskPath == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(userPath(*taskPath))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read task: %w", err)
+	}
+
+	var task speedtest.BandwidthTestTask
+	if err := json.Unmarshal(data, &task); err != nil {
+		return fmt.Errorf("failed to parse task: %w", err)
+	}
+	result, err := speedtest.GetService().RunTask(&task)
+	if err != nil {
+		return err
+	}
+
+	streams := make([]map[string]interface{}, 0, len(result.StreamResults))
+	for _, s := range result.StreamResults {
+		stream := map[string]interface{}{
+			"stream_id":   s.StreamID,
+			"chunks_sent": s.ChunksSent,
+			"bytes_sent":  s.BytesSent,
+			"duration_ms": s.Duration.Milliseconds(),
+			"success":     s.Success,
+		}
+		if s.Error != nil {
+			stream["error"] = s.Error.Error()
+		}
+		streams = append(streams, stream)
+	}
+	return printJSON(map[string]interface{}{
+		"test_id":         result.TestID,
+		"success":         result.Success,
+		"total_bytes":     result.TotalBytes,
+		"total_chunks":    result.TotalChunks,
+		"duration_ms":     result.Duration.Milliseconds(),
+		"throughput_mbps": result.CalculateThroughput(),
+		"streams":         streams,
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/identity"
+)
+
+// backupPassphraseEnv 身份备份口令的环境变量，避免口令出现在命令行和 shell 历史中
+const backupPassphraseEnv = "ARO_BACKUP_PASSPHRASE"
+
+// cmdIdentity 输出克隆检测结果；identity rotate 轮换密钥，identity reregister 以新身份重新注册，
+// identity export/import 导出和恢复加密的身份备份
+// 正在运行的节点仍持有旧密钥，轮换后应在宽限期内重启；导入前应停止正在运行的节点
+func cmdIdentity(args []string) error {
+	fs := flag.NewFlagSet("identity", flag.ExitOnError)
+	fs.Parse(args)
+	client, err := newAPIClient()
+	if err != nil {
+		return err
+	}
+	keys, err := openKeyStore()
+	if err != nil {
+		return err
+	}
+	switch fs.Arg(0) {
+	case "":
+		return printJSON(identity.CheckClone(config.GetConfig()))
+	case "rotate":
+		res, err := identity.Rotate(context.Background(), client, keys)
+		if err != nil {
+			return err
+		}
+		return printJSON(res)
+	case "reregister":
+		resp, err := identity.Reregister(context.Background(), client, keys)
+		if err != nil {
+			return err
+		}
+		return printJSON(map[string]interface{}{
+			"client_id": client.ClientID,
+			"signup":    resp,
+		})
+	case "export":
+		return identityExport(fs.Args()[1:])
+	case "import":
+		return identityImport(client, keys, fs.Args()[1:])
+	default:
+		return fmt.Errorf("unknown identity command %q", fs.Arg(0))
+	}
+}
+
+// identityExport 把当前身份写入加密的备份文件
+func identityExport(args []string) error {
+	fs := flag.NewFlagSet("identity export", flag.ExitOnError)
+	out := fs.String("o", "aro-identity.pem", "backup file to write ('-' for stdout)")
+	fs.Parse(args)
+	keys, err := openKeyStore()
+	if err != nil {
+		return err
+	}
+	data, err := identity.Export(config.GetConfig(), keys, os.Getenv(backupPassphraseEnv))
+	if err != nil {
+		return fmt.Errorf("%w (the passphrase is read from %s)", err, backupPassphraseEnv)
+	}
+	if *out == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	path := userPath(*out)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "identity written to %s\n", path)
+	return nil
+}
+
+// identityImport 从加密的备份文件恢复身份
+func identityImport(client *api_client.APIClient, keys crypto.KeyStore, args []string) error {
+	fs := flag.NewFlagSet("identity import", flag.ExitOnError)
+	var opts identity.ImportOptions
+	fs.BoolVar(&opts.Overwrite, "overwrite", false, "replace the identity this device is already registered with")
+	fs.BoolVar(&opts.Force, "force", false, "import even if the backend cannot confirm the identity is unused elsewhere")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: aro-node identity import [-overwrite] [-force] FILE")
+	}
+	data, err := os.ReadFile(userPath(fs.Arg(0)))
+	if err != nil {
+		return err
+	}
+	info, err := identity.Import(context.Background(), client, keys, data, os.Getenv(backupPassphraseEnv), opts)
+	if err != nil {
+		return err
+	}
+	return printJSON(info)
+}
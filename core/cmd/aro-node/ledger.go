@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/datadir"
+	"aro-ext-app/core/internal/ledger"
+	"aro-ext-app/core/internal/storage"
+)
+
+// openStorage 打开当前环境身份目录中的本地存储，与正在运行的节点共用（存储支持多进程访问）
+func openStorage() (*storage.Storage, error) {
+	return storage.Open(filepath.Join(config.GetConfig().IdentityDir(datadir.Get()), storage.FileName))
+}
+
+// cmdLedger 输出本地账本的汇总；ledger reconcile 对比本地活动和后端积分
+// 账本由 run 记录，这里只读取
+func cmdLedger(args []string) error {
+	fs := flag.NewFlagSet("ledger", flag.ExitOnError)
+	by := fs.String("by", string(ledger.ByDay), "granularity: hour, day or total")
+	since := fs.Duration("since", 7*24*time.Hour, "how far back to look")
+	fs.Parse(args)
+	switch fs.Arg(0) {
+	case "":
+	case "reconcile":
+		return ledgerReconcile(fs.Args()[1:])
+	default:
+		return fmt.Errorf("unknown ledger command %q", fs.Arg(0))
+	}
+
+	store, err := openStorage()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	to := time.Now()
+	summaries, err := ledger.New(ledger.Options{Store: store}).Aggregate(to.Add(-*since), to, ledger.Granularity(*by))
+	if err != nil {
+		return err
+	}
+	if summaries == nil {
+		summaries = []ledger.Summary{}
+	}
+	return printJSON(summaries)
+}
+
+// ledgerReconcile 输出对账报告
+func ledgerReconcile(args []string) error {
+	fs := flag.NewFlagSet("ledger reconcile", flag.ExitOnError)
+	since := fs.Duration("since", 7*24*time.Hour, "how far back to look")
+	lag := fs.Int("lag", 1, "hours until the backend credits an hour's rewards")
+	minOnline := fs.Duration("min-online", ledger.DefaultMinOnline, "online time after which an hour should earn rewards")
+	fs.Parse(args)
+
+	store, err := openStorage()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	to := time.Now()
+	report, err := ledger.New(ledger.Options{Store: store}).Reconcile(to.Add(-*since), to, ledger.ReconcileOptions{
+		SettleLag: *lag,
+		MinOnline: *minOnline,
+	})
+	if err != nil {
+		return err
+	}
+	return printJSON(report)
+}
@@ -0,0 +1,207 @@
+// aro-node 无界面节点程序，在 Linux 服务器等没有 Flutter 外壳的环境中运行节点
+//
+// 与 libstudy 使用相同的 api_client、proxy_worker、crypto 包，
+// 子命令覆盖 libstudy 导出的全部能力，run 子命令以前台守护方式运行节点
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/datadir"
+)
+
+const usage = `Usage: aro-node [-dir DIR] [-profile NAME] [-api URL] <command> [args]
+
+Commands:
+  init                 load or create the node keypair and client ID
+  signup               register this node with the backend
+  stat                 show node statistics
+  rewards              show node rewards
+  ledger [-by hour|day|total] [-since DURATION]
+                       show what this node did (traffic, connections,
+                       bandwidth tests, online time) and the points it
+                       earned, as recorded locally by run
+  ledger reconcile [-since DURATION] [-lag HOURS] [-min-online DURATION]
+                       list hours where local activity and backend rewards
+                       disagree
+  sysinfo [report]     show the collected system info, or report it now
+  identity [rotate|reregister]
+                       show whether this identity was cloned from another
+                       device, rotate the node key, or register a new identity
+  identity export [-o FILE]
+  identity import [-overwrite] [-force] FILE
+                       back up or restore this node's identity; the backup is
+                       encrypted with the passphrase in ARO_BACKUP_PASSPHRASE
+  worker start|stop|restart|status
+                       run the proxy worker, or control the running one
+  nat                  detect the NAT type via STUN
+  speedtest            run a bandwidth test task
+  version [check]      show the current version, or check for updates
+  update check|download|status|rollback
+                       check for, download (installed on the next run) or
+                       roll back a self-update
+  update channel NAME|pin VERSION|unpin
+                       set the update channel (dev/testnet/mainnet/beta) or
+                       freeze this node on a version
+  run                  run the node in the foreground until SIGINT/SIGTERM,
+                       receiving scheduled tasks from the task stream
+                       (GRPC_URL)
+  status               show the status of the running node
+  logs [-n N]          show recent logs of the running node
+  reload               reload the config in the running node (it also picks up
+                       edits to config.env / config.yaml on its own); invalid
+                       edits are rejected and the previous config is kept
+
+The node private key (aro_rsa) is encrypted according to KEY_PROTECTION in
+config.env: with a machine secret file (default), with the passphrase in
+ARO_KEY_PASSPHRASE, or not at all. Plaintext keys from older versions are
+encrypted on first load.
+
+The backend environment is chosen by -profile or PROFILE in config.env:
+staging (default), testnet, mainnet or local (a mockbackend on
+127.0.0.1:18080). Each profile has its own API, WebSocket, update and proxy
+auth endpoints, and its own node identity: keys of profiles other than
+staging live in profiles/NAME in the data directory. -api overrides the
+profile's API URL.
+
+Keys, config.env and state files live in the data directory: -dir,
+ARO_DATA_DIR, or the platform default (~/.local/share/aro on Linux,
+~/Library/Application Support/ARO on macOS, %APPDATA%\ARO on Windows).
+Without -dir, a node identity left in the current directory by older versions
+is moved there on first run. Relative file arguments are resolved against the
+current directory.
+
+The running node is controlled through a Unix socket (aro-node.sock) in the
+data directory, authenticated by the owner-only token file aro-node.token.
+
+Run 'aro-node <command> -h' for command flags.
+`
+
+// globalOptions 所有子命令共享的参数
+type globalOptions struct {
+	dir     string
+	profile string
+	apiURL  string
+}
+
+var opts globalOptions
+
+// startDir 启动时的当前目录，命令行中的相对路径相对它解析（之后会切换到数据目录）
+var startDir string
+
+// userPath 把命令行参数中的相对路径解析为相对启动目录的路径，'-' 表示标准输入输出
+func userPath(p string) string {
+	if p == "" || p == "-" || filepath.IsAbs(p) || startDir == "" {
+		return p
+	}
+	return filepath.Join(startDir, p)
+}
+
+func main() {
+	flags := flag.NewFlagSet("aro-node", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flags.StringVar(&opts.dir, "dir", "", "data directory holding keys, config and state files (default: platform data dir, or ARO_DATA_DIR)")
+	flags.StringVar(&opts.profile, "profile", "", "backend environment: staging, testnet, mainnet or local (default: PROFILE in config.env)")
+	flags.StringVar(&opts.apiURL, "api", "", "backend API base URL (default: the profile's API URL)")
+	flags.Parse(os.Args[1:])
+
+	args := flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	// 密钥、config.env、控制套接字等都保存在数据目录（-dir 或平台默认目录）中，切换目录后重新加载配置
+	// 未指定 -dir 时把旧版本保存在当前目录的身份迁移到默认数据目录
+	startDir, _ = os.Getwd()
+	if opts.dir != "" {
+		datadir.Set(opts.dir)
+	}
+	dir := datadir.Get()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		fatalf("failed to create %s: %v", dir, err)
+	}
+	if opts.dir == "" && startDir != "" {
+		if _, err := datadir.Migrate(startDir, dir); err != nil {
+			fatalf("failed to move node files from %s to %s: %v", startDir, dir, err)
+		}
+	}
+	if err := os.Chdir(dir); err != nil {
+		fatalf("failed to enter %s: %v", dir, err)
+	}
+	// -profile 只对本次运行（和 run 启动的 worker 进程）生效，通过环境变量覆盖 config.env
+	if opts.profile != "" {
+		if _, ok := config.LookupProfile(opts.profile); !ok {
+			fatalf("unknown profile %q", opts.profile)
+		}
+		os.Setenv(config.KeyProfile, opts.profile)
+	}
+	config.GetConfig().Reload()
+
+	cmd, rest := args[0], args[1:]
+	var err error
+	switch cmd {
+	case "init":
+		err = cmdInit(rest)
+	case "signup":
+		err = cmdSignUp(rest)
+	case "stat":
+		err = cmdStat(rest)
+	case "rewards":
+		err = cmdRewards(rest)
+	case "ledger":
+		err = cmdLedger(rest)
+	case "sysinfo":
+		err = cmdSysInfo(rest)
+	case "identity":
+		err = cmdIdentity(rest)
+	case "worker":
+		err = cmdWorker(rest)
+	case "nat":
+		err = cmdNat(rest)
+	case "speedtest":
+		err = cmdSpeedtest(rest)
+	case "version":
+		err = cmdVersion(rest)
+	case "update":
+		err = cmdUpdate(rest)
+	case "run":
+		err = cmdRun(rest)
+	case "status":
+		err = cmdStatus(rest)
+	case "logs":
+		err = cmdLogs(rest)
+	case "reload":
+		err = cmdReload(rest)
+	case "help", "-h", "--help":
+		flags.Usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", cmd)
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fatalf("%s: %v", cmd, err)
+	}
+}
+
+// printJSON 以缩进 JSON 输出结果，便于脚本和人工阅读
+func printJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "aro-node: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/identity"
+	"aro-ext-app/core/internal/sysinfo"
+	"aro-ext-app/core/internal/updater"
+	"aro-ext-app/core/version"
+)
+
+// openKeyStore 按 KEY_PROTECTION 打开工作目录下的私钥存储，口令通过 ARO_KEY_PASSPHRASE 提供
+func openKeyStore() (crypto.KeyStore, error) {
+	return crypto.OpenKeyStore(config.GetConfig(), "")
+}
+
+// newAPIClient 加载或创建密钥对和客户端 ID，初始化 API 客户端（对应 InitLibstudy）
+func newAPIClient() (*api_client.APIClient, error) {
+	keys, err := openKeyStore()
+	if err != nil {
+		return nil, err
+	}
+	keyPair, err := crypto.LoadOrCreateKeyPair(keys, crypto.KeyTypeFromConfig(config.GetConfig()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keypair: %w", err)
+	}
+	clientID := crypto.GenerateClientID()
+	client := api_client.NewAPIClient(opts.apiURL, clientID, keyPair)
+	if err := identity.LoadPreviousKey(client, keys); err != nil {
+		log.Printf("%v", err)
+	}
+	return client, nil
+}
+
+func cmdInit(args []string) error {
+	flag.NewFlagSet("init", flag.ExitOnError).Parse(args)
+	client, err := newAPIClient()
+	if err != nil {
+		return err
+	}
+	publicKey, err := crypto.ExportPublicKeyToPEM(client.PublicKey)
+	if err != nil {
+		return err
+	}
+	return printJSON(map[string]interface{}{
+		"client_id":  client.ClientID,
+		"profile":    config.GetConfig().Profile().Name,
+		"api_url":    client.BaseURL,
+		"public_key": publicKey,
+	})
+}
+
+func cmdSignUp(args []string) error {
+	flag.NewFlagSet("signup", flag.ExitOnError).Parse(args)
+	client, err := newAPIClient()
+	if err != nil {
+		return err
+	}
+	keys, err := openKeyStore()
+	if err != nil {
+		return err
+	}
+	resp, err := identity.SignUp(context.Background(), client, keys)
+	if err != nil {
+		return err
+	}
+	return printJSON(resp)
+}
+
+func cmdStat(args []string) error {
+	flag.NewFlagSet("stat", flag.ExitOnError).Parse(args)
+	client, err := newAPIClient()
+	if err != nil {
+		return err
+	}
+	resp, err := client.GetNodeStat()
+	if err != nil {
+		return err
+	}
+	return printJSON(resp)
+}
+
+func cmdRewards(args []string) error {
+	flag.NewFlagSet("rewards", flag.ExitOnError).Parse(args)
+	client, err := newAPIClient()
+	if err != nil {
+		return err
+	}
+	resp, err := client.GetRewards()
+	if err != nil {
+		return err
+	}
+	return printJSON(resp)
+}
+
+// cmdSysInfo 输出采集到的系统信息；sysinfo report 立即上报
+func cmdSysInfo(args []string) error {
+	fs := flag.NewFlagSet("sysinfo", flag.ExitOnError)
+	fs.Parse(args)
+	client, err := newAPIClient()
+	if err != nil {
+		return err
+	}
+	if fs.Arg(0) != "report" {
+		return printJSON(map[string]interface{}{
+			"system": sysinfo.Collect(""),
+			"report": client.CollectBaseInfo(),
+		})
+	}
+	resp, err := client.ReportSystemInfo()
+	if err != nil {
+		return err
+	}
+	return printJSON(resp)
+}
+
+// cmdVersion 输出当前版本；version check 额外查询后端最新版本，并按更新策略（固定版本、最低版本、灰度）判断是否可以更新
+func cmdVersion(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	env := fs.String("env", "", "update channel to query (default: UPDATE_CHANNEL from config)")
+	fs.Parse(args)
+
+	current := map[string]string{
+		"version":    version.VERSION,
+		"build_time": version.BUILDTIME,
+		"git_commit": version.GITCOMMIT,
+		"git_branch": version.GITBRANCH,
+	}
+	if fs.Arg(0) != "check" {
+		return printJSON(current)
+	}
+
+	client, err := newAPIClient()
+	if err != nil {
+		return err
+	}
+	policy := updater.PolicyFromConfig(config.GetConfig(), client.ClientID, version.VERSION)
+	if *env != "" {
+		policy.Channel = *env
+	}
+	rel, err := updater.FetchRelease(context.Background(), client, policy.Channel)
+	if err != nil {
+		return err
+	}
+	decision := policy.Decide(rel)
+	return printJSON(map[string]interface{}{
+		"current":          current,
+		"latest":           rel,
+		"decision":         decision,
+		"update_available": decision.Update,
+	})
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package main
+
+import "syscall"
+
+const (
+	// processQueryLimitedInformation 只查询进程状态所需的最小权限
+	processQueryLimitedInformation = 0x1000
+	// stillActive GetExitCodeProcess 对仍在运行的进程返回的退出码
+	stillActive = 259
+)
+
+// processAlive 检查进程是否存在且仍在运行
+// Windows 不支持 signal 0，os.FindProcess 只要能打开进程句柄就成功（包括已退出但句柄未释放的进程），因此查询退出码
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// restartSelf 用磁盘上（已更新）的可执行文件替换当前进程，PID 不变
+func restartSelf(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(exe, append([]string{exe}, args...), os.Environ())
+}
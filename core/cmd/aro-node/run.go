@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/events"
+	"aro-ext-app/core/internal/heartbeat"
+	"aro-ext-app/core/internal/identity"
+	"aro-ext-app/core/internal/ledger"
+	"aro-ext-app/core/internal/proxy_worker"
+	"aro-ext-app/core/internal/storage"
+	"aro-ext-app/core/internal/taskstream"
+	"aro-ext-app/core/internal/updater"
+)
+
+// maxRestartDelay worker 连续崩溃时重启间隔的上限
+const maxRestartDelay = 5 * time.Minute
+
+// cmdRun 前台运行节点：安装已暂存的更新、注册、启动 worker 并在崩溃时自动重启、定时心跳和本地账本、
+// 系统信息变化时自动上报，配置文件修改后自动重新加载，通过本地控制接口接受 status/worker/reload 等命令，
+// 从任务流（GRPC_URL，为空时不连接）接收并执行 NAT 探测和带宽测试任务，
+// 收到 SIGINT/SIGTERM 后优雅退出，等待执行中的任务结束
+func cmdRun(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	workerConfigPath := fs.String("worker-config", "", "proxy worker config (JSON); when empty the worker can be started later through the control API")
+	heartbeatInterval := fs.Duration("heartbeat", 0, "interval between heartbeats (default: HEARTBEAT_INTERVAL from config, 3m)")
+	settings, _ := config.GetConfig().Settings()
+	restartDelay := fs.Duration("restart-delay", time.Duration(settings.Worker.RestartDelay)*time.Second, "initial delay before restarting a crashed worker (default: worker.restart_delay from config)")
+	baseInfo := fs.Duration("baseinfo", api_client.DefaultBaseInfoInterval, "interval between system info checks; changes are reported to the backend")
+	fs.Parse(args)
+	// 重启后的当前目录是数据目录，参数中的相对路径换成绝对路径
+	*workerConfigPath = userPath(*workerConfigPath)
+	args = flagArgs(fs)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := acquirePidFile(); err != nil {
+		return err
+	}
+	defer releasePidFile()
+	setupLogging()
+
+	// 安装上次下载的更新，或回滚未通过健康检查的版本，然后用新的可执行文件重启
+	u, err := newUpdater()
+	if err != nil {
+		log.Printf("Self-update disabled: %v", err)
+	} else if restart, err := applyUpdateOnStart(u); err != nil {
+		log.Printf("Failed to apply update: %v", err)
+	} else if restart {
+		log.Println("Restarting into the updated aro-node...")
+		return restartSelf(runArgs(args))
+	}
+
+	client, err := newAPIClient()
+	if err != nil {
+		return err
+	}
+	log.Printf("aro-node running, client ID: %s, API: %s", client.ClientID, client.BaseURL)
+
+	manager := proxy_worker.GetManager()
+	store, err := openStorage()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	// 上次运行保存的连接状态已经过时，心跳开始后按结果更新，退出时重置为 idle
+	store.UpdateConnectStatus(storage.StatusConnecting)
+	defer store.UpdateConnectStatus(storage.StatusIdle)
+	hb := heartbeat.New(heartbeat.Options{
+		Client:   client,
+		Worker:   manager,
+		Interval: *heartbeatInterval,
+		OnResult: func(err error) {
+			if ctx.Err() == nil {
+				store.UpdateConnectStatus(storage.ConnectStatusOf(err))
+			}
+		},
+	})
+	lg := ledger.New(ledger.Options{Store: store, Worker: manager, Events: events.GetBus(), Client: client})
+	if err := startControl(ctx, client.ClientID, hb); err != nil {
+		return err
+	}
+
+	keys, err := openKeyStore()
+	if err != nil {
+		return err
+	}
+	if _, err := identity.SignUp(ctx, client, keys); err != nil {
+		// 注册失败不退出，心跳成功即说明节点可用
+		log.Printf("Node sign up failed: %v", err)
+	}
+	if u != nil {
+		if err := checkUpdateHealth(ctx, u, client); errors.Is(err, updater.ErrRolledBack) {
+			st, _ := u.State()
+			events.Publish(events.OTARolledBack, events.OTAEvent{
+				CurrentVersion: st.PreviousVersion,
+				LatestVersion:  st.Version,
+				Error:          st.LastError,
+			})
+			log.Println("Restarting into the previous aro-node...")
+			return restartSelf(runArgs(args))
+		} else if err != nil {
+			log.Printf("Update health check failed: %v", err)
+		}
+
+		if staged, err := stageForcedUpdate(ctx, u, client); err != nil {
+			log.Printf("Forced update check failed: %v", err)
+		} else if staged {
+			log.Println("Restarting to install the forced update...")
+			return restartSelf(runArgs(args))
+		}
+	}
+
+	if *workerConfigPath != "" {
+		workerConfig, err := loadWorkerConfig(*workerConfigPath)
+		if err != nil {
+			return err
+		}
+		if err := manager.Start(*workerConfig); err != nil {
+			return err
+		}
+	}
+	// -restart-delay 显式设置时不随配置变化
+	var workerDelay atomic.Int64
+	workerDelay.Store(int64(*restartDelay))
+	restartDelayFixed := false
+	fs.Visit(func(f *flag.Flag) { restartDelayFixed = restartDelayFixed || f.Name == "restart-delay" })
+	cfg := config.GetConfig()
+	unsubscribe := cfg.Subscribe(func(ev config.ReloadEvent) {
+		if ev.Err != nil {
+			events.Publish(events.ConfigRejected, events.ConfigEvent{Error: ev.Err.Error()})
+			return
+		}
+		if ev.Changed(config.KeyAPIURL) {
+			client.SetBaseURL(ev.Settings.API.URL)
+		}
+		if ev.Changed(config.KeyGRPCURL) {
+			log.Println("GRPC_URL changed, restart aro-node to connect to the new task stream")
+		}
+		if ev.Changed(config.KeyHeartbeatInterval) && *heartbeatInterval == 0 {
+			hb.SetInterval(time.Duration(ev.Settings.API.HeartbeatInterval) * time.Second)
+		}
+		if ev.Changed(config.KeyRetryCount, config.KeyRetryInterval, config.KeyTimeout) {
+			client.Transport.SetPolicy(api_client.RetryPolicyFromConfig(cfg))
+		}
+		if ev.Changed(config.KeyWorkerRestartDelay) && !restartDelayFixed {
+			workerDelay.Store(int64(time.Duration(ev.Settings.Worker.RestartDelay) * time.Second))
+		}
+		keys := make([]string, len(ev.Changes))
+		for i, ch := range ev.Changes {
+			keys[i] = ch.Key
+		}
+		events.Publish(events.ConfigReloaded, events.ConfigEvent{Keys: keys})
+	})
+	defer unsubscribe()
+	go cfg.Watch(ctx, 0)
+
+	go superviseWorker(ctx, manager, func() time.Duration { return time.Duration(workerDelay.Load()) })
+	go hb.Run(ctx)
+	go lg.Run(ctx)
+	go client.WatchBaseInfo(ctx, *baseInfo)
+	tasksDone := make(chan struct{})
+	if addr := cfg.Profile().GRPCURL; addr != "" {
+		stream := taskstream.New(taskstream.Options{Address: addr, Client: client})
+		go func() {
+			stream.Run(ctx)
+			close(tasksDone)
+		}()
+	} else {
+		log.Println("GRPC_URL is not set, scheduled tasks are not received")
+		close(tasksDone)
+	}
+
+	<-ctx.Done()
+	log.Println("Shutting down aro-node...")
+	<-tasksDone
+	if manager.IsRunning() {
+		if err := manager.Stop(); err != nil {
+			log.Printf("Failed to stop proxy worker: %v", err)
+		}
+	}
+	return nil
+}
+
+// flagArgs 由解析后的 fs 重新生成命令行参数，只包含显式设置的参数
+func flagArgs(fs *flag.FlagSet) []string {
+	var args []string
+	fs.Visit(func(f *flag.Flag) {
+		args = append(args, "-"+f.Name+"="+f.Value.String())
+	})
+	return append(args, fs.Args()...)
+}
+
+// runArgs 重启自身时使用的参数，-dir 使用绝对路径（当前目录已切换到数据目录）
+func runArgs(args []string) []string {
+	dir, _ := os.Getwd()
+	global := []string{"-dir", dir, "-api", opts.apiURL}
+	if opts.profile != "" {
+		global = append(global, "-profile", opts.profile)
+	}
+	return append(append(global, "run"), args...)
+}
+
+// superviseWorker 监听 worker.crashed 事件并重启 worker，连续崩溃时从 initialDelay 开始指数退避
+// initialDelay 在每次隧道连接成功后重新读取，配置修改后从下一轮崩溃开始生效
+func superviseWorker(ctx context.Context, manager *proxy_worker.Manager, initialDelay func() time.Duration) {
+	ch, cancel := events.GetBus().Subscribe(16)
+	defer cancel()
+
+	delay := initialDelay()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-ch:
+			switch ev.Type {
+			case events.TunnelConnected:
+				delay = initialDelay()
+				continue
+			case events.WorkerCrashed:
+			default:
+				continue
+			}
+		}
+
+		log.Printf("Proxy worker crashed, restarting in %v", delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if err := manager.Restart(); err != nil {
+			log.Printf("Failed to restart proxy worker: %v", err)
+		}
+		delay *= 2
+		if delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+	}
+}
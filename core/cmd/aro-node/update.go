@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/errcode"
+	"aro-ext-app/core/internal/events"
+	"aro-ext-app/core/internal/updater"
+	"aro-ext-app/core/version"
+)
+
+// healthCheckTimeout 新版本首次健康检查的超时时间
+const healthCheckTimeout = time.Minute
+
+// newUpdater 创建更新 aro-node 自身可执行文件的更新器，状态保存在工作目录的 updates/ 下
+func newUpdater() (*updater.Updater, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return nil, err
+	}
+	key, err := updater.ParsePublicKey(version.RELEASE_PUBLIC_KEY)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := filepath.Abs("updates")
+	if err != nil {
+		return nil, err
+	}
+	return updater.New(updater.Options{
+		Dir:            dir,
+		Target:         exe,
+		CurrentVersion: version.VERSION,
+		PublicKey:      key,
+	})
+}
+
+// cmdUpdate 管理自更新：
+//   - check 按更新策略查询新版本，download 下载校验并暂存（下次 run 启动时替换）
+//   - status 查看更新状态，rollback 回滚试运行中的新版本
+//   - channel <name> 切换更新渠道，pin <version> / unpin 固定或取消固定版本
+func cmdUpdate(args []string) error {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	fs.Parse(args)
+
+	cfg := config.GetConfig()
+	switch fs.Arg(0) {
+	case "channel":
+		if err := updater.ValidateChannel(fs.Arg(1)); err != nil {
+			return err
+		}
+		if err := cfg.SetAndSave(config.KeyUpdateChannel, fs.Arg(1)); err != nil {
+			return err
+		}
+		return printJSON(updater.PolicyFromConfig(cfg, crypto.GenerateClientID(), version.VERSION))
+	case "pin", "unpin":
+		pin := fs.Arg(1)
+		if fs.Arg(0) == "unpin" {
+			pin = ""
+		} else if pin == "" {
+			return fmt.Errorf("usage: aro-node update pin <version>")
+		}
+		if err := cfg.SetAndSave(config.KeyUpdatePinVersion, pin); err != nil {
+			return err
+		}
+		return printJSON(updater.PolicyFromConfig(cfg, crypto.GenerateClientID(), version.VERSION))
+	}
+
+	u, err := newUpdater()
+	if err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "check", "download":
+		client, err := newAPIClient()
+		if err != nil {
+			return err
+		}
+		policy := updater.PolicyFromConfig(cfg, client.ClientID, version.VERSION)
+		rel, err := updater.FetchRelease(context.Background(), client, policy.Channel)
+		if err != nil {
+			return err
+		}
+		decision := policy.Decide(rel)
+		available := decision.Update && u.Available(rel)
+		if fs.Arg(0) == "check" || !available {
+			return printJSON(map[string]interface{}{
+				"current":          version.VERSION,
+				"policy":           policy,
+				"latest":           rel,
+				"decision":         decision,
+				"update_available": available,
+			})
+		}
+		log.Printf("Downloading aro-node %s (%s)...", rel.Version, decision.Reason)
+		if err := u.Stage(context.Background(), rel); err != nil {
+			return err
+		}
+		log.Printf("aro-node %s staged, it will be installed the next time 'aro-node run' starts", rel.Version)
+	case "status", "":
+	case "rollback":
+		if _, err := u.Rollback("requested by user"); err != nil && !errors.Is(err, updater.ErrRolledBack) {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown update command %q", fs.Arg(0))
+	}
+
+	st, err := u.State()
+	if err != nil {
+		return err
+	}
+	return printJSON(st)
+}
+
+// applyUpdateOnStart run 启动时调用：试运行超过次数则回滚，有暂存版本则替换，
+// 返回 true 表示磁盘上的可执行文件已变化，调用方应重启自身
+func applyUpdateOnStart(u *updater.Updater) (bool, error) {
+	st, err := u.Startup()
+	if errors.Is(err, updater.ErrRolledBack) {
+		events.Publish(events.OTARolledBack, events.OTAEvent{
+			CurrentVersion: st.PreviousVersion,
+			LatestVersion:  st.Version,
+			Error:          st.LastError,
+		})
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	applied, err := u.Apply()
+	if err != nil || !applied {
+		return false, err
+	}
+	st, _ = u.State()
+	events.Publish(events.OTAApplied, events.OTAEvent{
+		CurrentVersion: st.PreviousVersion,
+		LatestVersion:  st.Version,
+	})
+	return true, nil
+}
+
+// checkUpdateHealth 试运行中的新版本完成首次心跳后确认更新，心跳失败则回滚，
+// 后端不可达时无法判断，保持试运行到下次启动；后端拒绝节点凭证（包括节点尚未注册）
+// 说明新版本能正常访问后端，问题在身份而不在版本，视为健康
+func checkUpdateHealth(ctx context.Context, u *updater.Updater, client *api_client.APIClient) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	_, statErr := client.GetNodeStatContext(ctx)
+	switch errcode.Of(statErr) {
+	case errcode.BackendUnreachable:
+		log.Printf("Update health check inconclusive: %v", statErr)
+		return nil
+	case errcode.AuthFailed:
+		log.Printf("Update health check: the backend rejected the node credentials (%v), keeping the update", statErr)
+		statErr = nil
+	}
+	return u.HealthCheck(ctx, func(context.Context) error { return statErr })
+}
+
+// stageForcedUpdate 当前版本低于后端要求的最低支持版本时立即下载暂存新版本，
+// 返回 true 表示调用方应重启以安装
+func stageForcedUpdate(ctx context.Context, u *updater.Updater, client *api_client.APIClient) (bool, error) {
+	policy := updater.PolicyFromConfig(config.GetConfig(), client.ClientID, version.VERSION)
+	rel, err := updater.FetchRelease(ctx, client, policy.Channel)
+	if err != nil {
+		return false, err
+	}
+	decision := policy.Decide(rel)
+	if decision.Unsupported {
+		log.Printf("Warning: aro-node %s is below the minimum supported version %s (%s)", version.VERSION, rel.MinVersion, decision.Reason)
+	}
+	if !decision.Forced || !decision.Update || !u.Available(rel) {
+		return false, nil
+	}
+	log.Printf("Forced update to %s: %s", rel.Version, decision.Reason)
+	if err := u.Stage(ctx, rel); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/control"
+	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/events"
+	"aro-ext-app/core/internal/proxy_worker"
+)
+
+// pidFile 前台进程写在工作目录中的 pid 文件，用于防止重复启动，
+// 以及控制接口不可用时 worker stop 退回到发送信号
+const pidFile = "aro-node.pid"
+
+func cmdWorker(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: aro-node worker start|stop|restart|status")
+	}
+	switch args[0] {
+	case "start":
+		return cmdWorkerStart(args[1:])
+	case "stop":
+		return cmdWorkerStop(args[1:])
+	case "restart":
+		return cmdWorkerRestart(args[1:])
+	case "status":
+		return cmdWorkerStatus(args[1:])
+	default:
+		return fmt.Errorf("unknown worker command %q", args[0])
+	}
+}
+
+// cmdWorkerStart 在前台运行代理 worker，直到收到 SIGINT/SIGTERM 或 worker 被停止
+func cmdWorkerStart(args []string) error {
+	fs := flag.NewFlagSet("worker start", flag.ExitOnError)
+	configPath := fs.String("config", "", "proxy worker config (JSON, same shape as StartProxyWorker; default: worker.json in the data dir)")
+	fs.Parse(args)
+
+	path := "worker.json"
+	if *configPath != "" {
+		path = userPath(*configPath)
+	}
+	workerConfig, err := loadWorkerConfig(path)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := acquirePidFile(); err != nil {
+		return err
+	}
+	defer releasePidFile()
+	setupLogging()
+
+	if err := startControl(ctx, crypto.GenerateClientID(), nil); err != nil {
+		return err
+	}
+
+	// 先订阅再启动，避免漏掉 worker.stopped
+	ch, cancel := events.GetBus().Subscribe(16)
+	defer cancel()
+
+	manager := proxy_worker.GetManager()
+	if err := manager.Start(*workerConfig); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Shutting down proxy worker...")
+			return manager.Stop()
+		case ev := <-ch:
+			// 通过控制接口停止 worker 后进程随之退出（restart 不会导致退出）
+			if ev.Type == events.WorkerStopped && !manager.IsRunning() {
+				time.Sleep(2 * time.Second)
+				if !manager.IsRunning() {
+					log.Println("Proxy worker stopped, exiting")
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// cmdWorkerStop 通过控制接口停止 worker；控制接口不可用时向前台进程发送 SIGTERM
+func cmdWorkerStop(args []string) error {
+	fs := flag.NewFlagSet("worker stop", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 10*time.Second, "how long to wait before killing the process")
+	fs.Parse(args)
+
+	err := callControl(http.MethodPost, "/worker/stop", nil, nil)
+	if err == nil {
+		return printJSON(map[string]bool{"stopped": true})
+	}
+	if !errors.Is(err, control.ErrUnavailable) {
+		return err
+	}
+	log.Printf("%v, signalling the process instead", err)
+
+	pid, err := readPidFile()
+	if err != nil {
+		return err
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	if err := proc.Signal(syscall.SIGTERM); err != nil {
+		// Windows 不支持 SIGTERM，直接结束进程
+		if err := proc.Kill(); err != nil {
+			return fmt.Errorf("failed to stop process %d: %w", pid, err)
+		}
+	}
+
+	deadline := time.Now().Add(*timeout)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			log.Printf("Process %d did not exit in %v, killing", pid, *timeout)
+			proc.Kill()
+			releasePidFile()
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return printJSON(map[string]interface{}{"pid": pid, "stopped": true})
+}
+
+// cmdWorkerRestart 通过控制接口重启 worker
+func cmdWorkerRestart(args []string) error {
+	flag.NewFlagSet("worker restart", flag.ExitOnError).Parse(args)
+	var status proxy_worker.WorkerStatus
+	if err := callControl(http.MethodPost, "/worker/restart", nil, &status); err != nil {
+		return err
+	}
+	return printJSON(status)
+}
+
+// cmdWorkerStatus 输出正在运行的节点中的 worker 状态
+func cmdWorkerStatus(args []string) error {
+	flag.NewFlagSet("worker status", flag.ExitOnError).Parse(args)
+
+	var status control.Status
+	err := callControl(http.MethodGet, "/status", nil, &status)
+	if errors.Is(err, control.ErrUnavailable) {
+		return printJSON(proxy_worker.WorkerStatus{})
+	}
+	if err != nil {
+		return err
+	}
+	return printJSON(status.Worker)
+}
+
+func loadWorkerConfig(path string) (*proxy_worker.ProxyWorkerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read worker config: %w", err)
+	}
+	var workerConfig proxy_worker.ProxyWorkerConfig
+	if err := json.Unmarshal(data, &workerConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse worker config: %w", err)
+	}
+	workerConfig.ApplyProfile(config.GetConfig().Profile().ProxyAuthURL)
+	return &workerConfig, nil
+}
+
+// acquirePidFile 写入 pid 文件，已有存活的 aro-node 进程时返回错误
+func acquirePidFile() error {
+	if pid, err := readPidFile(); err == nil && pid != os.Getpid() && processAlive(pid) {
+		return fmt.Errorf("aro-node is already running (pid %d)", pid)
+	}
+	return os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0644)
+}
+
+func releasePidFile() {
+	os.Remove(pidFile)
+}
+
+func readPidFile() (int, error) {
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, fmt.Errorf("aro-node is not running")
+		}
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid pid file: %w", err)
+	}
+	return pid, nil
+}
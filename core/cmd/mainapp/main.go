@@ -2,7 +2,7 @@ package main
 
 import (
 	"aro-ext-app/core/internal/api_client"
-	"aro-ext-app/core/internal/constant"
+	"aro-ext-app/core/internal/config"
 	"aro-ext-app/core/internal/crypto"
 	"aro-ext-app/core/internal/storage"
 	"log"
@@ -14,8 +14,8 @@ var (
 	apiClient  *api_client.APIClient
 	keyPair    *crypto.KeyPair
 	clientID   string
-	baseAPIURL = constant.HTTP_SERVER_ENDPOINT
-	baseWSURL  = constant.WS_SERVER_ENDPOINT
+	baseAPIURL = config.GetConfig().Get(config.KeyAPIURL)
+	baseWSURL  = config.GetConfig().Get(config.KeyWSURL)
 	storageApi *storage.Storage
 )
 
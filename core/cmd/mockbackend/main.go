@@ -0,0 +1,59 @@
+// mockbackend 独立运行的 ARO 模拟后端，供 aro-node、Flutter 外壳等在不访问真实后端的情况下联调
+//
+// 用法：mockbackend [-listen 127.0.0.1:18080] [-script script.json] [-max-skew 5m] [-require-v2] [-key-types ed25519,ecdsa-p256,rsa]
+//
+// 启动后把客户端的 API 地址指向打印的 URL（aro-node -api URL，InitLibstudy 的 BaseAPIURL），
+// 通过 /__mock/ 管理接口注入故障、绑定节点、查看请求记录（见 internal/mockbackend）
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"aro-ext-app/core/internal/mockbackend"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:18080", "address to listen on")
+	script := flag.String("script", "", "JSON file with releases, rewards, proxy users and faults to load at start")
+	maxSkew := flag.Duration("max-skew", mockbackend.DefaultMaxSkew, "maximum accepted signature timestamp skew (0 disables the check)")
+	requireV2 := flag.Bool("require-v2", false, "reject v1 tokens that do not sign the method, path, body and nonce")
+	keyTypes := flag.String("key-types", "", "comma-separated node key types to accept (default ed25519,ecdsa-p256,rsa)")
+	flag.Parse()
+
+	backend := mockbackend.New()
+	backend.MaxSkew = *maxSkew
+	backend.RequireV2 = *requireV2
+	if *keyTypes != "" {
+		backend.KeyTypes = strings.Split(*keyTypes, ",")
+	}
+	if *script != "" {
+		if err := backend.LoadFile(*script); err != nil {
+			log.Fatalf("Failed to load script %s: %v", *script, err)
+		}
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", *listen, err)
+	}
+	log.Printf("Mock ARO backend listening on http://%s", ln.Addr())
+	log.Printf("Proxy auth endpoint: http://%s%s", ln.Addr(), mockbackend.ProxyAuthPath)
+
+	server := &http.Server{Handler: backend}
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		server.Close()
+	}()
+	if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
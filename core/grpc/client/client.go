@@ -3,6 +3,7 @@ package client
 import (
 	probev1 "aro-ext-app/core/grpc/gen/grpc/message"
 	"aro-ext-app/core/internal/auth"
+	"aro-ext-app/core/internal/events"
 	"aro-ext-app/core/internal/speedtest"
 	"aro-ext-app/core/internal/workland"
 	"context"
@@ -110,23 +111,34 @@ func (c *Client) Chat(ctx context.Context, udpNatProbe *workland.UDPNatProbe) {
 					time.Sleep(time.Second * 10)
 					continue
 				}
+				events.Publish(events.TaskReceived, events.TaskEvent{Kind: "nat_probe", TaskID: natProbeTask.TaskId})
+				completeNatProbe := func(err error) {
+					ev := events.TaskEvent{Kind: "nat_probe", TaskID: natProbeTask.TaskId, Success: err == nil}
+					if err != nil {
+						ev.Error = err.Error()
+					}
+					events.Publish(events.TaskCompleted, ev)
+				}
 
 				err, payload := udpNatProbe.SendProbe(fmt.Sprintf("%s:%d", natProbeTask.CheckerIp, natProbeTask.CheckerPort), natProbeTask.TaskId, 0, natProbeTask.SubTaskId, token)
 				log.Printf("Chat 0 Send probe: %+v", payload)
 				if err != nil {
 					log.Printf("Chat 0 Failed to send probe: %+v", err)
+					completeNatProbe(err)
 					continue
 				}
 				err, payload = udpNatProbe.SendProbe(fmt.Sprintf("%s:%d", payload.CheckerIp, payload.CheckerPort), payload.TaskId, payload.Stage, payload.SubTaskId, token)
 				log.Printf("Chat 1 Send probe: %+v", payload)
 				if err != nil {
 					log.Printf("Chat 1 Failed to ack send probe:%+v", err)
+					completeNatProbe(err)
 					continue
 				}
 				err, payload = udpNatProbe.SendProbe(fmt.Sprintf("%s:%d", payload.CheckerIp, payload.CheckerPort), payload.TaskId, payload.Stage, payload.SubTaskId, token)
 				log.Printf("Chat 2 Send probe: %+v", payload)
 				if err != nil {
 					log.Printf("Chat 2 Failed to ack send probe: %+v", err)
+					completeNatProbe(err)
 					continue
 				}
 				err, payload = udpNatProbe.SendProbe(fmt.Sprintf("%s:%d", payload.CheckerIp, payload.CheckerPort), payload.TaskId, payload.Stage, payload.SubTaskId, token)
@@ -134,6 +146,7 @@ func (c *Client) Chat(ctx context.Context, udpNatProbe *workland.UDPNatProbe) {
 				if err != nil {
 					log.Printf("Chat 3 Failed to ack send probe: %+v", err)
 				}
+				completeNatProbe(err)
 
 			}
 
@@ -0,0 +1,161 @@
+package api_client
+
+import (
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/errcode"
+	"aro-ext-app/core/internal/sysinfo"
+	"aro-ext-app/core/version"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"runtime"
+	"time"
+)
+
+// DefaultBaseInfoInterval is how often WatchBaseInfo re-collects the system fingerprint
+const DefaultBaseInfoInterval = time.Hour
+
+// BaseInfoFromSystem maps a collected system fingerprint onto the reportBaseInfo request body
+func BaseInfoFromSystem(info sysinfo.Info, nodeID string) NodeReportBaseInfoRequest {
+	platform := info.OS
+	if platform == "darwin" {
+		platform = "macos"
+	}
+	return NodeReportBaseInfoRequest{
+		UserAgent:      fmt.Sprintf("aro-core/%s (%s %s; %s)", version.VERSION, platform, info.OSVersion, info.Arch),
+		Language:       info.Language(),
+		IsMobile:       info.OS == "android" || info.OS == "ios",
+		SysPlatform:    platform,
+		SysCPU:         info.CPUCores,
+		TimeZone:       info.TimeZoneOffset,
+		NodeID:         nodeID,
+		OSName:         info.OSName,
+		OSVersion:      info.OSVersion,
+		Arch:           info.Arch,
+		CPUModel:       info.CPUModel,
+		MemoryTotal:    info.MemoryTotal,
+		DiskTotal:      info.DiskTotal,
+		DiskFree:       info.DiskFree,
+		TimeZoneName:   info.TimeZone,
+		Locale:         info.Locale,
+		NetworkTypes:   info.NetworkTypes(),
+		Container:      info.Container,
+		Virtualization: info.Virtualization,
+		CoreVersion:    version.VERSION,
+	}
+}
+
+// SetBaseInfoOverrides stores caller-supplied fields that replace the collected values in every
+// later report. overrides is a JSON object using the NodeReportBaseInfoRequest keys; only the
+// keys present are overridden, and an empty value clears previous overrides
+func (c *APIClient) SetBaseInfoOverrides(overrides json.RawMessage) error {
+	if len(overrides) > 0 {
+		var probe NodeReportBaseInfoRequest
+		if err := json.Unmarshal(overrides, &probe); err != nil {
+			return errcode.Errorf(errcode.InvalidParams, "invalid base info overrides: %w", err)
+		}
+	}
+	c.baseInfoMu.Lock()
+	defer c.baseInfoMu.Unlock()
+	c.baseInfoOverrides = append(json.RawMessage(nil), overrides...)
+	c.baseInfoGen++
+	return nil
+}
+
+// CollectBaseInfo collects the system fingerprint and applies the caller overrides
+func (c *APIClient) CollectBaseInfo() NodeReportBaseInfoRequest {
+	c.baseInfoMu.Lock()
+	defer c.baseInfoMu.Unlock()
+	return c.collectBaseInfo()
+}
+
+// collectBaseInfo must be called with baseInfoMu held
+func (c *APIClient) collectBaseInfo() NodeReportBaseInfoRequest {
+	req := BaseInfoFromSystem(sysinfo.Collect(c.DataDir), c.ID())
+	if len(c.baseInfoOverrides) > 0 {
+		// Unmarshalling onto the collected struct only replaces the keys present in the overrides
+		json.Unmarshal(c.baseInfoOverrides, &req)
+	}
+	return req
+}
+
+// baseInfoHash fingerprints a report, ignoring fields that change on every collection
+func baseInfoHash(req NodeReportBaseInfoRequest) string {
+	req.DiskFree = 0
+	return sysinfo.Fingerprint(req)
+}
+
+// ReportSystemInfo Collect the system fingerprint and report it unconditionally
+// Endpoint: POST /api/liteNode/node/reportBaseInfo
+func (c *APIClient) ReportSystemInfo() (*APIResponseWith[ReportBaseInfoData], error) {
+	return c.ReportSystemInfoContext(context.Background())
+}
+
+// ReportSystemInfoContext is ReportSystemInfo with a context
+func (c *APIClient) ReportSystemInfoContext(ctx context.Context) (*APIResponseWith[ReportBaseInfoData], error) {
+	resp, _, err := c.reportSystemInfo(ctx, false)
+	return resp, err
+}
+
+// ReportBaseInfoIfChanged reports the system fingerprint when it differs from the last
+// successful report; it returns whether a report was sent
+func (c *APIClient) ReportBaseInfoIfChanged(ctx context.Context) (bool, error) {
+	_, sent, err := c.reportSystemInfo(ctx, true)
+	return sent, err
+}
+
+// reportSystemInfo collects and sends a report without holding baseInfoMu during the request.
+// When SetBaseInfoOverrides ran while the report was in flight, the report may have landed after
+// one that includes the new overrides, so it is collected and sent again to make the latest
+// overrides land last
+func (c *APIClient) reportSystemInfo(ctx context.Context, onlyIfChanged bool) (*APIResponseWith[ReportBaseInfoData], bool, error) {
+	for {
+		c.baseInfoMu.Lock()
+		req := c.collectBaseInfo()
+		gen := c.baseInfoGen
+		c.baseInfoMu.Unlock()
+
+		hash := baseInfoHash(req)
+		if onlyIfChanged && hash == c.Config.Get(config.KeyBaseInfoHash) {
+			return nil, false, nil
+		}
+		resp, err := c.NodeReportBaseInfoContext(ctx, req)
+		if err != nil {
+			return resp, false, err
+		}
+		c.baseInfoMu.Lock()
+		stale := gen != c.baseInfoGen
+		c.baseInfoMu.Unlock()
+		if stale {
+			continue
+		}
+		if err := c.Config.SetAndSave(config.KeyBaseInfoHash, hash); err != nil {
+			log.Printf("Failed to save base info hash: %v", err)
+		}
+		return resp, true, nil
+	}
+}
+
+// WatchBaseInfo reports the system fingerprint now and then every interval whenever it
+// changed, until ctx is done. Intended to run in its own goroutine after sign-up
+func (c *APIClient) WatchBaseInfo(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultBaseInfoInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if sent, err := c.ReportBaseInfoIfChanged(ctx); err != nil {
+			log.Printf("Base info report failed: %v", err)
+		} else if sent {
+			log.Printf("Base info reported (%s/%s)", runtime.GOOS, runtime.GOARCH)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package api_client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/events"
+	"aro-ext-app/core/internal/sysinfo"
+)
+
+func TestBaseInfoFromSystem(t *testing.T) {
+	info := sysinfo.Info{OS: "darwin", OSVersion: "14.2", Arch: "arm64", CPUCores: 10, Locale: "en-US", TimeZoneOffset: "+08:00",
+		Interfaces: []sysinfo.Interface{{Name: "en0", Type: sysinfo.InterfaceWiFi, Up: true}}}
+	req := BaseInfoFromSystem(info, "client-1")
+	if req.SysPlatform != "macos" || req.SysCPU != 10 || req.Language != "en" || req.TimeZone != "+08:00" || req.NodeID != "client-1" {
+		t.Errorf("unexpected request %+v", req)
+	}
+	if req.IsMobile || len(req.NetworkTypes) != 1 || req.NetworkTypes[0] != sysinfo.InterfaceWiFi {
+		t.Errorf("unexpected request %+v", req)
+	}
+}
+
+func TestReportBaseInfoIfChanged(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		reported []NodeReportBaseInfoRequest
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req NodeReportBaseInfoRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		reported = append(reported, req)
+		mu.Unlock()
+		w.Write([]byte(`{"code":200,"message":"ok","data":null}`))
+	}))
+	defer srv.Close()
+
+	keyPair, err := crypto.GenerateRSAKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	c := NewAPIClient(srv.URL, "client-1", keyPair)
+	c.Config = config.New(dir)
+	c.Events = events.NewBus(16)
+	c.Transport = NewTransport(RetryPolicy{})
+	c.HttpClient = c.Transport.Client
+	c.DataDir = dir
+
+	ctx := context.Background()
+	if sent, err := c.ReportBaseInfoIfChanged(ctx); err != nil || !sent {
+		t.Fatalf("expected first report to be sent, got %v %v", sent, err)
+	}
+	if sent, err := c.ReportBaseInfoIfChanged(ctx); err != nil || sent {
+		t.Fatalf("expected unchanged info to be skipped, got %v %v", sent, err)
+	}
+
+	if err := c.SetBaseInfoOverrides(json.RawMessage(`{"sysCpu":"many"}`)); err == nil {
+		t.Error("expected invalid overrides to be rejected")
+	}
+	if err := c.SetBaseInfoOverrides(json.RawMessage(`{"sysCpu":64,"language":"xx"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if sent, err := c.ReportBaseInfoIfChanged(ctx); err != nil || !sent {
+		t.Fatalf("expected overridden info to be reported, got %v %v", sent, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reported) != 2 {
+		t.Fatalf("expected 2 reports, got %d", len(reported))
+	}
+	last := reported[1]
+	if last.SysCPU != 64 || last.Language != "xx" || last.Arch == "" || last.CoreVersion == "" {
+		t.Errorf("expected overrides on top of collected info, got %+v", last)
+	}
+}
+
+func TestReportResentWhenOverridesChangeInFlight(t *testing.T) {
+	var (
+		c        *APIClient
+		reported []NodeReportBaseInfoRequest
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req NodeReportBaseInfoRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		reported = append(reported, req)
+		// The overrides change while the first report is in flight
+		if len(reported) == 1 {
+			if err := c.SetBaseInfoOverrides(json.RawMessage(`{"language":"xx"}`)); err != nil {
+				t.Error(err)
+			}
+		}
+		w.Write([]byte(`{"code":200,"message":"ok","data":null}`))
+	}))
+	defer srv.Close()
+
+	keyPair, err := crypto.GenerateRSAKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	c = NewAPIClient(srv.URL, "client-1", keyPair)
+	c.Config = config.New(dir)
+	c.Events = events.NewBus(16)
+	c.Transport = NewTransport(RetryPolicy{})
+	c.HttpClient = c.Transport.Client
+	c.DataDir = dir
+
+	if _, err := c.ReportSystemInfo(); err != nil {
+		t.Fatal(err)
+	}
+	if len(reported) != 2 || reported[1].Language != "xx" {
+		t.Fatalf("expected the report to be sent again with the new overrides, got %+v", reported)
+	}
+	if c.Config.Get(config.KeyBaseInfoHash) != baseInfoHash(c.CollectBaseInfo()) {
+		t.Error("expected the hash of the last report to be saved")
+	}
+}
@@ -1,20 +1,21 @@
 package api_client
 
 import (
+	"aro-ext-app/core/internal/clock"
 	"aro-ext-app/core/internal/config"
 	"aro-ext-app/core/internal/constant"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	base64 "encoding/base64"
-	"encoding/json"
 	"encoding/pem"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"runtime"
+	"time"
 )
 
 type DeviceType string
@@ -33,9 +34,6 @@ type BackendService struct {
 	authToken    string
 }
 
-// Package-level singleton instance (可选，用于直接调用)
-var defaultBackendService *BackendService
-
 func PublicEncrypt(publicKeyBase64 string, message string) (string, error) {
 	// decode the base64 encoded public key
 	publicKeyBytes, err := base64.StdEncoding.DecodeString(publicKeyBase64)
@@ -67,36 +65,69 @@ func PublicEncrypt(publicKeyBase64 string, message string) (string, error) {
 	return encryptedStr, nil
 }
 
-func getAuthToken(deviceType string, serialNumber string) (string, error) {
+func getAuthToken(publicKey string, deviceType string, serialNumber string) (string, error) {
 	msg := fmt.Sprintf("enreach:%s:%s", deviceType, serialNumber)
-	return PublicEncrypt(constant.BACKEND_ENCODE_PUBLIC_KEY, msg)
+	return PublicEncrypt(publicKey, msg)
+}
+
+// GenerateBearerToken returns the backend bearer token for the serial number in cfg,
+// encrypted with the backend public key of cfg's profile
+func GenerateBearerToken(cfg *config.Config) (string, error) {
+	serialNumber := cfg.Get(config.KeySN)
+	if serialNumber == "" {
+		return "", fmt.Errorf("serial number is not set")
+	}
+	return getAuthToken(cfg.Profile().BackendPublicKey, runtime.GOOS, serialNumber)
 }
 
+// NewBackendService creates the backend service of the process-wide config's profile
 func NewBackendService(deviceType string, serialNumber string) *BackendService {
-	authToken, _ := getAuthToken(deviceType, serialNumber)
+	return newBackendService(config.GetConfig().Profile().BackendPublicKey, deviceType, serialNumber)
+}
+
+func newBackendService(publicKey string, deviceType string, serialNumber string) *BackendService {
+	authToken, _ := getAuthToken(publicKey, deviceType, serialNumber)
 	log.Println(authToken)
-	bs := &BackendService{
+	return &BackendService{
 		SerialNumber: serialNumber,
 		DeviceType:   deviceType,
 		authToken:    authToken,
 	}
-	// Set as default instance for direct calls
-	defaultBackendService = bs
-	return bs
 }
 
-// 接收者方法版本（用于面向对象调用）
-func GetLastVersion(program constant.OtaProgram, env string) (*APIResponse, error) {
+// GetLastVersion queries the latest release with the process-wide config and clock;
+// a node uses its client's GetLastVersion
+func GetLastVersion(program constant.OtaProgram, env string) (*APIResponseWith[LastVersionData], error) {
+	cfg := config.GetConfig()
+	return getLastVersion(context.Background(), NewTransport(RetryPolicyFromConfig(cfg)), cfg.Profile(), cfg.Get(config.KeySN), clock.GetClock(), program, env)
+}
+
+// GetLastVersion queries the latest release using this client's serial number
+func (c *APIClient) GetLastVersion(program constant.OtaProgram, env string) (*APIResponseWith[LastVersionData], error) {
+	return c.GetLastVersionContext(context.Background(), program, env)
+}
+
+// GetLastVersionContext is GetLastVersion with a context; the request goes to the
+// update URL of the client's profile, or to the client's API URL when it has none
+func (c *APIClient) GetLastVersionContext(ctx context.Context, program constant.OtaProgram, env string) (*APIResponseWith[LastVersionData], error) {
+	profile := c.Config.Profile()
+	if c.Config.Get(config.KeyUpdateURL) == "" {
+		profile.OTAURL = c.URL()
+	}
+	return getLastVersion(ctx, c.transport(), profile, c.Config.Get(config.KeySN), c.clock(), program, env)
+}
+
+func getLastVersion(ctx context.Context, t *Transport, profile config.Profile, sn string, clk *clock.Clock, program constant.OtaProgram, env string) (*APIResponseWith[LastVersionData], error) {
 	isa := 0
 	if runtime.GOARCH == "arm64" {
 		isa = 1
 	}
 
 	path := fmt.Sprintf("/api/keeper/ota/%s/%s/%d/%s/lastest", program, env, isa, runtime.GOOS)
-	log.Println(cfg.Get(config.KeySN))
-	backendService := NewBackendService(runtime.GOOS, cfg.Get(config.KeySN))
+	log.Println(sn)
+	backendService := newBackendService(profile.BackendPublicKey, runtime.GOOS, sn)
 	log.Printf("GetLastVersion params: program=%s, env=%s, isa=%d, os=%s, path=%s", program, env, isa, runtime.GOOS, path)
-	apiResponse, err := backendService.get(path)
+	apiResponse, err := backendService.get(ctx, t, profile.OTAURL, path, clk)
 	if err != nil {
 		return nil, err
 	}
@@ -105,39 +136,28 @@ func GetLastVersion(program constant.OtaProgram, env string) (*APIResponse, erro
 }
 
 // 辅助函数：从指定 URL 获取版本信息
-// 内部实现细节
-func (b *BackendService) get(path string) (*APIResponse, error) {
-	url := fmt.Sprintf("%s%s", constant.HTTP_SERVER_ENDPOINT, path)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
-	}
-
-	// Add auth header
-	req.Header.Set("Authorization", "Bearer "+b.authToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// 内部实现细节，请求经过 t（重试、退避、熔断），响应的 Date 头用于校正 clk
+func (b *BackendService) get(ctx context.Context, t *Transport, baseURL string, path string, clk *clock.Clock) (*APIResponseWith[LastVersionData], error) {
+	url := fmt.Sprintf("%s%s", baseURL, path)
+
+	var sent time.Time
+	resp, err := t.Do(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+		// Add auth header
+		req.Header.Set("Authorization", "Bearer "+b.authToken)
+		sent = time.Now()
+		return req, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %v", err)
-	}
-	defer resp.Body.Close()
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %v", err)
+		return nil, err
 	}
+	clk.ObserveDate(resp.Header.Get("Date"), sent, time.Now())
 
 	// 打印原始响应体，用于调试
-	log.Printf("Raw response body: %s", string(respBody))
+	log.Printf("Raw response body: %s", string(resp.Body))
 
-	var apiResp APIResponse
-	if err := json.Unmarshal(respBody, &apiResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response (HTTP %d): %w", resp.StatusCode, err)
-	}
-
-	if apiResp.Code != 0 && apiResp.Code != 200 {
-		return &apiResp, fmt.Errorf("API error: code=%d, message=%s", apiResp.Code, apiResp.Message)
-	}
-	return &apiResp, nil
+	return decodeTyped[LastVersionData](nil, path, resp.Body, resp.StatusCode)
 }
@@ -1,15 +1,20 @@
 package api_client
 
 import (
-	"aro-ext-app/core/internal/constant"
+	"aro-ext-app/core/internal/clock"
+	"aro-ext-app/core/internal/config"
 	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/errcode"
+	"aro-ext-app/core/internal/events"
 	"bytes"
-	"crypto/rsa"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"aro-ext-app/core/internal/auth"
@@ -17,124 +22,349 @@ import (
 
 // APIClient API client with authentication information
 type APIClient struct {
-	BaseURL    string
+	// BaseURL is the backend address; use URL and SetBaseURL once the client is in use
+	BaseURL string
+	// HttpClient is the underlying client of Transport
 	HttpClient *http.Client
+	// ClientID identifies the node; use ID and SetIdentity once the client is in use
 	ClientID   string
-	PrivateKey *rsa.PrivateKey
-	PublicKey  *rsa.PublicKey
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+	// Config stores the serial number and bound user returned by the backend
+	Config *config.Config
+	// Events receives auth.failed and clock.skewed events
+	Events *events.Bus
+	// Clock corrects signature timestamps by the offset observed in backend responses
+	Clock *clock.Clock
+	// Transport retries, backs off and circuit-breaks every request
+	Transport *Transport
+	// DataDir is the directory whose disk usage is reported in the base info;
+	// empty uses the working directory
+	DataDir string
+
+	baseInfoMu        sync.Mutex
+	baseInfoOverrides json.RawMessage
+	// baseInfoGen counts SetBaseInfoOverrides calls, telling a report whether the overrides
+	// changed while it was in flight
+	baseInfoGen uint64
+
+	// urlMu guards BaseURL after construction
+	urlMu sync.RWMutex
+
+	// authV2 is set once the backend confirmed auth scheme v2; requests then stop
+	// carrying the replayable v1 signature
+	authV2 atomic.Bool
+
+	// keyMu guards ClientID, PrivateKey, PublicKey and the previous key after construction
+	keyMu         sync.RWMutex
+	previousKey   crypto.PrivateKey
+	previousUntil time.Time
 }
 
 // String implements Stringer interface for safe logging
 func (c *APIClient) String() string {
-	keyBitSize := 0
-	if c.PrivateKey != nil && c.PrivateKey.N != nil {
-		keyBitSize = c.PrivateKey.N.BitLen()
+	var keyType crypto.KeyType
+	if key, _ := c.keys(); key != nil {
+		keyType = crypto.KeyTypeOf(key)
 	}
-	return fmt.Sprintf("APIClient{BaseURL: %s, ClientID: %s, KeySize: %d bits}",
-		c.BaseURL, c.ClientID, keyBitSize)
+	return fmt.Sprintf("APIClient{BaseURL: %s, ClientID: %s, KeyType: %s}",
+		c.URL(), c.ID(), keyType)
+}
+
+// URL returns the backend base URL
+func (c *APIClient) URL() string {
+	c.urlMu.RLock()
+	defer c.urlMu.RUnlock()
+	return c.BaseURL
+}
+
+// SetBaseURL points the client at another backend; requests already in flight
+// keep the previous address
+func (c *APIClient) SetBaseURL(baseURL string) {
+	c.urlMu.Lock()
+	defer c.urlMu.Unlock()
+	c.BaseURL = baseURL
 }
 
 // NewAPIClient creates an API client instance
 // Parameters:
-// - baseURL: API service base URL (e.g., https://testnet-api.aro.network)
+// - baseURL: API service base URL (e.g., https://testnet-api.aro.network), empty for the API URL of the configured profile
 // - clientID: Node ID (client unique identifier)
-// - privateKey: RSA private key (for signature authentication)
+// - keyPair: Node key pair (RSA, Ed25519 or ECDSA P-256, for signature authentication)
 //
 // Note: This client will be dynamically loaded via dlopen by libstudy
-// All requests automatically add RSA signature authentication headers
+// All requests automatically add signature authentication headers
+// The client uses the process-wide config and event bus; a Node running next to
+// other nodes replaces Config and Events with its own instances.
+// Each client gets its own Transport, configured from the process-wide config
 func NewAPIClient(baseURL string, clientID string, keyPair *crypto.KeyPair) *APIClient {
 	if baseURL == "" {
-		baseURL = constant.HTTP_SERVER_ENDPOINT
+		baseURL = config.GetConfig().Get(config.KeyAPIURL)
 	}
+	transport := NewTransport(RetryPolicyFromConfig(config.GetConfig()))
 	return &APIClient{
 		BaseURL:    baseURL,
 		ClientID:   clientID,
 		PrivateKey: keyPair.PrivateKey,
 		PublicKey:  keyPair.PublicKey,
-		HttpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		Config:     config.GetConfig(),
+		Events:     events.GetBus(),
+		Clock:      clock.GetClock(),
+		HttpClient: transport.Client,
+		Transport:  transport,
 	}
 }
 
-// Request sends an HTTP request with automatic authentication header
+// Request sends an HTTP request with automatic authentication headers
 // Implementation mimics aro-ext-ui axios interceptor:
 // 1. Generate timestamp
-// 2. Sign with private key: SHA256(clientID:timestamp)
-// 3. Generate Bearer Token: Bearer base64("aro:clientID:timestamp:signature")
+// 2. Sign with private key: clientID:timestamp
+// 3. Generate Bearer Token: Bearer base64("aro:clientID:timestamp:signature"), with ":keyType" appended for non-RSA keys
+// and additionally signs method, path, body hash and a nonce (X-Aro-* headers, scheme v2)
 func (c *APIClient) Request(method, path string, body interface{}) ([]byte, int, error) {
-	log.Printf("APIClient: %v", c)
-	log.Printf("APIClient pointers - HttpClient: %p, PrivateKey: %p, PublicKey: %p",
-		c.HttpClient, c.PrivateKey, c.PublicKey)
-	url := fmt.Sprintf("%s%s", c.BaseURL, path)
+	return c.RequestContext(context.Background(), method, path, body)
+}
 
-	var reqBody io.Reader
-	if body != nil {
-		data, _ := json.Marshal(body)
-		reqBody = bytes.NewReader(data)
-	}
-	log.Printf("Requesting %s %+v", url, body)
-	req, err := http.NewRequest(method, url, reqBody)
+// RequestContext is Request with a context; the request goes through the client's
+// Transport, which retries transient failures and re-signs every attempt
+func (c *APIClient) RequestContext(ctx context.Context, method, path string, body interface{}) ([]byte, int, error) {
+	resp, _, err := c.do(ctx, method, path, body)
 	if err != nil {
 		return nil, 0, err
 	}
+	return resp.Body, resp.StatusCode, nil
+}
 
-	// Generate authentication credentials
-	credentials := auth.NewAuthCredentials(c.ClientID, c.PrivateKey)
-	// Add authentication header and content type
-	req.Header.Set("Authorization", credentials.GetAuthHeader())
-	req.Header.Set("Content-Type", "application/json")
+// roundTrip holds the local send and receive times of a request's final attempt
+type roundTrip struct {
+	sent, received time.Time
+}
 
-	// Send request
-	resp, err := c.HttpClient.Do(req)
-	if err != nil {
-		return nil, 0, fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
+// do signs and sends a request, feeding the response's Date header to the client's Clock.
+// A request rejected with 401 is sent once more when that response corrected the clock,
+// as the rejection was most likely caused by a skewed timestamp, and once more signed
+// with the previous key while a key rotation's grace window is open
+func (c *APIClient) do(ctx context.Context, method, path string, body interface{}) (*Response, roundTrip, error) {
+	key, previous := c.keys()
+	log.Printf("APIClient: %v", c)
+	log.Printf("APIClient pointers - HttpClient: %p, PrivateKey: %p", c.HttpClient, key)
+	url := fmt.Sprintf("%s%s", c.URL(), path)
+	log.Printf("Requesting %s %+v", url, body)
 
-	// Read response body
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, resp.StatusCode, fmt.Errorf("failed to read response: %w", err)
+	clockRetried, previousTried := false, false
+	for {
+		var rt roundTrip
+		resp, err := c.transport().Do(ctx, func(ctx context.Context) (*http.Request, error) {
+			data, err := c.marshalBody(body, key)
+			if err != nil {
+				return nil, err
+			}
+			var reqBody io.Reader
+			if data != nil {
+				reqBody = bytes.NewReader(data)
+			}
+			req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+			if err != nil {
+				return nil, err
+			}
+
+			// Sign method, path, body and a fresh nonce (auth scheme v2, see auth.Signer);
+			// the Authorization header stays v1-compatible for backends that have not migrated
+			signer := auth.NewSigner(c.ID(), key)
+			signer.Now = c.Now
+			signer.V2Only = c.authV2.Load()
+			if err := signer.Sign(req, data); err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if key := idempotencyKey(ctx); key != "" {
+				req.Header.Set("Idempotency-Key", key)
+			}
+			rt.sent = time.Now()
+			return req, nil
+		})
+		if err != nil {
+			return nil, rt, err
+		}
+		rt.received = time.Now()
+		if resp.Header.Get(auth.HeaderAuthVersion) == fmt.Sprint(auth.SchemeV2) {
+			c.authV2.Store(true)
+		}
+
+		corrected := c.observeClock(func(clk *clock.Clock) bool {
+			return clk.ObserveDate(resp.Header.Get("Date"), rt.sent, rt.received)
+		})
+		if resp.StatusCode == http.StatusUnauthorized {
+			if corrected && !clockRetried {
+				log.Printf("%s %s was rejected before the clock was corrected, retrying", method, path)
+				clockRetried = true
+				continue
+			}
+			if previous != nil && !previousTried {
+				log.Printf("%s %s was rejected with the rotated key, retrying with the previous key", method, path)
+				key, previousTried = previous, true
+				continue
+			}
+		}
+		return resp, rt, nil
 	}
+}
+
+// signedBody builds a request body that carries its own signed timestamp (sign-up);
+// it is called for every attempt with the attempt's key, so retries sent after the
+// clock was corrected are signed with the corrected time
+type signedBody func(key crypto.PrivateKey) (interface{}, error)
 
-	return respBody, resp.StatusCode, nil
+// marshalBody encodes the body of one attempt; a nil body sends no body
+func (c *APIClient) marshalBody(body interface{}, key crypto.PrivateKey) ([]byte, error) {
+	if build, ok := body.(signedBody); ok {
+		var err error
+		if body, err = build(key); err != nil {
+			return nil, err
+		}
+	}
+	if body == nil {
+		return nil, nil
+	}
+	return json.Marshal(body)
 }
 
 // Get sends a GET request and returns parsed response
 func (c *APIClient) Get(path string) (*APIResponse, error) {
-	respBody, statusCode, err := c.Request("GET", path, nil)
+	return c.GetContext(context.Background(), path)
+}
+
+// GetContext is Get with a context
+func (c *APIClient) GetContext(ctx context.Context, path string) (*APIResponse, error) {
+	respBody, statusCode, err := c.RequestContext(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, err
 	}
+	return c.parseResponse(path, respBody, statusCode)
+}
+
+// Post sends a POST request and returns parsed response
+func (c *APIClient) Post(path string, body interface{}) (*APIResponse, error) {
+	return c.PostContext(context.Background(), path, body)
+}
 
+// PostContext is Post with a context
+func (c *APIClient) PostContext(ctx context.Context, path string, body interface{}) (*APIResponse, error) {
+	respBody, statusCode, err := c.RequestContext(ctx, "POST", path, body)
+	if err != nil {
+		return nil, err
+	}
+	return c.parseResponse(path, respBody, statusCode)
+}
+
+// parseResponse decodes the backend envelope and turns business errors into coded errors
+func (c *APIClient) parseResponse(path string, respBody []byte, statusCode int) (*APIResponse, error) {
 	var apiResp APIResponse
 	if err := json.Unmarshal(respBody, &apiResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response (HTTP %d): %w", statusCode, err)
+		publishAuthFailure(c.Events, path, statusCode, 0, string(respBody))
+		return nil, errcode.Errorf(responseErrorCode(statusCode, 0), "failed to parse response (HTTP %d): %w", statusCode, err)
 	}
+	publishAuthFailure(c.Events, path, statusCode, apiResp.Code, apiResp.Message)
 
 	if apiResp.Code != 0 && apiResp.Code != 200 {
-		return &apiResp, fmt.Errorf("API error: code=%d, message=%s", apiResp.Code, apiResp.Message)
+		return &apiResp, errcode.Errorf(responseErrorCode(statusCode, apiResp.Code), "%w",
+			&ResponseError{StatusCode: statusCode, Code: apiResp.Code, Message: apiResp.Message})
 	}
 
 	return &apiResp, nil
 }
 
-// Post sends a POST request and returns parsed response
-func (c *APIClient) Post(path string, body interface{}) (*APIResponse, error) {
-	respBody, statusCode, err := c.Request("POST", path, body)
+// getTyped sends a GET request and decodes the response data into T
+func getTyped[T any](ctx context.Context, c *APIClient, path string) (*APIResponseWith[T], error) {
+	respBody, statusCode, err := c.RequestContext(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, err
 	}
+	return decodeTyped[T](c.Events, path, respBody, statusCode)
+}
 
-	var apiResp APIResponse
-	if err := json.Unmarshal(respBody, &apiResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response (HTTP %d): %w", statusCode, err)
+// postTyped sends a POST request and decodes the response data into T
+func postTyped[T any](ctx context.Context, c *APIClient, path string, body interface{}) (*APIResponseWith[T], error) {
+	respBody, statusCode, err := c.RequestContext(ctx, "POST", path, body)
+	if err != nil {
+		return nil, err
 	}
+	return decodeTyped[T](c.Events, path, respBody, statusCode)
+}
 
-	if apiResp.Code != 0 && apiResp.Code != 200 {
-		return &apiResp, fmt.Errorf("API error: code=%d, message=%s", apiResp.Code, apiResp.Message)
+// decodeTyped decodes the backend envelope, then the data into T
+// Data that does not match T or fails its Validate method is a BACKEND_ERROR,
+// so callers never see a half-filled struct
+func decodeTyped[T any](bus *events.Bus, path string, respBody []byte, statusCode int) (*APIResponseWith[T], error) {
+	var envelope struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &envelope); err != nil {
+		publishAuthFailure(bus, path, statusCode, 0, string(respBody))
+		return nil, errcode.Errorf(responseErrorCode(statusCode, 0), "failed to parse response (HTTP %d): %w", statusCode, err)
 	}
+	publishAuthFailure(bus, path, statusCode, envelope.Code, envelope.Message)
 
-	return &apiResp, nil
+	resp := &APIResponseWith[T]{Code: envelope.Code, Message: envelope.Message, raw: envelope.Data}
+	if envelope.Code != 0 && envelope.Code != 200 {
+		return resp, errcode.Errorf(responseErrorCode(statusCode, envelope.Code), "%w",
+			&ResponseError{StatusCode: statusCode, Code: envelope.Code, Message: envelope.Message})
+	}
+	if len(envelope.Data) > 0 && string(envelope.Data) != "null" {
+		if err := json.Unmarshal(envelope.Data, &resp.Data); err != nil {
+			return nil, errcode.Errorf(errcode.BackendError, "unexpected data from %s: %w", path, err)
+		}
+	}
+	if v, ok := any(resp.Data).(validator); ok {
+		if err := v.Validate(); err != nil {
+			return nil, errcode.Errorf(errcode.BackendError, "invalid data from %s: %w", path, err)
+		}
+	}
+	return resp, nil
+}
+
+// transport returns the client's Transport; a client built without NewAPIClient
+// gets a transport configured from its config for each call
+func (c *APIClient) transport() *Transport {
+	if c.Transport != nil {
+		return c.Transport
+	}
+	cfg := c.Config
+	if cfg == nil {
+		cfg = config.GetConfig()
+	}
+	return NewTransport(RetryPolicyFromConfig(cfg))
+}
+
+// publishAuthFailure publishes an auth.failed event when the backend rejects the credentials
+// Both the HTTP status and the business code in the response body are checked
+func publishAuthFailure(bus *events.Bus, path string, statusCode int, code int, message string) {
+	if !isAuthFailure(statusCode) && !isAuthFailure(code) {
+		return
+	}
+	if !isAuthFailure(statusCode) {
+		statusCode = code
+	}
+	if bus == nil {
+		bus = events.GetBus()
+	}
+	bus.Publish(events.AuthFailed, events.AuthEvent{
+		Path:       path,
+		StatusCode: statusCode,
+		Message:    message,
+	})
+}
+
+// responseErrorCode classifies a failed backend response for FFI callers
+func responseErrorCode(statusCode int, code int) errcode.Code {
+	if isAuthFailure(statusCode) || isAuthFailure(code) {
+		return errcode.AuthFailed
+	}
+	return errcode.BackendError
+}
+
+func isAuthFailure(code int) bool {
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
 }
@@ -0,0 +1,128 @@
+package api_client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"aro-ext-app/core/internal/auth"
+	"aro-ext-app/core/internal/clock"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/crashdump"
+	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/events"
+)
+
+func TestNodeSignUpResignsAfterClockCorrection(t *testing.T) {
+	keyPair, err := crypto.GenerateRSAKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 服务端时间比本地快两小时，签名时间戳未校正时被拒绝
+	const skew = 2 * time.Hour
+	var bodies []NodeSignUpRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now().Add(skew)
+		w.Header().Set("Date", now.UTC().Format(http.TimeFormat))
+		var req NodeSignUpRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		bodies = append(bodies, req)
+		if d := now.Unix() - req.Timestamp; d > 60 || d < -60 {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":401,"message":"timestamp expired"}`))
+			return
+		}
+		if err := crypto.VerifySignature(keyPair.PublicKey, fmt.Sprintf("%s:%d", req.ClientID, req.Timestamp), req.Signature); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":401,"message":"bad signature"}`))
+			return
+		}
+		w.Write([]byte(`{"code":200,"message":"ok","data":{"serialNumber":"SN-1"}}`))
+	}))
+	defer srv.Close()
+
+	cfg := config.New(t.TempDir())
+	c := NewAPIClient(srv.URL, "client-1", keyPair)
+	c.Config = cfg
+	c.Events = events.NewBus(16)
+	c.Clock = clock.New(cfg)
+	c.Transport = NewTransport(RetryPolicy{})
+	c.HttpClient = c.Transport.Client
+
+	resp, err := c.NodeSignUpContext(context.Background())
+	if err != nil || resp.Data.SerialNumber != "SN-1" {
+		t.Fatalf("expected the retry to be signed with the corrected clock, got %v", err)
+	}
+	if len(bodies) != 2 || bodies[1].Timestamp-bodies[0].Timestamp < int64(skew/time.Second)-5 {
+		t.Errorf("expected a re-signed body on retry, got %+v", bodies)
+	}
+}
+
+func TestStopsSendingV1AfterV2Confirmed(t *testing.T) {
+	keyPair, err := crypto.GenerateKeyPair(crypto.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v1Accepted []bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 去掉 v2 头后按 v1 校验，记录令牌能否被当作 v1 重放
+		v1 := r.Clone(r.Context())
+		v1.Header.Del(auth.HeaderAuthVersion)
+		_, err := auth.NewVerifier(auth.DefaultMaxSkew).Verify(v1, nil, func(string) (crypto.PublicKey, error) { return keyPair.PublicKey, nil })
+		v1Accepted = append(v1Accepted, err == nil)
+		w.Header().Set(auth.HeaderAuthVersion, "2")
+		w.Write([]byte(`{"code":200,"message":"ok"}`))
+	}))
+	defer srv.Close()
+
+	cfg := config.New(t.TempDir())
+	c := NewAPIClient(srv.URL, "client-1", keyPair)
+	c.Config = cfg
+	c.Events = events.NewBus(16)
+	c.Clock = clock.New(cfg)
+	c.Transport = NewTransport(RetryPolicy{})
+	c.HttpClient = c.Transport.Client
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetContext(context.Background(), "/api/x"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(v1Accepted) != 2 || !v1Accepted[0] || v1Accepted[1] {
+		t.Errorf("expected only the first request to carry a v1 signature, got %v", v1Accepted)
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	keyPair, err := crypto.GenerateKeyPair(crypto.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		w.Write([]byte(`{"code":200,"message":"ok"}`))
+	}))
+	defer srv.Close()
+
+	cfg := config.New(t.TempDir())
+	c := NewAPIClient(srv.URL, "client-1", keyPair)
+	c.Config = cfg
+	c.Events = events.NewBus(16)
+	c.Clock = clock.New(cfg)
+
+	beats := []Heartbeat{{ID: "a"}, {ID: "b"}}
+	c.NodeHeartbeatContext(context.Background(), beats)
+	// 同一批心跳重新发送时使用相同的 key
+	c.NodeHeartbeatContext(context.Background(), beats)
+	c.NodeHeartbeatContext(context.Background(), beats[:1])
+	c.ReportCrashContext(context.Background(), crashdump.Report{ID: "crash-1"})
+	c.NodeReportBaseInfoContext(context.Background(), NodeReportBaseInfoRequest{})
+	if len(keys) != 5 || keys[0] == "" || keys[0] != keys[1] || keys[2] == keys[0] || keys[3] != "crash-1" || keys[4] == "" {
+		t.Errorf("unexpected idempotency keys %q", keys)
+	}
+}
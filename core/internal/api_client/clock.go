@@ -0,0 +1,68 @@
+package api_client
+
+import (
+	"context"
+	"time"
+
+	"aro-ext-app/core/internal/clock"
+	"aro-ext-app/core/internal/events"
+)
+
+// ServerTimePath is the backend time endpoint used by SyncClock
+const ServerTimePath = "/api/liteNode/time"
+
+// Now returns the current time corrected by the offset observed in backend responses;
+// use it for every timestamp the backend checks
+func (c *APIClient) Now() time.Time {
+	return c.clock().Now()
+}
+
+// ClockStatus returns the observed clock offset and whether it exceeds the skew threshold
+func (c *APIClient) ClockStatus() clock.Status {
+	return c.clock().Status()
+}
+
+// SyncClock measures the clock offset against the backend
+// Endpoint: GET /api/liteNode/time
+//
+// Response data:
+//   - timestamp: Server time in Unix milliseconds
+//
+// Every response already corrects the clock from its Date header (1s resolution);
+// the time endpoint refines it to milliseconds. Backends without the endpoint still
+// correct the clock from the Date header of the error response.
+func (c *APIClient) SyncClock(ctx context.Context) (clock.Status, error) {
+	resp, rt, err := c.do(ctx, "GET", ServerTimePath, nil)
+	if err != nil {
+		return c.ClockStatus(), err
+	}
+	data, err := decodeTyped[ServerTimeData](c.Events, ServerTimePath, resp.Body, resp.StatusCode)
+	if err != nil {
+		return c.ClockStatus(), err
+	}
+	c.observeClock(func(clk *clock.Clock) bool {
+		return clk.Observe(time.UnixMilli(data.Data.Timestamp), rt.sent, rt.received, time.Millisecond, clock.SourceTimeAPI)
+	})
+	return c.ClockStatus(), nil
+}
+
+// observeClock applies an observation to the clock and publishes a clock.skewed event
+// when it pushes the offset over the threshold; it reports whether the offset changed
+func (c *APIClient) observeClock(observe func(clk *clock.Clock) bool) bool {
+	clk := c.clock()
+	wasSkewed := clk.Status().Skewed
+	if !observe(clk) {
+		return false
+	}
+	if st := clk.Status(); st.Skewed && !wasSkewed && c.Events != nil {
+		c.Events.Publish(events.ClockSkewed, events.ClockEvent{Offset: st.Offset, Threshold: st.Threshold, Source: st.Source})
+	}
+	return true
+}
+
+func (c *APIClient) clock() *clock.Clock {
+	if c.Clock != nil {
+		return c.Clock
+	}
+	return clock.GetClock()
+}
@@ -3,11 +3,17 @@ package api_client
 import (
 	"aro-ext-app/core/internal/auth"
 	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/crashdump"
 	"aro-ext-app/core/internal/crypto"
-	"aro-ext-app/core/internal/storage"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
 	"runtime"
-	"time"
+
+	"github.com/google/uuid"
 )
 
 // ======================
@@ -20,58 +26,110 @@ import (
 //
 // Request body:
 //   - clientId: Node ID
-//   - publicKey: RSA public key (PEM format, base64 encoded)
+//   - publicKey: Public key (PKIX PEM format, base64 encoded)
+//   - keyType: Key algorithm (ed25519, ecdsa-p256), omitted for RSA
 //   - signature: Digital signature
 //   - timestamp: Request timestamp (milliseconds)
 //
 // Response data:
 //   - user: User information
 //   - node: Node information (nodeId, status, etc.)
+//
+// A backend that does not accept the key type answers 400 with data.keyTypes listing
+// the types it accepts; backends older than key type negotiation answer 400 without
+// the list and only accept RSA. Both are returned as *KeyTypeError
+func (c *APIClient) NodeSignUp() (*APIResponseWith[SignUpData], error) {
+	return c.NodeSignUpContext(context.Background())
+}
 
-var storageApi = storage.GetStorage()
-var cfg = config.GetConfig()
-
-func (c *APIClient) NodeSignUp() (*APIResponse, error) {
-	sn := cfg.Get(config.KeySN)
+// NodeSignUpContext is NodeSignUp with a context
+func (c *APIClient) NodeSignUpContext(ctx context.Context) (*APIResponseWith[SignUpData], error) {
+	sn := c.Config.Get(config.KeySN)
 	if sn != "" {
-		var apiResponse = APIResponse{
+		var apiResponse = APIResponseWith[SignUpData]{
 			Code:    200,
 			Message: "success",
-			Data: map[string]interface{}{
-				"serialNumber": sn,
-			},
+			Data:    SignUpData{SerialNumber: sn},
 		}
 		return &apiResponse, nil
 	}
-	timestamp := time.Now().UTC().Unix()
-	signature := auth.GenerateRSASignature(c.ClientID, timestamp, c.PrivateKey)
-	//storageApi.GetString(storage.PUBLIC_KEY)
-	publicKey, err := crypto.ExportPublicKeyToPEM(c.PublicKey)
+	privateKey, _ := c.keys()
+	keyType := crypto.KeyTypeOf(privateKey)
+	// The body is signed per attempt: a retry after the clock was corrected must not
+	// resend the skewed timestamp
+	req := signedBody(func(key crypto.PrivateKey) (interface{}, error) {
+		publicKey, err := crypto.ExportPublicKeyToPEM(key.Public().(crypto.PublicKey))
+		if err != nil {
+			return nil, err
+		}
+		timestamp := c.Now().UTC().Unix()
+		body := NodeSignUpRequest{
+			ClientID:  c.ID(),
+			PublicKey: publicKey,
+			Signature: auth.GenerateSignature(c.ID(), timestamp, key),
+			Timestamp: timestamp,
+		}
+		if kt := crypto.KeyTypeOf(key); kt != crypto.KeyTypeRSA {
+			body.KeyType = string(kt)
+		}
+		return body, nil
+	})
+
+	apiResponse, err := postTyped[SignUpData](ctx, c, "/api/liteNode/signUp", req)
 	if err != nil {
+		if keyErr := keyTypeError(keyType, apiResponse, err); keyErr != nil {
+			return nil, keyErr
+		}
 		return nil, err
 	}
 
-	req := NodeSignUpRequest{
-		ClientID:  c.ClientID,
-		PublicKey: publicKey,
-		Signature: signature,
-		Timestamp: time.Now().UTC().Unix(),
-	}
+	sn = apiResponse.Data.SerialNumber
+	newBackendService(c.Config.Profile().BackendPublicKey, runtime.GOOS, sn)
+	c.Config.SetAndSave(config.KeySN, sn)
 
-	apiResponse, err := c.Post("/api/liteNode/signUp", req)
-	if err != nil {
-		return nil, err
-	}
+	return apiResponse, nil
+}
 
-	sn = apiResponse.Data.(map[string]interface{})["serialNumber"].(string)
-	NewBackendService(runtime.GOOS, sn)
-	cfg.SetAndSave(config.KeySN, sn)
+// KeyTypeError is returned by NodeSignUp when the backend does not accept the node's key type
+type KeyTypeError struct {
+	KeyType crypto.KeyType
+	// Supported lists the key types the backend accepts, in the backend's order of preference
+	Supported []crypto.KeyType
+	Err       error
+}
 
-	return &APIResponse{
-		Code:    apiResponse.Code,
-		Message: apiResponse.Message,
-		Data:    apiResponse.Data,
-	}, nil
+func (e *KeyTypeError) Error() string {
+	return fmt.Sprintf("backend does not accept %s keys (supported: %v): %v", e.KeyType, e.Supported, e.Err)
+}
+
+func (e *KeyTypeError) Unwrap() error { return e.Err }
+
+// keyTypeError turns a rejected sign-up or rotation into a KeyTypeError when the rejection is about the key type
+func keyTypeError[T any](keyType crypto.KeyType, resp *APIResponseWith[T], err error) error {
+	if resp == nil || resp.Code != 400 {
+		return nil
+	}
+	var data SignUpData
+	if len(resp.raw) > 0 {
+		_ = json.Unmarshal(resp.raw, &data)
+	}
+	if len(data.KeyTypes) == 0 {
+		// Backends without key type negotiation only know RSA
+		if keyType == crypto.KeyTypeRSA {
+			return nil
+		}
+		return &KeyTypeError{KeyType: keyType, Supported: []crypto.KeyType{crypto.KeyTypeRSA}, Err: err}
+	}
+	keyErr := &KeyTypeError{KeyType: keyType, Err: err}
+	for _, name := range data.KeyTypes {
+		if name == string(keyType) {
+			return nil
+		}
+		if t, perr := crypto.ParseKeyType(name); perr == nil {
+			keyErr.Supported = append(keyErr.Supported, t)
+		}
+	}
+	return keyErr
 }
 
 // NodeReportBaseInfo Report node basic information
@@ -90,8 +148,106 @@ func (c *APIClient) NodeSignUp() (*APIResponse, error) {
 //   - nodeId: Node ID
 //
 // Response: Operation result (success/failure)
-func (c *APIClient) NodeReportBaseInfo(sysInfo NodeReportBaseInfoRequest) (*APIResponse, error) {
-	return c.Post("/api/liteNode/node/reportBaseInfo", sysInfo)
+func (c *APIClient) NodeReportBaseInfo(sysInfo NodeReportBaseInfoRequest) (*APIResponseWith[ReportBaseInfoData], error) {
+	return c.NodeReportBaseInfoContext(context.Background(), sysInfo)
+}
+
+// NodeReportBaseInfoContext is NodeReportBaseInfo with a context; each report gets a
+// fresh Idempotency-Key so that its attempts are retried and deduplicated
+func (c *APIClient) NodeReportBaseInfoContext(ctx context.Context, sysInfo NodeReportBaseInfoRequest) (*APIResponseWith[ReportBaseInfoData], error) {
+	ctx = WithIdempotencyKey(ctx, uuid.NewString())
+	return postTyped[ReportBaseInfoData](ctx, c, "/api/liteNode/node/reportBaseInfo", sysInfo)
+}
+
+// NodeHeartbeat Report node liveness
+// Endpoint: POST /api/liteNode/node/heartbeat
+//
+// Request body:
+//   - nodeId: Node ID
+//   - beats: Liveness samples, oldest first; beats missed while offline are sent in
+//     one batch with their original timestamps
+//
+// Response data:
+//   - accepted: Number of beats stored
+//   - interval: Next heartbeat interval in seconds (0 keeps the current interval)
+func (c *APIClient) NodeHeartbeat(beats []Heartbeat) (*APIResponseWith[HeartbeatData], error) {
+	return c.NodeHeartbeatContext(context.Background(), beats)
+}
+
+// NodeHeartbeatContext is NodeHeartbeat with a context; the Idempotency-Key is derived
+// from the beat IDs, so a batch sent again after a lost response gets the same key
+func (c *APIClient) NodeHeartbeatContext(ctx context.Context, beats []Heartbeat) (*APIResponseWith[HeartbeatData], error) {
+	h := sha256.New()
+	for _, beat := range beats {
+		io.WriteString(h, beat.ID)
+		io.WriteString(h, "\n")
+	}
+	ctx = WithIdempotencyKey(ctx, hex.EncodeToString(h.Sum(nil)))
+	req := NodeHeartbeatRequest{NodeID: c.ID(), Beats: beats}
+	return postTyped[HeartbeatData](ctx, c, "/api/liteNode/node/heartbeat", req)
+}
+
+// NodeRotateKey Replace the node's key pair
+// Endpoint: POST /api/liteNode/node/rotateKey
+//
+// Request body:
+//   - clientId: Node ID
+//   - newPublicKey: New public key (PKIX PEM format, base64 encoded), may use another key type than the current key
+//   - timestamp: Unix seconds
+//   - oldSignature, newSignature: Signatures of KeyRotationMessage by the current and new keys
+//
+// Response data:
+//   - gracePeriod: Seconds during which the old key is still accepted
+//
+// The request is signed with the current key. Sending the same new key again after
+// it was accepted succeeds, so an interrupted rotation can be retried. The client
+// keeps using the current key until the caller switches with SetKeyPair.
+// A new key of a type the backend does not accept is returned as *KeyTypeError.
+func (c *APIClient) NodeRotateKey(ctx context.Context, newKey *crypto.KeyPair) (*APIResponseWith[RotateKeyData], error) {
+	publicKey, err := crypto.ExportPublicKeyToPEM(newKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	current, _ := c.keys()
+	req := NodeRotateKeyRequest{
+		ClientID:     c.ID(),
+		NewPublicKey: publicKey,
+		Timestamp:    c.Now().Unix(),
+	}
+	message := KeyRotationMessage(req.ClientID, req.NewPublicKey, req.Timestamp)
+	if req.OldSignature, err = crypto.SignMessage(current, message); err != nil {
+		return nil, err
+	}
+	if req.NewSignature, err = crypto.SignMessage(newKey.PrivateKey, message); err != nil {
+		return nil, err
+	}
+	resp, err := postTyped[RotateKeyData](ctx, c, "/api/liteNode/node/rotateKey", req)
+	if err != nil {
+		if keyErr := keyTypeError(crypto.KeyTypeOf(newKey.PrivateKey), resp, err); keyErr != nil {
+			return nil, keyErr
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// KeyRotationMessage returns the message both keys sign in a rotation request
+func KeyRotationMessage(clientID, newPublicKey string, timestamp int64) string {
+	return fmt.Sprintf("aro-rotate:%s:%d:%s", clientID, timestamp, newPublicKey)
+}
+
+// NodePresence Report when the backend last heard from this node
+// Endpoint: GET /api/liteNode/node/presence
+//
+// Response data:
+//   - lastSeen: Time of the last heartbeat (unix milliseconds), 0 if never
+//   - hardwareId: Hardware id reported in that heartbeat
+//
+// Used before restoring an identity backup to refuse identities still running on another device.
+// Only the mock backend serves this endpoint so far; against a backend without it the
+// request fails and restoring a backup needs ImportOptions.Force
+func (c *APIClient) NodePresence(ctx context.Context) (*APIResponseWith[PresenceData], error) {
+	return getTyped[PresenceData](ctx, c, "/api/liteNode/node/presence")
 }
 
 // GetNodeStat Get node statistics
@@ -108,27 +264,25 @@ func (c *APIClient) NodeReportBaseInfo(sysInfo NodeReportBaseInfoRequest) (*APIR
 //   - node: Node status
 //   - points: Current points balance
 //   - stats: Various statistics
-func (c *APIClient) GetNodeStat() (*APIResponse, error) {
-	apiResponse, err := c.Get("/api/liteNode/stat")
-	if err != nil {
-		return nil, err
-	}
-	dataBytes, err := json.Marshal(apiResponse.Data)
-	if err != nil {
-		return nil, err
-	}
-	var bindUser storage.BindInfo
-	err = json.Unmarshal(dataBytes, &bindUser)
+func (c *APIClient) GetNodeStat() (*APIResponseWith[NodeStatData], error) {
+	return c.GetNodeStatContext(context.Background())
+}
+
+// GetNodeStatContext is GetNodeStat with a context
+func (c *APIClient) GetNodeStatContext(ctx context.Context) (*APIResponseWith[NodeStatData], error) {
+	apiResponse, err := getTyped[NodeStatData](ctx, c, "/api/liteNode/stat")
 	if err != nil {
 		return nil, err
 	}
+	bindUser := apiResponse.Data
 
-	NewBackendService(runtime.GOOS, bindUser.SerialNumber)
-	cfg.SetAndSave(config.KeySN, bindUser.SerialNumber)
+	newBackendService(c.Config.Profile().BackendPublicKey, runtime.GOOS, bindUser.SerialNumber)
+	values := map[string]string{config.KeySN: bindUser.SerialNumber}
 	if bindUser.BindUser != nil {
-		cfg.SetAndSave(config.USER_ID, bindUser.BindUser.UUID)
-		cfg.SetAndSave(config.EMAIL, bindUser.BindUser.Email)
+		values[config.USER_ID] = bindUser.BindUser.UUID
+		values[config.EMAIL] = bindUser.BindUser.Email
 	}
+	c.Config.SetAndSaveAll(values)
 	// Only start WebSocket if bound and not already running
 	// if bindUser.Bind && !ws_client.IsWebSocketRunning() {
 	// 	ws_client.StartWebSocketClient()
@@ -150,6 +304,28 @@ func (c *APIClient) GetNodeStat() (*APIResponse, error) {
 //   - totalRewards: Total accumulated rewards
 //   - weeklyRewards: 7-day reward breakdown
 //   - rewardInfo: Detailed reward information
-func (c *APIClient) GetRewards() (*APIResponse, error) {
-	return c.Get("/api/liteNode/rewards")
-}
\ No newline at end of file
+func (c *APIClient) GetRewards() (*APIResponseWith[RewardsData], error) {
+	return c.GetRewardsContext(context.Background())
+}
+
+// GetRewardsContext is GetRewards with a context
+func (c *APIClient) GetRewardsContext(ctx context.Context) (*APIResponseWith[RewardsData], error) {
+	return getTyped[RewardsData](ctx, c, "/api/liteNode/rewards")
+}
+
+// ReportCrash Upload a crash report written by a recovered FFI panic
+// Endpoint: POST /api/liteNode/node/reportCrash
+//
+// Called on the next start for every pending report; the report is removed
+// locally only after the backend accepts it
+//
+// Request body: crashdump.Report (id, time, func, panic, stack, version, os, arch)
+func (c *APIClient) ReportCrash(report crashdump.Report) (*APIResponseWith[ReportCrashData], error) {
+	return c.ReportCrashContext(context.Background(), report)
+}
+
+// ReportCrashContext is ReportCrash with a context; the report ID is the Idempotency-Key
+func (c *APIClient) ReportCrashContext(ctx context.Context, report crashdump.Report) (*APIResponseWith[ReportCrashData], error) {
+	ctx = WithIdempotencyKey(ctx, report.ID)
+	return postTyped[ReportCrashData](ctx, c, "/api/liteNode/node/reportCrash", report)
+}
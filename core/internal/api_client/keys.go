@@ -0,0 +1,55 @@
+package api_client
+
+import (
+	"time"
+
+	"aro-ext-app/core/internal/crypto"
+)
+
+// SetKeyPair switches the key used to sign requests, e.g. after NodeRotateKey.
+// previous, when not nil, signs one more attempt of a request the backend rejects
+// with 401 until previousUntil, covering backends that have not picked up the rotation yet
+func (c *APIClient) SetKeyPair(keyPair *crypto.KeyPair, previous crypto.PrivateKey, previousUntil time.Time) {
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+	c.PrivateKey = keyPair.PrivateKey
+	c.PublicKey = keyPair.PublicKey
+	c.previousKey = previous
+	c.previousUntil = previousUntil
+}
+
+// SetIdentity switches the client ID and key pair together, e.g. after re-registering
+// the node or restoring an identity backup; the previous key is dropped
+func (c *APIClient) SetIdentity(clientID string, keyPair *crypto.KeyPair) {
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+	c.ClientID = clientID
+	c.PrivateKey = keyPair.PrivateKey
+	c.PublicKey = keyPair.PublicKey
+	c.previousKey = nil
+	c.previousUntil = time.Time{}
+}
+
+// ID returns the client ID requests are currently signed with
+func (c *APIClient) ID() string {
+	c.keyMu.RLock()
+	defer c.keyMu.RUnlock()
+	return c.ClientID
+}
+
+// keys returns the current signing key, and the previous key while its grace window is open
+func (c *APIClient) keys() (current, previous crypto.PrivateKey) {
+	c.keyMu.RLock()
+	defer c.keyMu.RUnlock()
+	if c.previousKey != nil && c.Now().Before(c.previousUntil) {
+		previous = c.previousKey
+	}
+	return c.PrivateKey, previous
+}
+
+// KeyPair returns the key pair currently used to sign requests
+func (c *APIClient) KeyPair() *crypto.KeyPair {
+	c.keyMu.RLock()
+	defer c.keyMu.RUnlock()
+	return &crypto.KeyPair{PrivateKey: c.PrivateKey, PublicKey: c.PublicKey}
+}
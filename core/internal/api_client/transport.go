@@ -0,0 +1,439 @@
+package api_client
+
+import (
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/errcode"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Default retry settings, used when the config values are missing or invalid
+const (
+	DefaultRetryCount    = 3
+	DefaultRetryInterval = time.Second
+	DefaultMaxRetryDelay = 30 * time.Second
+	DefaultTimeout       = 30 * time.Second
+
+	// DefaultBreakerThreshold consecutive failures that open a host's circuit
+	DefaultBreakerThreshold = 5
+	// DefaultBreakerCooldown time an open circuit waits before letting a probe through
+	DefaultBreakerCooldown = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without sending a request while a host's circuit is open
+var ErrCircuitOpen = errcode.New(errcode.BackendUnreachable, "backend circuit breaker is open")
+
+// ResponseError is a response the backend sent but rejected, carrying the HTTP
+// status and the business code of the envelope
+type ResponseError struct {
+	StatusCode int
+	Code       int
+	Message    string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("API error: code=%d, message=%s", e.Code, e.Message)
+}
+
+// Retryable reports whether sending the same request again later may succeed:
+// network failures, timeouts, an open circuit and 408, 429 or 5xx responses are
+// retryable; rejected credentials and other 4xx responses fail the same way again
+func Retryable(err error) bool {
+	if err == nil || errcode.Of(err) == errcode.AuthFailed {
+		return false
+	}
+	var re *ResponseError
+	if !errors.As(err, &re) {
+		return true
+	}
+	for _, code := range []int{re.StatusCode, re.Code} {
+		if code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || (code >= 500 && code < 600) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryPolicy controls how the transport retries failed backend calls
+type RetryPolicy struct {
+	// MaxRetries number of retries after the first attempt
+	MaxRetries int
+	// BaseDelay delay before the first retry, doubled on every retry
+	BaseDelay time.Duration
+	// MaxDelay upper bound for backoff and Retry-After delays
+	MaxDelay time.Duration
+	// Timeout per-attempt timeout
+	Timeout time.Duration
+	// BreakerThreshold consecutive failures that open a host's circuit
+	BreakerThreshold int
+	// BreakerCooldown time an open circuit waits before letting a probe through
+	BreakerCooldown time.Duration
+}
+
+// RetryPolicyFromConfig reads RETRY_COUNT, RETRY_INTERVAL (ms) and TIMEOUT (s);
+// invalid values fall back to the defaults in config.Settings
+func RetryPolicyFromConfig(cfg *config.Config) RetryPolicy {
+	p := RetryPolicy{
+		MaxRetries:       DefaultRetryCount,
+		BaseDelay:        DefaultRetryInterval,
+		MaxDelay:         DefaultMaxRetryDelay,
+		Timeout:          DefaultTimeout,
+		BreakerThreshold: DefaultBreakerThreshold,
+		BreakerCooldown:  DefaultBreakerCooldown,
+	}
+	s, _ := cfg.Settings()
+	p.MaxRetries = s.API.RetryCount
+	p.BaseDelay = time.Duration(s.API.RetryInterval) * time.Millisecond
+	p.Timeout = time.Duration(s.API.Timeout) * time.Second
+	return p
+}
+
+// Transport is the layer under every backend call of one client: per-attempt timeout,
+// exponential backoff with full jitter, idempotency-aware retries, Retry-After
+// handling and a per-host circuit breaker. It also implements http.RoundTripper
+// for callers that stream bodies (update downloads, bandwidth test uploads)
+type Transport struct {
+	// Client sends the attempts; its Transport is the underlying round tripper.
+	// Timeouts are applied per attempt by Do, not through Client.Timeout
+	Client *http.Client
+
+	mu       sync.Mutex
+	policy   RetryPolicy
+	breakers map[string]*breaker
+}
+
+// NewTransport creates a transport with its own circuit breakers
+func NewTransport(policy RetryPolicy) *Transport {
+	return &Transport{
+		Client:   &http.Client{},
+		policy:   policy,
+		breakers: make(map[string]*breaker),
+	}
+}
+
+// Policy returns the current retry policy
+func (t *Transport) Policy() RetryPolicy {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.policy
+}
+
+// SetPolicy replaces the retry policy, e.g. after RETRY_COUNT, RETRY_INTERVAL or
+// TIMEOUT changed on a config reload; calls in flight keep the old policy
+func (t *Transport) SetPolicy(policy RetryPolicy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.policy = policy
+}
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey returns a context whose requests carry the Idempotency-Key
+// header, so that a POST is retried like an idempotent request and the backend
+// can drop duplicates of an attempt whose response was lost
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// idempotencyKey returns the key set by WithIdempotencyKey
+func idempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyCtx{}).(string)
+	return key
+}
+
+// Response is a fully read backend response
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Do sends the request built by newRequest, retrying transient failures.
+// newRequest is called for every attempt so that bodies and time-based auth
+// headers are fresh. Requests are retried on network errors and 502/503/504/429
+// when idempotent (GET, HEAD, PUT, DELETE, OPTIONS or carrying an Idempotency-Key
+// header); other requests are only retried when they provably never reached the
+// server (dial errors, 429 and 503). Non-2xx responses that are not retried are
+// returned without an error so callers can parse the body.
+func (t *Transport) Do(ctx context.Context, newRequest func(ctx context.Context) (*http.Request, error)) (*Response, error) {
+	policy := t.Policy()
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest(ctx)
+		if err != nil {
+			return nil, err
+		}
+		br := t.breaker(req.URL.Host)
+		if !br.allow() {
+			if lastErr != nil {
+				return nil, fmt.Errorf("%w (last error: %v)", ErrCircuitOpen, lastErr)
+			}
+			return nil, ErrCircuitOpen
+		}
+
+		resp, err := t.send(req, policy.Timeout)
+		retry, delay := classify(req, resp, err, attempt, policy)
+		br.record(ctx, err == nil && resp.StatusCode < 500, err, policy)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = errcode.Errorf(errcode.BackendUnreachable, "request failed: %w", err)
+		} else {
+			lastErr = nil
+		}
+		if !retry || attempt >= policy.MaxRetries {
+			if lastErr != nil {
+				return nil, lastErr
+			}
+			return resp, nil
+		}
+
+		if err != nil {
+			log.Printf("%s %s failed (attempt %d): %v, retrying in %v", req.Method, req.URL.Path, attempt+1, err, delay)
+		} else {
+			log.Printf("%s %s returned HTTP %d (attempt %d), retrying in %v", req.Method, req.URL.Path, resp.StatusCode, attempt+1, delay)
+			lastErr = errcode.Errorf(errcode.BackendError, "HTTP %d", resp.StatusCode)
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// RoundTrip implements http.RoundTripper for callers that read or write the body
+// as a stream: requests pass the same circuit breaker as Do and are retried like Do
+// until response headers arrive, as long as the body can be replayed (GetBody).
+// The body is left to the caller, so no per-attempt timeout applies
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	policy := t.Policy()
+	ctx := req.Context()
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	attemptReq := req
+	for attempt := 0; ; attempt++ {
+		br := t.breaker(req.URL.Host)
+		if !br.allow() {
+			return nil, ErrCircuitOpen
+		}
+
+		resp, err := t.roundTripper().RoundTrip(attemptReq)
+		var meta *Response
+		if err == nil {
+			meta = &Response{StatusCode: resp.StatusCode, Header: resp.Header}
+		}
+		retry, delay := classify(req, meta, err, attempt, policy)
+		br.record(ctx, err == nil && resp.StatusCode < 500, err, policy)
+		if !retry || !replayable || attempt >= policy.MaxRetries {
+			return resp, err
+		}
+
+		if err != nil {
+			log.Printf("%s %s failed (attempt %d): %v, retrying in %v", req.Method, req.URL.Path, attempt+1, err, delay)
+		} else {
+			log.Printf("%s %s returned HTTP %d (attempt %d), retrying in %v", req.Method, req.URL.Path, resp.StatusCode, attempt+1, delay)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+		attemptReq = req.Clone(ctx)
+		if req.GetBody != nil {
+			if attemptReq.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// roundTripper returns the round tripper under Client
+func (t *Transport) roundTripper() http.RoundTripper {
+	if t.Client.Transport != nil {
+		return t.Client.Transport
+	}
+	return http.DefaultTransport
+}
+
+// send performs a single attempt with the given timeout and reads the whole body
+func (t *Transport) send(req *http.Request, timeout time.Duration) (*Response, error) {
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
+}
+
+// classify decides whether an attempt should be retried and how long to wait
+func classify(req *http.Request, resp *Response, err error, attempt int, policy RetryPolicy) (bool, time.Duration) {
+	idempotent := isIdempotent(req)
+	delay := backoff(attempt, policy)
+
+	if err != nil {
+		if req.Context().Err() != nil {
+			return false, 0
+		}
+		return idempotent || isDialError(err), delay
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		if d, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			delay = min(d, policy.MaxDelay)
+		}
+		return true, delay
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent, delay
+	}
+	return false, 0
+}
+
+// backoff returns a random delay in [0, min(MaxDelay, BaseDelay*2^attempt)] (full jitter)
+func backoff(attempt int, policy RetryPolicy) time.Duration {
+	ceiling := policy.BaseDelay << min(attempt, 30)
+	if ceiling <= 0 || ceiling > policy.MaxDelay {
+		ceiling = policy.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+func (t *Transport) breaker(host string) *breaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.breakers[host]
+	if !ok {
+		b = &breaker{host: host}
+		t.breakers[host] = b
+	}
+	return b
+}
+
+// isIdempotent reports whether a request can safely be sent more than once
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// isDialError reports whether the request failed before a connection was made
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// breaker is a per-host circuit breaker: after threshold consecutive failures the
+// circuit opens and calls fail fast; after the cooldown one probe is let through
+// (half-open) and its result closes or re-opens the circuit
+type breaker struct {
+	host string
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record counts the outcome of an attempt. Attempts cancelled by the caller say
+// nothing about the backend, so they only end a half-open probe
+func (b *breaker) record(ctx context.Context, ok bool, err error, policy RetryPolicy) {
+	switch {
+	case err != nil && (ctx.Err() != nil || errors.Is(err, context.Canceled)):
+		b.release()
+	case ok:
+		b.success()
+	default:
+		b.failure(policy.BreakerThreshold, policy.BreakerCooldown)
+	}
+}
+
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.openUntil.IsZero() {
+		log.Printf("Circuit for %s closed", b.host)
+	}
+	b.failures = 0
+	b.openUntil = time.Time{}
+	b.probing = false
+}
+
+func (b *breaker) failure(threshold int, cooldown time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if threshold > 0 && (b.probing || b.failures >= threshold) {
+		if b.openUntil.IsZero() || b.probing {
+			log.Printf("Circuit for %s opened after %d consecutive failures", b.host, b.failures)
+		}
+		b.openUntil = time.Now().Add(cooldown)
+		b.probing = false
+	}
+}
@@ -0,0 +1,220 @@
+package api_client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"aro-ext-app/core/internal/errcode"
+)
+
+func testPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries:       3,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         50 * time.Millisecond,
+		Timeout:          time.Second,
+		BreakerThreshold: 100,
+		BreakerCooldown:  time.Minute,
+	}
+}
+
+func request(method, url string) func(ctx context.Context) (*http.Request, error) {
+	return func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, method, url, nil)
+	}
+}
+
+// flaky 前 failures 次返回 status，之后返回 200
+func flaky(failures int32, status int, header http.Header) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(`{"code":200}`))
+	}))
+	return srv, &calls
+}
+
+func TestTransportRetriesIdempotentRequests(t *testing.T) {
+	srv, calls := flaky(2, http.StatusBadGateway, nil)
+	defer srv.Close()
+
+	resp, err := NewTransport(testPolicy()).Do(context.Background(), request("GET", srv.URL))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("resp = %+v, err = %v", resp, err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestTransportDoesNotRetryNonIdempotentPost(t *testing.T) {
+	srv, calls := flaky(1, http.StatusBadGateway, nil)
+	defer srv.Close()
+
+	resp, err := NewTransport(testPolicy()).Do(context.Background(), request("POST", srv.URL))
+	if err != nil || resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("resp = %+v, err = %v", resp, err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected a single attempt, got %d", calls.Load())
+	}
+}
+
+func TestTransportRoundTrip(t *testing.T) {
+	srv, calls := flaky(2, http.StatusBadGateway, nil)
+	defer srv.Close()
+
+	// 经过 RoundTrip 的流式请求同样重试，响应体交给调用方读取
+	tr := NewTransport(testPolicy())
+	resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("resp = %+v, err = %v", resp, err)
+	}
+	resp.Body.Close()
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls.Load())
+	}
+
+	// 重新加载配置后使用新的策略
+	policy := testPolicy()
+	policy.MaxRetries = 0
+	tr.SetPolicy(policy)
+	srv2, calls2 := flaky(1, http.StatusBadGateway, nil)
+	defer srv2.Close()
+	resp, err = (&http.Client{Transport: tr}).Get(srv2.URL)
+	if err != nil || resp.StatusCode != http.StatusBadGateway || calls2.Load() != 1 {
+		t.Fatalf("expected a single attempt after SetPolicy, got %d, resp = %+v, err = %v", calls2.Load(), resp, err)
+	}
+	resp.Body.Close()
+}
+
+func TestTransportRetriesPostWithIdempotencyKey(t *testing.T) {
+	srv, calls := flaky(1, http.StatusBadGateway, nil)
+	defer srv.Close()
+
+	ctx := WithIdempotencyKey(context.Background(), "key-1")
+	resp, err := NewTransport(testPolicy()).Do(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", srv.URL, nil)
+		if err == nil {
+			req.Header.Set("Idempotency-Key", idempotencyKey(ctx))
+		}
+		return req, err
+	})
+	if err != nil || resp.StatusCode != http.StatusOK || calls.Load() != 2 {
+		t.Fatalf("expected the POST to be retried, got %d attempts, resp = %+v, err = %v", calls.Load(), resp, err)
+	}
+}
+
+func TestTransportHonoursRetryAfter(t *testing.T) {
+	srv, calls := flaky(1, http.StatusServiceUnavailable, http.Header{"Retry-After": {"0"}})
+	defer srv.Close()
+
+	resp, err := NewTransport(testPolicy()).Do(context.Background(), request("POST", srv.URL))
+	if err != nil || resp.StatusCode != http.StatusOK || calls.Load() != 2 {
+		t.Fatalf("resp = %+v, err = %v, calls = %d", resp, err, calls.Load())
+	}
+	if d, ok := retryAfter("120"); !ok || d != 2*time.Minute {
+		t.Errorf("retryAfter(120) = %v, %v", d, ok)
+	}
+}
+
+func TestTransportCircuitBreaker(t *testing.T) {
+	srv, calls := flaky(1000, http.StatusInternalServerError, nil)
+	defer srv.Close()
+
+	policy := testPolicy()
+	policy.MaxRetries = 0
+	policy.BreakerThreshold = 2
+	tr := NewTransport(policy)
+	for i := 0; i < 2; i++ {
+		if _, err := tr.Do(context.Background(), request("GET", srv.URL)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tr.Do(context.Background(), request("GET", srv.URL)); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected open circuit, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected the open circuit to fail fast, server saw %d calls", calls.Load())
+	}
+}
+
+// TestCancelledRequestsKeepCircuitClosed 调用方取消的请求不说明后端不可用，不计入熔断
+func TestCancelledRequestsKeepCircuitClosed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte(`{"code":200}`))
+	}))
+	defer srv.Close()
+
+	policy := testPolicy()
+	policy.MaxRetries = 0
+	policy.BreakerThreshold = 1
+	tr := NewTransport(policy)
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		if _, err := tr.Do(ctx, request("GET", srv.URL+"/slow")); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context canceled, got %v", err)
+		}
+		ctx, cancel = context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/slow", nil)
+		if _, err := tr.RoundTrip(req); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context canceled from RoundTrip, got %v", err)
+		}
+	}
+	if _, err := tr.Do(context.Background(), request("GET", srv.URL)); err != nil {
+		t.Fatalf("expected cancelled requests not to open the circuit, got %v", err)
+	}
+}
+
+func TestTransportStopsOnContextCancel(t *testing.T) {
+	srv, _ := flaky(1000, http.StatusServiceUnavailable, http.Header{"Retry-After": {"10"}})
+	defer srv.Close()
+
+	policy := testPolicy()
+	policy.MaxDelay = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := NewTransport(policy).Do(ctx, request("GET", srv.URL)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("expected cancellation to interrupt the Retry-After wait")
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("connection refused"), true},
+		{ErrCircuitOpen, true},
+		{errcode.Errorf(errcode.BackendError, "%w", &ResponseError{StatusCode: 503}), true},
+		{errcode.Errorf(errcode.BackendError, "%w", &ResponseError{StatusCode: 200, Code: 429}), true},
+		{errcode.Errorf(errcode.BackendError, "%w", &ResponseError{StatusCode: 400, Code: 400}), false},
+		{errcode.Errorf(errcode.BackendError, "%w", &ResponseError{StatusCode: 200, Code: 4001}), false},
+		{errcode.Errorf(errcode.AuthFailed, "%w", &ResponseError{StatusCode: 401, Code: 401}), false},
+	} {
+		if got := Retryable(tc.err); got != tc.want {
+			t.Errorf("Retryable(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
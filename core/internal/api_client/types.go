@@ -1,5 +1,12 @@
 package api_client
 
+import (
+	"aro-ext-app/core/internal/storage"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
 // APIResponse Standard response structure (compatible with aro-ext-ui design)
 // Uses interface{} instead of generics for c-shared compatibility
 type APIResponse struct {
@@ -9,10 +16,32 @@ type APIResponse struct {
 }
 
 // APIResponseWith Generic version of APIResponse to support typed data
+// Responses decoded from the backend keep the raw data and marshal it back
+// unchanged, so fields the typed struct does not know about still reach Flutter
 type APIResponseWith[T any] struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
 	Data    T      `json:"data"`
+
+	raw json.RawMessage
+}
+
+// MarshalJSON emits the backend's original data when available
+func (r APIResponseWith[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(APIResponse{Code: r.Code, Message: r.Message, Data: r.RawData()})
+}
+
+// RawData returns the backend's original data when available, otherwise Data
+func (r APIResponseWith[T]) RawData() interface{} {
+	if r.raw != nil {
+		return r.raw
+	}
+	return r.Data
+}
+
+// validator is implemented by response data that checks its required fields
+type validator interface {
+	Validate() error
 }
 
 // ======================
@@ -21,10 +50,21 @@ type APIResponseWith[T any] struct {
 
 // NodeSignUpRequest Node registration request body (mimics aro-ext-ui /api/liteNode/signUp)
 type NodeSignUpRequest struct {
-	ClientID  string `json:"clientId"`  // Node ID
-	PublicKey string `json:"publicKey"` // RSA public key (base64 encoded)
-	Signature string `json:"signature"` // Signature
-	Timestamp int64  `json:"timestamp"` // Timestamp
+	ClientID  string `json:"clientId"`          // Node ID
+	PublicKey string `json:"publicKey"`         // Public key (PKIX PEM, base64 encoded)
+	KeyType   string `json:"keyType,omitempty"` // Key algorithm, empty for RSA
+	Signature string `json:"signature"`         // Signature
+	Timestamp int64  `json:"timestamp"`         // Timestamp
+}
+
+// NodeRotateKeyRequest Key rotation request body. The request itself is signed with the
+// current key; both signatures cover KeyRotationMessage to prove possession of both keys
+type NodeRotateKeyRequest struct {
+	ClientID     string `json:"clientId"`     // Node ID
+	NewPublicKey string `json:"newPublicKey"` // New public key (PKIX PEM format, base64 encoded)
+	Timestamp    int64  `json:"timestamp"`    // Unix seconds, part of the signed message
+	OldSignature string `json:"oldSignature"` // Current key's signature of KeyRotationMessage
+	NewSignature string `json:"newSignature"` // New key's signature of KeyRotationMessage
 }
 
 // NodeReportBaseInfoRequest System information report request
@@ -36,6 +76,77 @@ type NodeReportBaseInfoRequest struct {
 	SysCPU      int    `json:"sysCpu"`      // CPU cores
 	TimeZone    string `json:"timeZone"`    // Timezone
 	NodeID      string `json:"nodeId"`      // Node ID
+
+	// Fields below are collected by the core (see sysinfo) and omitted when unknown
+	OSName         string   `json:"osName,omitempty"`         // OS distribution or product name
+	OSVersion      string   `json:"osVersion,omitempty"`      // Kernel or OS version
+	Arch           string   `json:"arch,omitempty"`           // CPU architecture (GOARCH)
+	CPUModel       string   `json:"cpuModel,omitempty"`       // CPU model name
+	MemoryTotal    uint64   `json:"memoryTotal,omitempty"`    // Total memory in bytes
+	DiskTotal      uint64   `json:"diskTotal,omitempty"`      // Data disk size in bytes
+	DiskFree       uint64   `json:"diskFree,omitempty"`       // Data disk free space in bytes
+	TimeZoneName   string   `json:"timeZoneName,omitempty"`   // IANA time zone name
+	Locale         string   `json:"locale,omitempty"`         // BCP 47 locale, e.g. en-US
+	NetworkTypes   []string `json:"networkTypes,omitempty"`   // Active interface types (ethernet, wifi, cellular...)
+	Container      string   `json:"container,omitempty"`      // Container runtime, empty on bare metal
+	Virtualization string   `json:"virtualization,omitempty"` // Hypervisor, empty on physical hardware
+	CoreVersion    string   `json:"coreVersion,omitempty"`    // Version of this core library
+}
+
+// Heartbeat One liveness sample. Timestamp is when the sample was taken, so beats
+// buffered while offline are replayed with their original time
+type Heartbeat struct {
+	ID            string `json:"id"`                    // Unique per beat; the backend stores a beat resent after a lost response only once
+	Timestamp     int64  `json:"timestamp"`             // Sample time (unix milliseconds)
+	Uptime        int64  `json:"uptime"`                // Seconds since the node started
+	WorkerRunning bool   `json:"workerRunning"`         // Whether the proxy worker is running
+	WorkerUptime  int64  `json:"workerUptime"`          // Seconds since the proxy worker started, 0 when stopped
+	TunnelState   string `json:"tunnelState,omitempty"` // connecting, connected or disconnected
+	PublicIP      string `json:"publicIp,omitempty"`    // Public IP seen by STUN
+	NatType       string `json:"natType,omitempty"`     // NAT type detected by STUN
+	TotalConns    uint64 `json:"totalConns"`            // Proxy connections since the worker started
+	CurrentConns  uint64 `json:"currentConns"`          // Open proxy connections
+	InputBytes    uint64 `json:"inputBytes"`            // Proxy bytes received since the worker started
+	OutputBytes   uint64 `json:"outputBytes"`           // Proxy bytes sent since the worker started
+	CoreVersion   string `json:"coreVersion,omitempty"` // Version of this core library
+	ClockOffset   int64  `json:"clockOffset"`           // Server time minus local clock (milliseconds), already applied to Timestamp
+	HardwareID    string `json:"hardwareId,omitempty"`  // Hash of the machine identity, differs when the node identity is copied to another device
+}
+
+// NodeHeartbeatRequest Heartbeat request body, beats are ordered oldest first
+type NodeHeartbeatRequest struct {
+	NodeID string      `json:"nodeId"`
+	Beats  []Heartbeat `json:"beats"`
+}
+
+// HeartbeatData Data of /api/liteNode/node/heartbeat
+type HeartbeatData struct {
+	Accepted int `json:"accepted"` // Number of beats stored by the backend
+	// Interval heartbeat interval in seconds requested by the backend scheduler, 0 keeps the current one
+	Interval int `json:"interval"`
+	// CloneSuspected the backend has seen this client ID with more than one hardware ID
+	CloneSuspected bool `json:"cloneSuspected"`
+}
+
+// Validate checks the requested interval
+func (d HeartbeatData) Validate() error {
+	if d.Interval < 0 {
+		return fmt.Errorf("invalid heartbeat interval %d", d.Interval)
+	}
+	return nil
+}
+
+// ServerTimeData Data of /api/liteNode/time
+type ServerTimeData struct {
+	Timestamp int64 `json:"timestamp"` // Server time in Unix milliseconds
+}
+
+// Validate checks that the server returned a time
+func (d ServerTimeData) Validate() error {
+	if d.Timestamp <= 0 {
+		return fmt.Errorf("invalid server time %d", d.Timestamp)
+	}
+	return nil
 }
 
 type LastVersionData struct {
@@ -43,5 +154,118 @@ type LastVersionData struct {
 	URL          string `json:"url"`
 	ReleaseNotes string `json:"releaseNotes"`
 	Checksum     string `json:"checksum"`
+	Signature    string `json:"signature"`
+	// MinVersion minimum supported version, older nodes must update
+	MinVersion string `json:"minVersion"`
+	// RolloutPercent staged rollout percentage (0-100), nil means full rollout
+	RolloutPercent *int `json:"rolloutPercent"`
 }
 
+// Validate checks that a published release can be downloaded
+func (d LastVersionData) Validate() error {
+	if d.Version != "" && d.URL == "" {
+		return fmt.Errorf("release %s has no download url", d.Version)
+	}
+	if d.RolloutPercent != nil && (*d.RolloutPercent < 0 || *d.RolloutPercent > 100) {
+		return fmt.Errorf("invalid rollout percentage %d", *d.RolloutPercent)
+	}
+	return nil
+}
+
+// SignUpData Data of /api/liteNode/signUp
+type SignUpData struct {
+	SerialNumber string `json:"serialNumber"` // Serial number assigned to this node
+	// KeyTypes lists the accepted key types when the backend rejects the node's key type
+	KeyTypes []string `json:"keyTypes,omitempty"`
+}
+
+// Validate checks the serial number is present
+func (d SignUpData) Validate() error {
+	if d.SerialNumber == "" {
+		return fmt.Errorf("missing serialNumber")
+	}
+	return nil
+}
+
+// RotateKeyData Data of /api/liteNode/node/rotateKey
+type RotateKeyData struct {
+	// GracePeriod seconds during which the backend still accepts the old key
+	GracePeriod int64 `json:"gracePeriod"`
+}
+
+// Validate checks the grace period
+func (d RotateKeyData) Validate() error {
+	if d.GracePeriod < 0 {
+		return fmt.Errorf("invalid grace period %d", d.GracePeriod)
+	}
+	return nil
+}
+
+// ReportBaseInfoData Data of /api/liteNode/node/reportBaseInfo; the backend returns no data
+type ReportBaseInfoData struct{}
+
+// ReportCrashData Data of /api/liteNode/node/reportCrash; the backend returns no data
+type ReportCrashData struct{}
+
+// PresenceData Data of /api/liteNode/node/presence
+type PresenceData struct {
+	// LastSeen is when the backend last received a heartbeat (unix milliseconds), 0 if never
+	LastSeen int64 `json:"lastSeen"`
+	// HardwareID is the hardware id reported in that heartbeat
+	HardwareID string `json:"hardwareId,omitempty"`
+}
+
+// NodeStatData Data of /api/liteNode/stat
+type NodeStatData struct {
+	SerialNumber string            `json:"serialNumber"` // Serial number of this node
+	Bind         bool              `json:"bind"`         // Whether the node is bound to a user
+	BindUser     *storage.BindUser `json:"bindUser"`     // Bound user, nil when not bound
+}
+
+// Validate checks the serial number is present
+func (d NodeStatData) Validate() error {
+	if d.SerialNumber == "" {
+		return fmt.Errorf("missing serialNumber")
+	}
+	return nil
+}
+
+// RewardsData Data of /api/liteNode/rewards
+type RewardsData struct {
+	LastNetworkPoints Number          `json:"lastNetworkPoints"` // Points from last cycle
+	TotalRewards      Number          `json:"totalRewards"`      // Total accumulated rewards
+	WeeklyRewards     json.RawMessage `json:"weeklyRewards"`     // 7-day reward breakdown
+	RewardInfo        json.RawMessage `json:"rewardInfo"`        // Detailed reward information
+}
+
+// Validate rejects negative reward totals
+func (d RewardsData) Validate() error {
+	if d.LastNetworkPoints < 0 || d.TotalRewards < 0 {
+		return fmt.Errorf("negative rewards")
+	}
+	return nil
+}
+
+// Number A numeric field the backend may send either as a JSON number or as a numeric string
+type Number float64
+
+// UnmarshalJSON accepts 12.5, "12.5" and null
+func (n *Number) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		if s == "" {
+			*n = 0
+			return nil
+		}
+		data = []byte(s)
+	}
+	f, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %s", data)
+	}
+	*n = Number(f)
+	return nil
+}
@@ -0,0 +1,65 @@
+package api_client
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"aro-ext-app/core/internal/errcode"
+	"aro-ext-app/core/internal/events"
+)
+
+func TestDecodeTypedKeepsUnknownFields(t *testing.T) {
+	body := `{"code":200,"message":"ok","data":{"lastNetworkPoints":"12.5","totalRewards":30,"weeklyRewards":[1,2],"extra":"kept"}}`
+	resp, err := decodeTyped[RewardsData](events.NewBus(16), "/rewards", []byte(body), 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.LastNetworkPoints != 12.5 || resp.Data.TotalRewards != 30 {
+		t.Errorf("unexpected rewards: %+v", resp.Data)
+	}
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var round struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(out, &round); err != nil {
+		t.Fatal(err)
+	}
+	if round.Data["extra"] != "kept" {
+		t.Errorf("expected unknown field to survive marshalling, got %s", out)
+	}
+}
+
+func TestDecodeTypedValidates(t *testing.T) {
+	cases := map[string]string{
+		"missing serial": `{"code":200,"data":{"bind":false}}`,
+		"wrong type":     `{"code":200,"data":{"serialNumber":42}}`,
+	}
+	for name, body := range cases {
+		_, err := decodeTyped[NodeStatData](events.NewBus(16), "/stat", []byte(body), 200)
+		if errcode.Of(err) != errcode.BackendError {
+			t.Errorf("%s: expected BACKEND_ERROR, got %v", name, err)
+		}
+	}
+
+	_, err := decodeTyped[LastVersionData](events.NewBus(16), "/ota", []byte(`{"code":200,"data":{"version":"1.0.0"}}`), 200)
+	if errcode.Of(err) != errcode.BackendError {
+		t.Errorf("expected release without url to be rejected, got %v", err)
+	}
+}
+
+func TestDecodeTypedBusinessError(t *testing.T) {
+	bus := events.NewBus(16)
+	resp, err := decodeTyped[SignUpData](bus, "/signUp", []byte(`{"code":401,"message":"denied"}`), 200)
+	var coded *errcode.Error
+	if !errors.As(err, &coded) || coded.Code != errcode.AuthFailed {
+		t.Fatalf("expected AUTH_FAILED, got %v", err)
+	}
+	if resp == nil || resp.Code != 401 {
+		t.Errorf("expected the envelope to be returned with the error, got %+v", resp)
+	}
+}
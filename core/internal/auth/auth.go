@@ -1,13 +1,11 @@
 package auth
 
 import (
-	"crypto"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/sha256"
-	"encoding/base64"
 	"fmt"
 	"time"
+
+	"aro-ext-app/core/internal/clock"
+	"aro-ext-app/core/internal/crypto"
 )
 
 // AuthCredentials 认证凭证
@@ -18,16 +16,22 @@ type AuthCredentials struct {
 	Token     string
 }
 
-// NewAuthCredentials 创建新认证凭证，使用 RSA 私钥签名
-func NewAuthCredentials(clientID string, privateKey *rsa.PrivateKey) *AuthCredentials {
-	timestamp := time.Now().UTC().Unix()
+// NewAuthCredentials 创建新认证凭证，使用节点私钥签名（v1，只签名 clientID:timestamp）
+// 时间戳取自校正了时钟偏差的全局时钟（见 clock 包），持有节点自己的时钟时使用 NewAuthCredentialsAt
+// HTTP 请求应使用 Signer，同时携带 v2 签名
+func NewAuthCredentials(clientID string, privateKey crypto.PrivateKey) *AuthCredentials {
+	return NewAuthCredentialsAt(clientID, privateKey, clock.GetClock().Now())
+}
+
+// NewAuthCredentialsAt 创建时间戳为 now 的认证凭证，now 应为校正后的时间（如 APIClient.Now）
+func NewAuthCredentialsAt(clientID string, privateKey crypto.PrivateKey, now time.Time) *AuthCredentials {
+	timestamp := now.UTC().Unix()
 
-	// 使用 RSA 私钥生成签名
-	signature := GenerateRSASignature(clientID, timestamp, privateKey)
+	// 使用节点私钥生成签名
+	signature := GenerateSignature(clientID, timestamp, privateKey)
 
 	// 生成 Bearer Token
-	auth := fmt.Sprintf("aro:%s:%d:%s", clientID, timestamp, signature)
-	token := base64.StdEncoding.EncodeToString([]byte(auth))
+	token := EncodeToken(clientID, timestamp, signature, crypto.KeyTypeOf(privateKey))
 
 	return &AuthCredentials{
 		ClientID:  clientID,
@@ -37,22 +41,17 @@ func NewAuthCredentials(clientID string, privateKey *rsa.PrivateKey) *AuthCreden
 	}
 }
 
-// generateRSASignature 使用 RSA 私钥生成数字签名
-func GenerateRSASignature(clientID string, timestamp int64, privateKey *rsa.PrivateKey) string {
+// GenerateSignature 使用节点私钥签名 clientID:timestamp，签名算法由私钥类型决定
+func GenerateSignature(clientID string, timestamp int64, privateKey crypto.PrivateKey) string {
 	// 要签名的数据
 	data := fmt.Sprintf("%s:%d", clientID, timestamp)
 
-	// 计算 SHA256 哈希
-	hash := sha256.Sum256([]byte(data))
-
-	// 使用 RSA 私钥对哈希进行签名
-	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hash[:])
+	// 返回 base64 编码的签名
+	signature, err := crypto.SignMessage(privateKey, data)
 	if err != nil {
 		return "" // 在实际应用中应该处理错误
 	}
-
-	// 返回 base64 编码的签名
-	return base64.StdEncoding.EncodeToString(signature)
+	return signature
 }
 
 // GetAuthHeader 获取授权头
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"aro-ext-app/core/internal/crypto"
+)
+
+func newKey(t *testing.T, keyType crypto.KeyType) *crypto.KeyPair {
+	t.Helper()
+	keyPair, err := crypto.GenerateKeyPair(keyType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyPair
+}
+
+func signedRequest(t *testing.T, key crypto.PrivateKey, method, url string, body []byte) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewSigner("client-1", key).Sign(req, body); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for _, keyType := range crypto.KeyTypes {
+		t.Run(string(keyType), func(t *testing.T) { testSignAndVerify(t, keyType) })
+	}
+}
+
+func testSignAndVerify(t *testing.T, keyType crypto.KeyType) {
+	keyPair := newKey(t, keyType)
+	key := keyPair.PrivateKey
+	lookup := func(clientID string) (crypto.PublicKey, error) {
+		if clientID != "client-1" {
+			return nil, fmt.Errorf("unknown client %s", clientID)
+		}
+		return keyPair.PublicKey, nil
+	}
+	body := []byte(`{"a":1}`)
+
+	v := NewVerifier(DefaultMaxSkew)
+	req := signedRequest(t, key, http.MethodPost, "https://example.com/api/x?y=1", body)
+	got, err := v.Verify(req, body, lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ClientID != "client-1" || got.Version != SchemeV2 || got.Nonce == "" {
+		t.Errorf("unexpected result %+v", got)
+	}
+	if _, err := v.Verify(req, body, lookup); err == nil || !strings.Contains(err.Error(), "replayed") {
+		t.Errorf("expected replay to be rejected, got %v", err)
+	}
+
+	tampered := []struct {
+		name   string
+		mutate func(r *http.Request) []byte
+	}{
+		{"body", func(r *http.Request) []byte { return []byte(`{"a":2}`) }},
+		{"body hash", func(r *http.Request) []byte {
+			r.Header.Set(HeaderContentSHA256, BodyHash([]byte(`{"a":2}`)))
+			return []byte(`{"a":2}`)
+		}},
+		{"path", func(r *http.Request) []byte { r.URL.Path = "/api/other"; return body }},
+		{"query", func(r *http.Request) []byte { r.URL.RawQuery = "y=2"; return body }},
+		{"method", func(r *http.Request) []byte { r.Method = http.MethodPut; return body }},
+		{"nonce", func(r *http.Request) []byte { r.Header.Set(HeaderNonce, "00"); return body }},
+		{"version", func(r *http.Request) []byte { r.Header.Set(HeaderAuthVersion, "3"); return body }},
+	}
+	for _, tc := range tampered {
+		req := signedRequest(t, key, http.MethodPost, "https://example.com/api/x?y=1", body)
+		b := tc.mutate(req)
+		if _, err := v.Verify(req, b, lookup); err == nil {
+			t.Errorf("expected tampered %s to be rejected", tc.name)
+		}
+	}
+
+	// 签名失败的请求不占用 nonce
+	req = signedRequest(t, key, http.MethodPost, "https://example.com/api/x", body)
+	if _, err := v.Verify(req, []byte("other"), lookup); err == nil {
+		t.Fatal("expected body mismatch")
+	}
+	if _, err := v.Verify(req, body, lookup); err != nil {
+		t.Errorf("expected the original request to verify, got %v", err)
+	}
+}
+
+func TestTokenKeyType(t *testing.T) {
+	rsaKey := newKey(t, crypto.KeyTypeRSA)
+	edKey := newKey(t, crypto.KeyTypeEd25519)
+
+	// RSA 令牌保持旧格式，未升级的后端仍能解析
+	creds := NewAuthCredentials("client-1", rsaKey.PrivateKey)
+	token, err := ParseToken(creds.GetAuthHeader())
+	if err != nil || token.KeyType != crypto.KeyTypeRSA || strings.Count(decodeToken(t, creds.Token), ":") != 3 {
+		t.Errorf("expected a legacy RSA token, got %+v, %v", token, err)
+	}
+	token, err = ParseToken(NewAuthCredentials("client-1", edKey.PrivateKey).GetAuthHeader())
+	if err != nil || token.KeyType != crypto.KeyTypeEd25519 {
+		t.Errorf("expected an ed25519 token, got %+v, %v", token, err)
+	}
+
+	// 令牌声明的算法与注册的公钥不一致时拒绝
+	v := NewVerifier(DefaultMaxSkew)
+	req := signedRequest(t, edKey.PrivateKey, http.MethodGet, "https://example.com/api/x", nil)
+	lookup := func(string) (crypto.PublicKey, error) { return rsaKey.PublicKey, nil }
+	if _, err := v.Verify(req, nil, lookup); err == nil || !strings.Contains(err.Error(), "key type") {
+		t.Errorf("expected a key type mismatch, got %v", err)
+	}
+}
+
+func decodeToken(t *testing.T, token string) string {
+	t.Helper()
+	raw, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(raw)
+}
+
+func TestVerifyV1AndSkew(t *testing.T) {
+	keyPair := newKey(t, crypto.KeyTypeRSA)
+	key := keyPair.PrivateKey
+	lookup := func(string) (crypto.PublicKey, error) { return keyPair.PublicKey, nil }
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/api/x", nil)
+	req.Header.Set("Authorization", NewAuthCredentials("client-1", key).GetAuthHeader())
+	v := NewVerifier(DefaultMaxSkew)
+	if got, err := v.Verify(req, nil, lookup); err != nil || got.Version != SchemeV1 {
+		t.Errorf("expected v1 token to be accepted, got %+v, %v", got, err)
+	}
+	v.RequireV2 = true
+	if _, err := v.Verify(req, nil, lookup); err == nil {
+		t.Error("expected v1 token to be rejected when v2 is required")
+	}
+
+	signer := NewSigner("client-1", key)
+	signer.Now = func() time.Time { return time.Now().Add(-time.Hour) }
+	req, _ = http.NewRequest(http.MethodGet, "https://example.com/api/x", nil)
+	if err := signer.Sign(req, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(req, nil, lookup); err == nil || !strings.Contains(err.Error(), "skew") {
+		t.Errorf("expected skewed timestamp to be rejected, got %v", err)
+	}
+	v.MaxSkew = 2 * time.Hour
+	if _, err := v.Verify(req, nil, lookup); err != nil {
+		t.Errorf("expected timestamp within the window to verify, got %v", err)
+	}
+}
+
+func TestDowngradeAfterV2(t *testing.T) {
+	keyPair := newKey(t, crypto.KeyTypeEd25519)
+	key := keyPair.PrivateKey
+	lookup := func(string) (crypto.PublicKey, error) { return keyPair.PublicKey, nil }
+	v1Request := func() *http.Request {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com/api/x", nil)
+		req.Header.Set("Authorization", NewAuthCredentials("client-1", key).GetAuthHeader())
+		return req
+	}
+
+	v := NewVerifier(DefaultMaxSkew)
+	if _, err := v.Verify(v1Request(), nil, lookup); err != nil {
+		t.Fatalf("expected v1 to be accepted before the client used v2, got %v", err)
+	}
+	if _, err := v.Verify(signedRequest(t, key, http.MethodGet, "https://example.com/api/x", nil), nil, lookup); err != nil {
+		t.Fatal(err)
+	}
+	// 去掉 v2 头降级为 v1 的请求被拒绝，另一个共享 Pins 的校验器也拒绝
+	downgraded := signedRequest(t, key, http.MethodGet, "https://example.com/api/x", nil)
+	downgraded.Header.Del(HeaderAuthVersion)
+	if _, err := v.Verify(downgraded, nil, lookup); err == nil || !strings.Contains(err.Error(), "switched") {
+		t.Errorf("expected a downgraded request to be rejected, got %v", err)
+	}
+	other := &Verifier{MaxSkew: DefaultMaxSkew, Pins: v.Pins}
+	if _, err := other.Verify(v1Request(), nil, lookup); err == nil {
+		t.Error("expected v1 to be rejected after the client used v2")
+	}
+
+	// V2Only 时令牌中不再携带 v1 签名
+	signer := NewSigner("client-2", key)
+	signer.V2Only = true
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/api/x", nil)
+	if err := signer.Sign(req, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewVerifier(DefaultMaxSkew).Verify(req, nil, lookup); err != nil {
+		t.Errorf("expected a v2-only request to verify, got %v", err)
+	}
+	req.Header.Del(HeaderAuthVersion)
+	if _, err := NewVerifier(DefaultMaxSkew).Verify(req, nil, lookup); err == nil {
+		t.Error("expected the token of a v2-only request not to verify as v1")
+	}
+}
+
+func TestNonceCacheExpires(t *testing.T) {
+	var c NonceCache
+	now := time.Now()
+	if !c.use("a", now.Add(time.Second), now) || c.use("a", now.Add(time.Second), now) {
+		t.Fatal("expected the nonce to be usable once")
+	}
+	// 两次清理之间过期的 nonce 也按未使用处理
+	if !c.use("a", now.Add(time.Minute), now.Add(2*time.Second)) {
+		t.Error("expected an expired nonce to be usable again")
+	}
+}
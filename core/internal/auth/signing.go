@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"aro-ext-app/core/internal/crypto"
+)
+
+// 签名方案版本
+//
+// v1 只签名 clientID:timestamp，令牌被截获后可以在时间窗口内用于任意接口和请求体；
+// v2 额外签名请求方法、路径、请求体摘要和随机 nonce，服务端拒绝重复的 nonce。
+// 迁移期间 v2 请求同时携带 v1 格式的 Bearer 令牌，未升级的后端仍按 v1 校验，
+// 升级后的后端根据 HeaderAuthVersion 选择校验方式，并在响应中返回 HeaderAuthVersion: 2；
+// 客户端收到后设置 Signer.V2Only，不再发送 v1 签名，后端也拒绝已使用过 v2 的客户端的 v1 请求（见 SchemePins）
+const (
+	SchemeV1 = 1
+	SchemeV2 = 2
+)
+
+// v2 请求头
+const (
+	HeaderAuthVersion   = "X-Aro-Auth-Version"
+	HeaderNonce         = "X-Aro-Nonce"
+	HeaderContentSHA256 = "X-Aro-Content-SHA256"
+	HeaderSignature     = "X-Aro-Signature"
+)
+
+// signatureAlgorithmsV2 v2 待签名字符串的第一行，随节点密钥的算法变化，
+// 同一签名不能被当作另一种算法的签名校验
+var signatureAlgorithmsV2 = map[crypto.KeyType]string{
+	crypto.KeyTypeRSA:     "ARO2-RSA-SHA256",
+	crypto.KeyTypeEd25519: "ARO2-ED25519",
+	crypto.KeyTypeECDSA:   "ARO2-ECDSA-P256-SHA256",
+}
+
+// Signer 为请求添加 v2 签名
+type Signer struct {
+	ClientID   string
+	PrivateKey crypto.PrivateKey
+	// Now 签名时间，为空时使用 time.Now
+	Now func() time.Time
+	// V2Only 后端已确认支持 v2 时为 true：Bearer 令牌中的签名换成 v2 签名，
+	// 不再携带只签名 clientID:timestamp、截获后可用于任意请求的 v1 签名
+	V2Only bool
+}
+
+// NewSigner 创建 v2 请求签名器
+func NewSigner(clientID string, privateKey crypto.PrivateKey) *Signer {
+	return &Signer{ClientID: clientID, PrivateKey: privateKey}
+}
+
+// Sign 为请求设置 Authorization（v1 兼容令牌，V2Only 时只用于携带 clientID 和时间戳）和 v2 签名头，body 为请求体（可为空）
+// 每次调用生成新的 nonce，重试的请求必须重新签名
+func (s *Signer) Sign(req *http.Request, body []byte) error {
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	timestamp := now().UTC().Unix()
+	nonce, err := NewNonce()
+	if err != nil {
+		return err
+	}
+	bodyHash := BodyHash(body)
+
+	keyType := crypto.KeyTypeOf(s.PrivateKey)
+	signature, err := crypto.SignMessage(s.PrivateKey, CanonicalRequest(keyType, s.ClientID, timestamp, nonce, req.Method, req.URL.RequestURI(), bodyHash))
+	if err != nil {
+		return fmt.Errorf("failed to sign request: %w", err)
+	}
+	legacy := signature
+	if !s.V2Only {
+		if legacy = GenerateSignature(s.ClientID, timestamp, s.PrivateKey); legacy == "" {
+			return fmt.Errorf("failed to sign request")
+		}
+	}
+
+	req.Header.Set("Authorization", "Bearer "+EncodeToken(s.ClientID, timestamp, legacy, keyType))
+	req.Header.Set(HeaderAuthVersion, fmt.Sprint(SchemeV2))
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderContentSHA256, bodyHash)
+	req.Header.Set(HeaderSignature, signature)
+	return nil
+}
+
+// CanonicalRequest 返回 v2 待签名字符串，各字段以换行分隔：
+// 算法、clientID、timestamp、nonce、大写的请求方法、请求 URI（路径和查询串）、请求体 SHA256（十六进制）
+func CanonicalRequest(keyType crypto.KeyType, clientID string, timestamp int64, nonce, method, requestURI, bodyHash string) string {
+	return strings.Join([]string{
+		signatureAlgorithmsV2[keyType],
+		clientID,
+		fmt.Sprint(timestamp),
+		nonce,
+		strings.ToUpper(method),
+		requestURI,
+		bodyHash,
+	}, "\n")
+}
+
+// BodyHash 返回请求体的 SHA256（十六进制），空请求体也有固定的摘要
+func BodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewNonce 生成 128 位随机 nonce（十六进制）
+func NewNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// EncodeToken 生成 Bearer 令牌 base64("aro:clientID:timestamp:signature[:keyType]")
+// RSA 令牌不带算法，与旧版本的格式相同，未升级的后端可以继续校验 RSA 节点
+func EncodeToken(clientID string, timestamp int64, signature string, keyType crypto.KeyType) string {
+	token := fmt.Sprintf("aro:%s:%d:%s", clientID, timestamp, signature)
+	if keyType != "" && keyType != crypto.KeyTypeRSA {
+		token += ":" + string(keyType)
+	}
+	return base64.StdEncoding.EncodeToString([]byte(token))
+}
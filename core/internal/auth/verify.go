@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"aro-ext-app/core/internal/crypto"
+)
+
+// DefaultMaxSkew 默认允许的签名时间戳偏差
+const DefaultMaxSkew = 5 * time.Minute
+
+// KeyLookup 根据 clientID 返回节点公钥
+type KeyLookup func(clientID string) (crypto.PublicKey, error)
+
+// Verified 校验通过的请求信息
+type Verified struct {
+	ClientID  string
+	Timestamp int64
+	Version   int
+	Nonce     string // v1 请求为空
+}
+
+// Verifier 服务端校验 v1/v2 签名，供模拟后端和测试使用，与后端的校验规则一致
+type Verifier struct {
+	// MaxSkew 时间戳与服务端时间的最大偏差，0 表示不检查
+	MaxSkew time.Duration
+	// Now 服务端时钟，为空时使用 time.Now
+	Now func() time.Time
+	// RequireV2 拒绝 v1 请求，后端完成迁移后开启
+	RequireV2 bool
+	// Nonces 已使用的 v2 nonce，为空时不检查重放
+	Nonces *NonceCache
+	// Pins 已使用 v2 的客户端，为空时不防止降级
+	Pins *SchemePins
+}
+
+// nonceSweepInterval NonceCache 清理过期 nonce 的间隔
+const nonceSweepInterval = time.Minute
+
+// NonceCache 记录时间窗口内已使用的 nonce，可在多个 Verifier 之间共享
+// 过期的 nonce 每隔 nonceSweepInterval 集中清理一次，不在每次校验时遍历
+type NonceCache struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time // clientID/nonce -> 过期时间
+	nextSweep time.Time
+}
+
+// SchemePins 记录已经用 v2 签名通过校验的客户端，之后拒绝这些客户端的 v1 请求，
+// 截获的 v1 令牌不能用来绕过 v2 的请求体和 nonce 校验；可在多个 Verifier 之间共享
+type SchemePins struct {
+	mu sync.Mutex
+	v2 map[string]bool
+}
+
+// NewVerifier 创建签名校验器
+func NewVerifier(maxSkew time.Duration) *Verifier {
+	return &Verifier{MaxSkew: maxSkew, Nonces: &NonceCache{}, Pins: &SchemePins{}}
+}
+
+// Token 解析后的 Bearer 令牌
+type Token struct {
+	ClientID  string
+	Timestamp int64
+	Signature string
+	// KeyType 签名算法，旧格式（不带算法）的令牌为 RSA
+	KeyType crypto.KeyType
+}
+
+// ParseToken 解析 Authorization 头 "Bearer base64(aro:clientID:timestamp:signature[:keyType])"
+// 出错时返回的 Token 带有已解析的字段
+func ParseToken(header string) (*Token, error) {
+	res := &Token{}
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return res, fmt.Errorf("missing bearer token")
+	}
+	raw, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return res, fmt.Errorf("malformed bearer token: %w", err)
+	}
+	// base64 签名不含冒号，第 5 段为算法
+	parts := strings.Split(string(raw), ":")
+	if len(parts) < 4 || len(parts) > 5 || parts[0] != "aro" {
+		return res, fmt.Errorf("bearer token is not an aro token")
+	}
+	res.ClientID = parts[1]
+	res.Timestamp, err = strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return res, fmt.Errorf("malformed timestamp: %w", err)
+	}
+	res.Signature = parts[3]
+	res.KeyType = crypto.KeyTypeRSA
+	if len(parts) == 5 {
+		if res.KeyType, err = crypto.ParseKeyType(parts[4]); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// Verify 校验请求签名，body 为已读取的请求体；返回的 Verified 在出错时也带有 clientID（如果能解析）
+func (v *Verifier) Verify(r *http.Request, body []byte, lookup KeyLookup) (*Verified, error) {
+	token, err := ParseToken(r.Header.Get("Authorization"))
+	clientID, timestamp := token.ClientID, token.Timestamp
+	res := &Verified{ClientID: clientID, Timestamp: timestamp, Version: SchemeV1}
+	if err != nil {
+		return res, err
+	}
+	if err := v.CheckTimestamp(timestamp); err != nil {
+		return res, err
+	}
+	pub, err := lookup(clientID)
+	if err != nil {
+		return res, err
+	}
+	// 令牌声明的算法必须与注册的公钥一致，不能用另一种算法解释同一签名
+	if keyType := crypto.KeyTypeOf(pub); keyType != token.KeyType {
+		return res, fmt.Errorf("token key type %s does not match the registered %s key", token.KeyType, keyType)
+	}
+
+	switch version := r.Header.Get(HeaderAuthVersion); version {
+	case "", "1":
+		if v.RequireV2 {
+			return res, fmt.Errorf("auth scheme v1 is no longer accepted")
+		}
+		if v.Pins.pinned(clientID) {
+			return res, fmt.Errorf("client %s has switched to auth scheme v2, v1 is no longer accepted", clientID)
+		}
+		if err := crypto.VerifySignature(pub, fmt.Sprintf("%s:%d", clientID, timestamp), token.Signature); err != nil {
+			return res, fmt.Errorf("invalid signature: %w", err)
+		}
+		return res, nil
+	case "2":
+		res.Version = SchemeV2
+	default:
+		return res, fmt.Errorf("unsupported auth scheme %q", version)
+	}
+
+	res.Nonce = r.Header.Get(HeaderNonce)
+	if res.Nonce == "" {
+		return res, fmt.Errorf("missing %s", HeaderNonce)
+	}
+	bodyHash := BodyHash(body)
+	if r.Header.Get(HeaderContentSHA256) != bodyHash {
+		return res, fmt.Errorf("body hash mismatch")
+	}
+	canonical := CanonicalRequest(token.KeyType, clientID, timestamp, res.Nonce, r.Method, r.URL.RequestURI(), bodyHash)
+	if err := crypto.VerifySignature(pub, canonical, r.Header.Get(HeaderSignature)); err != nil {
+		return res, fmt.Errorf("invalid signature: %w", err)
+	}
+	// 签名通过后才记录 nonce，伪造的请求不能占用 nonce
+	if err := v.useNonce(clientID, res.Nonce, timestamp); err != nil {
+		return res, err
+	}
+	v.Pins.pin(clientID)
+	return res, nil
+}
+
+// CheckTimestamp 拒绝偏差超过 MaxSkew 的时间戳
+func (v *Verifier) CheckTimestamp(timestamp int64) error {
+	skew := v.now().Sub(time.Unix(timestamp, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if v.MaxSkew > 0 && skew > v.MaxSkew {
+		return fmt.Errorf("timestamp skew %s exceeds %s", skew.Round(time.Second), v.MaxSkew)
+	}
+	return nil
+}
+
+// useNonce 记录 nonce，重复使用时返回错误
+// 时间戳超出 MaxSkew 的请求已被拒绝，nonce 只需保留到 timestamp+MaxSkew
+func (v *Verifier) useNonce(clientID, nonce string, timestamp int64) error {
+	if v.Nonces == nil {
+		return nil
+	}
+	now := v.now()
+	ttl := v.MaxSkew
+	if ttl <= 0 {
+		ttl = DefaultMaxSkew
+	}
+	expires := time.Unix(timestamp, 0).Add(ttl)
+	if expires.Before(now) {
+		expires = now.Add(ttl)
+	}
+	if !v.Nonces.use(clientID+"/"+nonce, expires, now) {
+		return fmt.Errorf("replayed nonce")
+	}
+	return nil
+}
+
+// use 记录 key 直到 expires，key 未过期时返回 false
+func (c *NonceCache) use(key string, expires, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen == nil {
+		c.seen = make(map[string]time.Time)
+	}
+	if !now.Before(c.nextSweep) {
+		for k, exp := range c.seen {
+			if exp.Before(now) {
+				delete(c.seen, k)
+			}
+		}
+		c.nextSweep = now.Add(nonceSweepInterval)
+	}
+	if exp, ok := c.seen[key]; ok && !exp.Before(now) {
+		return false
+	}
+	c.seen[key] = expires
+	return true
+}
+
+// Reset 清空已记录的 nonce
+func (c *NonceCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seen = nil
+}
+
+// pin 记录 clientID 已使用 v2，p 为空时忽略
+func (p *SchemePins) pin(clientID string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.v2 == nil {
+		p.v2 = make(map[string]bool)
+	}
+	p.v2[clientID] = true
+}
+
+// Reset 清空已记录的客户端
+func (p *SchemePins) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.v2 = nil
+}
+
+// pinned 返回 clientID 是否已使用过 v2
+func (p *SchemePins) pinned(clientID string) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.v2[clientID]
+}
+
+func (v *Verifier) now() time.Time {
+	if v.Now != nil {
+		return v.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,173 @@
+// Package clock 检测并校正本地时钟与后端时钟的偏差
+//
+// 本地时钟不准的节点，签名时间戳会被后端拒绝，后端下发的任务过期时间也会被误判。
+// Clock 根据后端响应的 Date 头或时间接口估计偏差（offset = 服务端时间 - 本地时间），
+// 持久化到配置的 CLOCK_OFFSET 中，重启后立即生效；签名、心跳和测速任务通过 Now 得到校正后的时间。
+// 偏差超过 CLOCK_SKEW_THRESHOLD 时 Status.Skewed 为 true，提示用户同步系统时间
+package clock
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"aro-ext-app/core/internal/config"
+)
+
+// DefaultThreshold 默认的时钟偏差告警阈值
+const DefaultThreshold = time.Minute
+
+// 时间来源
+const (
+	SourceConfig  = "config"   // 上次运行保存的偏差
+	SourceDate    = "date"     // 响应的 Date 头，精确到秒
+	SourceTimeAPI = "time_api" // 后端时间接口，精确到毫秒
+)
+
+// Status 时钟状态
+type Status struct {
+	Offset    int64  `json:"offset"`    // 毫秒，服务端时间 - 本地时间
+	Skewed    bool   `json:"skewed"`    // 偏差超过阈值
+	Threshold int64  `json:"threshold"` // 秒
+	Source    string `json:"source,omitempty"`
+	LastSync  int64  `json:"last_sync"` // 最近一次观测的 Unix 秒，0 表示尚未观测
+	RTT       int64  `json:"rtt"`       // 最近一次观测的往返时间（毫秒）
+}
+
+// Clock 带偏差校正的时钟，可并发使用
+type Clock struct {
+	cfg       *config.Config
+	threshold time.Duration
+	// local 本地时钟，测试可替换
+	local func() time.Time
+
+	mu     sync.Mutex
+	offset time.Duration
+	status Status
+}
+
+var (
+	instance *Clock
+	once     sync.Once
+)
+
+// GetClock 返回使用全局配置的进程级时钟
+func GetClock() *Clock {
+	once.Do(func() {
+		instance = New(config.GetConfig())
+	})
+	return instance
+}
+
+// New 创建时钟，从 cfg 读取上次保存的偏差和告警阈值，cfg 为空时不持久化
+func New(cfg *config.Config) *Clock {
+	c := &Clock{cfg: cfg, threshold: ThresholdFromConfig(cfg), local: time.Now}
+	c.status.Threshold = int64(c.threshold / time.Second)
+	if cfg != nil {
+		if ms, err := strconv.ParseInt(cfg.Get(config.KeyClockOffset), 10, 64); err == nil {
+			c.offset = time.Duration(ms) * time.Millisecond
+			c.status.Offset = ms
+			c.status.Source = SourceConfig
+			c.status.Skewed = c.skewed(c.offset)
+		}
+	}
+	return c
+}
+
+// ThresholdFromConfig 读取 CLOCK_SKEW_THRESHOLD（秒），未配置或无效时返回 DefaultThreshold
+func ThresholdFromConfig(cfg *config.Config) time.Duration {
+	if cfg == nil {
+		return DefaultThreshold
+	}
+	if v, err := strconv.Atoi(cfg.Get(config.KeyClockSkewThreshold)); err == nil && v > 0 {
+		return time.Duration(v) * time.Second
+	}
+	return DefaultThreshold
+}
+
+// Now 返回校正后的当前时间
+func (c *Clock) Now() time.Time {
+	return c.local().Add(c.Offset())
+}
+
+// Offset 返回当前偏差（服务端时间 - 本地时间）
+func (c *Clock) Offset() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.offset
+}
+
+// Status 返回时钟状态
+func (c *Clock) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// ObserveDate 根据响应的 Date 头更新偏差，sent、received 为本地时钟下发出请求和收到响应的时间
+// Date 头缺失或无法解析时忽略，返回偏差是否变化
+func (c *Clock) ObserveDate(header string, sent, received time.Time) bool {
+	if header == "" {
+		return false
+	}
+	server, err := http.ParseTime(header)
+	if err != nil {
+		return false
+	}
+	// Date 头截断到秒，真实时间在 [server, server+1s) 内
+	return c.Observe(server.Add(time.Second/2), sent, received, time.Second, SourceDate)
+}
+
+// Observe 记录一次服务端时间观测
+//
+// 按 NTP 的方式假设服务端在往返时间的中点生成 server，估计 offset = server + rtt/2 - received；
+// 估计值的误差不超过 (rtt + resolution) / 2，当前偏差在误差范围内时保持不变，避免抖动。
+// 偏差变化时写入配置，返回偏差是否变化
+func (c *Clock) Observe(server, sent, received time.Time, resolution time.Duration, source string) bool {
+	rtt := received.Sub(sent)
+	if rtt < 0 {
+		rtt = 0
+	}
+	estimate := server.Add(rtt / 2).Sub(received)
+
+	c.mu.Lock()
+	c.status.LastSync = received.Add(estimate).Unix()
+	c.status.RTT = rtt.Milliseconds()
+	if abs(estimate-c.offset) <= (rtt+resolution)/2 {
+		c.mu.Unlock()
+		return false
+	}
+	wasSkewed := c.status.Skewed
+	c.offset = estimate.Round(time.Millisecond)
+	c.status.Offset = c.offset.Milliseconds()
+	c.status.Source = source
+	c.status.Skewed = c.skewed(c.offset)
+	st, offset := c.status, c.offset
+	c.mu.Unlock()
+
+	switch {
+	case st.Skewed:
+		log.Printf("Clock skew detected: server time is %v ahead of the local clock (source: %s), using server time", offset, source)
+	case wasSkewed:
+		log.Printf("Clock skew resolved: server time is %v ahead of the local clock", offset)
+	}
+	if c.cfg != nil {
+		if err := c.cfg.SetAndSave(config.KeyClockOffset, strconv.FormatInt(st.Offset, 10)); err != nil {
+			log.Printf("Failed to save clock offset: %v", err)
+		}
+	}
+	return true
+}
+
+func (c *Clock) skewed(offset time.Duration) bool {
+	return abs(offset) > c.threshold
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,60 @@
+package clock
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"aro-ext-app/core/internal/config"
+)
+
+func TestObserveDate(t *testing.T) {
+	cfg := config.New(t.TempDir())
+	c := New(cfg)
+	local := time.Unix(1700000000, 0)
+	c.local = func() time.Time { return local }
+
+	// Date 头只精确到秒，一秒以内的差异不改变偏差
+	if c.ObserveDate(local.UTC().Format(http.TimeFormat), local.Add(-100*time.Millisecond), local) {
+		t.Error("expected sub-second difference to be ignored")
+	}
+	if st := c.Status(); st.Offset != 0 || st.LastSync == 0 || st.RTT != 100 {
+		t.Errorf("unexpected status %+v", st)
+	}
+
+	server := local.Add(90 * time.Second)
+	if !c.ObserveDate(server.UTC().Format(http.TimeFormat), local.Add(-200*time.Millisecond), local) {
+		t.Fatal("expected offset to change")
+	}
+	st := c.Status()
+	if st.Offset != 90600 || !st.Skewed || st.Source != SourceDate || st.Threshold != 60 {
+		t.Errorf("unexpected status %+v", st)
+	}
+	if got := c.Now(); !got.Equal(local.Add(90600 * time.Millisecond)) {
+		t.Errorf("expected corrected time, got %v", got)
+	}
+	if got := cfg.Get(config.KeyClockOffset); got != "90600" {
+		t.Errorf("expected offset to be saved, got %q", got)
+	}
+
+	// 更精确的时间接口在误差范围外时覆盖 Date 头的结果
+	if !c.Observe(local.Add(90*time.Second), local.Add(-20*time.Millisecond), local, time.Millisecond, SourceTimeAPI) {
+		t.Fatal("expected time endpoint to refine the offset")
+	}
+	if st := c.Status(); st.Offset != 90010 || st.Source != SourceTimeAPI {
+		t.Errorf("unexpected status %+v", st)
+	}
+}
+
+func TestRestoreFromConfig(t *testing.T) {
+	cfg := config.New(t.TempDir())
+	cfg.Set(config.KeyClockOffset, "-30000")
+	cfg.Set(config.KeyClockSkewThreshold, "10")
+	st := New(cfg).Status()
+	if st.Offset != -30000 || !st.Skewed || st.Source != SourceConfig || st.Threshold != 10 {
+		t.Errorf("unexpected status %+v", st)
+	}
+	if st := New(nil).Status(); st.Offset != 0 || st.Skewed || st.Threshold != int64(DefaultThreshold/time.Second) {
+		t.Errorf("unexpected status without config %+v", st)
+	}
+}
@@ -2,12 +2,21 @@ package config
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
+
+	"aro-ext-app/core/internal/datadir"
+	"aro-ext-app/core/internal/errcode"
+	"aro-ext-app/core/internal/fsutil"
 )
 
 // Config 配置管理
@@ -15,6 +24,19 @@ type Config struct {
 	mu   sync.RWMutex
 	data map[string]string
 	path string
+	dir  string // 非空时只使用该目录下的 config.yaml / config.json 和 config.env（独立实例）
+	// structuredPath 读取的 YAML/JSON 配置文件，只读；SetAndSave 写入 config.env
+	structuredPath string
+	// loadErrs 读取 YAML/JSON 配置文件时发现的错误，由 Settings 报告
+	loadErrs []FieldError
+	// 重新加载的状态，见 Status
+	lastReload time.Time
+	lastError  string
+	watching   int
+
+	subMu sync.Mutex
+	subs  map[int]func(ReloadEvent)
+	subID int
 }
 
 // 全局配置单例
@@ -33,35 +55,49 @@ func GetConfig() *Config {
 		instance.loadDefaults()
 		instance.loadFromFile()
 		instance.loadFromEnv()
+		instance.resolveProfile()
 	})
 	return instance
 }
 
-// loadDefaults 加载默认配置
+// New 创建独立的 Config 实例，只从 dir 下的 config.env 读取和保存配置
+// 用于同一进程中运行多个互相隔离的节点，全局配置请使用 GetConfig
+func New(dir string) *Config {
+	c := &Config{
+		data: make(map[string]string),
+		dir:  dir,
+	}
+	c.loadDefaults()
+	c.loadFromFile()
+	c.loadFromEnv()
+	c.resolveProfile()
+	return c
+}
+
+// loadDefaults 加载默认配置（Settings 的 default 标签）
 func (c *Config) loadDefaults() {
-	defaults := map[string]string{
-		"API_URL":        "https://testnet-api.aro.network",
-		"WS_URL":         "https://testnet-ws.aro.network",
-		"LOG_LEVEL":      "info",
-		"LOG_FILE":       "",
-		"KEYPAIR_PATH":   ".",
-		"STORAGE_PATH":   ".",
-		"TIMEOUT":        "30",
-		"RETRY_COUNT":    "3",
-		"RETRY_INTERVAL": "1000",
-		"DEBUG":          "false",
-		"ENV":            "testnet",
-		"PROGRAM_APP":    "aro-ext",
-	}
-
-	for key, value := range defaults {
-		c.data[key] = value
+	for _, f := range settingFields {
+		c.data[f.key] = f.tag.Get("default")
 	}
 }
 
 // loadFromFile 从配置文件加载配置
 func (c *Config) loadFromFile() {
+	c.structuredPath = ""
+	c.loadErrs = nil
+	if c.dir != "" {
+		c.loadStructured(c.dir)
+		c.path = filepath.Join(c.dir, "config.env")
+		if err := c.loadFromPath(c.path); err == nil {
+			log.Printf("Config loaded from: %s", c.path)
+		}
+		return
+	}
+
+	// 当前目录的 .env / config.env 是旧版本的位置，InitLibstudy 会把它们迁移到数据目录
+	c.loadStructured(datadir.Get())
 	configPaths := []string{
+		filepath.Join(datadir.Get(), "config.env"),
 		".env",
 		"config.env",
 		filepath.Join(os.Getenv("HOME"), ".aro", "config.env"),
@@ -90,15 +126,14 @@ func (c *Config) loadFromFile() {
 	}
 }
 
-// loadFromPath 从指定路径加载配置文件
+// loadFromPath 从指定路径加载配置文件，未知的 key 记录到 loadErrs，由 Settings 报告
 func (c *Config) loadFromPath(path string) error {
-	file, err := os.Open(path)
+	data, err := readEnvFile(path)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 
@@ -115,93 +150,164 @@ func (c *Config) loadFromPath(path string) error {
 			// 移除引号
 			value = strings.Trim(value, "\"'")
 			c.data[key] = value
+			if !knownKey(key) {
+				e := FieldError{Path: filepath.Base(path) + ": " + key, Message: "unknown key"}
+				c.loadErrs = append(c.loadErrs, e)
+				log.Printf("Ignoring %s", e.Error())
+			}
 		}
 	}
 
 	return scanner.Err()
 }
 
-// loadFromEnv 从环境变量加载配置（覆盖文件配置）
+// readEnvFile 读取 config.env，文件损坏时从 config.env.bak 恢复（见 fsutil.ReadFile）；
+// 没有可用的备份时丢弃 NUL 字节和不完整的字符，尽量保留其余配置项
+func readEnvFile(path string) ([]byte, error) {
+	data, err := fsutil.ReadFile(path, validateEnvFile)
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		return data, err
+	}
+	raw, rerr := os.ReadFile(path)
+	if rerr != nil {
+		return nil, rerr
+	}
+	log.Printf("%s is corrupted and has no usable backup: %v", path, err)
+	return bytes.ToValidUTF8(bytes.ReplaceAll(raw, []byte{0}, nil), nil), nil
+}
+
+// validateEnvFile 检查 config.env 是否损坏：崩溃时未写完的文件常见的 NUL 字节或不完整的 UTF-8 字符
+func validateEnvFile(data []byte) error {
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return errors.New("config file contains binary data")
+	}
+	return nil
+}
+
+// loadFromEnv 从环境变量加载配置（覆盖文件配置），只读取 Settings 中的配置项
 func (c *Config) loadFromEnv() {
-	envVars := []string{
-		"API_URL",
-		"WS_URL",
-		"LOG_LEVEL",
-		"LOG_FILE",
-		"KEYPAIR_PATH",
-		"STORAGE_PATH",
-		"TIMEOUT",
-		"RETRY_COUNT",
-		"RETRY_INTERVAL",
-		"DEBUG",
-		"ENV",
-		"PROGRAM_APP",
-	}
-
-	for _, key := range envVars {
+	for _, key := range SettingKeys() {
 		if value := os.Getenv(key); value != "" {
 			c.data[key] = value
 		}
 	}
 }
 
-// Get 获取配置值
+// Get 获取配置值，节点身份相关的 key（CLIENT_ID、SERIAL_NUMBER 等）读取当前环境的值，见 Profile
 func (c *Config) Get(key string) string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.data[key]
+	return c.data[c.scopedKey(key)]
 }
 
 // Set 设置配置值（仅在内存中，不写入文件）
 func (c *Config) Set(key, value string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.data[key] = value
+	c.data[c.scopedKey(key)] = value
 }
 
-// SetAndSave 设置配置值并写入文件
+// SetAndSave 设置配置值并写入 config.env，见 SetAndSaveAll
 func (c *Config) SetAndSave(key, value string) error {
-	c.Set(key, value)
-
+	return c.SetAndSaveAll(map[string]string{key: value})
+}
 
+// SetAndSaveAll 设置多个配置值并一次写入 config.env
+// Settings 中的配置项先按类型校验，任一取值不合法时返回 INVALID_CONFIG，配置不变；类型化的写法见 SetSetting
+// 节点身份相关的 key 与 Get 一样写入当前环境；PROFILE 不能在这里修改，切换环境使用 SetProfile 并重新创建节点
+//
+// 写入时持有进程间文件锁 config.env.lock，在锁内读取文件的最新内容、替换或追加这些 key 后原子地替换文件，
+// 共用数据目录的其他进程写入的配置项不会丢失；替换前的版本保存为 config.env.bak，文件损坏时从备份恢复
+func (c *Config) SetAndSaveAll(values map[string]string) error {
+	if _, ok := values[KeyProfile]; ok {
+		return errcode.New(errcode.InvalidConfig, "PROFILE can only be changed with SetProfile")
+	}
+	return c.saveAll(values)
+}
 
+// saveAll 校验并写入配置值，见 SetAndSaveAll
+func (c *Config) saveAll(values map[string]string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	for key, value := range values {
+		if err := ValidateValue(key, value); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	scoped := make(map[string]string, len(values))
+	for key, value := range values {
+		scoped[c.scopedKey(key)] = value
+	}
+	values = scoped
+	for key, value := range values {
+		c.data[key] = value
+	}
 	// 确定配置文件路径
 	configPath := c.path
+	c.mu.Unlock()
 	if configPath == "" {
-		configPath = ".env"
+		configPath = filepath.Join(datadir.Get(), "config.env")
 	}
 
-	
 	// 确保目录存在
 	dir := filepath.Dir(configPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
+	lock, err := fsutil.LockFile(configPath + ".lock")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
 	// 读取现有配置文件
-	lines := []string{}
-	if file, err := os.Open(configPath); err == nil {
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			line := scanner.Text()
-			// 跳过要更新的 key 的行
-			if !strings.HasPrefix(strings.TrimSpace(line), key+"=") {
-				lines = append(lines, line)
+	var lines []string
+	data, err := readEnvFile(configPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	}
+
+	// 原位替换已有的 key，删除重复的行，其余 key 按字母顺序追加
+	written := make(map[string]bool, len(values))
+	kept := lines[:0]
+	for _, line := range lines {
+		key, _, ok := strings.Cut(strings.TrimSpace(line), "=")
+		key = strings.TrimSpace(key)
+		if value, saved := values[key]; ok && saved {
+			if written[key] {
+				continue
 			}
+			written[key] = true
+			line = fmt.Sprintf("%s=%s", key, value)
 		}
-		file.Close()
+		kept = append(kept, line)
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if !written[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		kept = append(kept, fmt.Sprintf("%s=%s", key, values[key]))
 	}
-
-	// 添加新行
-	lines = append(lines, fmt.Sprintf("%s=%s", key, value))
 
 	// 写入文件
-	content := strings.Join(lines, "\n")
-	if err := os.WriteFile(configPath, []byte(content+"\n"), 0644); err != nil {
+	content := strings.Join(kept, "\n") + "\n"
+	if err := fsutil.WriteFileWithBackup(configPath, []byte(content), 0644, validateEnvFile); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
+	c.mu.Lock()
 	c.path = configPath
+	c.mu.Unlock()
 	return nil
 }
 
@@ -217,7 +323,7 @@ func (c *Config) GetAll() map[string]string {
 	return result
 }
 
-// GetInt 获取整数配置值
+// GetInt 获取整数配置值，无法解析时返回 0；Settings 中的配置项应使用 Settings 读取
 func (c *Config) GetInt(key string) int {
 	val := c.Get(key)
 	var result int
@@ -225,7 +331,7 @@ func (c *Config) GetInt(key string) int {
 	return result
 }
 
-// GetBool 获取布尔配置值
+// GetBool 获取布尔配置值；Settings 中的配置项应使用 Settings 读取
 func (c *Config) GetBool(key string) bool {
 	val := strings.ToLower(c.Get(key))
 	return val == "true" || val == "1" || val == "yes"
@@ -236,12 +342,6 @@ func (c *Config) Reset() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.data = make(map[string]string)
-	instance.loadDefaults()
-}
-
-// Reload 重新加载配置（从文件和环境变量）
-func (c *Config) Reload() {
-	c.Reset()
-	c.loadFromFile()
-	c.loadFromEnv()
+	c.loadDefaults()
+	c.resolveProfile()
 }
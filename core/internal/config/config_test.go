@@ -2,7 +2,12 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
+
+	"aro-ext-app/core/internal/errcode"
 )
 
 func TestGetConfig(t *testing.T) {
@@ -115,8 +120,13 @@ func TestConfigConstants(t *testing.T) {
 		{KeyTimeout, "TIMEOUT"},
 		{KeyRetryCount, "RETRY_COUNT"},
 		{KeyRetryInterval, "RETRY_INTERVAL"},
+		{KeyHeartbeatInterval, "HEARTBEAT_INTERVAL"},
+		{KeyClockSkewThreshold, "CLOCK_SKEW_THRESHOLD"},
 		{KeyKeypairPath, "KEYPAIR_PATH"},
 		{KeyStoragePath, "STORAGE_PATH"},
+		{KeyKeyProtection, "KEY_PROTECTION"},
+		{KeyKeySecretFile, "KEY_SECRET_FILE"},
+		{KeyKeyType, "KEY_TYPE"},
 		{KeyEnv, "ENV"},
 		{KeyProgramApp, "PROGRAM_APP"},
 		{KeyDebug, "DEBUG"},
@@ -133,11 +143,11 @@ func TestDefaultValues(t *testing.T) {
 	cfg := GetConfig()
 
 	// 验证重要的默认值
-	if cfg.Get(KeyAPIURL) != "https://testnet-api.aro.network" {
+	if cfg.Get(KeyAPIURL) != "https://staging-api.aro.network" {
 		t.Error("API_URL default value mismatch")
 	}
 
-	if cfg.Get(KeyWSURL) != "https://testnet-ws.aro.network" {
+	if cfg.Get(KeyWSURL) != "https://staging-ws.aro.network" {
 		t.Error("WS_URL default value mismatch")
 	}
 
@@ -149,3 +159,84 @@ func TestDefaultValues(t *testing.T) {
 		t.Error("RETRY_COUNT default value should be 3")
 	}
 }
+
+func TestNewIsolatedInstances(t *testing.T) {
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	cfg1 := New(dir1)
+	cfg2 := New(dir2)
+
+	if cfg1 == GetConfig() || cfg1 == cfg2 {
+		t.Fatal("New should return independent instances")
+	}
+	if err := cfg1.SetAndSave(KeyClientId, "node-1"); err != nil {
+		t.Fatalf("SetAndSave failed: %v", err)
+	}
+	if got := cfg2.Get(KeyClientId); got != "" {
+		t.Errorf("expected other instance to be unaffected, got %s", got)
+	}
+	if _, err := os.Stat(dir1 + "/config.env"); err != nil {
+		t.Errorf("expected config.env in instance dir: %v", err)
+	}
+
+	// 重新创建实例应从目录中读回配置
+	if got := New(dir1).Get(KeyClientId); got != "node-1" {
+		t.Errorf("expected node-1 after reload, got %s", got)
+	}
+}
+
+func TestSetAndSaveAllMergesConcurrentWriters(t *testing.T) {
+	dir := t.TempDir()
+	// 两个实例模拟共用数据目录的 aro-node 和桌面应用
+	cfg1, cfg2 := New(dir), New(dir)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if err := cfg1.SetAndSaveAll(map[string]string{KeyClientId: "node-1", KeySN: strconv.Itoa(i)}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			if err := cfg2.SetAndSaveAll(map[string]string{USER_ID: "user-2"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	reloaded := New(dir)
+	if reloaded.Get(KeyClientId) != "node-1" || reloaded.Get(USER_ID) != "user-2" || reloaded.Get(KeySN) == "" {
+		t.Errorf("expected both writers' keys to be kept, got %v", reloaded.GetAll())
+	}
+}
+
+func TestSetAndSaveAllRejectsInvalidBatch(t *testing.T) {
+	cfg := New(t.TempDir())
+	err := cfg.SetAndSaveAll(map[string]string{KeyClientId: "node-1", KeyTimeout: "soon"})
+	if errcode.Of(err) != errcode.InvalidConfig {
+		t.Fatalf("expected INVALID_CONFIG, got %v", err)
+	}
+	if cfg.Get(KeyClientId) != "" {
+		t.Errorf("expected nothing to be saved, got %s", cfg.Get(KeyClientId))
+	}
+}
+
+func TestCorruptedConfigRestoredFromBackup(t *testing.T) {
+	dir := t.TempDir()
+	cfg := New(dir)
+	if err := cfg.SetAndSave(KeyClientId, "node-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.SetAndSave(KeySN, "sn-1"); err != nil {
+		t.Fatal(err)
+	}
+	// 写入中途断电：文件被截断并填充了 NUL
+	if err := os.WriteFile(filepath.Join(dir, "config.env"), []byte("CLIENT_ID=no\x00\x00\x00"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := New(dir).Get(KeyClientId); got != "node-1" {
+		t.Errorf("expected the backup to be restored, got %q", got)
+	}
+}
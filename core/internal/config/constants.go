@@ -6,22 +6,39 @@ package config
 const (
 	KeyAPIURL   = "API_URL"
 	KeyWSURL    = "WS_URL"
+	KeyGRPCURL  = "GRPC_URL"
 	KeyClientId = "CLIENT_ID"
 	KeySN       = "SERIAL_NUMBER"
 	USER_ID     = "USER_ID"
 	EMAIL       = "EMAIL"
+	// KeyBaseInfoHash 上次成功上报的系统信息摘要，变化时重新上报
+	KeyBaseInfoHash = "BASE_INFO_HASH"
+	// KeyClockOffset 服务端时间与本地时钟的偏差（毫秒），由 core 根据后端响应维护
+	KeyClockOffset = "CLOCK_OFFSET"
+	// KeyHardwareID 创建节点身份时的硬件标识，与当前设备不同时说明身份被复制到了另一台设备
+	KeyHardwareID = "HARDWARE_ID"
+	// KeyPreviousKeyUntil 密钥轮换后旧密钥（aro_rsa.old）保留到的 Unix 秒
+	KeyPreviousKeyUntil = "PREVIOUS_KEY_UNTIL"
 )
 
 // 日志相关配置 key
 const (
 	KeyLogLevel = "LOG_LEVEL"
-	KeyLogFile  = "LOG_FILE"
+	// KeyLogFile 已不再使用，日志写入数据目录下的 libstudy.log
+	KeyLogFile = "LOG_FILE"
 )
 
 // 存储相关配置 key
 const (
+	// KeyKeypairPath、KeyStoragePath 已不再使用，密钥和本地数据保存在数据目录
 	KeyKeypairPath = "KEYPAIR_PATH"
 	KeyStoragePath = "STORAGE_PATH"
+	// KeyKeyProtection 私钥保护方式：machine（本机密钥文件加密）、passphrase（口令加密）或 none（明文）
+	KeyKeyProtection = "KEY_PROTECTION"
+	// KeyKeySecretFile machine 方式使用的本机密钥文件，为空时使用用户配置目录下的 aro/machine.secret
+	KeyKeySecretFile = "KEY_SECRET_FILE"
+	// KeyKeyType 新生成密钥的算法：ed25519、ecdsa-p256 或 rsa，已有的私钥不受影响
+	KeyKeyType = "KEY_TYPE"
 )
 
 // 网络相关配置 key
@@ -29,15 +46,38 @@ const (
 	KeyTimeout       = "TIMEOUT"
 	KeyRetryCount    = "RETRY_COUNT"
 	KeyRetryInterval = "RETRY_INTERVAL"
+	// KeyHeartbeatInterval 心跳间隔（秒）
+	KeyHeartbeatInterval = "HEARTBEAT_INTERVAL"
+	// KeyClockSkewThreshold 时钟偏差告警阈值（秒）
+	KeyClockSkewThreshold = "CLOCK_SKEW_THRESHOLD"
+)
+
+// worker 相关配置 key
+const (
+	// KeyProxyAuthURL 代理认证接口地址，为空时使用当前环境的地址
+	KeyProxyAuthURL = "PROXY_AUTH_URL"
+	// KeyWorkerRestartDelay worker 崩溃后首次重启前的等待时间（秒）
+	KeyWorkerRestartDelay = "WORKER_RESTART_DELAY"
 )
 
 // 环境相关配置 key
 const (
+	// KeyProfile 后端环境（staging、testnet、mainnet、local），决定各服务的默认地址和节点身份，见 Profile
+	KeyProfile = "PROFILE"
+	// KeyEnv 已不再使用，环境由 KeyProfile 决定
 	KeyEnv        = "ENV"
 	KeyProgramApp = "PROGRAM_APP"
 	KeyDebug      = "DEBUG"
 )
 
+// 更新相关配置 key
+const (
+	KeyUpdateChannel    = "UPDATE_CHANNEL"
+	KeyUpdatePinVersion = "UPDATE_PIN_VERSION"
+	// KeyUpdateURL 更新检查地址，为空时使用当前环境的地址
+	KeyUpdateURL = "UPDATE_URL"
+)
+
 // 环境值
 const (
 	EnvTestnet = "testnet"
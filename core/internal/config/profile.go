@@ -0,0 +1,201 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"aro-ext-app/core/internal/errcode"
+)
+
+// 内置的后端环境
+const (
+	ProfileStaging = "staging"
+	ProfileTestnet = "testnet"
+	ProfileMainnet = "mainnet"
+	ProfileLocal   = "local"
+	// DefaultProfile 未配置 PROFILE 时使用的环境，旧版本的节点都注册在这里
+	DefaultProfile = ProfileStaging
+)
+
+// backendPublicKey 加密 OTA 和测速接口 Bearer Token 的后端 RSA 公钥（base64 编码的 PEM）
+const backendPublicKey = "LS0tLS1CRUdJTiBSU0EgUFVCTElDIEtFWS0tLS0tCk1JSUJDZ0tDQVFFQTBocFFjTng5NEk5TGNvUFpzMlJRRktLa2tiaXZFOEhtd3NGaXVYRTFtdFpMRGcwRUlUVWoKRzVLUXRUUjgzZGhyWG5lLzB5TkhxdVNacWZIcnpLM2YrUE8wbmllNmlROFl0UlZVWW5INjRzUXBuYld6V2ZhbgpFT0RMSVNwUThZS1pzZSt4SVorTzZFaUduUGFnZStBWnZnQmJhcjltb3Z4L3ZXcmVzWDVRellTOGlaZ3FFNGoyClFYVE5CYnFqa0NEZFpoT1NVelAxckw0dSt3UEdBMW16RU5laDI1Sk5OQUlkNG90VVpvSHlMZFdHMWlFVFhvM0sKcy9Kb0tQZ3YrTVVLWDFuQm5ubHhTMnoxTDMvS0QxK3dqeTNhSDBrbVQvYWFmTFFrbk8xcHlJcjhZQWZpZGVkNgpNRklGa3lnTlJkYVkyU0J2VGlVeG93UnBwa0RKdzZqWll3SURBUUFCCi0tLS0tRU5EIFJTQSBQVUJMSUMgS0VZLS0tLS0K"
+
+// proxyAuthPath 后端的代理认证接口，对应 gost aro auther 的 backUrl
+const proxyAuthPath = "/api/liteNode/proxy/auth"
+
+// Profile 一个后端环境的地址和密钥
+// 地址为空表示：GRPCURL 不连接任务流，OTAURL 使用 APIURL
+type Profile struct {
+	Name         string `json:"name"`
+	APIURL       string `json:"api_url"`
+	WSURL        string `json:"ws_url"`
+	GRPCURL      string `json:"grpc_url,omitempty"`
+	OTAURL       string `json:"ota_url,omitempty"`
+	ProxyAuthURL string `json:"proxy_auth_url"`
+	// BackendPublicKey 后端 RSA 公钥（base64 编码的 PEM），见 api_client.PublicEncrypt
+	BackendPublicKey string `json:"-"`
+}
+
+// profiles 内置的环境，与 EnvSettings.Profile 的 enum 标签一致
+var profiles = map[string]Profile{
+	ProfileStaging: {
+		Name:             ProfileStaging,
+		APIURL:           "https://staging-api.aro.network",
+		WSURL:            "https://staging-ws.aro.network",
+		ProxyAuthURL:     "https://staging-api.aro.network" + proxyAuthPath,
+		BackendPublicKey: backendPublicKey,
+	},
+	ProfileTestnet: {
+		Name:             ProfileTestnet,
+		APIURL:           "https://testnet-api.aro.network",
+		WSURL:            "https://testnet-ws.aro.network",
+		ProxyAuthURL:     "https://testnet-api.aro.network" + proxyAuthPath,
+		BackendPublicKey: backendPublicKey,
+	},
+	ProfileMainnet: {
+		Name:             ProfileMainnet,
+		APIURL:           "https://api.aro.network",
+		WSURL:            "https://ws.aro.network",
+		ProxyAuthURL:     "https://api.aro.network" + proxyAuthPath,
+		BackendPublicKey: backendPublicKey,
+	},
+	// ProfileLocal 本机的 mockbackend（cmd/mockbackend 的默认监听地址）
+	ProfileLocal: {
+		Name:             ProfileLocal,
+		APIURL:           "http://127.0.0.1:18080",
+		WSURL:            "http://127.0.0.1:18080",
+		ProxyAuthURL:     "http://127.0.0.1:18080" + proxyAuthPath,
+		BackendPublicKey: backendPublicKey,
+	},
+}
+
+// Profiles 返回按名称排序的内置环境
+func Profiles() []Profile {
+	list := make([]Profile, 0, len(profiles))
+	for _, p := range profiles {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// LookupProfile 返回名为 name 的内置环境
+func LookupProfile(name string) (Profile, bool) {
+	p, ok := profiles[name]
+	return p, ok
+}
+
+// profileEndpoints 由环境提供默认值的配置项，配置文件或环境变量中设置了的以设置的为准
+var profileEndpoints = []struct {
+	key string
+	get func(Profile) string
+}{
+	{KeyAPIURL, func(p Profile) string { return p.APIURL }},
+	{KeyWSURL, func(p Profile) string { return p.WSURL }},
+	{KeyGRPCURL, func(p Profile) string { return p.GRPCURL }},
+	{KeyProxyAuthURL, func(p Profile) string { return p.ProxyAuthURL }},
+	{KeyUpdateURL, func(p Profile) string { return p.OTAURL }},
+}
+
+// profileScoped 节点身份相关的 key，按环境分开保存，切换环境不会把一个网络的身份带到另一个网络
+var profileScoped = map[string]bool{
+	KeyClientId:         true,
+	KeySN:               true,
+	USER_ID:             true,
+	EMAIL:               true,
+	KeyBaseInfoHash:     true,
+	KeyClockOffset:      true,
+	KeyHardwareID:       true,
+	KeyPreviousKeyUntil: true,
+}
+
+// profileName 返回当前的环境名，未配置或未知时为 DefaultProfile，调用方持有 c.mu
+func (c *Config) profileName() string {
+	if _, ok := profiles[c.data[KeyProfile]]; ok {
+		return c.data[KeyProfile]
+	}
+	return DefaultProfile
+}
+
+// resolveProfile 用当前环境的地址填充未设置的地址配置项，在加载文件和环境变量之后调用
+func (c *Config) resolveProfile() {
+	p := profiles[c.profileName()]
+	for _, e := range profileEndpoints {
+		if c.data[e.key] == "" {
+			c.data[e.key] = e.get(p)
+		}
+	}
+}
+
+// scopedKey 返回身份相关的 key 在当前环境下保存的 key，调用方持有 c.mu
+// DefaultProfile 使用原来的 key（兼容旧版本的 config.env），其他环境加上环境名前缀，如 MAINNET_CLIENT_ID
+func (c *Config) scopedKey(key string) string {
+	if !profileScoped[key] {
+		return key
+	}
+	if name := c.profileName(); name != DefaultProfile {
+		return strings.ToUpper(name) + "_" + key
+	}
+	return key
+}
+
+// Profile 返回当前环境，地址为实际使用的地址（包括配置文件或环境变量中的覆盖），OTAURL 未设置时为 APIURL
+func (c *Config) Profile() Profile {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	p := profiles[c.profileName()]
+	p.APIURL = c.data[KeyAPIURL]
+	p.WSURL = c.data[KeyWSURL]
+	p.GRPCURL = c.data[KeyGRPCURL]
+	p.OTAURL = c.data[KeyUpdateURL]
+	p.ProxyAuthURL = c.data[KeyProxyAuthURL]
+	if p.OTAURL == "" {
+		p.OTAURL = p.APIURL
+	}
+	return p
+}
+
+// SetProfile 切换环境：写入 config.env 并重新加载，地址和节点身份随之切换
+// 已经创建的 API 客户端和密钥存储仍属于之前的环境，调用方应重新创建节点（InitLibstudy、CreateNode）
+func (c *Config) SetProfile(name string) error {
+	if _, ok := profiles[name]; !ok {
+		return errcode.Errorf(errcode.InvalidConfig, "unknown profile %q", name)
+	}
+	c.mu.RLock()
+	current := c.profileName()
+	c.mu.RUnlock()
+	if name == current {
+		return nil
+	}
+	if err := c.saveAll(map[string]string{KeyProfile: name}); err != nil {
+		return err
+	}
+	c.Reload()
+	return nil
+}
+
+// IdentityDir 返回 dir 下当前环境的身份目录（私钥文件所在的目录）
+// DefaultProfile 为 dir 本身（兼容旧版本），其他环境为 dir/profiles/<name>
+func (c *Config) IdentityDir(dir string) string {
+	c.mu.RLock()
+	name := c.profileName()
+	c.mu.RUnlock()
+	if name == DefaultProfile {
+		return dir
+	}
+	return filepath.Join(dir, "profiles", name)
+}
+
+// checkProfile 拒绝运行中切换环境：已经创建的客户端和密钥属于之前的环境，切换需要重新创建节点
+func (c *Config) checkProfile(next *Config) error {
+	c.mu.RLock()
+	current := c.profileName()
+	c.mu.RUnlock()
+	if name := next.profileName(); name != current {
+		return errcode.New(errcode.InvalidConfig,
+			fmt.Sprintf("PROFILE changed from %s to %s, restart the node to switch profiles", current, name))
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"aro-ext-app/core/internal/errcode"
+)
+
+func TestProfilesMatchSettingsEnum(t *testing.T) {
+	f, ok := lookupSetting(KeyProfile)
+	if !ok {
+		t.Fatal("PROFILE is not a setting")
+	}
+	enum := strings.Split(f.tag.Get("enum"), ",")
+	sort.Strings(enum)
+	list := Profiles()
+	if len(list) != len(enum) {
+		t.Fatalf("expected profiles %v, got %d", enum, len(list))
+	}
+	for i, p := range list {
+		if p.Name != enum[i] || p.APIURL == "" || p.WSURL == "" || p.ProxyAuthURL == "" || p.BackendPublicKey == "" {
+			t.Errorf("incomplete profile %+v", p)
+		}
+	}
+	if _, ok := LookupProfile(DefaultProfile); !ok {
+		t.Errorf("default profile %s is not defined", DefaultProfile)
+	}
+}
+
+func TestProfileEndpoints(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config.env"), []byte("PROFILE=testnet\nWS_URL=https://ws.example.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p := New(dir).Profile()
+	if p.Name != ProfileTestnet || p.APIURL != "https://testnet-api.aro.network" || p.OTAURL != p.APIURL ||
+		!strings.HasPrefix(p.ProxyAuthURL, p.APIURL) {
+		t.Errorf("expected the testnet endpoints, got %+v", p)
+	}
+	if p.WSURL != "https://ws.example.com" {
+		t.Errorf("expected the configured WS_URL to win, got %s", p.WSURL)
+	}
+}
+
+func TestIdentityScopedByProfile(t *testing.T) {
+	dir := t.TempDir()
+	cfg := New(dir)
+	if err := cfg.SetAndSaveAll(map[string]string{KeyClientId: "staging-node", KeySN: "staging-sn"}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.IdentityDir(dir) != dir {
+		t.Errorf("expected the default profile to keep its identity in %s", dir)
+	}
+
+	if err := cfg.SetProfile(ProfileMainnet); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Get(KeyClientId) != "" || cfg.Get(KeySN) != "" || cfg.Get(KeyAPIURL) != "https://api.aro.network" {
+		t.Fatalf("expected a fresh mainnet identity, got %s %s %s", cfg.Get(KeyClientId), cfg.Get(KeySN), cfg.Get(KeyAPIURL))
+	}
+	if err := cfg.SetAndSave(KeyClientId, "mainnet-node"); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.IdentityDir(dir); got != filepath.Join(dir, "profiles", ProfileMainnet) {
+		t.Errorf("unexpected mainnet identity dir %s", got)
+	}
+
+	if err := cfg.SetProfile(ProfileStaging); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Get(KeyClientId) != "staging-node" || cfg.Get(KeySN) != "staging-sn" {
+		t.Errorf("expected the staging identity back, got %s %s", cfg.Get(KeyClientId), cfg.Get(KeySN))
+	}
+	if cfg.SetProfile("devnet") == nil {
+		t.Error("expected an unknown profile to be rejected")
+	}
+	// 切换环境只能通过 SetProfile
+	if err := cfg.SetAndSave(KeyProfile, ProfileMainnet); errcode.Of(err) != errcode.InvalidConfig {
+		t.Errorf("expected SetAndSave(PROFILE) to be rejected, got %v", err)
+	}
+	if err := cfg.SetSetting("profile", ProfileMainnet); errcode.Of(err) != errcode.InvalidConfig {
+		t.Errorf("expected SetSetting(profile) to be rejected, got %v", err)
+	}
+	if cfg.Profile().Name != ProfileStaging {
+		t.Errorf("expected the profile to stay %s, got %s", ProfileStaging, cfg.Profile().Name)
+	}
+}
+
+func TestReloadCheckedRejectsProfileSwitch(t *testing.T) {
+	dir := t.TempDir()
+	cfg := New(dir)
+	if err := os.WriteFile(filepath.Join(dir, "config.env"), []byte("PROFILE=mainnet\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.ReloadChecked(); errcode.Of(err) != errcode.InvalidConfig {
+		t.Fatalf("expected INVALID_CONFIG, got %v", err)
+	}
+	if p := cfg.Profile(); p.Name != DefaultProfile {
+		t.Errorf("expected the running profile to be kept, got %s", p.Name)
+	}
+}
@@ -0,0 +1,532 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"aro-ext-app/core/internal/errcode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Settings 类型化的配置
+//
+// 每个字段对应 config.env / 环境变量中的一个 key（key 标签），YAML/JSON 配置文件使用按分组嵌套的字段名（json 标签）；
+// default、min、max、enum、format、pattern 标签同时用于默认值、校验和 Schema 导出
+// 读取顺序（后者覆盖前者）：默认值 < config.yaml / config.yml / config.json < config.env < 环境变量
+type Settings struct {
+	API       APISettings       `json:"api" desc:"后端 API"`
+	WS        WSSettings        `json:"ws" desc:"WebSocket 连接"`
+	Worker    WorkerSettings    `json:"worker" desc:"代理 worker"`
+	Speedtest SpeedtestSettings `json:"speedtest" desc:"带宽测试任务"`
+	Logging   LoggingSettings   `json:"logging" desc:"日志"`
+	Limits    LimitsSettings    `json:"limits" desc:"资源上限"`
+	Storage   StorageSettings   `json:"storage" desc:"密钥和本地存储"`
+	Env       EnvSettings       `json:"env" desc:"运行环境"`
+	Update    UpdateSettings    `json:"update" desc:"自动更新"`
+}
+
+// APISettings 后端 API
+type APISettings struct {
+	URL                string `json:"url" key:"API_URL" format:"uri" desc:"API 服务器地址，为空时使用 env.profile 环境的地址"`
+	Timeout            int    `json:"timeout" key:"TIMEOUT" default:"30" min:"1" max:"300" desc:"请求超时（秒）"`
+	RetryCount         int    `json:"retry_count" key:"RETRY_COUNT" default:"3" min:"0" max:"10" desc:"重试次数"`
+	RetryInterval      int    `json:"retry_interval" key:"RETRY_INTERVAL" default:"1000" min:"100" max:"60000" desc:"重试间隔（毫秒）"`
+	HeartbeatInterval  int    `json:"heartbeat_interval" key:"HEARTBEAT_INTERVAL" default:"180" min:"10" max:"3600" desc:"心跳间隔（秒），后端可在心跳响应中调整"`
+	ClockSkewThreshold int    `json:"clock_skew_threshold" key:"CLOCK_SKEW_THRESHOLD" default:"60" min:"1" max:"86400" desc:"本地时钟与服务端偏差超过该值（秒）时在状态中告警"`
+}
+
+// WSSettings WebSocket 连接
+type WSSettings struct {
+	URL                  string `json:"url" key:"WS_URL" format:"uri" desc:"WebSocket 服务器地址，为空时使用 env.profile 环境的地址"`
+	ReconnectionDelay    int    `json:"reconnection_delay" key:"RECONNECTION_DELAY" default:"5000" min:"100" max:"600000" desc:"断线重连的初始间隔（毫秒）"`
+	ReconnectionDelayMax int    `json:"reconnection_delay_max" key:"RECONNECTION_DELAY_MAX" default:"10000" min:"100" max:"600000" desc:"断线重连的最大间隔（毫秒）"`
+}
+
+// WorkerSettings 代理 worker
+type WorkerSettings struct {
+	RestartDelay int    `json:"restart_delay" key:"WORKER_RESTART_DELAY" default:"5" min:"1" max:"3600" desc:"aro-node run 中 worker 崩溃后首次重启前的等待时间（秒），连续崩溃时指数退避；libstudy 不自动重启 worker，不使用该配置"`
+	AuthURL      string `json:"auth_url" key:"PROXY_AUTH_URL" format:"uri" desc:"代理认证接口地址（启用代理认证时使用），为空时使用 env.profile 环境的地址"`
+}
+
+// SpeedtestSettings 带宽测试任务
+type SpeedtestSettings struct {
+	MaxDuration    int `json:"max_duration" key:"SPEEDTEST_MAX_DURATION" default:"120" min:"1" max:"3600" desc:"接受的带宽测试最长时间（秒），更长的任务被拒绝"`
+	MaxConcurrency int `json:"max_concurrency" key:"SPEEDTEST_MAX_CONCURRENCY" default:"16" min:"1" max:"256" desc:"接受的带宽测试最大并发流数"`
+}
+
+// LoggingSettings 日志
+type LoggingSettings struct {
+	Level   string `json:"level" key:"LOG_LEVEL" default:"info" enum:"debug,info,warn,error" desc:"日志级别"`
+	MaxSize int    `json:"max_size" key:"LOG_MAX_SIZE" default:"10" min:"1" max:"1024" desc:"libstudy.log 的最大大小（MB），超出后轮转"`
+	Debug   bool   `json:"debug" key:"DEBUG" default:"false" desc:"调试模式"`
+}
+
+// LimitsSettings 资源上限
+type LimitsSettings struct {
+	MaxPendingHeartbeats int `json:"max_pending_heartbeats" key:"HEARTBEAT_MAX_PENDING" default:"1000" min:"1" max:"100000" desc:"离线时最多缓存的心跳数，超出后丢弃最旧的"`
+}
+
+// StorageSettings 密钥和本地存储
+type StorageSettings struct {
+	KeyProtection string `json:"key_protection" key:"KEY_PROTECTION" default:"machine" enum:"machine,passphrase,none" desc:"私钥保护方式：machine 用本机密钥文件加密，passphrase 用口令（ARO_KEY_PASSPHRASE）加密，none 保存明文"`
+	KeySecretFile string `json:"key_secret_file" key:"KEY_SECRET_FILE" desc:"machine 方式的本机密钥文件，为空时使用用户配置目录下的 aro/machine.secret"`
+	KeyType       string `json:"key_type" key:"KEY_TYPE" default:"ed25519" enum:"ed25519,ecdsa-p256,rsa" desc:"新生成密钥（注册、轮换、重新注册）的算法，已有的私钥不受影响"`
+}
+
+// EnvSettings 运行环境
+type EnvSettings struct {
+	Profile    string `json:"profile" key:"PROFILE" default:"staging" enum:"staging,testnet,mainnet,local" desc:"后端环境，决定 API、WebSocket、任务流、更新和代理认证的默认地址；节点身份（客户端 ID、SN、私钥）按环境分开保存"`
+	ProgramApp string `json:"program_app" key:"PROGRAM_APP" default:"aro-ext" desc:"应用名称"`
+}
+
+// UpdateSettings 自动更新
+type UpdateSettings struct {
+	Channel    string `json:"channel" key:"UPDATE_CHANNEL" default:"dev" enum:"dev,testnet,mainnet,beta" desc:"更新渠道"`
+	URL        string `json:"url" key:"UPDATE_URL" format:"uri" desc:"更新检查地址，为空时使用 env.profile 环境的地址，环境也没有时与 API 服务器相同"`
+	PinVersion string `json:"pin_version" key:"UPDATE_PIN_VERSION" pattern:"^(v?[0-9]+(\\.[0-9]+){0,2}(-[0-9A-Za-z.-]+)?)?$" desc:"固定版本（为空则跟随渠道最新版本），设置后只会更新到该版本"`
+}
+
+// FieldError 一个配置项的校验错误
+type FieldError struct {
+	Path    string `json:"path"` // 分组.字段，如 api.timeout
+	Key     string `json:"key"`  // config.env / 环境变量中的 key，未知字段为空
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("%s: %s", e.Path, e.Message)
+	}
+	return fmt.Sprintf("%s (%s): %s", e.Path, e.Key, e.Message)
+}
+
+// ValidationError 配置校验错误，包含所有出错的配置项
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// settingField 由 Settings 的结构体标签生成的配置项描述
+type settingField struct {
+	path    string
+	key     string
+	kind    reflect.Kind
+	index   []int
+	tag     reflect.StructTag
+	section string
+}
+
+// settingFields Settings 的全部配置项，按声明顺序排列
+var settingFields = buildSettingFields()
+
+func buildSettingFields() []settingField {
+	var fields []settingField
+	t := reflect.TypeOf(Settings{})
+	for i := 0; i < t.NumField(); i++ {
+		sec := t.Field(i)
+		for j := 0; j < sec.Type.NumField(); j++ {
+			f := sec.Type.Field(j)
+			fields = append(fields, settingField{
+				path:    sec.Tag.Get("json") + "." + f.Tag.Get("json"),
+				key:     f.Tag.Get("key"),
+				kind:    f.Type.Kind(),
+				index:   []int{i, j},
+				tag:     f.Tag,
+				section: sec.Tag.Get("json"),
+			})
+		}
+	}
+	return fields
+}
+
+// lookupSetting 按 key（如 TIMEOUT）或路径（如 api.timeout）查找配置项
+func lookupSetting(name string) (settingField, bool) {
+	for _, f := range settingFields {
+		if f.key == name || f.path == name {
+			return f, true
+		}
+	}
+	return settingField{}, false
+}
+
+// SettingKeys 返回所有类型化配置项的 key
+func SettingKeys() []string {
+	keys := make([]string, len(settingFields))
+	for i, f := range settingFields {
+		keys[i] = f.key
+	}
+	return keys
+}
+
+// DefaultSettings 返回默认配置，地址为 DefaultProfile 环境的地址
+func DefaultSettings() *Settings {
+	s := &Settings{}
+	v := reflect.ValueOf(s).Elem()
+	for _, f := range settingFields {
+		if def := f.tag.Get("default"); def != "" {
+			value, _ := f.parse(def)
+			v.FieldByIndex(f.index).Set(reflect.ValueOf(value))
+		}
+	}
+	// 地址的默认值来自 DefaultProfile，与 resolveProfile 一致
+	p := profiles[DefaultProfile]
+	s.API.URL, s.WS.URL, s.Worker.AuthURL = p.APIURL, p.WSURL, p.ProxyAuthURL
+	s.Update.URL = p.OTAURL
+	return s
+}
+
+// retiredKeys 旧版本 config.env 中已不再使用的配置项，读取时忽略，不作为未知配置项报告
+// 密钥和本地数据保存在数据目录（见 datadir），日志写入数据目录下的 libstudy.log，环境由 PROFILE 决定
+var retiredKeys = map[string]bool{
+	KeyLogFile:     true,
+	KeyKeypairPath: true,
+	KeyStoragePath: true,
+	KeyEnv:         true,
+}
+
+// knownKey 判断 config.env 中的 key 是否有效：类型化配置项、由环境提供默认值的地址、
+// 节点身份（包括其他环境带前缀的 key）或已不再使用的旧配置项
+func knownKey(key string) bool {
+	if retiredKeys[key] || profileScoped[key] {
+		return true
+	}
+	for _, f := range settingFields {
+		if f.key == key {
+			return true
+		}
+	}
+	for _, e := range profileEndpoints {
+		if e.key == key {
+			return true
+		}
+	}
+	for name := range profiles {
+		if prefix := strings.ToUpper(name) + "_"; strings.HasPrefix(key, prefix) && profileScoped[key[len(prefix):]] {
+			return true
+		}
+	}
+	return false
+}
+
+// Settings 解析并校验当前配置
+// 总是返回完整的 Settings，无效的配置项使用默认值；有无效配置项时同时返回 INVALID_CONFIG 错误，
+// 其中的 *ValidationError 列出每个出错的配置项（包括配置文件中的未知字段和 config.env 中的未知 key）
+func (c *Config) Settings() (*Settings, error) {
+	s := DefaultSettings()
+	v := reflect.ValueOf(s).Elem()
+
+	c.mu.RLock()
+	errs := append([]FieldError(nil), c.loadErrs...)
+	raw := make(map[string]string, len(settingFields))
+	for _, f := range settingFields {
+		raw[f.key] = c.data[f.key]
+	}
+	c.mu.RUnlock()
+
+	for _, f := range settingFields {
+		value := raw[f.key]
+		if value == "" {
+			continue
+		}
+		parsed, err := f.parse(value)
+		if err != nil {
+			errs = append(errs, FieldError{Path: f.path, Key: f.key, Message: err.Error()})
+			continue
+		}
+		v.FieldByIndex(f.index).Set(reflect.ValueOf(parsed))
+	}
+	if len(errs) > 0 {
+		return s, errcode.Errorf(errcode.InvalidConfig, "invalid config: %w", &ValidationError{Fields: errs})
+	}
+	return s, nil
+}
+
+// Validate 校验当前配置，等价于丢弃 Settings 的返回值
+func (c *Config) Validate() error {
+	_, err := c.Settings()
+	return err
+}
+
+// ValidateValue 校验 key 的取值，非类型化的 key（如 CLIENT_ID）不校验，空值表示恢复默认值
+func ValidateValue(key, value string) error {
+	f, ok := lookupSetting(key)
+	if !ok || value == "" {
+		return nil
+	}
+	if _, err := f.parse(value); err != nil {
+		return errcode.Errorf(errcode.InvalidConfig, "invalid config: %w",
+			&ValidationError{Fields: []FieldError{{Path: f.path, Key: f.key, Message: err.Error()}}})
+	}
+	return nil
+}
+
+// SetSetting 按路径（如 api.timeout）或 key 设置一个类型化配置项并写入 config.env
+// value 可以是字符串、整数、布尔值或 JSON 数字，类型或取值不合法时返回 INVALID_CONFIG，配置不变
+func (c *Config) SetSetting(name string, value interface{}) error {
+	f, ok := lookupSetting(name)
+	if !ok {
+		return errcode.Errorf(errcode.InvalidConfig, "unknown setting %q", name)
+	}
+	raw, err := formatScalar(value)
+	if err != nil {
+		return errcode.Errorf(errcode.InvalidConfig, "invalid config: %w",
+			&ValidationError{Fields: []FieldError{{Path: f.path, Key: f.key, Message: err.Error()}}})
+	}
+	return c.SetAndSave(f.key, raw)
+}
+
+// parse 把字符串解析为字段类型的值并校验
+func (f settingField) parse(raw string) (interface{}, error) {
+	raw = strings.TrimSpace(raw)
+	switch f.kind {
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %q", raw)
+		}
+		if min, ok := f.intTag("min"); ok && n < min {
+			return nil, fmt.Errorf("must be at least %d, got %d", min, n)
+		}
+		if max, ok := f.intTag("max"); ok && n > max {
+			return nil, fmt.Errorf("must be at most %d, got %d", max, n)
+		}
+		return n, nil
+	case reflect.Bool:
+		switch strings.ToLower(raw) {
+		case "true", "1", "yes", "on":
+			return true, nil
+		case "false", "0", "no", "off":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid boolean %q", raw)
+	default:
+		if enum := f.enum(); len(enum) > 0 && raw != "" {
+			found := false
+			for _, e := range enum {
+				found = found || e == raw
+			}
+			if !found {
+				return nil, fmt.Errorf("must be one of %s, got %q", strings.Join(enum, ", "), raw)
+			}
+		}
+		if f.tag.Get("format") == "uri" && raw != "" {
+			u, err := url.Parse(raw)
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				return nil, fmt.Errorf("invalid URL %q", raw)
+			}
+		}
+		if pattern := f.tag.Get("pattern"); pattern != "" && !regexp.MustCompile(pattern).MatchString(raw) {
+			return nil, fmt.Errorf("%q does not match %s", raw, pattern)
+		}
+		return raw, nil
+	}
+}
+
+func (f settingField) intTag(name string) (int, bool) {
+	v := f.tag.Get(name)
+	if v == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(v)
+	return n, err == nil
+}
+
+func (f settingField) enum() []string {
+	if v := f.tag.Get("enum"); v != "" {
+		return strings.Split(v, ",")
+	}
+	return nil
+}
+
+// formatScalar 把 YAML/JSON 中的标量转换为 config.env 中的字符串
+func formatScalar(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		if v != float64(int64(v)) {
+			return "", fmt.Errorf("must be an integer, got %v", v)
+		}
+		return strconv.FormatInt(int64(v), 10), nil
+	case interface{ String() string }: // json.Number
+		return v.String(), nil
+	default:
+		return "", fmt.Errorf("must be a string, number or boolean, got %T", value)
+	}
+}
+
+// applyDocument 把 YAML/JSON 配置文档中的配置项写入 set，返回未知字段和无法识别的值
+func applyDocument(doc map[string]interface{}, set func(key, value string)) []FieldError {
+	var errs []FieldError
+	for _, secName := range sortedKeys(doc) {
+		known := false
+		for _, f := range settingFields {
+			known = known || f.section == secName
+		}
+		if !known {
+			errs = append(errs, FieldError{Path: secName, Message: "unknown section"})
+			continue
+		}
+		section, ok := doc[secName].(map[string]interface{})
+		if !ok {
+			if doc[secName] != nil {
+				errs = append(errs, FieldError{Path: secName, Message: "must be an object"})
+			}
+			continue
+		}
+		for _, name := range sortedKeys(section) {
+			path := secName + "." + name
+			f, ok := lookupSetting(path)
+			if !ok {
+				errs = append(errs, FieldError{Path: path, Message: "unknown field"})
+				continue
+			}
+			if section[name] == nil {
+				continue
+			}
+			raw, err := formatScalar(section[name])
+			if err != nil {
+				errs = append(errs, FieldError{Path: path, Key: f.key, Message: err.Error()})
+				continue
+			}
+			set(f.key, raw)
+		}
+	}
+	return errs
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Schema 返回 Settings 的 JSON Schema（draft-07），供 UI 生成设置界面和校验输入
+// 结构与 YAML/JSON 配置文件相同，每个字段的 x-env 为 config.env / 环境变量中的 key
+func Schema() map[string]interface{} {
+	sections := map[string]interface{}{}
+	t := reflect.TypeOf(Settings{})
+	for i := 0; i < t.NumField(); i++ {
+		sec := t.Field(i)
+		name := sec.Tag.Get("json")
+		properties := map[string]interface{}{}
+		for _, f := range settingFields {
+			if f.section == name {
+				properties[strings.TrimPrefix(f.path, name+".")] = f.schema()
+			}
+		}
+		sections[name] = map[string]interface{}{
+			"type":                 "object",
+			"description":          sec.Tag.Get("desc"),
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	}
+	return map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"title":                "ARO Configuration Schema",
+		"description":          "统一的配置架构，由 core/internal/config.Settings 生成，请勿手工修改",
+		"type":                 "object",
+		"properties":           sections,
+		"additionalProperties": false,
+	}
+}
+
+func (f settingField) schema() map[string]interface{} {
+	s := map[string]interface{}{
+		"description": f.tag.Get("desc"),
+		"x-env":       f.key,
+	}
+	switch f.kind {
+	case reflect.Int:
+		s["type"] = "integer"
+		if min, ok := f.intTag("min"); ok {
+			s["minimum"] = min
+		}
+		if max, ok := f.intTag("max"); ok {
+			s["maximum"] = max
+		}
+	case reflect.Bool:
+		s["type"] = "boolean"
+	default:
+		s["type"] = "string"
+		if enum := f.enum(); len(enum) > 0 {
+			s["enum"] = enum
+		}
+		if format := f.tag.Get("format"); format != "" {
+			s["format"] = format
+		}
+		if pattern := f.tag.Get("pattern"); pattern != "" {
+			s["pattern"] = pattern
+		}
+	}
+	if def := f.tag.Get("default"); def != "" {
+		s["default"], _ = f.parse(def)
+	}
+	return s
+}
+
+// structuredFiles YAML/JSON 配置文件名，按顺序使用第一个存在的文件
+var structuredFiles = []string{"config.yaml", "config.yml", "config.json"}
+
+// loadStructured 读取 dir 下的 YAML/JSON 配置文件，语法错误、未知字段和无法识别的值记录到 loadErrs
+func (c *Config) loadStructured(dir string) {
+	for _, name := range structuredFiles {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var doc map[string]interface{}
+		if filepath.Ext(name) == ".json" {
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.UseNumber()
+			err = dec.Decode(&doc)
+		} else {
+			err = yaml.Unmarshal(data, &doc)
+		}
+		if err != nil {
+			c.loadErrs = append(c.loadErrs, FieldError{Path: name, Message: err.Error()})
+			log.Printf("Failed to parse %s: %v", path, err)
+			return
+		}
+		errs := applyDocument(doc, func(key, value string) { c.data[key] = value })
+		for _, e := range errs {
+			e.Path = name + ": " + e.Path
+			c.loadErrs = append(c.loadErrs, e)
+			log.Printf("Ignoring %s", e.Error())
+		}
+		c.structuredPath = path
+		log.Printf("Config loaded from: %s", path)
+		return
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"aro-ext-app/core/internal/errcode"
+)
+
+func TestSettingsDefaults(t *testing.T) {
+	s, err := New(t.TempDir()).Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, DefaultSettings()) {
+		t.Errorf("expected the defaults, got %+v", s)
+	}
+	if s.API.Timeout != 30 || s.Logging.Level != LogLevelInfo || s.Logging.Debug || s.Storage.KeyType != "ed25519" {
+		t.Errorf("unexpected defaults %+v", s)
+	}
+}
+
+func TestSettingsReportFieldPaths(t *testing.T) {
+	cfg := New(t.TempDir())
+	cfg.Set(KeyTimeout, "3o")
+	cfg.Set(KeyLogLevel, "verbose")
+	cfg.Set(KeyRetryCount, "11")
+
+	s, err := cfg.Settings()
+	if errcode.Of(err) != errcode.InvalidConfig {
+		t.Fatalf("expected INVALID_CONFIG, got %v", err)
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Fields) != 3 {
+		t.Fatalf("expected three field errors, got %v", err)
+	}
+	paths := map[string]bool{}
+	for _, f := range verr.Fields {
+		paths[f.Path] = true
+	}
+	for _, p := range []string{"api.timeout", "api.retry_count", "logging.level"} {
+		if !paths[p] {
+			t.Errorf("expected an error for %s, got %v", p, verr.Fields)
+		}
+	}
+	if s.API.Timeout != 30 || s.Logging.Level != LogLevelInfo {
+		t.Errorf("expected invalid values to fall back to the defaults, got %+v", s.API)
+	}
+}
+
+func TestSettingsPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	yamlDoc := "api:\n  timeout: 45\n  retry_count: 5\n  heartbeat_interval: 100\nlogging:\n  levle: debug\n  debug: yes\nbogus: {}\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(yamlDoc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.env"), []byte("RETRY_COUNT=7\nRETRY_CUONT=8\nENV=testnet\nMAINNET_CLIENT_ID=id\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(KeyHeartbeatInterval, "200")
+
+	s, err := New(dir).Settings()
+	if s.API.Timeout != 45 || s.API.RetryCount != 7 || s.API.HeartbeatInterval != 200 || !s.Logging.Debug {
+		t.Errorf("expected yaml < config.env < environment, got %+v %+v", s.API, s.Logging)
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Fields) != 3 {
+		t.Fatalf("expected the unknown section, field and key to be reported, got %v", err)
+	}
+	if verr.Fields[0].Path != "config.yaml: bogus" || verr.Fields[1].Path != "config.yaml: logging.levle" || verr.Fields[2].Path != "config.env: RETRY_CUONT" {
+		t.Errorf("unexpected field errors %v", verr.Fields)
+	}
+}
+
+func TestSettingsFromJSON(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"api":{"url":"http://localhost:8080","timeout":12.5},"update":{"channel":"beta"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(dir).Settings()
+	if s.API.URL != "http://localhost:8080" || s.Update.Channel != "beta" {
+		t.Errorf("expected values from config.json, got %+v", s)
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Fields) != 1 || verr.Fields[0].Key != KeyTimeout {
+		t.Errorf("expected a non-integer timeout to be reported, got %v", err)
+	}
+}
+
+func TestSetAndSaveValidates(t *testing.T) {
+	dir := t.TempDir()
+	cfg := New(dir)
+	if err := cfg.SetAndSave(KeyTimeout, "0"); errcode.Of(err) != errcode.InvalidConfig {
+		t.Fatalf("expected an out of range timeout to be rejected, got %v", err)
+	}
+	if cfg.Get(KeyTimeout) != "30" {
+		t.Errorf("expected the rejected value not to be stored, got %s", cfg.Get(KeyTimeout))
+	}
+	if err := cfg.SetSetting("api.timeout", 60); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.SetSetting("logging.debug", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.SetSetting("api.timeout", "soon"); errcode.Of(err) != errcode.InvalidConfig {
+		t.Errorf("expected a typed error, got %v", err)
+	}
+	if err := cfg.SetSetting("api.timeot", 60); errcode.Of(err) != errcode.InvalidConfig {
+		t.Errorf("expected an unknown setting to be rejected, got %v", err)
+	}
+	if err := cfg.SetAndSave(KeyClientId, "any value"); err != nil {
+		t.Errorf("expected untyped keys to be saved as is: %v", err)
+	}
+
+	s, err := New(dir).Settings()
+	if err != nil || s.API.Timeout != 60 || !s.Logging.Debug {
+		t.Errorf("expected the typed values to be saved, got %+v %v", s, err)
+	}
+}
+
+// TestSchemaFileUpToDate config.schema.json 由 Schema 生成，修改 Settings 后用 UPDATE_SCHEMA=1 重新生成
+func TestSchemaFileUpToDate(t *testing.T) {
+	data, err := json.MarshalIndent(Schema(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, '\n')
+	if os.Getenv("UPDATE_SCHEMA") == "1" {
+		if err := os.WriteFile("config.schema.json", data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	current, err := os.ReadFile("config.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(current) != string(data) {
+		t.Error("config.schema.json is out of date, run the config tests with UPDATE_SCHEMA=1")
+	}
+}
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"aro-ext-app/core/internal/datadir"
+)
+
+// DefaultWatchInterval Watch 检查配置文件变化的默认间隔
+const DefaultWatchInterval = 2 * time.Second
+
+// Change 重新加载时一个配置项的变化
+type Change struct {
+	Key  string `json:"key"`
+	Path string `json:"path,omitempty"` // 类型化配置项的路径（如 api.timeout），其他 key 为空
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// ReloadEvent 一次重新加载的结果，发送给 Subscribe 注册的订阅者
+// Err 非空表示新配置无效被拒绝，之前的配置保持不变；否则 Settings 为新配置，Changes 列出变化的配置项
+type ReloadEvent struct {
+	Settings *Settings
+	Changes  []Change
+	Err      error
+}
+
+// Changed 返回 keys 中是否有配置项发生了变化
+func (e ReloadEvent) Changed(keys ...string) bool {
+	for _, ch := range e.Changes {
+		for _, key := range keys {
+			if ch.Key == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReloadStatus 配置文件和重新加载的状态，时间为 Unix 秒，0 表示尚未发生
+type ReloadStatus struct {
+	Path       string `json:"path"`                 // 当前的 config.env，为空时 SetAndSave 写入数据目录
+	Structured string `json:"structured,omitempty"` // 当前的 YAML/JSON 配置文件
+	Watching   bool   `json:"watching"`
+	LastReload int64  `json:"last_reload"`
+	// LastError 最近一次被拒绝的重新加载，之后成功重新加载时清空
+	LastError string `json:"last_error,omitempty"`
+	// Errors 当前配置中的无效配置项，这些配置项使用默认值
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// Subscribe 注册配置变化的订阅者，返回取消函数
+// 重新加载后有配置项变化或新配置被拒绝时调用 fn，fn 在重新加载的 goroutine 中同步执行，不应阻塞
+func (c *Config) Subscribe(fn func(ReloadEvent)) (cancel func()) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	if c.subs == nil {
+		c.subs = make(map[int]func(ReloadEvent))
+	}
+	c.subID++
+	id := c.subID
+	c.subs[id] = fn
+	return func() {
+		c.subMu.Lock()
+		defer c.subMu.Unlock()
+		delete(c.subs, id)
+	}
+}
+
+func (c *Config) notify(ev ReloadEvent) {
+	c.subMu.Lock()
+	subs := make([]func(ReloadEvent), 0, len(c.subs))
+	for _, fn := range c.subs {
+		subs = append(subs, fn)
+	}
+	c.subMu.Unlock()
+	for _, fn := range subs {
+		fn(ev)
+	}
+}
+
+// Reload 重新加载配置（从文件和环境变量），用于切换数据目录等必须生效的场合
+// 无效的配置项与 Settings 一样使用默认值；配置有变化时通知订阅者
+func (c *Config) Reload() {
+	c.apply(c.load())
+}
+
+// ReloadChecked 重新加载配置，新配置无效（见 Settings）或切换了环境（PROFILE）时拒绝，保留之前的配置，
+// 错误记录在 Status 中并通知订阅者；成功时返回变化的配置项
+func (c *Config) ReloadChecked() ([]Change, error) {
+	next := c.load()
+	err := c.checkProfile(next)
+	if err == nil {
+		_, err = next.Settings()
+	}
+	if err != nil {
+		c.mu.Lock()
+		c.lastError = err.Error()
+		c.mu.Unlock()
+		log.Printf("Rejected config reload, keeping the previous config: %v", err)
+		c.notify(ReloadEvent{Err: err})
+		return nil, err
+	}
+	return c.apply(next), nil
+}
+
+// load 按与 GetConfig / New 相同的顺序把配置读到一个新的 Config 中，不影响当前配置
+func (c *Config) load() *Config {
+	next := &Config{data: make(map[string]string), dir: c.dir}
+	next.loadDefaults()
+	next.loadFromFile()
+	next.loadFromEnv()
+	next.resolveProfile()
+	return next
+}
+
+// apply 用 next 替换当前配置，返回按 key 排序的变化，有变化时通知订阅者
+func (c *Config) apply(next *Config) []Change {
+	c.mu.Lock()
+	var changes []Change
+	for key, value := range next.data {
+		if old := c.data[key]; old != value {
+			changes = append(changes, Change{Key: key, Old: old, New: value})
+		}
+	}
+	for key, old := range c.data {
+		if _, ok := next.data[key]; !ok && old != "" {
+			changes = append(changes, Change{Key: key, Old: old})
+		}
+	}
+	c.data = next.data
+	c.path = next.path
+	c.structuredPath = next.structuredPath
+	c.loadErrs = next.loadErrs
+	c.lastReload = time.Now()
+	c.lastError = ""
+	c.mu.Unlock()
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	for i := range changes {
+		if f, ok := lookupSetting(changes[i].Key); ok {
+			changes[i].Path = f.path
+		}
+	}
+	if len(changes) > 0 {
+		settings, _ := c.Settings()
+		c.notify(ReloadEvent{Settings: settings, Changes: changes})
+	}
+	return changes
+}
+
+// Status 返回配置文件和重新加载的状态
+func (c *Config) Status() ReloadStatus {
+	_, err := c.Settings()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	st := ReloadStatus{
+		Path:       c.path,
+		Structured: c.structuredPath,
+		Watching:   c.watching > 0,
+		LastError:  c.lastError,
+	}
+	if !c.lastReload.IsZero() {
+		st.LastReload = c.lastReload.Unix()
+	}
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		st.Errors = verr.Fields
+	}
+	return st
+}
+
+// Watch 定期检查配置文件（config.env 和 YAML/JSON 配置文件）的修改时间和大小，变化时调用 ReloadChecked，直到 ctx 结束
+// interval <= 0 时使用 DefaultWatchInterval；使用轮询而不是文件系统通知，在所有平台（包括移动端）上行为一致
+func (c *Config) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	last := c.fingerprint()
+	c.mu.Lock()
+	c.watching++
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.watching--
+		c.mu.Unlock()
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if c.fingerprint() == last {
+			continue
+		}
+		if changes, err := c.ReloadChecked(); err == nil && len(changes) > 0 {
+			log.Printf("Config reloaded, %d setting(s) changed", len(changes))
+		}
+		// 重新加载可能换了 config.env 的位置
+		last = c.fingerprint()
+	}
+}
+
+// watchedFiles 当前可能影响配置的文件：config.env 和 YAML/JSON 配置文件（包括尚未创建的）
+func (c *Config) watchedFiles() []string {
+	c.mu.RLock()
+	path, dir := c.path, c.dir
+	c.mu.RUnlock()
+	if dir == "" {
+		dir = datadir.Get()
+	}
+	if path == "" {
+		path = filepath.Join(dir, "config.env")
+	}
+	files := []string{path}
+	for _, name := range structuredFiles {
+		files = append(files, filepath.Join(dir, name))
+	}
+	return files
+}
+
+// fingerprint 由被监视文件的修改时间和大小生成，不存在的文件记为 -
+func (c *Config) fingerprint() string {
+	var fp string
+	for _, path := range c.watchedFiles() {
+		if info, err := os.Stat(path); err == nil {
+			fp += fmt.Sprintf("%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())
+		} else {
+			fp += path + ":-;"
+		}
+	}
+	return fp
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"aro-ext-app/core/internal/errcode"
+)
+
+func TestReloadCheckedNotifiesChanges(t *testing.T) {
+	dir := t.TempDir()
+	cfg := New(dir)
+	var got []ReloadEvent
+	cancel := cfg.Subscribe(func(ev ReloadEvent) { got = append(got, ev) })
+	defer cancel()
+
+	if err := os.WriteFile(filepath.Join(dir, "config.env"), []byte("LOG_LEVEL=debug\nHEARTBEAT_INTERVAL=60\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := cfg.ReloadChecked()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Key != KeyHeartbeatInterval || changes[0].Path != "api.heartbeat_interval" ||
+		changes[0].Old != "180" || changes[0].New != "60" || changes[1].Key != KeyLogLevel {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	if len(got) != 1 || !got[0].Changed(KeyLogLevel) || got[0].Changed(KeyTimeout) || got[0].Settings.API.HeartbeatInterval != 60 {
+		t.Fatalf("expected one event with the new settings, got %+v", got)
+	}
+
+	if changes, err := cfg.ReloadChecked(); err != nil || len(changes) != 0 || len(got) != 1 {
+		t.Errorf("expected an unchanged reload not to notify, got %v %v %d", changes, err, len(got))
+	}
+}
+
+func TestReloadCheckedKeepsPreviousConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.env")
+	if err := os.WriteFile(path, []byte("TIMEOUT=45\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := New(dir)
+	var got []ReloadEvent
+	cfg.Subscribe(func(ev ReloadEvent) { got = append(got, ev) })
+
+	if err := os.WriteFile(path, []byte("TIMEOUT=45s\nLOG_LEVEL=debug\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.ReloadChecked(); errcode.Of(err) != errcode.InvalidConfig {
+		t.Fatalf("expected INVALID_CONFIG, got %v", err)
+	}
+	if cfg.Get(KeyTimeout) != "45" || cfg.Get(KeyLogLevel) != LogLevelInfo {
+		t.Errorf("expected the previous config to be kept, got %s %s", cfg.Get(KeyTimeout), cfg.Get(KeyLogLevel))
+	}
+	if len(got) != 1 || got[0].Err == nil {
+		t.Errorf("expected subscribers to see the rejection, got %+v", got)
+	}
+	if st := cfg.Status(); st.LastError == "" || st.Path != path || len(st.Errors) != 0 {
+		t.Errorf("expected the rejection in the status, got %+v", st)
+	}
+
+	if err := os.WriteFile(path, []byte("TIMEOUT=50\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.ReloadChecked(); err != nil {
+		t.Fatal(err)
+	}
+	if st := cfg.Status(); st.LastError != "" || st.LastReload == 0 {
+		t.Errorf("expected a successful reload to clear the error, got %+v", st)
+	}
+}
+
+func TestWatchReloadsOnChange(t *testing.T) {
+	dir := t.TempDir()
+	cfg := New(dir)
+	changed := make(chan ReloadEvent, 1)
+	cfg.Subscribe(func(ev ReloadEvent) { changed <- ev })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cfg.Watch(ctx, 10*time.Millisecond)
+	for !cfg.Status().Watching {
+		time.Sleep(time.Millisecond)
+	}
+
+	// config.yaml 尚不存在，新建的文件也应被发现
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("worker:\n  restart_delay: 9\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-changed:
+		if ev.Err != nil || !ev.Changed(KeyWorkerRestartDelay) || ev.Settings.Worker.RestartDelay != 9 {
+			t.Errorf("unexpected event %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("config change was not picked up")
+	}
+}
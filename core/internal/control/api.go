@@ -0,0 +1,233 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"aro-ext-app/core/internal/clock"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/events"
+	"aro-ext-app/core/internal/ledger"
+	"aro-ext-app/core/internal/netcheck"
+	"aro-ext-app/core/internal/proxy_worker"
+	"aro-ext-app/core/version"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 接口参数上限
+const (
+	defaultLogLines = 200
+	maxLogLines     = 5000
+	maxLogBytes     = 4 << 20
+	maxEventTimeout = 60 * time.Second
+	maxEvents       = 256
+)
+
+// register 注册路由，所有接口都需要令牌
+func (s *Server) register(r *gin.Engine, token string) {
+	r.Use(gin.Recovery())
+	if s.opts.AccessLog {
+		r.Use(gin.Logger())
+	}
+
+	router := r.Group("")
+	router.Use(mwTokenAuth(token))
+
+	router.GET("/status", s.getStatus)
+	router.GET("/events", s.getEvents)
+	router.GET("/logs", s.getLogs)
+
+	router.POST("/worker/start", s.startWorker)
+	router.POST("/worker/stop", s.stopWorker)
+	router.POST("/worker/restart", s.restartWorker)
+
+	router.POST("/config/reload", s.reloadConfig)
+	router.POST("/nat", s.detectNat)
+}
+
+func writeError(c *gin.Context, status int, msg string) {
+	c.JSON(status, Response{Code: status, Msg: msg})
+}
+
+// Status /status 响应数据
+type Status struct {
+	Version   string                    `json:"version"`
+	PID       int                       `json:"pid"`
+	Uptime    int64                     `json:"uptime"` // 秒
+	Node      interface{}               `json:"node,omitempty"`
+	Worker    proxy_worker.WorkerStatus `json:"worker"`
+	Heartbeat interface{}               `json:"heartbeat,omitempty"`
+	Clock     clock.Status              `json:"clock"`
+	Config    config.ReloadStatus       `json:"config"`
+}
+
+// getStatus 对应 GetProxyWorkerStatus / GetCurrentVersion
+func (s *Server) getStatus(c *gin.Context) {
+	status := Status{
+		Version: version.VERSION,
+		PID:     os.Getpid(),
+		Uptime:  int64(time.Since(s.start).Seconds()),
+		Worker:  s.opts.Worker.GetStatus(),
+		Clock:   s.opts.Clock.Status(),
+		Config:  s.opts.Config.Status(),
+	}
+	if s.opts.NodeInfo != nil {
+		status.Node = s.opts.NodeInfo()
+	}
+	if s.opts.Heartbeat != nil {
+		status.Heartbeat = s.opts.Heartbeat()
+	}
+	c.JSON(http.StatusOK, Response{Data: status})
+}
+
+// getEvents 对应 PollEvents，参数 cursor、timeout_ms
+func (s *Server) getEvents(c *gin.Context) {
+	cursor, _ := strconv.ParseUint(c.Query("cursor"), 10, 64)
+	timeoutMs, _ := strconv.Atoi(c.Query("timeout_ms"))
+
+	bus := s.opts.Events
+	if timeoutMs <= 0 {
+		c.JSON(http.StatusOK, Response{Data: bus.Since(cursor, maxEvents)})
+		return
+	}
+	timeout := time.Duration(timeoutMs) * time.Millisecond
+	if timeout > maxEventTimeout {
+		timeout = maxEventTimeout
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+	c.JSON(http.StatusOK, Response{Data: bus.Wait(ctx, cursor, maxEvents)})
+}
+
+// getLogs 返回日志文件最后 lines 行
+func (s *Server) getLogs(c *gin.Context) {
+	if s.opts.LogFile == "" {
+		writeError(c, http.StatusNotFound, "log file is not configured")
+		return
+	}
+	lines, err := strconv.Atoi(c.DefaultQuery("lines", strconv.Itoa(defaultLogLines)))
+	if err != nil || lines <= 0 {
+		writeError(c, http.StatusBadRequest, "lines must be a positive integer")
+		return
+	}
+	if lines > maxLogLines {
+		lines = maxLogLines
+	}
+
+	tail, err := tailFile(s.opts.LogFile, lines)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, Response{Data: tail})
+}
+
+// tailFile 读取文件最后 n 行（最多读取 maxLogBytes 字节）
+func tailFile(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size() - maxLogBytes
+	if offset < 0 {
+		offset = 0
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.TrimRight(data, "\n")
+	if len(data) == 0 {
+		return []string{}, nil
+	}
+	lines := strings.Split(string(data), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// startWorker 对应 StartProxyWorker，请求体为 ProxyWorkerConfig，auth_url 为空时使用环境的 PROXY_AUTH_URL
+func (s *Server) startWorker(c *gin.Context) {
+	var workerConfig proxy_worker.ProxyWorkerConfig
+	if err := c.ShouldBindJSON(&workerConfig); err != nil {
+		writeError(c, http.StatusBadRequest, fmt.Sprintf("JSON parsing failed: %s", err))
+		return
+	}
+	workerConfig.ApplyProfile(s.opts.Config.Profile().ProxyAuthURL)
+	manager := s.opts.Worker
+	if err := manager.Start(workerConfig); err != nil {
+		writeError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, Response{Msg: "OK", Data: manager.GetStatus()})
+}
+
+// stopWorker 对应 StopProxyWorker
+func (s *Server) stopWorker(c *gin.Context) {
+	if err := s.opts.Worker.Stop(); err != nil {
+		writeError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, Response{Msg: "OK"})
+}
+
+// restartWorker 对应 RestartProxyWorker
+func (s *Server) restartWorker(c *gin.Context) {
+	manager := s.opts.Worker
+	authURL := s.opts.Config.Profile().ProxyAuthURL
+	if err := manager.RestartWith(func(c *proxy_worker.ProxyWorkerConfig) { c.ApplyProfile(authURL) }); err != nil {
+		writeError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, Response{Msg: "OK", Data: manager.GetStatus()})
+}
+
+// reloadConfig 重新加载配置文件和环境变量，新配置无效时保留之前的配置并返回 422
+// 成功时 data 为变化的配置项
+func (s *Server) reloadConfig(c *gin.Context) {
+	changes, err := s.opts.Config.ReloadChecked()
+	if err != nil {
+		writeError(c, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if changes == nil {
+		changes = []config.Change{}
+	}
+	c.JSON(http.StatusOK, Response{Msg: "OK", Data: changes})
+}
+
+// detectNat 执行 STUN NAT 检测，参数 timeout_ms 为单个服务器超时
+// 检测结束后发布 NAT 探测的 task.completed 事件，由账本记录
+func (s *Server) detectNat(c *gin.Context) {
+	timeoutMs, _ := strconv.Atoi(c.Query("timeout_ms"))
+	result, err := netcheck.Detect(c.Request.Context(), nil, time.Duration(timeoutMs)*time.Millisecond)
+	completed := events.TaskEvent{Kind: ledger.TaskNATProbe, Success: err == nil}
+	if err != nil {
+		completed.Error = err.Error()
+	}
+	s.opts.Events.Publish(events.TaskCompleted, completed)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, Response{Data: result})
+}
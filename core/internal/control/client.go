@@ -0,0 +1,103 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ErrUnavailable 节点没有运行控制服务（令牌文件不存在或无法连接）
+var ErrUnavailable = errors.New("control API unavailable")
+
+// Client 控制接口客户端，供 aro-node 子命令访问正在运行的节点
+type Client struct {
+	token string
+	base  string
+	http  *http.Client
+}
+
+// NewClient 创建客户端，network/addr 与服务端 Options 相同，token 从令牌文件读取
+func NewClient(network, addr, tokenFile string) (*Client, error) {
+	if network == "" {
+		network = "unix"
+	}
+	if addr == "" {
+		addr = DefaultSocketFile
+	}
+	if tokenFile == "" {
+		tokenFile = DefaultTokenFile
+	}
+	token, err := ReadToken(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read control token: %v", ErrUnavailable, err)
+	}
+
+	dialer := &net.Dialer{Timeout: 3 * time.Second}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+	base := "http://aro-node"
+	if network == "tcp" {
+		base = "http://" + addr
+	}
+	return &Client{
+		token: token,
+		base:  base,
+		http:  &http.Client{Transport: transport},
+	}, nil
+}
+
+// Do 发送请求，body 非空时编码为 JSON；响应 data 解码到 out（可为 nil）
+func (c *Client) Do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	var r struct {
+		Code int             `json:"code"`
+		Msg  string          `json:"msg"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("failed to parse response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("control API error: code=%d, message=%s", r.Code, r.Msg)
+	}
+	if out != nil && len(r.Data) > 0 {
+		return json.Unmarshal(r.Data, out)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package control
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/events"
+	"aro-ext-app/core/internal/proxy_worker"
+)
+
+func startServer(t *testing.T, opts Options) (*Server, string) {
+	t.Helper()
+	// unix socket 路径长度有限，使用短的临时目录
+	dir, err := os.MkdirTemp("", "aroctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	opts.Addr = filepath.Join(dir, "ctl.sock")
+	opts.TokenFile = filepath.Join(dir, "token")
+	s, err := NewServer(opts)
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	go s.Serve()
+	t.Cleanup(func() { s.Close() })
+	return s, dir
+}
+
+func TestTokenFilePermissions(t *testing.T) {
+	_, dir := startServer(t, Options{})
+
+	for _, name := range []string{"token", "ctl.sock"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("%s: expected mode 0600, got %o", name, perm)
+		}
+	}
+}
+
+func TestInsecureTokenIsReplaced(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("leaked\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadToken(path); err == nil {
+		t.Error("expected a world-readable token file to be refused")
+	}
+	token, err := LoadOrCreateToken(path)
+	if err != nil || token == "leaked" {
+		t.Fatalf("expected a new token, got %q, %v", token, err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %o", info.Mode().Perm())
+	}
+	if got, err := ReadToken(path); err != nil || got != token {
+		t.Errorf("expected the new token to be readable, got %q, %v", got, err)
+	}
+}
+
+func TestStatusRequiresToken(t *testing.T) {
+	_, dir := startServer(t, Options{NodeInfo: func() interface{} { return "node-1" }})
+	sock := filepath.Join(dir, "ctl.sock")
+
+	client, err := NewClient("unix", sock, filepath.Join(dir, "token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status Status
+	if err := client.Do(context.Background(), http.MethodGet, "/status", nil, &status); err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if status.PID != os.Getpid() || status.Node != "node-1" {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	bad := filepath.Join(dir, "bad-token")
+	os.WriteFile(bad, []byte("nope"), 0600)
+	client, _ = NewClient("unix", sock, bad)
+	err = client.Do(context.Background(), http.MethodGet, "/status", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected 401 error, got %v", err)
+	}
+}
+
+func TestLogsTail(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "node.log")
+	os.WriteFile(logFile, []byte("a\nb\nc\n"), 0644)
+	_, dir := startServer(t, Options{LogFile: logFile})
+
+	client, _ := NewClient("unix", filepath.Join(dir, "ctl.sock"), filepath.Join(dir, "token"))
+	var lines []string
+	if err := client.Do(context.Background(), http.MethodGet, "/logs?lines=2", nil, &lines); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(lines, ",") != "b,c" {
+		t.Errorf("expected [b c], got %v", lines)
+	}
+}
+
+func TestEventsUseNodeBus(t *testing.T) {
+	bus := events.NewBus(16)
+	_, dir := startServer(t, Options{Events: bus})
+	bus.Publish(events.ConfigReloaded, events.ConfigEvent{Keys: []string{"API_URL"}})
+	events.Publish(events.ConfigRejected, events.ConfigEvent{Error: "other node"})
+
+	client, _ := NewClient("unix", filepath.Join(dir, "ctl.sock"), filepath.Join(dir, "token"))
+	var batch events.Batch
+	if err := client.Do(context.Background(), http.MethodGet, "/events", nil, &batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Events) != 1 || batch.Events[0].Type != events.ConfigReloaded {
+		t.Errorf("expected only the node's event, got %+v", batch.Events)
+	}
+}
+
+// TestWorkerUsesProfileAuthURL 请求中没有 auth_url 时使用环境的 PROXY_AUTH_URL，否则启用认证的配置无法通过校验
+func TestWorkerUsesProfileAuthURL(t *testing.T) {
+	bus := events.NewBus(16)
+	worker := proxy_worker.NewManager("control-test", bus)
+	_, dir := startServer(t, Options{Config: config.New(t.TempDir()), Events: bus, Worker: worker})
+	defer func() {
+		if worker.IsRunning() {
+			worker.Stop()
+		}
+	}()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	localPort := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	body := proxy_worker.ProxyWorkerConfig{
+		SN:              "sn",
+		Token:           "token",
+		TunnelID:        "4f8e1c2a-6b3d-4e5f-8a9b-0c1d2e3f4a5b",
+		ProxyServerIP:   "127.0.0.1",
+		ProxyServerPort: 1,
+		LocalPort:       localPort,
+		DisableTLS:      true,
+		EnableAuth:      true,
+		AuthCacheDir:    t.TempDir(),
+	}
+	client, _ := NewClient("unix", filepath.Join(dir, "ctl.sock"), filepath.Join(dir, "token"))
+	if err := client.Do(context.Background(), http.MethodPost, "/worker/start", body, nil); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if err := client.Do(context.Background(), http.MethodPost, "/worker/restart", nil, nil); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	if !worker.IsRunning() {
+		t.Error("expected the worker to be running after restart")
+	}
+}
+
+func TestTCPRequiresLoopback(t *testing.T) {
+	if _, err := listen("tcp", "0.0.0.0:0"); err == nil {
+		t.Error("expected non-loopback address to be rejected")
+	}
+}
@@ -0,0 +1,165 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"aro-ext-app/core/internal/clock"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/events"
+	"aro-ext-app/core/internal/proxy_worker"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 默认文件名，相对节点工作目录
+const (
+	DefaultSocketFile = "aro-node.sock"
+	DefaultTokenFile  = "aro-node.token"
+)
+
+// Response 控制接口统一响应结构（与 GOST api 包保持一致）
+type Response struct {
+	Code int         `json:"code,omitempty"`
+	Msg  string      `json:"msg,omitempty"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Options 控制服务配置
+type Options struct {
+	// Network 监听网络，unix（默认）或 tcp
+	Network string
+	// Addr unix socket 路径或 tcp 地址（tcp 只允许 localhost）
+	Addr string
+	// TokenFile 令牌文件路径
+	TokenFile string
+	// LogFile 节点日志文件，供 /logs 接口读取，为空时 /logs 不可用
+	LogFile string
+	// NodeInfo 返回附加到 /status 中的节点信息（client ID 等），可为空
+	NodeInfo func() interface{}
+	// Heartbeat 返回附加到 /status 中的心跳状态（最近一次成功时间等），可为空
+	Heartbeat func() interface{}
+	// AccessLog 是否记录访问日志
+	AccessLog bool
+
+	// 节点状态，为空时使用进程级单例（全局配置、事件总线、时钟和 worker）
+	Config *config.Config
+	Events *events.Bus
+	Clock  *clock.Clock
+	Worker *proxy_worker.Manager
+}
+
+// Server 节点本地控制服务，提供与 libstudy 导出函数对应的 JSON-over-HTTP 接口
+type Server struct {
+	s     *http.Server
+	ln    net.Listener
+	opts  Options
+	start time.Time
+}
+
+// NewServer 创建控制服务并开始监听，需要调用 Serve 处理请求
+func NewServer(opts Options) (*Server, error) {
+	if opts.Network == "" {
+		opts.Network = "unix"
+	}
+	if opts.Addr == "" {
+		opts.Addr = DefaultSocketFile
+	}
+	if opts.TokenFile == "" {
+		opts.TokenFile = DefaultTokenFile
+	}
+	if opts.Config == nil {
+		opts.Config = config.GetConfig()
+	}
+	if opts.Events == nil {
+		opts.Events = events.GetBus()
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.GetClock()
+	}
+	if opts.Worker == nil {
+		opts.Worker = proxy_worker.GetManager()
+	}
+
+	token, err := LoadOrCreateToken(opts.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := listen(opts.Network, opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	s := &Server{
+		ln:    ln,
+		opts:  opts,
+		start: time.Now(),
+	}
+	s.register(r, token)
+	s.s = &http.Server{Handler: r}
+	return s, nil
+}
+
+// listen 监听控制地址；unix socket 权限设为 0600，tcp 只允许回环地址
+func listen(network, addr string) (net.Listener, error) {
+	switch network {
+	case "unix":
+		// 上次异常退出可能遗留 socket 文件，确认无人监听后删除
+		if _, err := os.Stat(addr); err == nil {
+			if conn, err := net.Dial("unix", addr); err == nil {
+				conn.Close()
+				return nil, fmt.Errorf("control socket %s is already in use", addr)
+			}
+			os.Remove(addr)
+		}
+		ln, err := net.Listen("unix", addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		if err := os.Chmod(addr, 0600); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("failed to restrict control socket: %w", err)
+		}
+		return ln, nil
+	case "tcp":
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return nil, fmt.Errorf("control address must be a loopback address, got %s", addr)
+		}
+		return net.Listen("tcp", addr)
+	default:
+		return nil, fmt.Errorf("unsupported control network %q", network)
+	}
+}
+
+// Serve 处理请求直到 Close 被调用
+func (s *Server) Serve() error {
+	log.Printf("Control API listening on %s://%s", s.opts.Network, s.opts.Addr)
+	err := s.s.Serve(s.ln)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Addr 返回监听地址
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Close 关闭控制服务
+func (s *Server) Close() error {
+	// net.UnixListener 关闭时会删除 socket 文件
+	return s.s.Close()
+}
@@ -0,0 +1,97 @@
+package control
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tokenBytes 控制令牌的随机字节数
+const tokenBytes = 32
+
+// errInsecureToken 令牌文件不是普通文件、其他用户可以访问或不属于当前用户
+var errInsecureToken = errors.New("insecure control token file")
+
+// LoadOrCreateToken 读取令牌文件，不存在时生成新令牌并以 0600 权限写入，
+// 只有节点所属用户（和 root）能读取令牌，从而控制节点
+// 已有的令牌文件其他用户可以访问或不属于当前用户时，令牌可能已经泄露，删除后重新生成
+func LoadOrCreateToken(path string) (string, error) {
+	token, err := ReadToken(path)
+	if err == nil {
+		return token, nil
+	}
+	switch {
+	case errors.Is(err, errInsecureToken):
+		log.Printf("Control: %v, creating a new token", err)
+		if err := os.Remove(path); err != nil {
+			return "", fmt.Errorf("failed to remove insecure control token: %w", err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return "", err
+	}
+
+	buf := make([]byte, tokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate control token: %w", err)
+	}
+	token = hex.EncodeToString(buf)
+	// O_EXCL：不写入在删除之后被其他用户抢先创建的文件
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to write control token: %w", err)
+	}
+	_, err = f.WriteString(token + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to write control token: %w", err)
+	}
+	return token, nil
+}
+
+// ReadToken 读取令牌文件，拒绝其他用户可以访问或不属于当前用户（root 除外）的文件
+func ReadToken(path string) (string, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%w: %s is not a regular file", errInsecureToken, path)
+	}
+	if err := checkTokenOwner(path, info); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("control token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// mwTokenAuth 校验 Authorization: Bearer <token>
+func mwTokenAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.JSON(http.StatusUnauthorized, Response{
+				Code: http.StatusUnauthorized,
+				Msg:  "Unauthorized",
+			})
+			c.Abort()
+		}
+	}
+}
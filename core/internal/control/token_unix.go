@@ -0,0 +1,22 @@
+//go:build !windows
+
+package control
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkTokenOwner 令牌文件只有所有者可以访问（0600 或更严格），且属于当前用户；
+// root 可以读取节点所属用户的令牌，用于控制以其他用户运行的节点
+func checkTokenOwner(path string, info os.FileInfo) error {
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("%w: %s has mode %o, expected 0600", errInsecureToken, path, perm)
+	}
+	euid := os.Geteuid()
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && euid != 0 && int(st.Uid) != euid {
+		return fmt.Errorf("%w: %s is owned by uid %d, not the current user", errInsecureToken, path, st.Uid)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package control
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRootReadsOtherUsersToken(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("node-user\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(path, 65534, 65534); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := ReadToken(path); err != nil || token != "node-user" {
+		t.Errorf("expected root to read the token, got %q, %v", token, err)
+	}
+
+	// 权限过宽的令牌即使由 root 读取也拒绝
+	os.Chmod(path, 0644)
+	if _, err := ReadToken(path); err == nil {
+		t.Error("expected a world-readable token file to be refused")
+	}
+}
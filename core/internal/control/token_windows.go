@@ -0,0 +1,11 @@
+//go:build windows
+
+package control
+
+import "os"
+
+// checkTokenOwner Windows 的文件权限由 ACL 控制，令牌文件位于用户的数据目录（%APPDATA%）中，
+// 默认只有该用户和管理员可以访问，不做额外检查
+func checkTokenOwner(path string, info os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,182 @@
+package crashdump
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"aro-ext-app/core/internal/datadir"
+	"aro-ext-app/core/version"
+)
+
+// DefaultDir 默认崩溃报告目录（数据目录下的子目录，见 datadir 包）
+const DefaultDir = "crashes"
+
+// MaxReports 最多保留的崩溃报告数量，超出时删除最旧的
+const MaxReports = 20
+
+// Report 一次 panic 的崩溃报告
+type Report struct {
+	ID      string `json:"id"`
+	Time    int64  `json:"time"` // Unix 毫秒
+	Func    string `json:"func"`
+	Panic   string `json:"panic"`
+	Stack   string `json:"stack"`
+	Version string `json:"version"`
+	OS      string `json:"os"`
+	Arch    string `json:"arch"`
+}
+
+var (
+	mu  sync.Mutex
+	dir string // 为空时使用数据目录下的 DefaultDir
+)
+
+// SetDir 设置崩溃报告目录，为空时恢复默认目录
+func SetDir(d string) {
+	mu.Lock()
+	defer mu.Unlock()
+	dir = d
+}
+
+// Dir 返回当前崩溃报告目录
+func Dir() string {
+	mu.Lock()
+	defer mu.Unlock()
+	return currentDir()
+}
+
+// currentDir 返回崩溃报告目录，调用方持有 mu
+func currentDir() string {
+	if dir == "" {
+		return filepath.Join(datadir.Get(), DefaultDir)
+	}
+	return dir
+}
+
+// Write 将 panic 信息和堆栈写入崩溃报告文件，返回文件路径
+func Write(funcName string, r interface{}, stack []byte) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	dir := currentDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create crash dir: %w", err)
+	}
+	now := time.Now()
+	report := Report{
+		ID:      fmt.Sprintf("crash-%s-%d", now.Format("20060102-150405.000"), os.Getpid()),
+		Time:    now.UnixMilli(),
+		Func:    funcName,
+		Panic:   fmt.Sprint(r),
+		Stack:   string(stack),
+		Version: version.VERSION,
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, report.ID+".json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to write crash report: %w", err)
+	}
+	prune()
+	return path, nil
+}
+
+// Pending 返回尚未上传的崩溃报告，按时间从旧到新排序
+func Pending() ([]Report, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	files, err := list()
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]Report, 0, len(files))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		var report Report
+		if err := json.Unmarshal(data, &report); err != nil {
+			log.Printf("crashdump: dropping unreadable report %s: %v", f, err)
+			os.Remove(f)
+			continue
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// Remove 删除已上传的崩溃报告
+func Remove(id string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	err := os.Remove(filepath.Join(currentDir(), filepath.Base(id)+".json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// UploadPending 依次上传未上传的崩溃报告，成功的报告被删除
+// 遇到第一个上传失败即停止，剩余报告留到下次启动
+func UploadPending(upload func(Report) error) (int, error) {
+	reports, err := Pending()
+	if err != nil {
+		return 0, err
+	}
+	uploaded := 0
+	for _, report := range reports {
+		if err := upload(report); err != nil {
+			return uploaded, fmt.Errorf("failed to upload crash report %s: %w", report.ID, err)
+		}
+		if err := Remove(report.ID); err != nil {
+			log.Printf("crashdump: failed to remove uploaded report %s: %v", report.ID, err)
+		}
+		uploaded++
+	}
+	return uploaded, nil
+}
+
+// list 返回目录中的报告文件，按文件名（即时间）排序，调用方需持有 mu
+func list() ([]string, error) {
+	dir := currentDir()
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), "crash-") && strings.HasSuffix(e.Name(), ".json") {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// prune 删除超出 MaxReports 的最旧报告，调用方需持有 mu
+func prune() {
+	files, err := list()
+	if err != nil || len(files) <= MaxReports {
+		return
+	}
+	for _, f := range files[:len(files)-MaxReports] {
+		os.Remove(f)
+	}
+}
@@ -0,0 +1,33 @@
+package crashdump
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWriteAndUpload(t *testing.T) {
+	SetDir(t.TempDir())
+	defer SetDir("")
+
+	if _, err := Write("StartProxyWorker", "nil map", []byte("goroutine 1 [running]:")); err != nil {
+		t.Fatal(err)
+	}
+	reports, err := Pending()
+	if err != nil || len(reports) != 1 {
+		t.Fatalf("pending = %v, %v", reports, err)
+	}
+	if r := reports[0]; r.Func != "StartProxyWorker" || r.Panic != "nil map" || !strings.Contains(r.Stack, "goroutine 1") {
+		t.Errorf("unexpected report %+v", r)
+	}
+
+	if n, err := UploadPending(func(Report) error { return errors.New("offline") }); err == nil || n != 0 {
+		t.Fatalf("expected failed upload to keep report, got %d, %v", n, err)
+	}
+	if n, err := UploadPending(func(Report) error { return nil }); err != nil || n != 1 {
+		t.Fatalf("upload = %d, %v", n, err)
+	}
+	if reports, _ := Pending(); len(reports) != 0 {
+		t.Errorf("expected uploaded report to be removed, got %d", len(reports))
+	}
+}
@@ -0,0 +1,509 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/datadir"
+	"aro-ext-app/core/internal/fsutil"
+)
+
+// KeyStore 保存节点私钥，name 为 KeyFileName、PendingKeyFileName 或 PreviousKeyFileName
+type KeyStore interface {
+	// Load 读取私钥，不存在时返回 os.ErrNotExist
+	Load(name string) (PrivateKey, error)
+	// Save 原子地写入私钥，覆盖已有的同名私钥
+	Save(name string, key PrivateKey) error
+	// Remove 删除私钥，不存在时不报错
+	Remove(name string) error
+}
+
+// 私钥保护方式（KEY_PROTECTION）
+const (
+	ProtectionMachine    = "machine"    // 用本机密钥文件加密，默认
+	ProtectionPassphrase = "passphrase" // 用口令加密，口令来自 SetKeyPassphrase 或环境变量 ARO_KEY_PASSPHRASE
+	ProtectionNone       = "none"       // 明文 PEM，与旧版本相同
+)
+
+// PassphraseEnv 提供私钥口令的环境变量，口令不写入配置文件
+const PassphraseEnv = "ARO_KEY_PASSPHRASE"
+
+// 加密私钥的 PEM 格式：内容为 nonce + AES-256-GCM(PKCS#8 DER)，
+// 头部记录派生加密密钥（KEK）的方式和参数；明文私钥为 PKCS#1（RSA）或 PKCS#8（其他算法）
+const (
+	encryptedKeyBlockType = "ARO ENCRYPTED PRIVATE KEY"
+	legacyKeyBlockType    = "RSA PRIVATE KEY"
+	pkcs8KeyBlockType     = "PRIVATE KEY"
+
+	kdfPBKDF2 = "pbkdf2-sha256"
+	kdfHKDF   = "hkdf-sha256"
+
+	// passphraseIterations PBKDF2 迭代次数（OWASP 2023 对 SHA-256 的建议值）
+	passphraseIterations = 600000
+	machineSecretSize    = 32
+	saltSize             = 16
+)
+
+var (
+	passphraseMu sync.RWMutex
+	passphrase   string
+)
+
+// SetKeyPassphrase 设置 KEY_PROTECTION=passphrase 时使用的口令，优先于环境变量 ARO_KEY_PASSPHRASE
+func SetKeyPassphrase(p string) {
+	passphraseMu.Lock()
+	defer passphraseMu.Unlock()
+	passphrase = p
+}
+
+func keyPassphrase() string {
+	passphraseMu.RLock()
+	defer passphraseMu.RUnlock()
+	if passphrase != "" {
+		return passphrase
+	}
+	return os.Getenv(PassphraseEnv)
+}
+
+// OpenKeyStore 按 cfg 的 KEY_PROTECTION 打开 baseDir 下的私钥存储，baseDir 为空时使用数据目录
+// 私钥按 cfg 的环境分开保存，见 config.Config.IdentityDir
+func OpenKeyStore(cfg *config.Config, baseDir string) (KeyStore, error) {
+	dir, err := keyDir(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	if scoped := cfg.IdentityDir(dir); scoped != dir {
+		if err := os.MkdirAll(scoped, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create the identity dir: %w", err)
+		}
+		dir = scoped
+	}
+	switch protection := cfg.Get(config.KeyKeyProtection); protection {
+	case ProtectionNone:
+		return &FileKeyStore{Dir: dir}, nil
+	case ProtectionPassphrase:
+		p := keyPassphrase()
+		if p == "" {
+			return nil, fmt.Errorf("KEY_PROTECTION is passphrase but no passphrase is set (%s)", PassphraseEnv)
+		}
+		return &EncryptedFileKeyStore{Dir: dir, KEK: Passphrase(p)}, nil
+	case ProtectionMachine, "":
+		path := cfg.Get(config.KeyKeySecretFile)
+		if path == "" {
+			path = DefaultMachineSecretPath(dir)
+		}
+		return &EncryptedFileKeyStore{Dir: dir, KEK: MachineSecret{Path: path}}, nil
+	default:
+		return nil, fmt.Errorf("unknown KEY_PROTECTION %q", protection)
+	}
+}
+
+// DefaultMachineSecretPath 返回默认的本机密钥文件路径：用户配置目录下的 aro/machine.secret，
+// 与数据目录分开保存，复制或备份数据目录不会同时带走解密私钥所需的密钥；无法确定用户配置目录时使用 dir
+func DefaultMachineSecretPath(dir string) string {
+	if base, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(base, "aro", "machine.secret")
+	}
+	return filepath.Join(dir, KeyFileName+".secret")
+}
+
+// KEKSource 派生加密私钥的密钥（KEK）
+type KEKSource interface {
+	// kdf 返回写入 PEM 头部的派生方式
+	kdf() string
+	// deriveKey 用 salt 派生 AES-256 密钥，create 为 true 时允许创建缺失的密钥材料
+	deriveKey(salt []byte, iterations int, create bool) ([]byte, error)
+}
+
+// Passphrase 用户口令，通过 PBKDF2-SHA256 派生 KEK
+type Passphrase string
+
+func (p Passphrase) kdf() string { return kdfPBKDF2 }
+
+func (p Passphrase) deriveKey(salt []byte, iterations int, create bool) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, string(p), salt, iterations, 32)
+}
+
+// ErrMachineSecretMissing 私钥已加密保存但本机密钥文件不存在（被删除或换了路径）
+// 与 os.ErrNotExist 区分：私钥仍在，调用方不能把它当作没有私钥而生成新密钥覆盖
+var ErrMachineSecretMissing = errors.New("machine secret is missing")
+
+// MachineSecret 本机随机密钥文件，通过 HKDF-SHA256 派生 KEK；文件不存在时在首次保存私钥时创建
+type MachineSecret struct {
+	Path string
+}
+
+func (m MachineSecret) kdf() string { return kdfHKDF }
+
+func (m MachineSecret) deriveKey(salt []byte, iterations int, create bool) ([]byte, error) {
+	secret, err := os.ReadFile(m.Path)
+	if errors.Is(err, os.ErrNotExist) && !create {
+		return nil, fmt.Errorf("%w: %s", ErrMachineSecretMissing, m.Path)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		secret = make([]byte, machineSecretSize)
+		if _, err = rand.Read(secret); err != nil {
+			return nil, err
+		}
+		if err = os.MkdirAll(filepath.Dir(m.Path), 0700); err == nil {
+			err = fsutil.WriteFile(m.Path, secret, 0600)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("machine secret %s: %w", m.Path, err)
+	}
+	if len(secret) < machineSecretSize {
+		return nil, fmt.Errorf("machine secret %s is too short", m.Path)
+	}
+	return hkdf.Key(sha256.New, secret, salt, KeyFileName, 32)
+}
+
+// FileKeyStore 明文 PEM 格式的私钥文件，RSA 私钥与旧版本的格式（PKCS#1）相同
+type FileKeyStore struct {
+	Dir string
+}
+
+// Load 实现 KeyStore
+func (s *FileKeyStore) Load(name string) (PrivateKey, error) {
+	block, err := readKeyBlock(filepath.Join(s.Dir, name))
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == encryptedKeyBlockType {
+		return nil, fmt.Errorf("%s is encrypted, set KEY_PROTECTION to open it", name)
+	}
+	return parsePlainKey(block, name)
+}
+
+// Save 实现 KeyStore
+func (s *FileKeyStore) Save(name string, key PrivateKey) error {
+	return saveKeyFile(s.Dir, name, encodePrivateKey(key), key)
+}
+
+// Remove 实现 KeyStore
+func (s *FileKeyStore) Remove(name string) error {
+	return removeKeyFile(s.Dir, name)
+}
+
+// EncryptedFileKeyStore 加密的私钥文件，读取到旧版本的明文私钥时自动改写为加密格式
+type EncryptedFileKeyStore struct {
+	Dir string
+	KEK KEKSource
+}
+
+// Load 实现 KeyStore
+func (s *EncryptedFileKeyStore) Load(name string) (PrivateKey, error) {
+	block, err := readKeyBlock(filepath.Join(s.Dir, name))
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == legacyKeyBlockType || block.Type == pkcs8KeyBlockType {
+		key, err := parsePlainKey(block, name)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.Save(name, key); err != nil {
+			return nil, fmt.Errorf("encrypting the plaintext %s failed: %w", name, err)
+		}
+		log.Printf("Migrated plaintext private key %s to encrypted storage", name)
+		return key, nil
+	}
+	if block.Type != encryptedKeyBlockType {
+		return nil, fmt.Errorf("invalid private key format in %s", name)
+	}
+	if kdf := block.Headers["Kdf"]; kdf != s.KEK.kdf() {
+		return nil, fmt.Errorf("%s is protected with %s, not %s", name, kdf, s.KEK.kdf())
+	}
+	salt, err := base64.StdEncoding.DecodeString(block.Headers["Salt"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt in %s: %w", name, err)
+	}
+	iterations := 0
+	if s.KEK.kdf() == kdfPBKDF2 {
+		if iterations, err = strconv.Atoi(block.Headers["Iterations"]); err != nil || iterations <= 0 {
+			return nil, fmt.Errorf("invalid iterations in %s", name)
+		}
+	}
+	kek, err := s.KEK.deriveKey(salt, iterations, false)
+	if err != nil {
+		return nil, err
+	}
+	der, err := openSealed(kek, block.Bytes, encryptedKeyBlockType)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s failed (wrong passphrase or machine secret): %w", name, err)
+	}
+	return parsePKCS8Key(der, name)
+}
+
+// Save 实现 KeyStore
+func (s *EncryptedFileKeyStore) Save(name string, key PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	headers := map[string]string{"Kdf": s.KEK.kdf(), "Salt": base64.StdEncoding.EncodeToString(salt)}
+	iterations := 0
+	if s.KEK.kdf() == kdfPBKDF2 {
+		iterations = passphraseIterations
+		headers["Iterations"] = strconv.Itoa(iterations)
+	}
+	kek, err := s.KEK.deriveKey(salt, iterations, true)
+	if err != nil {
+		return err
+	}
+	sealed, err := seal(kek, der, encryptedKeyBlockType)
+	if err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: encryptedKeyBlockType, Headers: headers, Bytes: sealed})
+	return saveKeyFile(s.Dir, name, data, key)
+}
+
+// Remove 实现 KeyStore
+func (s *EncryptedFileKeyStore) Remove(name string) error {
+	return removeKeyFile(s.Dir, name)
+}
+
+// MemoryKeyStore 只保存在内存中的私钥，用于测试
+type MemoryKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]PrivateKey
+}
+
+// NewMemoryKeyStore 创建空的内存私钥存储
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: make(map[string]PrivateKey)}
+}
+
+// Load 实现 KeyStore
+func (s *MemoryKeyStore) Load(name string) (PrivateKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+	}
+	return key, nil
+}
+
+// Save 实现 KeyStore
+func (s *MemoryKeyStore) Save(name string, key PrivateKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[name] = key
+	return nil
+}
+
+// Remove 实现 KeyStore
+func (s *MemoryKeyStore) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, name)
+	return nil
+}
+
+// keyDir 返回密钥目录，为空时使用数据目录（见 datadir 包）
+func keyDir(baseDir string) (string, error) {
+	if baseDir != "" {
+		return baseDir, nil
+	}
+	return datadir.Ensure()
+}
+
+// readKeyBlock 读取私钥文件的 PEM 块，文件损坏时从 saveKeyFile 写入的备份恢复，
+// 文件不存在时返回的错误满足 errors.Is(err, os.ErrNotExist)
+func readKeyBlock(path string) (*pem.Block, error) {
+	data, err := fsutil.ReadFile(path, validKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	return block, nil
+}
+
+// validKeyFile 检查私钥文件是否包含 PEM 块
+func validKeyFile(data []byte) error {
+	if block, _ := pem.Decode(data); block == nil {
+		return errors.New("invalid private key format")
+	}
+	return nil
+}
+
+// parsePlainKey 解析明文私钥：PKCS#1（RSA）或 PKCS#8
+func parsePlainKey(block *pem.Block, name string) (PrivateKey, error) {
+	switch block.Type {
+	case legacyKeyBlockType:
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve the private key: %w", err)
+		}
+		return key, nil
+	case pkcs8KeyBlockType:
+		return parsePKCS8Key(block.Bytes, name)
+	default:
+		return nil, fmt.Errorf("invalid private key format in %s", name)
+	}
+}
+
+// keyLockFile 私钥文件的进程间锁，共用数据目录的进程依次写入私钥
+const keyLockFile = "aro_rsa.lock"
+
+// saveKeyFile 原子地写入私钥文件，当前私钥（KeyFileName）同时写入 aro_rsa.bak 用于损坏恢复，
+// 并更新明文公钥文件 aro_rsa.pub
+// 备份与 aro_rsa 内容相同，不保留上一代私钥：轮换或加密迁移之后，旧私钥（或明文私钥）不会留在磁盘上
+func saveKeyFile(dir, name string, data []byte, key PrivateKey) error {
+	lock, err := fsutil.LockFile(filepath.Join(dir, keyLockFile))
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	path := filepath.Join(dir, name)
+	if name == KeyFileName {
+		// 先覆盖备份，中途崩溃时 aro_rsa 仍是完整的当前私钥
+		err = fsutil.WriteFile(path+fsutil.BackupSuffix, data, 0600)
+	}
+	if err == nil {
+		err = fsutil.WriteFile(path, data, 0600)
+	}
+	if err != nil {
+		return fmt.Errorf("writing the private key failed: %w", err)
+	}
+	if name != KeyFileName {
+		return nil
+	}
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return fmt.Errorf("serialization of public key failed: %w", err)
+	}
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes})
+	if err := fsutil.WriteFile(path+".pub", publicKeyPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write the public key: %w", err)
+	}
+	return nil
+}
+
+// removeKeyFile 删除私钥文件和它的备份
+func removeKeyFile(dir, name string) error {
+	return fsutil.Remove(filepath.Join(dir, name))
+}
+
+// 口令加密数据的错误
+var (
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	ErrCorrupted       = errors.New("encrypted data is corrupted")
+)
+
+// SealWithPassphrase 用口令加密 plaintext，返回 blockType 类型的 PEM；
+// 头部与加密私钥相同（Kdf、Salt、Iterations），另外记录密文的 SHA-256（Checksum），用于区分文件损坏和口令错误
+func SealWithPassphrase(blockType, passphrase string, plaintext []byte) ([]byte, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase is required")
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	kek, err := Passphrase(passphrase).deriveKey(salt, passphraseIterations, true)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := seal(kek, plaintext, blockType)
+	if err != nil {
+		return nil, err
+	}
+	checksum := sha256.Sum256(sealed)
+	headers := map[string]string{
+		"Kdf":        kdfPBKDF2,
+		"Salt":       base64.StdEncoding.EncodeToString(salt),
+		"Iterations": strconv.Itoa(passphraseIterations),
+		"Checksum":   hex.EncodeToString(checksum[:]),
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Headers: headers, Bytes: sealed}), nil
+}
+
+// OpenWithPassphrase 解密 SealWithPassphrase 生成的数据
+// 数据不完整或被修改时返回 ErrCorrupted，口令错误时返回 ErrWrongPassphrase
+func OpenWithPassphrase(blockType, passphrase string, data []byte) ([]byte, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("no %s found: %w", blockType, ErrCorrupted)
+	}
+	checksum := sha256.Sum256(block.Bytes)
+	if block.Headers["Checksum"] != hex.EncodeToString(checksum[:]) {
+		return nil, fmt.Errorf("checksum mismatch: %w", ErrCorrupted)
+	}
+	if kdf := block.Headers["Kdf"]; kdf != kdfPBKDF2 {
+		return nil, fmt.Errorf("unsupported kdf %q: %w", kdf, ErrCorrupted)
+	}
+	salt, err := base64.StdEncoding.DecodeString(block.Headers["Salt"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %w", ErrCorrupted)
+	}
+	iterations, err := strconv.Atoi(block.Headers["Iterations"])
+	if err != nil || iterations <= 0 {
+		return nil, fmt.Errorf("invalid iterations: %w", ErrCorrupted)
+	}
+	kek, err := Passphrase(passphrase).deriveKey(salt, iterations, false)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := openSealed(kek, block.Bytes, blockType)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+// seal 用 AES-256-GCM 加密，返回 nonce + 密文，aad 为 PEM 类型
+func seal(key, plaintext []byte, aad string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, []byte(aad)), nil
+}
+
+func openSealed(key, sealed []byte, aad string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, []byte(aad))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,161 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"aro-ext-app/core/internal/fsutil"
+)
+
+func TestEncryptedKeyStoreMigratesPlaintextKey(t *testing.T) {
+	dir := t.TempDir()
+	keyPair, err := GenerateRSAKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (&FileKeyStore{Dir: dir}).Save(KeyFileName, keyPair.PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &EncryptedFileKeyStore{Dir: dir, KEK: MachineSecret{Path: filepath.Join(t.TempDir(), "machine.secret")}}
+	loaded, err := LoadKeyPair(store)
+	if err != nil || !loaded.PrivateKey.Equal(keyPair.PrivateKey) {
+		t.Fatalf("expected the plaintext key to load: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, KeyFileName))
+	if !bytes.Contains(data, []byte(encryptedKeyBlockType)) || bytes.Contains(data, []byte(legacyKeyBlockType)) {
+		t.Fatalf("expected aro_rsa to be rewritten encrypted, got:\n%s", data)
+	}
+	// 备份不能保留迁移前的明文私钥
+	backup, _ := os.ReadFile(filepath.Join(dir, KeyFileName+fsutil.BackupSuffix))
+	if !bytes.Equal(backup, data) {
+		t.Fatalf("expected aro_rsa.bak to match the encrypted key, got:\n%s", backup)
+	}
+	if _, err := (&FileKeyStore{Dir: dir}).Load(KeyFileName); err == nil {
+		t.Error("expected the plain store to refuse an encrypted key")
+	}
+
+	again, err := LoadKeyPair(store)
+	if err != nil || !again.PrivateKey.Equal(keyPair.PrivateKey) {
+		t.Fatalf("expected the encrypted key to load: %v", err)
+	}
+}
+
+func TestEncryptedKeyStoreWrongSecret(t *testing.T) {
+	dir := t.TempDir()
+	store := &EncryptedFileKeyStore{Dir: dir, KEK: Passphrase("correct horse")}
+	keyPair, err := LoadOrCreateKeyPair(store, KeyTypeRSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrong := &EncryptedFileKeyStore{Dir: dir, KEK: Passphrase("battery staple")}
+	if _, err := LoadOrCreateKeyPair(wrong, KeyTypeRSA); err == nil || errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected a decryption error, got %v", err)
+	}
+	if _, err := LoadKeyPair(&EncryptedFileKeyStore{Dir: dir, KEK: MachineSecret{Path: filepath.Join(dir, "secret")}}); err == nil {
+		t.Error("expected a passphrase-protected key to be refused with a machine secret")
+	}
+	// 解密失败时不能生成新密钥覆盖原有私钥
+	loaded, err := LoadKeyPair(store)
+	if err != nil || !loaded.PrivateKey.Equal(keyPair.PrivateKey) {
+		t.Fatalf("expected the original key to survive: %v", err)
+	}
+}
+
+func TestEncryptedKeyStoreMissingMachineSecret(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(t.TempDir(), "machine.secret")
+	store := &EncryptedFileKeyStore{Dir: dir, KEK: MachineSecret{Path: secret}}
+	if _, err := LoadOrCreateKeyPair(store, KeyTypeRSA); err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, KeyFileName)
+	before, _ := os.ReadFile(keyPath)
+
+	// 本机密钥丢失时不能当作没有私钥而生成新密钥
+	os.Remove(secret)
+	_, err := LoadOrCreateKeyPair(store, KeyTypeRSA)
+	if !errors.Is(err, ErrMachineSecretMissing) || errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ErrMachineSecretMissing, got %v", err)
+	}
+	if after, _ := os.ReadFile(keyPath); !bytes.Equal(before, after) {
+		t.Error("expected the encrypted key to be left untouched")
+	}
+}
+
+func TestEncryptedKeyStoreRejectsInvalidIterations(t *testing.T) {
+	dir := t.TempDir()
+	store := &EncryptedFileKeyStore{Dir: dir, KEK: Passphrase("correct horse")}
+	if _, err := LoadOrCreateKeyPair(store, KeyTypeRSA); err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, KeyFileName)
+	data, _ := os.ReadFile(keyPath)
+	for _, iterations := range []string{"0", "-1", "many"} {
+		tampered := bytes.Replace(data, []byte("Iterations: 600000"), []byte("Iterations: "+iterations), 1)
+		if err := os.WriteFile(keyPath, tampered, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Load(KeyFileName); err == nil || errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected iterations %q to be rejected, got %v", iterations, err)
+		}
+	}
+}
+
+func TestCommitPendingKeyPair(t *testing.T) {
+	store := NewMemoryKeyStore()
+	current, err := LoadOrCreateKeyPair(store, KeyTypeRSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPendingKeyPair(store); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected no pending key, got %v", err)
+	}
+	next, _ := GenerateRSAKeyPair()
+	if err := SavePendingKeyPair(store, next); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CommitPendingKeyPair(store); err != nil {
+		t.Fatal(err)
+	}
+	if k, err := LoadKeyPair(store); err != nil || !k.PrivateKey.Equal(next.PrivateKey) {
+		t.Errorf("expected the pending key to become current: %v", err)
+	}
+	if k, err := LoadPreviousKeyPair(store); err != nil || !k.PrivateKey.Equal(current.PrivateKey) {
+		t.Errorf("expected the current key to become previous: %v", err)
+	}
+	if _, err := LoadPendingKeyPair(store); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the pending key to be removed, got %v", err)
+	}
+}
+
+func TestFileKeyStoreRestoresCorruptedKey(t *testing.T) {
+	dir := t.TempDir()
+	store := &FileKeyStore{Dir: dir}
+	first, _ := GenerateRSAKeyPair()
+	second, _ := GenerateRSAKeyPair()
+	for _, k := range []*KeyPair{first, second} {
+		if err := store.Save(KeyFileName, k.PrivateKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, KeyFileName), []byte("-----BEGIN"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// 备份是当前私钥，不是被替换的上一代
+	key, err := store.Load(KeyFileName)
+	if err != nil || !key.Equal(second.PrivateKey) {
+		t.Fatalf("expected the backup of the current key, got %v", err)
+	}
+
+	if err := store.Remove(KeyFileName); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(KeyFileName); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a removed key to stay removed, got %v", err)
+	}
+}
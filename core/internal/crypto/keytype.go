@@ -0,0 +1,245 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+
+	"aro-ext-app/core/internal/config"
+)
+
+// KeyType 节点密钥算法
+//
+// RSA-2048 在低端 Android 设备上生成很慢，签名也很长，新节点默认使用 Ed25519；
+// 已有的 RSA 节点继续使用原来的密钥，可以通过密钥轮换换成新算法
+type KeyType string
+
+const (
+	KeyTypeRSA     KeyType = "rsa"        // RSA-2048，PKCS#1 v1.5 SHA-256
+	KeyTypeEd25519 KeyType = "ed25519"    // Ed25519
+	KeyTypeECDSA   KeyType = "ecdsa-p256" // ECDSA P-256 SHA-256，ASN.1 DER 签名
+)
+
+// DefaultKeyType 新节点默认的密钥算法
+const DefaultKeyType = KeyTypeEd25519
+
+// KeyTypes 支持的密钥算法，按优先级排列
+var KeyTypes = []KeyType{KeyTypeEd25519, KeyTypeECDSA, KeyTypeRSA}
+
+// PrivateKey 节点私钥：*rsa.PrivateKey、ed25519.PrivateKey 或 P-256 的 *ecdsa.PrivateKey
+type PrivateKey interface {
+	crypto.Signer
+	Equal(x crypto.PrivateKey) bool
+}
+
+// PublicKey 节点公钥：*rsa.PublicKey、ed25519.PublicKey 或 P-256 的 *ecdsa.PublicKey
+type PublicKey interface {
+	Equal(x crypto.PublicKey) bool
+}
+
+// ParseKeyType 解析密钥算法名称
+func ParseKeyType(name string) (KeyType, error) {
+	for _, t := range KeyTypes {
+		if string(t) == name {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported key type %q", name)
+}
+
+// KeyTypeFromConfig 读取 KEY_TYPE，未配置或无效时返回 DefaultKeyType
+func KeyTypeFromConfig(cfg *config.Config) KeyType {
+	name := cfg.Get(config.KeyKeyType)
+	if name == "" {
+		return DefaultKeyType
+	}
+	t, err := ParseKeyType(name)
+	if err != nil {
+		log.Printf("Invalid KEY_TYPE %q, using %s", name, DefaultKeyType)
+		return DefaultKeyType
+	}
+	return t
+}
+
+// KeyTypeOf 返回私钥或公钥的算法，不支持的密钥返回空字符串
+func KeyTypeOf(key any) KeyType {
+	switch k := key.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return KeyTypeRSA
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return KeyTypeEd25519
+	case *ecdsa.PrivateKey:
+		if k.Curve == elliptic.P256() {
+			return KeyTypeECDSA
+		}
+	case *ecdsa.PublicKey:
+		if k.Curve == elliptic.P256() {
+			return KeyTypeECDSA
+		}
+	}
+	return ""
+}
+
+// NewKeyPair 由私钥构造密钥对
+func NewKeyPair(privateKey PrivateKey) *KeyPair {
+	return &KeyPair{PrivateKey: privateKey, PublicKey: privateKey.Public().(PublicKey)}
+}
+
+// GenerateKeyPair 生成 keyType 类型的密钥对
+func GenerateKeyPair(keyType KeyType) (*KeyPair, error) {
+	var (
+		privateKey PrivateKey
+		err        error
+	)
+	switch keyType {
+	case KeyTypeRSA:
+		return GenerateRSAKeyPair()
+	case KeyTypeEd25519:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	case KeyTypeECDSA:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", keyType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %w", err)
+	}
+	return NewKeyPair(privateKey), nil
+}
+
+// Sign 按私钥的算法签名 message，返回原始签名
+func Sign(privateKey PrivateKey, message []byte) ([]byte, error) {
+	switch KeyTypeOf(privateKey) {
+	case KeyTypeRSA:
+		hashed := sha256.Sum256(message)
+		return privateKey.Sign(rand.Reader, hashed[:], crypto.SHA256)
+	case KeyTypeEd25519:
+		return privateKey.Sign(rand.Reader, message, crypto.Hash(0))
+	case KeyTypeECDSA:
+		hashed := sha256.Sum256(message)
+		return privateKey.Sign(rand.Reader, hashed[:], crypto.SHA256)
+	default:
+		return nil, fmt.Errorf("unsupported private key %T", privateKey)
+	}
+}
+
+// Verify 按公钥的算法校验 Sign 生成的签名
+func Verify(publicKey PublicKey, message, signature []byte) error {
+	switch pub := publicKey.(type) {
+	case *rsa.PublicKey:
+		hashed := sha256.Sum256(message)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, hashed[:], signature)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, message, signature) {
+			return errors.New("ed25519: verification error")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		hashed := sha256.Sum256(message)
+		if KeyTypeOf(pub) != KeyTypeECDSA || !ecdsa.VerifyASN1(pub, hashed[:], signature) {
+			return errors.New("ecdsa: verification error")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key %T", publicKey)
+	}
+}
+
+// SignMessage 使用私钥签名消息，返回 base64 编码的签名
+func SignMessage(privateKey PrivateKey, message string) (string, error) {
+	signature, err := Sign(privateKey, []byte(message))
+	if err != nil {
+		return "", fmt.Errorf("signature failed: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// VerifySignature 使用公钥验证 SignMessage 生成的签名
+func VerifySignature(publicKey PublicKey, message, signature string) error {
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("decoding the signature failed: %w", err)
+	}
+	return Verify(publicKey, []byte(message), signatureBytes)
+}
+
+// ExportPublicKeyToPEM 导出公钥为 base64 编码的 PEM（PKIX）字符串
+func ExportPublicKeyToPEM(publicKey PublicKey) (string, error) {
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyBytes,
+	})
+
+	return base64.StdEncoding.EncodeToString(publicKeyPEM), nil
+}
+
+// ParsePublicKeyFromPEM 解析 ExportPublicKeyToPEM 导出的公钥（base64 编码的 PEM）
+func ParsePublicKeyFromPEM(encoded string) (PublicKey, error) {
+	publicKeyPEM, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decoding the public key failed: %w", err)
+	}
+	block, _ := pem.Decode(publicKeyPEM)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("no PUBLIC KEY PEM block found")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the public key failed: %w", err)
+	}
+	if KeyTypeOf(pub) == "" {
+		return nil, fmt.Errorf("unsupported public key %T", pub)
+	}
+	return pub.(PublicKey), nil
+}
+
+// ExportPrivateKeyToPEM 导出私钥为明文 PEM：RSA 使用旧版本的 PKCS#1 格式，其他算法使用 PKCS#8
+func ExportPrivateKeyToPEM(privateKey PrivateKey) string {
+	if rsaKey, ok := privateKey.(*rsa.PrivateKey); ok {
+		return string(pem.EncodeToMemory(&pem.Block{
+			Type:  legacyKeyBlockType,
+			Bytes: x509.MarshalPKCS1PrivateKey(rsaKey),
+		}))
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return ""
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: pkcs8KeyBlockType, Bytes: der}))
+}
+
+// ParsePrivateKeyFromPEM 解析 ExportPrivateKeyToPEM 导出的明文私钥
+func ParsePrivateKeyFromPEM(data string) (PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("no private key PEM block found")
+	}
+	return parsePlainKey(block, "private key")
+}
+
+// parsePKCS8Key 解析 PKCS#8 DER 格式的私钥，只接受支持的算法
+func parsePKCS8Key(der []byte, name string) (PrivateKey, error) {
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve the private key: %w", err)
+	}
+	if KeyTypeOf(parsed) == "" {
+		return nil, fmt.Errorf("%s holds an unsupported private key %T", name, parsed)
+	}
+	return parsed.(PrivateKey), nil
+}
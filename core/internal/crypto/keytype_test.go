@@ -0,0 +1,63 @@
+package crypto
+
+import "testing"
+
+func TestSignVerifyKeyTypes(t *testing.T) {
+	for _, keyType := range KeyTypes {
+		t.Run(string(keyType), func(t *testing.T) {
+			keyPair, err := GenerateKeyPair(keyType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := KeyTypeOf(keyPair.PrivateKey); got != keyType {
+				t.Fatalf("expected %s, got %s", keyType, got)
+			}
+			signature, err := SignMessage(keyPair.PrivateKey, "client-1:1700000000")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifySignature(keyPair.PublicKey, "client-1:1700000000", signature); err != nil {
+				t.Errorf("expected the signature to verify: %v", err)
+			}
+			if err := VerifySignature(keyPair.PublicKey, "client-1:1700000001", signature); err == nil {
+				t.Error("expected a signature of another message to be rejected")
+			}
+
+			encoded, err := ExportPublicKeyToPEM(keyPair.PublicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pub, err := ParsePublicKeyFromPEM(encoded)
+			if err != nil || !pub.Equal(keyPair.PublicKey) {
+				t.Fatalf("expected the public key to round trip: %v", err)
+			}
+
+			// 明文和加密存储都能保存该算法的私钥
+			dir := t.TempDir()
+			for _, store := range []KeyStore{&FileKeyStore{Dir: dir}, &EncryptedFileKeyStore{Dir: t.TempDir(), KEK: Passphrase("secret")}} {
+				if err := store.Save(KeyFileName, keyPair.PrivateKey); err != nil {
+					t.Fatal(err)
+				}
+				loaded, err := LoadKeyPair(store)
+				if err != nil || !loaded.PrivateKey.Equal(keyPair.PrivateKey) {
+					t.Fatalf("expected %T to round trip the key: %v", store, err)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsOtherKeyType(t *testing.T) {
+	edKey, _ := GenerateKeyPair(KeyTypeEd25519)
+	ecKey, _ := GenerateKeyPair(KeyTypeECDSA)
+	signature, err := SignMessage(edKey.PrivateKey, "message")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySignature(ecKey.PublicKey, "message", signature); err == nil {
+		t.Error("expected an ed25519 signature to fail against an ECDSA key")
+	}
+	if _, err := ParseKeyType("dsa"); err == nil {
+		t.Error("expected an unknown key type to be rejected")
+	}
+}
@@ -0,0 +1,74 @@
+package crypto
+
+import "fmt"
+
+// 密钥轮换使用的私钥名称，与 aro_rsa 保存在同一个 KeyStore 中
+const (
+	// PendingKeyFileName 已生成、尚未被后端确认的新私钥，轮换中断后可以继续使用
+	PendingKeyFileName = KeyFileName + ".next"
+	// PreviousKeyFileName 轮换前的私钥，在宽限期内保留
+	PreviousKeyFileName = KeyFileName + ".old"
+)
+
+func encodePrivateKey(privateKey PrivateKey) []byte {
+	return []byte(ExportPrivateKeyToPEM(privateKey))
+}
+
+func loadKeyPair(store KeyStore, name string) (*KeyPair, error) {
+	privateKey, err := store.Load(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyPair(privateKey), nil
+}
+
+// SavePendingKeyPair 保存轮换中的新私钥（aro_rsa.next），当前密钥不受影响
+func SavePendingKeyPair(store KeyStore, keyPair *KeyPair) error {
+	if err := store.Save(PendingKeyFileName, keyPair.PrivateKey); err != nil {
+		return fmt.Errorf("saving the pending key failed: %w", err)
+	}
+	return nil
+}
+
+// LoadPendingKeyPair 读取未完成的轮换留下的新私钥，不存在时返回 os.ErrNotExist
+func LoadPendingKeyPair(store KeyStore) (*KeyPair, error) {
+	return loadKeyPair(store, PendingKeyFileName)
+}
+
+// DiscardPendingKeyPair 删除轮换中的新私钥，不存在时不报错
+func DiscardPendingKeyPair(store KeyStore) error {
+	return store.Remove(PendingKeyFileName)
+}
+
+// CommitPendingKeyPair 用 aro_rsa.next 替换当前密钥，原密钥保存为 aro_rsa.old
+//
+// 每一步都是原子的写入：先写入 aro_rsa.old，再替换 aro_rsa，最后删除 aro_rsa.next；
+// 任一步中断时 aro_rsa 要么是旧密钥（aro_rsa.next 仍在，可以重新提交），要么是新密钥
+func CommitPendingKeyPair(store KeyStore) (*KeyPair, error) {
+	pending, err := loadKeyPair(store, PendingKeyFileName)
+	if err != nil {
+		return nil, fmt.Errorf("no pending key to commit: %w", err)
+	}
+	if current, err := store.Load(KeyFileName); err == nil && !current.Equal(pending.PrivateKey) {
+		if err := store.Save(PreviousKeyFileName, current); err != nil {
+			return nil, fmt.Errorf("saving the previous key failed: %w", err)
+		}
+	}
+	if err := store.Save(KeyFileName, pending.PrivateKey); err != nil {
+		return nil, err
+	}
+	if err := DiscardPendingKeyPair(store); err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// LoadPreviousKeyPair 读取轮换前的私钥，不存在时返回 os.ErrNotExist
+func LoadPreviousKeyPair(store KeyStore) (*KeyPair, error) {
+	return loadKeyPair(store, PreviousKeyFileName)
+}
+
+// RemovePreviousKeyPair 宽限期结束后删除轮换前的私钥，不存在时不报错
+func RemovePreviousKeyPair(store KeyStore) error {
+	return store.Remove(PreviousKeyFileName)
+}
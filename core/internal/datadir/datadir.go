@@ -0,0 +1,112 @@
+// Package datadir 解析节点数据目录
+//
+// 密钥、config.env、日志和崩溃报告保存在平台约定的应用数据目录中，不再依赖进程的当前目录：
+//   - Linux 等：$XDG_DATA_HOME/aro，未设置时为 ~/.local/share/aro
+//   - macOS、iOS：~/Library/Application Support/ARO（iOS 的主目录即应用沙盒）
+//   - Windows：%APPDATA%\ARO
+//   - Android：没有可靠的应用目录环境变量，调用方应通过 InitLibstudy 的 data_dir 传入
+//     Context.getFilesDir()，未传入时沿用当前目录
+//
+// 环境变量 ARO_DATA_DIR 和 Set（InitLibstudy 的 data_dir、aro-node -dir）可以覆盖默认目录，
+// 旧版本写在当前目录的文件由 Migrate 一次性移动到数据目录
+package datadir
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// EnvVar 覆盖数据目录的环境变量
+const EnvVar = "ARO_DATA_DIR"
+
+var (
+	mu  sync.Mutex
+	dir string // 空字符串表示尚未解析
+)
+
+// Get 返回数据目录：Set 设置的目录、ARO_DATA_DIR 或平台默认目录，首次调用时解析
+func Get() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if dir == "" {
+		dir = resolve()
+	}
+	return dir
+}
+
+// Set 覆盖数据目录，空字符串恢复默认解析；应在读写密钥和配置之前调用，之后需要重新加载配置
+func Set(d string) {
+	if d != "" {
+		if abs, err := filepath.Abs(d); err == nil {
+			d = abs
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	dir = d
+}
+
+// Ensure 返回数据目录，不存在时创建（仅所有者可访问）
+func Ensure() (string, error) {
+	d := Get()
+	if err := os.MkdirAll(d, 0700); err != nil {
+		return "", fmt.Errorf("failed to create data dir: %w", err)
+	}
+	return d, nil
+}
+
+// Default 返回当前平台的默认数据目录，不考虑 ARO_DATA_DIR 和 Set
+func Default() string {
+	home, _ := os.UserHomeDir()
+	return defaultDir(runtime.GOOS, os.Getenv, home)
+}
+
+// resolve 按 ARO_DATA_DIR、平台默认目录、当前目录的顺序确定数据目录
+func resolve() string {
+	if d := os.Getenv(EnvVar); d != "" {
+		if abs, err := filepath.Abs(d); err == nil {
+			return abs
+		}
+		return d
+	}
+	if d := Default(); d != "" {
+		return d
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		log.Printf("datadir: cannot determine a data dir, using '.': %v", err)
+		return "."
+	}
+	return cwd
+}
+
+// defaultDir 返回 goos 平台的默认数据目录，无法确定时返回空字符串
+func defaultDir(goos string, getenv func(string) string, home string) string {
+	switch goos {
+	case "android":
+		return ""
+	case "windows":
+		if appData := getenv("APPDATA"); appData != "" {
+			return filepath.Join(appData, "ARO")
+		}
+		if home != "" {
+			return filepath.Join(home, "AppData", "Roaming", "ARO")
+		}
+	case "darwin", "ios":
+		if home != "" {
+			return filepath.Join(home, "Library", "Application Support", "ARO")
+		}
+	default:
+		if xdg := getenv("XDG_DATA_HOME"); filepath.IsAbs(xdg) {
+			return filepath.Join(xdg, "aro")
+		}
+		if home != "" {
+			return filepath.Join(home, ".local", "share", "aro")
+		}
+	}
+	return ""
+}
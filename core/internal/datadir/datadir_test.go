@@ -0,0 +1,102 @@
+package datadir
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultDir(t *testing.T) {
+	env := map[string]string{"APPDATA": `C:\Users\u\AppData\Roaming`}
+	getenv := func(k string) string { return env[k] }
+	cases := []struct {
+		goos, want string
+	}{
+		{"linux", filepath.Join("/home/u", ".local", "share", "aro")},
+		{"darwin", filepath.Join("/home/u", "Library", "Application Support", "ARO")},
+		{"ios", filepath.Join("/home/u", "Library", "Application Support", "ARO")},
+		{"windows", filepath.Join(`C:\Users\u\AppData\Roaming`, "ARO")},
+		{"android", ""},
+	}
+	for _, c := range cases {
+		if got := defaultDir(c.goos, getenv, "/home/u"); got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.goos, c.want, got)
+		}
+	}
+
+	env["XDG_DATA_HOME"] = "/data/xdg"
+	if got := defaultDir("linux", getenv, "/home/u"); got != filepath.Join("/data/xdg", "aro") {
+		t.Errorf("expected XDG_DATA_HOME to be used, got %q", got)
+	}
+	env["XDG_DATA_HOME"] = "relative"
+	if got := defaultDir("linux", getenv, "/home/u"); got != filepath.Join("/home/u", ".local", "share", "aro") {
+		t.Errorf("expected a relative XDG_DATA_HOME to be ignored, got %q", got)
+	}
+}
+
+func TestSetOverridesEnv(t *testing.T) {
+	defer Set("")
+	env := t.TempDir()
+	t.Setenv(EnvVar, env)
+	Set("")
+	if got := Get(); got != env {
+		t.Errorf("expected %s from %s, got %s", env, EnvVar, got)
+	}
+	override := t.TempDir()
+	Set(override)
+	if got := Get(); got != override {
+		t.Errorf("expected the override %s, got %s", override, got)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	from, to := t.TempDir(), filepath.Join(t.TempDir(), "data")
+	write := func(dir, name, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 没有私钥的目录不迁移
+	write(from, ".env", "API_URL=http://legacy\n")
+	if moved, err := Migrate(from, to); err != nil || len(moved) != 0 {
+		t.Fatalf("expected nothing to move without a key, got %v %v", moved, err)
+	}
+
+	write(from, "aro_rsa", "key")
+	write(from, "config.env", "API_URL=http://ignored\n")
+	write(from, "crashes/crash-1.json", "{}")
+	moved, err := Migrate(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 标记文件最后迁移，中途失败时下次启动还会继续
+	if len(moved) != 3 || moved[2] != "aro_rsa" {
+		t.Errorf("expected .env, crashes and then aro_rsa to move, got %v", moved)
+	}
+	if data, _ := os.ReadFile(filepath.Join(to, "config.env")); string(data) != "API_URL=http://legacy\n" {
+		t.Errorf("expected .env to become config.env, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(to, "crashes", "crash-1.json")); err != nil {
+		t.Errorf("expected crash reports to move: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(from, "aro_rsa")); !os.IsNotExist(err) {
+		t.Error("expected the key to be removed from the old location")
+	}
+
+	// 数据目录已有私钥时保留旧目录中的文件
+	write(from, "aro_rsa", "other key")
+	if moved, err := Migrate(from, to); err != nil || len(moved) != 0 {
+		t.Errorf("expected the existing identity to be kept, got %v %v", moved, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(to, "aro_rsa")); string(data) != "key" {
+		t.Errorf("expected the migrated key to be untouched, got %q", data)
+	}
+	if moved, err := Migrate(to, to); err != nil || len(moved) != 0 {
+		t.Errorf("expected migrating a dir onto itself to do nothing, got %v %v", moved, err)
+	}
+}
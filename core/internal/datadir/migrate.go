@@ -0,0 +1,147 @@
+package datadir
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// legacyFile 旧版本写在当前目录的文件及其在数据目录中的名称
+type legacyFile struct {
+	from, to string
+}
+
+// legacyFiles 需要迁移的文件，按顺序迁移，目标已存在时跳过
+// 私钥文件名与 crypto 包一致：aro_rsa、aro_rsa.pub、轮换中的 aro_rsa.next、宽限期内的 aro_rsa.old
+// 和无法确定用户配置目录时使用的 aro_rsa.secret；.env 的优先级高于 config.env，先迁移
+// 标记文件 aro_rsa 最后迁移：中途失败时旧目录仍有标记、数据目录还没有，下次启动会继续迁移剩下的文件
+var legacyFiles = []legacyFile{
+	{"aro_rsa.pub", "aro_rsa.pub"},
+	{"aro_rsa.next", "aro_rsa.next"},
+	{"aro_rsa.old", "aro_rsa.old"},
+	{"aro_rsa.secret", "aro_rsa.secret"},
+	{".env", "config.env"},
+	{"config.env", "config.env"},
+	{"libstudy.log", "libstudy.log"},
+	{"crashes", "crashes"},
+	{markerFile, markerFile},
+}
+
+// markerFile 旧目录中存在该文件时才迁移，避免把无关目录中的 .env 等文件搬走
+const markerFile = "aro_rsa"
+
+// Migrate 把旧版本保存在 from（通常是当前目录）中的密钥、配置、日志和崩溃报告移动到数据目录 to，
+// 返回移动的文件名
+// 只有 from 中存在私钥且 to 中还没有私钥时才迁移，因此重复调用是安全的，也不会覆盖数据目录中已有的身份
+func Migrate(from, to string) ([]string, error) {
+	if from == "" || to == "" {
+		return nil, nil
+	}
+	if same, err := sameDir(from, to); err != nil || same {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(from, markerFile)); err != nil {
+		return nil, nil
+	}
+	if _, err := os.Stat(filepath.Join(to, markerFile)); err == nil {
+		log.Printf("datadir: %s already holds a node key, leaving the one in %s alone", to, from)
+		return nil, nil
+	}
+	if err := os.MkdirAll(to, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data dir: %w", err)
+	}
+
+	var moved []string
+	for _, f := range legacyFiles {
+		src, dst := filepath.Join(from, f.from), filepath.Join(to, f.to)
+		if _, err := os.Lstat(src); err != nil {
+			continue
+		}
+		if _, err := os.Lstat(dst); err == nil {
+			continue
+		}
+		if err := move(src, dst); err != nil {
+			return moved, fmt.Errorf("failed to move %s to the data dir: %w", f.from, err)
+		}
+		moved = append(moved, f.from)
+	}
+	if len(moved) > 0 {
+		log.Printf("datadir: moved %v from %s to %s", moved, from, to)
+	}
+	return moved, nil
+}
+
+// sameDir 判断两个路径是否指向同一个目录，to 不存在时返回 false
+func sameDir(a, b string) (bool, error) {
+	sa, err := os.Stat(a)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	sb, err := os.Stat(b)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return os.SameFile(sa, sb), nil
+}
+
+// move 重命名文件或目录，跨文件系统时复制后删除原文件
+func move(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if err := os.MkdirAll(dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := move(filepath.Join(src, e.Name()), filepath.Join(dst, e.Name())); err != nil {
+				return err
+			}
+		}
+		return os.Remove(src)
+	}
+	if err := copyFile(src, dst, info.Mode().Perm()); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// copyFile 复制文件内容并同步到磁盘
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
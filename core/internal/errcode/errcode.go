@@ -0,0 +1,111 @@
+package errcode
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// Code 稳定的错误码，FFI 响应中以 error_code 字段返回
+// 调用方应根据 Code 而不是 message 文本判断错误类型，已发布的 Code 不能改名
+type Code string
+
+const (
+	OK                   Code = "OK"
+	InvalidParams        Code = "INVALID_PARAMS"
+	NotInitialized       Code = "NOT_INITIALIZED"
+	InvalidConfig        Code = "INVALID_CONFIG"
+	BackendUnreachable   Code = "BACKEND_UNREACHABLE"
+	BackendError         Code = "BACKEND_ERROR"
+	AuthFailed           Code = "AUTH_FAILED"
+	WorkerAlreadyRunning Code = "WORKER_ALREADY_RUNNING"
+	WorkerNotRunning     Code = "WORKER_NOT_RUNNING"
+	NodeNotFound         Code = "NODE_NOT_FOUND"
+	UpdateRejected       Code = "UPDATE_REJECTED"
+	InvalidBackup        Code = "INVALID_BACKUP"
+	IdentityInUse        Code = "IDENTITY_IN_USE"
+	Internal             Code = "INTERNAL"
+	Panic                Code = "PANIC"
+)
+
+// Entry 错误码目录中的一项
+type Entry struct {
+	Code        Code   `json:"code"`
+	Status      int    `json:"status"`
+	Description string `json:"description"`
+}
+
+// catalogue 错误码目录，Status 为兼容旧调用方保留的 HTTP 风格数字码
+var catalogue = []Entry{
+	{OK, 200, "success"},
+	{InvalidParams, 400, "malformed or missing call parameters"},
+	{NotInitialized, 500, "InitLibstudy has not been called"},
+	{InvalidConfig, 400, "configuration rejected by validation"},
+	{BackendUnreachable, 503, "backend could not be reached"},
+	{BackendError, 502, "backend returned an error or an unreadable response"},
+	{AuthFailed, 401, "backend rejected the node credentials"},
+	{WorkerAlreadyRunning, 409, "proxy worker is already running"},
+	{WorkerNotRunning, 409, "proxy worker is not running"},
+	{NodeNotFound, 404, "node handle is invalid or already destroyed"},
+	{UpdateRejected, 422, "update is unsigned, fails verification or is not newer"},
+	{InvalidBackup, 422, "identity backup is corrupted, unsupported or the passphrase is wrong"},
+	{IdentityInUse, 409, "identity in the backup is active on another device, or this device already has one"},
+	{Internal, 500, "unexpected internal error"},
+	{Panic, 500, "call panicked, a crash report was written"},
+}
+
+// Catalogue 返回完整的错误码目录
+func Catalogue() []Entry {
+	list := make([]Entry, len(catalogue))
+	copy(list, catalogue)
+	return list
+}
+
+// Status 返回错误码对应的 HTTP 风格数字码，未知错误码返回 500
+func (c Code) Status() int {
+	for _, e := range catalogue {
+		if e.Code == c {
+			return e.Status
+		}
+	}
+	return 500
+}
+
+// Error 携带错误码的错误
+type Error struct {
+	Code Code
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// New 创建携带错误码的错误
+func New(code Code, message string) error {
+	return &Error{Code: code, Err: errors.New(message)}
+}
+
+// Errorf 按格式创建携带错误码的错误，支持 %w
+func Errorf(code Code, format string, args ...interface{}) error {
+	return &Error{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// Of 返回错误链中的错误码
+// 未标记的网络错误归为 BackendUnreachable，其余归为 Internal
+func Of(err error) Code {
+	if err == nil {
+		return OK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	var urlErr *url.Error
+	var netErr net.Error
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) {
+		return BackendUnreachable
+	}
+	return Internal
+}
@@ -0,0 +1,39 @@
+package errcode
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+func TestOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Code
+	}{
+		{nil, OK},
+		{errors.New("boom"), Internal},
+		{New(WorkerNotRunning, "proxy worker is not running"), WorkerNotRunning},
+		{fmt.Errorf("restart: %w", New(InvalidConfig, "bad")), InvalidConfig},
+		{fmt.Errorf("request failed: %w", &url.Error{Op: "Get", URL: "http://x", Err: errors.New("refused")}), BackendUnreachable},
+	}
+	for _, tt := range tests {
+		if got := Of(tt.err); got != tt.want {
+			t.Errorf("Of(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCatalogue(t *testing.T) {
+	seen := map[Code]bool{}
+	for _, e := range Catalogue() {
+		if seen[e.Code] {
+			t.Errorf("duplicate code %s", e.Code)
+		}
+		seen[e.Code] = true
+	}
+	if OK.Status() != 200 || Code("UNKNOWN").Status() != 500 {
+		t.Error("unexpected status mapping")
+	}
+}
@@ -0,0 +1,257 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Type 事件类型
+type Type string
+
+const (
+	WorkerStarted      Type = "worker.started"
+	WorkerStopped      Type = "worker.stopped"
+	WorkerCrashed      Type = "worker.crashed"
+	TunnelConnected    Type = "tunnel.connected"
+	TunnelDisconnected Type = "tunnel.disconnected"
+	TaskReceived       Type = "task.received"
+	TaskCompleted      Type = "task.completed"
+	AuthFailed         Type = "auth.failed"
+	OTAAvailable       Type = "ota.available"
+	OTAStaged          Type = "ota.staged"
+	OTAApplied         Type = "ota.applied"
+	OTARolledBack      Type = "ota.rolled_back"
+	ClockSkewed        Type = "clock.skewed"
+	ConfigReloaded     Type = "config.reloaded"
+	ConfigRejected     Type = "config.rejected"
+)
+
+// DefaultCapacity 事件环形缓冲区默认容量
+const DefaultCapacity = 1024
+
+// Event 总线上发布的单个事件
+// Seq 单调递增，从 1 开始，作为 PollEvents 的游标
+type Event struct {
+	Seq  uint64      `json:"seq"`
+	Type Type        `json:"type"`
+	Time int64       `json:"time"` // Unix 毫秒
+	Data interface{} `json:"data,omitempty"`
+}
+
+// WorkerEvent worker 启停/崩溃事件数据
+type WorkerEvent struct {
+	TunnelID  string `json:"tunnel_id,omitempty"`
+	LocalPort int    `json:"local_port,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// TunnelEvent 隧道连接状态事件数据
+type TunnelEvent struct {
+	TunnelID string `json:"tunnel_id,omitempty"`
+	Service  string `json:"service"`
+	Message  string `json:"message,omitempty"`
+}
+
+// TaskEvent 任务接收/完成事件数据
+type TaskEvent struct {
+	Kind    string `json:"kind"` // nat_probe, bandwidth_test
+	TaskID  string `json:"task_id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// AuthEvent 鉴权失败事件数据
+type AuthEvent struct {
+	Path       string `json:"path"`
+	StatusCode int    `json:"status_code"`
+	Message    string `json:"message,omitempty"`
+}
+
+// OTAEvent 新版本可用事件数据
+type OTAEvent struct {
+	CurrentVersion string `json:"current_version"`
+	LatestVersion  string `json:"latest_version"`
+	URL            string `json:"url,omitempty"`
+	ReleaseNotes   string `json:"release_notes,omitempty"`
+	Forced         bool   `json:"forced,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// ClockEvent 时钟偏差事件数据
+type ClockEvent struct {
+	Offset    int64  `json:"offset"`    // 毫秒，服务端时间 - 本地时间
+	Threshold int64  `json:"threshold"` // 秒
+	Source    string `json:"source"`
+}
+
+// ConfigEvent 配置重新加载事件数据
+// reloaded 时 Keys 为变化的配置项，rejected 时 Error 为新配置的校验错误（之前的配置保持不变）
+type ConfigEvent struct {
+	Keys  []string `json:"keys,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// Batch 一次轮询返回的事件批次
+// Dropped 表示游标落后于缓冲区时被覆盖、无法再读取的事件数量
+type Batch struct {
+	Events     []Event `json:"events"`
+	NextCursor uint64  `json:"next_cursor"`
+	Dropped    uint64  `json:"dropped"`
+}
+
+// Bus 进程内事件总线
+// 事件保存在固定容量的环形缓冲区中，消费者通过游标增量拉取，
+// 也可以通过 Subscribe 获取实时推送的 channel
+type Bus struct {
+	mu     sync.Mutex
+	buf    []Event
+	next   uint64 // 下一个事件的 Seq
+	notify chan struct{}
+	subs   map[int]chan Event
+	subID  int
+}
+
+// 全局单例变量和初始化锁
+var (
+	instance *Bus
+	once     sync.Once
+)
+
+// GetBus 获取全局事件总线单例
+func GetBus() *Bus {
+	once.Do(func() {
+		instance = NewBus(DefaultCapacity)
+	})
+	return instance
+}
+
+// Publish 向全局事件总线发布事件
+func Publish(typ Type, data interface{}) {
+	GetBus().Publish(typ, data)
+}
+
+// NewBus 创建指定容量的事件总线
+func NewBus(capacity int) *Bus {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Bus{
+		buf:    make([]Event, capacity),
+		next:   1,
+		notify: make(chan struct{}),
+		subs:   make(map[int]chan Event),
+	}
+}
+
+// Publish 发布事件，返回分配的 Seq
+// 订阅者 channel 已满时丢弃该订阅者的这条事件，不会阻塞发布方
+func (b *Bus) Publish(typ Type, data interface{}) uint64 {
+	b.mu.Lock()
+	ev := Event{
+		Seq:  b.next,
+		Type: typ,
+		Time: time.Now().UnixMilli(),
+		Data: data,
+	}
+	b.buf[int(ev.Seq%uint64(len(b.buf)))] = ev
+	b.next++
+
+	close(b.notify)
+	b.notify = make(chan struct{})
+
+	for _, ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+	b.mu.Unlock()
+	return ev.Seq
+}
+
+// Since 返回 Seq 大于 cursor 的事件，最多 max 条（max <= 0 表示不限制）
+func (b *Bus) Since(cursor uint64, max int) Batch {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.since(cursor, max)
+}
+
+func (b *Bus) since(cursor uint64, max int) Batch {
+	batch := Batch{Events: []Event{}, NextCursor: cursor}
+	last := b.next - 1
+	if cursor >= last {
+		batch.NextCursor = last
+		return batch
+	}
+
+	first := cursor + 1
+	capacity := uint64(len(b.buf))
+	if last >= capacity && first <= last-capacity {
+		oldest := last - capacity + 1
+		batch.Dropped = oldest - first
+		first = oldest
+	}
+
+	for seq := first; seq <= last; seq++ {
+		if max > 0 && len(batch.Events) >= max {
+			break
+		}
+		batch.Events = append(batch.Events, b.buf[int(seq%capacity)])
+		batch.NextCursor = seq
+	}
+	return batch
+}
+
+// Wait 阻塞直到有 Seq 大于 cursor 的事件或 ctx 结束
+// ctx 结束时返回空批次而不是错误，调用方直接用 NextCursor 继续轮询即可
+func (b *Bus) Wait(ctx context.Context, cursor uint64, max int) Batch {
+	for {
+		b.mu.Lock()
+		batch := b.since(cursor, max)
+		notify := b.notify
+		b.mu.Unlock()
+
+		if len(batch.Events) > 0 || batch.Dropped > 0 {
+			return batch
+		}
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return batch
+		}
+	}
+}
+
+// Cursor 返回最新事件的 Seq，新消费者可以从这里开始只读取之后的事件
+func (b *Bus) Cursor() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.next - 1
+}
+
+// Subscribe 订阅实时事件，返回事件 channel 和取消函数
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	if buffer <= 0 {
+		buffer = 64
+	}
+	ch := make(chan Event, buffer)
+
+	b.mu.Lock()
+	id := b.subID
+	b.subID++
+	b.subs[id] = ch
+	b.mu.Unlock()
+
+	var cancelOnce sync.Once
+	cancel := func() {
+		cancelOnce.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
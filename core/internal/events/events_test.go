@@ -0,0 +1,102 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSinceReturnsEventsAfterCursor(t *testing.T) {
+	bus := NewBus(8)
+	bus.Publish(WorkerStarted, nil)
+	bus.Publish(TunnelConnected, nil)
+	bus.Publish(WorkerStopped, nil)
+
+	batch := bus.Since(1, 0)
+	if len(batch.Events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(batch.Events))
+	}
+	if batch.Events[0].Type != TunnelConnected || batch.Events[1].Type != WorkerStopped {
+		t.Errorf("unexpected event order: %+v", batch.Events)
+	}
+	if batch.NextCursor != 3 {
+		t.Errorf("expected next cursor 3, got %d", batch.NextCursor)
+	}
+
+	empty := bus.Since(batch.NextCursor, 0)
+	if len(empty.Events) != 0 || empty.NextCursor != 3 {
+		t.Errorf("expected empty batch at cursor 3, got %+v", empty)
+	}
+}
+
+func TestSinceLimitsBatchSize(t *testing.T) {
+	bus := NewBus(8)
+	for i := 0; i < 5; i++ {
+		bus.Publish(TaskReceived, nil)
+	}
+
+	batch := bus.Since(0, 2)
+	if len(batch.Events) != 2 || batch.NextCursor != 2 {
+		t.Fatalf("expected 2 events up to cursor 2, got %+v", batch)
+	}
+}
+
+func TestSinceReportsDroppedEvents(t *testing.T) {
+	bus := NewBus(4)
+	for i := 0; i < 10; i++ {
+		bus.Publish(TaskCompleted, i)
+	}
+
+	batch := bus.Since(0, 0)
+	if batch.Dropped != 6 {
+		t.Errorf("expected 6 dropped events, got %d", batch.Dropped)
+	}
+	if len(batch.Events) != 4 || batch.Events[0].Seq != 7 {
+		t.Errorf("expected events 7..10, got %+v", batch.Events)
+	}
+}
+
+func TestWaitBlocksUntilPublish(t *testing.T) {
+	bus := NewBus(8)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		bus.Publish(OTAAvailable, OTAEvent{LatestVersion: "1.0.0"})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	batch := bus.Wait(ctx, 0, 0)
+	if len(batch.Events) != 1 || batch.Events[0].Type != OTAAvailable {
+		t.Fatalf("expected ota event, got %+v", batch)
+	}
+}
+
+func TestWaitReturnsOnContextDone(t *testing.T) {
+	bus := NewBus(8)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	batch := bus.Wait(ctx, 0, 0)
+	if len(batch.Events) != 0 {
+		t.Errorf("expected no events, got %+v", batch.Events)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	bus := NewBus(8)
+	ch, cancel := bus.Subscribe(1)
+	defer cancel()
+
+	bus.Publish(AuthFailed, AuthEvent{Path: "/api/liteNode/stat", StatusCode: 401})
+
+	select {
+	case ev := <-ch:
+		if ev.Type != AuthFailed {
+			t.Errorf("expected auth.failed, got %s", ev.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for subscribed event")
+	}
+}
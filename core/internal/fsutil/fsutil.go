@@ -0,0 +1,109 @@
+// Package fsutil 崩溃安全的文件持久化
+//
+// 配置和身份文件通过 WriteFile 原子写入：先写同目录下的临时文件并 fsync，再重命名覆盖并 fsync 目录，
+// 崩溃或断电后读者只会看到旧内容或完整的新内容；WriteFileWithBackup 在覆盖前把当前版本保存为 .bak，
+// ReadFile 发现文件损坏时从 .bak 恢复。Lock 提供进程间文件锁，aro-node 和桌面应用可以共用一个数据目录
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// BackupSuffix WriteFileWithBackup 保存的上一个版本的文件后缀
+const BackupSuffix = ".bak"
+
+// WriteFile 原子写入 path：写入同目录下的临时文件并同步到磁盘后重命名，再同步目录使重命名持久化
+// 临时文件名唯一，未持有锁的并发写入不会互相破坏，最后重命名的一方生效
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if err := f.Chmod(perm); err != nil && runtime.GOOS != "windows" {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// WriteFileWithBackup 与 WriteFile 相同，覆盖前把 path 的当前内容原子地保存为 path.bak，
+// 当前内容通不过 valid（为空时不检查）时保留已有的备份
+func WriteFileWithBackup(path string, data []byte, perm os.FileMode, valid func([]byte) error) error {
+	if current, err := os.ReadFile(path); err == nil && len(current) > 0 && (valid == nil || valid(current) == nil) {
+		if err := WriteFile(path+BackupSuffix, current, perm); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", filepath.Base(path), err)
+		}
+	}
+	return WriteFile(path, data, perm)
+}
+
+// ReadFile 读取 path，内容通不过 valid 时改用 WriteFileWithBackup 保存的 path.bak 并用它恢复 path
+// path 不存在时返回满足 errors.Is(err, os.ErrNotExist) 的错误，不会用备份恢复被删除的文件；
+// 备份不存在或同样损坏时返回 path 的校验错误
+func ReadFile(path string, valid func([]byte) error) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	verr := valid(data)
+	if verr == nil {
+		return data, nil
+	}
+	backup, err := os.ReadFile(path + BackupSuffix)
+	if err != nil || valid(backup) != nil {
+		return nil, verr
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := WriteFile(path, backup, info.Mode().Perm()); err != nil {
+		return nil, fmt.Errorf("%w; restoring the backup failed: %v", verr, err)
+	}
+	log.Printf("%s is corrupted (%v), restored the backup copy", path, verr)
+	return backup, nil
+}
+
+// Remove 删除 path 和它的备份，文件不存在不是错误
+func Remove(path string) error {
+	for _, p := range []string{path, path + BackupSuffix} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncDir 同步目录项，部分平台（Windows）不支持打开目录同步，忽略错误
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
@@ -0,0 +1,95 @@
+package fsutil
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func validNonEmpty(data []byte) error {
+	if len(data) == 0 || bytes.IndexByte(data, 0) >= 0 {
+		return errors.New("corrupted")
+	}
+	return nil
+}
+
+func TestWriteFileLeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.env")
+	for _, content := range []string{"A=1\n", "A=2\n"} {
+		if err := WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "A=2\n" {
+		t.Errorf("unexpected content %q", data)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the target file, got %d entries", len(entries))
+	}
+}
+
+func TestReadFileRestoresBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.env")
+	if err := WriteFileWithBackup(path, []byte("A=1\n"), 0600, validNonEmpty); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileWithBackup(path, []byte("A=2\n"), 0600, validNonEmpty); err != nil {
+		t.Fatal(err)
+	}
+	// 模拟写入中途断电留下的损坏文件
+	if err := os.WriteFile(path, []byte{'A', 0, 0}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ReadFile(path, validNonEmpty)
+	if err != nil || string(data) != "A=1\n" {
+		t.Fatalf("expected the backup, got %q %v", data, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "A=1\n" {
+		t.Errorf("expected the file to be restored, got %q", data)
+	}
+
+	if err := Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(path, validNonEmpty); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a removed file to stay removed, got %v", err)
+	}
+	if _, err := os.Stat(path + BackupSuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the backup to be removed, got %v", err)
+	}
+}
+
+func TestLockFileSerializes(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "config.env.lock")
+	var (
+		wg      sync.WaitGroup
+		holders int
+		max     int
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lock, err := LockFile(lockPath)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			holders++
+			if holders > max {
+				max = holders
+			}
+			holders--
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+	if max != 1 {
+		t.Errorf("expected one lock holder at a time, got %d", max)
+	}
+}
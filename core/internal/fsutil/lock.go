@@ -0,0 +1,58 @@
+package fsutil
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Lock 进程间互斥的文件锁，锁住 path 上的锁文件（Unix 为 flock，Windows 为 LockFileEx），
+// 进程退出时由系统释放；同一进程中多个 goroutine 通过 Lock 串行执行
+type Lock struct {
+	f *os.File
+}
+
+// inProcess 同一进程中对同一锁文件加锁的互斥量：flock 按打开的文件描述符区分，不能互斥同进程的 goroutine
+var (
+	inProcessMu sync.Mutex
+	inProcess   = map[string]*sync.Mutex{}
+)
+
+func processMutex(path string) *sync.Mutex {
+	inProcessMu.Lock()
+	defer inProcessMu.Unlock()
+	mu, ok := inProcess[path]
+	if !ok {
+		mu = &sync.Mutex{}
+		inProcess[path] = mu
+	}
+	return mu
+}
+
+// LockFile 阻塞直到获得 path 上的锁，path 不存在时创建，调用方必须 Unlock
+func LockFile(path string) (*Lock, error) {
+	mu := processMutex(path)
+	mu.Lock()
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		mu.Unlock()
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		mu.Unlock()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return &Lock{f: f}, nil
+}
+
+// Unlock 释放锁
+func (l *Lock) Unlock() error {
+	path := l.f.Name()
+	err := unlockFile(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	processMutex(path).Unlock()
+	return err
+}
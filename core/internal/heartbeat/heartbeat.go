@@ -0,0 +1,338 @@
+// Package heartbeat 定时向后端上报节点存活状态：运行时长、worker 和隧道状态、公网 IP、
+// NAT 类型和代理流量计数
+//
+// 上报失败（离线、后端故障）时心跳保存在内存缓冲区中，恢复后按原始时间戳批量补发；
+// 后端可以在响应中调整心跳间隔
+package heartbeat
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/netcheck"
+	"aro-ext-app/core/internal/proxy_worker"
+	"aro-ext-app/core/internal/sysinfo"
+	"aro-ext-app/core/version"
+
+	"github.com/google/uuid"
+)
+
+// 默认参数
+const (
+	// DefaultInterval 默认心跳间隔
+	DefaultInterval = 3 * time.Minute
+	// MinInterval 心跳间隔下限，配置或后端要求的更短间隔按下限处理
+	MinInterval = 10 * time.Second
+	// DefaultNATInterval 重新检测 NAT 类型和公网 IP 的间隔
+	DefaultNATInterval = 30 * time.Minute
+	// DefaultMaxPending 离线时最多缓存的心跳数，超出后丢弃最旧的
+	DefaultMaxPending = 1000
+	// maxBatch 单次请求最多发送的心跳数
+	maxBatch = 100
+)
+
+// Options 心跳服务参数
+type Options struct {
+	// Client 上报使用的 API 客户端
+	Client *api_client.APIClient
+	// Worker 采集 worker、隧道状态和流量，为空时只上报运行时长
+	Worker *proxy_worker.Manager
+	// Interval 心跳间隔，为 0 时使用 IntervalFromConfig(Client.Config)
+	Interval time.Duration
+	// NATInterval 重新检测 NAT 的间隔，为 0 时使用 DefaultNATInterval，为负数时不检测
+	NATInterval time.Duration
+	// DetectNAT 检测 NAT 类型和公网 IP，为空时使用 netcheck.Detect
+	DetectNAT func(ctx context.Context) (*netcheck.Result, error)
+	// MaxPending 离线缓存上限，为 0 时使用 DefaultMaxPending
+	MaxPending int
+	// HardwareID 随心跳上报的硬件标识，供后端发现克隆的身份，为空时使用 sysinfo.HardwareID
+	HardwareID string
+	// Now 时钟，为空时使用 Client.Now（按服务端时间校正），测试可替换
+	Now func() time.Time
+	// OnResult 每次发送一批心跳后调用，err 为发送结果，为空时不调用
+	OnResult func(err error)
+}
+
+// Status 心跳状态，时间均为 Unix 秒，0 表示尚未发生
+type Status struct {
+	Running     bool   `json:"running"`
+	Interval    int64  `json:"interval"` // 秒
+	LastSuccess int64  `json:"last_success"`
+	LastAttempt int64  `json:"last_attempt"`
+	LastError   string `json:"last_error,omitempty"`
+	Pending     int    `json:"pending"`  // 等待补发的心跳数
+	Sent        uint64 `json:"sent"`     // 已被后端接受的心跳数
+	Dropped     uint64 `json:"dropped"`  // 缓存溢出丢弃的心跳数
+	Rejected    uint64 `json:"rejected"` // 后端拒绝（不可重试的错误，如认证失败、参数错误）而丢弃的心跳数
+	// CloneSuspected 后端发现同一客户端 ID 来自多台设备，应重新注册被复制的设备
+	CloneSuspected bool `json:"clone_suspected,omitempty"`
+}
+
+// Service 心跳服务
+type Service struct {
+	opts  Options
+	start time.Time
+
+	// beatMu 保证同一时间只有一次采集和发送，避免重复补发
+	beatMu sync.Mutex
+
+	mu       sync.Mutex
+	interval time.Duration
+	pending  []api_client.Heartbeat
+	status   Status
+	nat      *netcheck.Result
+	natAt    time.Time
+	reset    chan struct{} // 间隔变化时通知 Run 重建 ticker
+}
+
+// New 创建心跳服务，调用 Run 开始定时上报
+func New(opts Options) *Service {
+	if opts.Now == nil {
+		opts.Now = opts.Client.Now
+	}
+	if opts.Interval == 0 {
+		opts.Interval = IntervalFromConfig(opts.Client.Config)
+	}
+	if opts.NATInterval == 0 {
+		opts.NATInterval = DefaultNATInterval
+	}
+	if opts.DetectNAT == nil {
+		opts.DetectNAT = func(ctx context.Context) (*netcheck.Result, error) {
+			return netcheck.Detect(ctx, nil, 0)
+		}
+	}
+	if opts.MaxPending <= 0 {
+		opts.MaxPending = MaxPendingFromConfig(opts.Client.Config)
+	}
+	if opts.HardwareID == "" {
+		opts.HardwareID = sysinfo.HardwareID()
+	}
+	s := &Service{
+		opts:  opts,
+		start: opts.Now(),
+		reset: make(chan struct{}, 1),
+	}
+	s.interval = clampInterval(opts.Interval)
+	s.status.Interval = int64(s.interval / time.Second)
+	return s
+}
+
+// IntervalFromConfig 读取 HEARTBEAT_INTERVAL（秒），未配置或无效时返回 DefaultInterval
+func IntervalFromConfig(cfg *config.Config) time.Duration {
+	if cfg == nil {
+		return DefaultInterval
+	}
+	if v, err := strconv.Atoi(cfg.Get(config.KeyHeartbeatInterval)); err == nil && v > 0 {
+		return time.Duration(v) * time.Second
+	}
+	return DefaultInterval
+}
+
+// MaxPendingFromConfig 读取 limits.max_pending_heartbeats（HEARTBEAT_MAX_PENDING），未配置或无效时返回 DefaultMaxPending
+func MaxPendingFromConfig(cfg *config.Config) int {
+	if cfg == nil {
+		return DefaultMaxPending
+	}
+	s, _ := cfg.Settings()
+	return s.Limits.MaxPendingHeartbeats
+}
+
+func clampInterval(d time.Duration) time.Duration {
+	if d < MinInterval {
+		return MinInterval
+	}
+	return d
+}
+
+// Run 先与后端校准时钟，然后立即发送一次心跳，之后按间隔定时发送，直到 ctx 结束
+func (s *Service) Run(ctx context.Context) {
+	s.setRunning(true)
+	defer s.setRunning(false)
+
+	// 校准失败时沿用已保存的偏差，心跳响应的 Date 头之后继续校正
+	if _, err := s.opts.Client.SyncClock(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("Heartbeat: clock sync failed: %v", err)
+	}
+
+	ticker := time.NewTicker(s.Interval())
+	defer ticker.Stop()
+	for {
+		if err := s.Beat(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Heartbeat failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.reset:
+			ticker.Reset(s.Interval())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Beat 采集一次心跳并连同缓存中的心跳一起发送，失败时心跳留在缓存中等待下次补发；
+// 后端拒绝（见 api_client.Retryable）的一批心跳重发也会被拒绝，直接丢弃，不阻塞之后的心跳
+func (s *Service) Beat(ctx context.Context) error {
+	s.beatMu.Lock()
+	defer s.beatMu.Unlock()
+
+	beat := s.Sample(ctx)
+	s.mu.Lock()
+	s.pending = append(s.pending, beat)
+	if over := len(s.pending) - s.opts.MaxPending; over > 0 {
+		s.pending = s.pending[over:]
+		s.status.Dropped += uint64(over)
+	}
+	s.mu.Unlock()
+	return s.flush(ctx)
+}
+
+// flush 按时间顺序分批发送缓存的心跳，调用方持有 beatMu
+func (s *Service) flush(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		n := len(s.pending)
+		if n > maxBatch {
+			n = maxBatch
+		}
+		batch := append([]api_client.Heartbeat(nil), s.pending[:n]...)
+		s.mu.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		resp, err := s.opts.Client.NodeHeartbeatContext(ctx, batch)
+		now := s.opts.Now().Unix()
+		s.mu.Lock()
+		s.status.LastAttempt = now
+		if err != nil {
+			s.status.LastError = err.Error()
+			if !api_client.Retryable(err) {
+				log.Printf("Heartbeat: backend rejected %d beats, dropping them: %v", len(batch), err)
+				s.pending = s.pending[len(batch):]
+				s.status.Rejected += uint64(len(batch))
+			}
+			s.status.Pending = len(s.pending)
+			s.mu.Unlock()
+			s.report(err)
+			return err
+		}
+		s.pending = s.pending[len(batch):]
+		s.status.LastSuccess = now
+		s.status.LastError = ""
+		s.status.Sent += uint64(len(batch))
+		s.status.Pending = len(s.pending)
+		if resp.Data.CloneSuspected && !s.status.CloneSuspected {
+			log.Printf("Heartbeat: backend reports this node identity is in use on another device")
+		}
+		s.status.CloneSuspected = resp.Data.CloneSuspected
+		s.mu.Unlock()
+		s.report(nil)
+
+		if resp.Data.Interval > 0 {
+			s.SetInterval(time.Duration(resp.Data.Interval) * time.Second)
+		}
+	}
+}
+
+// report 把一批心跳的发送结果交给 OnResult
+func (s *Service) report(err error) {
+	if s.opts.OnResult != nil {
+		s.opts.OnResult(err)
+	}
+}
+
+// Sample 采集当前状态，不发送
+func (s *Service) Sample(ctx context.Context) api_client.Heartbeat {
+	now := s.opts.Now()
+	beat := api_client.Heartbeat{
+		ID:          uuid.NewString(),
+		Timestamp:   now.UnixMilli(),
+		Uptime:      int64(now.Sub(s.start) / time.Second),
+		CoreVersion: version.VERSION,
+		ClockOffset: s.opts.Client.ClockStatus().Offset,
+		HardwareID:  s.opts.HardwareID,
+	}
+	if s.opts.Worker != nil {
+		st := s.opts.Worker.GetStatus()
+		beat.WorkerRunning = st.IsRunning
+		if st.IsRunning && st.StartTime > 0 {
+			beat.WorkerUptime = now.Unix() - st.StartTime
+		}
+		beat.TunnelState = st.TunnelState
+		beat.TotalConns = st.Traffic.TotalConns
+		beat.CurrentConns = st.Traffic.CurrentConns
+		beat.InputBytes = st.Traffic.InputBytes
+		beat.OutputBytes = st.Traffic.OutputBytes
+	}
+	if nat := s.natResult(ctx, now); nat != nil {
+		beat.NatType = nat.NatType
+		beat.PublicIP = nat.PublicIP
+	}
+	return beat
+}
+
+// natResult 返回缓存的 NAT 检测结果，过期时重新检测，检测失败时沿用上次的结果
+func (s *Service) natResult(ctx context.Context, now time.Time) *netcheck.Result {
+	if s.opts.NATInterval < 0 {
+		return nil
+	}
+	s.mu.Lock()
+	nat, fresh := s.nat, !s.natAt.IsZero() && now.Sub(s.natAt) < s.opts.NATInterval
+	s.mu.Unlock()
+	if fresh {
+		return nat
+	}
+
+	result, err := s.opts.DetectNAT(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.natAt = now
+	if err != nil {
+		log.Printf("Heartbeat: NAT detection failed: %v", err)
+		return s.nat
+	}
+	s.nat = result
+	return result
+}
+
+// Interval 返回当前心跳间隔
+func (s *Service) Interval() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.interval
+}
+
+// SetInterval 调整心跳间隔，正在运行的 Run 从下一次心跳开始使用新间隔
+func (s *Service) SetInterval(d time.Duration) {
+	d = clampInterval(d)
+	s.mu.Lock()
+	changed := d != s.interval
+	s.interval = d
+	s.status.Interval = int64(d / time.Second)
+	s.mu.Unlock()
+	if changed {
+		select {
+		case s.reset <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Status 返回心跳状态
+func (s *Service) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+func (s *Service) setRunning(running bool) {
+	s.mu.Lock()
+	s.status.Running = running
+	s.mu.Unlock()
+}
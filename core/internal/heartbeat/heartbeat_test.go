@@ -0,0 +1,187 @@
+package heartbeat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/clock"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/events"
+	"aro-ext-app/core/internal/mockbackend"
+	"aro-ext-app/core/internal/netcheck"
+)
+
+// fakeClock 每次调用前进一秒
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time {
+	c.now = c.now.Add(time.Second)
+	return c.now
+}
+
+func newService(t *testing.T, b *mockbackend.Backend, opts Options) *Service {
+	t.Helper()
+	keyPair, err := crypto.GenerateRSAKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.New(t.TempDir())
+	c := api_client.NewAPIClient(b.URL(), crypto.ClientIDFrom(cfg), keyPair)
+	c.Config = cfg
+	c.Events = events.NewBus(16)
+	c.Clock = clock.New(cfg)
+	c.Transport = api_client.NewTransport(api_client.RetryPolicy{Timeout: 2 * time.Second, BreakerThreshold: 100, BreakerCooldown: time.Minute})
+	if _, err := c.NodeSignUp(); err != nil {
+		t.Fatal(err)
+	}
+	opts.Client = c
+	if opts.DetectNAT == nil {
+		opts.DetectNAT = func(ctx context.Context) (*netcheck.Result, error) {
+			return &netcheck.Result{NatType: netcheck.NatCone, PublicIP: "203.0.113.7"}, nil
+		}
+	}
+	return New(opts)
+}
+
+func TestBeatReportsState(t *testing.T) {
+	b := mockbackend.Start()
+	defer b.Close()
+	b.HeartbeatInterval = 60
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	s := newService(t, b, Options{Now: clock.Now})
+
+	if err := s.Beat(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	n, _ := b.Node(s.opts.Client.ClientID)
+	if len(n.Heartbeats) != 1 {
+		t.Fatalf("expected one heartbeat, got %d", len(n.Heartbeats))
+	}
+	beat := n.Heartbeats[0]
+	if beat.NatType != netcheck.NatCone || beat.PublicIP != "203.0.113.7" || beat.Uptime != 1 || beat.CoreVersion == "" {
+		t.Errorf("unexpected heartbeat %+v", beat)
+	}
+	st := s.Status()
+	if st.LastSuccess == 0 || st.Sent != 1 || st.Pending != 0 {
+		t.Errorf("unexpected status %+v", st)
+	}
+	if s.Interval() != time.Minute || st.Interval != 60 {
+		t.Errorf("expected the backend to set a 60s interval, got %v", s.Interval())
+	}
+}
+
+func TestBeatsBufferedWhileOffline(t *testing.T) {
+	b := mockbackend.Start()
+	defer b.Close()
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	s := newService(t, b, Options{Now: clock.Now, MaxPending: 3, NATInterval: -1})
+	ctx := context.Background()
+
+	b.Inject(mockbackend.Fault{Path: mockbackend.HeartbeatPath, Status: 503})
+	for i := 0; i < 4; i++ {
+		if err := s.Beat(ctx); err == nil {
+			t.Fatal("expected heartbeat to fail while the backend is down")
+		}
+	}
+	st := s.Status()
+	if st.Pending != 3 || st.Dropped != 1 || st.LastSuccess != 0 || st.LastError == "" {
+		t.Fatalf("unexpected status while offline %+v", st)
+	}
+
+	b.ClearFaults()
+	if err := s.Beat(ctx); err != nil {
+		t.Fatal(err)
+	}
+	n, _ := b.Node(s.opts.Client.ClientID)
+	if len(n.Heartbeats) != 3 {
+		t.Fatalf("expected the 3 most recent beats, got %d", len(n.Heartbeats))
+	}
+	for i := 1; i < len(n.Heartbeats); i++ {
+		if n.Heartbeats[i].Timestamp <= n.Heartbeats[i-1].Timestamp {
+			t.Errorf("expected beats in original order, got %+v", n.Heartbeats)
+		}
+	}
+	if n.Heartbeats[0].NatType != "" {
+		t.Errorf("expected NAT detection to be disabled, got %q", n.Heartbeats[0].NatType)
+	}
+	if st := s.Status(); st.Pending != 0 || st.LastError != "" || st.Sent != 3 || st.Dropped != 2 {
+		t.Errorf("unexpected status after recovery %+v", st)
+	}
+}
+
+func TestRejectedBeatsAreDropped(t *testing.T) {
+	b := mockbackend.Start()
+	defer b.Close()
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	s := newService(t, b, Options{Now: clock.Now, NATInterval: -1})
+	ctx := context.Background()
+
+	// 参数错误重发也会被拒绝，这批心跳不再保留
+	b.Inject(mockbackend.Fault{Path: mockbackend.HeartbeatPath, Status: 400, Times: 1})
+	if err := s.Beat(ctx); err == nil {
+		t.Fatal("expected the rejected heartbeat to fail")
+	}
+	if st := s.Status(); st.Pending != 0 || st.Rejected != 1 {
+		t.Fatalf("expected the rejected beat to be dropped, got %+v", st)
+	}
+	if err := s.Beat(ctx); err != nil {
+		t.Fatal(err)
+	}
+	n, _ := b.Node(s.opts.Client.ClientID)
+	if len(n.Heartbeats) != 1 || n.Heartbeats[0].ID == "" {
+		t.Errorf("expected only the later beat with an ID, got %+v", n.Heartbeats)
+	}
+
+	// 响应丢失后重发的心跳按 ID 去重
+	beats := []api_client.Heartbeat{s.Sample(ctx)}
+	for i := 0; i < 2; i++ {
+		if _, err := s.opts.Client.NodeHeartbeatContext(ctx, beats); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, _ := b.Node(s.opts.Client.ClientID); len(n.Heartbeats) != 2 {
+		t.Errorf("expected a resent beat to be stored once, got %d beats", len(n.Heartbeats))
+	}
+}
+
+func TestNATDetectionIsCached(t *testing.T) {
+	calls := 0
+	s := New(Options{
+		Client:      &api_client.APIClient{},
+		Interval:    time.Minute,
+		NATInterval: time.Hour,
+		DetectNAT: func(ctx context.Context) (*netcheck.Result, error) {
+			calls++
+			if calls > 1 {
+				return nil, errors.New("stun unreachable")
+			}
+			return &netcheck.Result{NatType: netcheck.NatSymmetric}, nil
+		},
+	})
+	now := time.Now()
+	s.natResult(context.Background(), now)
+	if got := s.natResult(context.Background(), now.Add(time.Minute)); got == nil || calls != 1 {
+		t.Fatalf("expected cached result, got %+v after %d calls", got, calls)
+	}
+	if got := s.natResult(context.Background(), now.Add(2*time.Hour)); got == nil || got.NatType != netcheck.NatSymmetric || calls != 2 {
+		t.Errorf("expected previous result to survive a failed detection, got %+v", got)
+	}
+}
+
+func TestIntervalFromConfig(t *testing.T) {
+	cfg := config.New(t.TempDir())
+	if got := IntervalFromConfig(cfg); got != 180*time.Second {
+		t.Errorf("expected default interval, got %v", got)
+	}
+	cfg.Set(config.KeyHeartbeatInterval, "30")
+	if got := IntervalFromConfig(cfg); got != 30*time.Second {
+		t.Errorf("expected 30s, got %v", got)
+	}
+	if got := New(Options{Client: &api_client.APIClient{}, Interval: time.Second}).Interval(); got != MinInterval {
+		t.Errorf("expected interval clamped to %v, got %v", MinInterval, got)
+	}
+}
@@ -0,0 +1,235 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/errcode"
+	"aro-ext-app/core/internal/sysinfo"
+)
+
+// 身份备份：私钥、客户端 ID、序列号和绑定用户保存在一个用口令加密的 PEM 文件中，
+// 重装或换设备后导入即可恢复原来的节点身份（和后端记录的奖励）
+const (
+	// BackupBlockType 备份文件的 PEM 类型
+	BackupBlockType = "ARO IDENTITY BACKUP"
+	// BackupVersion 当前的备份格式版本，导入时拒绝更新的版本
+	BackupVersion = 1
+	// ActiveWindow 备份中的身份在另一台设备上最后一次心跳距今小于该时间时拒绝导入（约 3 个默认心跳间隔）
+	ActiveWindow = 10 * time.Minute
+)
+
+// Backup 备份内容，只以加密形式写出
+type Backup struct {
+	Version      int    `json:"version"`
+	CreatedAt    int64  `json:"created_at"` // Unix 秒
+	ClientID     string `json:"client_id"`
+	SerialNumber string `json:"serial_number,omitempty"`
+	UserID       string `json:"user_id,omitempty"`
+	Email        string `json:"email,omitempty"`
+	KeyType      string `json:"key_type"`
+	PrivateKey   string `json:"private_key"` // 明文 PEM
+	HardwareID   string `json:"hardware_id"` // 导出设备的硬件标识
+}
+
+// BackupInfo 备份摘要，不含私钥
+type BackupInfo struct {
+	ClientID     string `json:"client_id"`
+	SerialNumber string `json:"serial_number"`
+	Email        string `json:"email"`
+	KeyType      string `json:"key_type"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+// ImportOptions 导入选项
+type ImportOptions struct {
+	// Overwrite 替换本设备上已注册的另一个身份，被替换的身份只能从它自己的备份恢复
+	Overwrite bool `json:"overwrite"`
+	// Force 后端无法确认身份是否在别处运行（不可达或不支持）时仍然导入；
+	// 后端确认身份正在另一台设备上运行时始终拒绝
+	Force bool `json:"force"`
+}
+
+// Info 返回备份摘要
+func (b *Backup) Info() BackupInfo {
+	return BackupInfo{
+		ClientID:     b.ClientID,
+		SerialNumber: b.SerialNumber,
+		Email:        b.Email,
+		KeyType:      b.KeyType,
+		CreatedAt:    b.CreatedAt,
+	}
+}
+
+// Export 导出 cfg 和 store 中的当前身份，用 passphrase 加密
+func Export(cfg *config.Config, store crypto.KeyStore, passphrase string) ([]byte, error) {
+	return export(cfg, store, passphrase, sysinfo.HardwareID(), time.Now())
+}
+
+func export(cfg *config.Config, store crypto.KeyStore, passphrase, hardwareID string, now time.Time) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errcode.New(errcode.InvalidParams, "a passphrase is required to export the identity")
+	}
+	clientID := cfg.Get(config.KeyClientId)
+	if clientID == "" {
+		return nil, errcode.New(errcode.InvalidParams, "this device has no identity to export")
+	}
+	keyPair, err := crypto.LoadKeyPair(store)
+	if err != nil {
+		return nil, err
+	}
+	backup := Backup{
+		Version:      BackupVersion,
+		CreatedAt:    now.Unix(),
+		ClientID:     clientID,
+		SerialNumber: cfg.Get(config.KeySN),
+		UserID:       cfg.Get(config.USER_ID),
+		Email:        cfg.Get(config.EMAIL),
+		KeyType:      string(crypto.KeyTypeOf(keyPair.PrivateKey)),
+		PrivateKey:   crypto.ExportPrivateKeyToPEM(keyPair.PrivateKey),
+		HardwareID:   hardwareID,
+	}
+	plaintext, err := json.Marshal(backup)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.SealWithPassphrase(BackupBlockType, passphrase, plaintext)
+}
+
+// OpenBackup 解密并校验备份，返回备份内容和其中的私钥
+func OpenBackup(data []byte, passphrase string) (*Backup, crypto.PrivateKey, error) {
+	plaintext, err := crypto.OpenWithPassphrase(BackupBlockType, passphrase, data)
+	if err != nil {
+		return nil, nil, errcode.Errorf(errcode.InvalidBackup, "cannot open the identity backup: %w", err)
+	}
+	var backup Backup
+	if err := json.Unmarshal(plaintext, &backup); err != nil {
+		return nil, nil, errcode.Errorf(errcode.InvalidBackup, "identity backup is unreadable: %w", err)
+	}
+	if backup.Version < 1 || backup.Version > BackupVersion {
+		return nil, nil, errcode.Errorf(errcode.InvalidBackup, "identity backup version %d is not supported", backup.Version)
+	}
+	if backup.ClientID == "" {
+		return nil, nil, errcode.New(errcode.InvalidBackup, "identity backup has no client id")
+	}
+	key, err := crypto.ParsePrivateKeyFromPEM(backup.PrivateKey)
+	if err != nil {
+		return nil, nil, errcode.Errorf(errcode.InvalidBackup, "identity backup holds an invalid key: %w", err)
+	}
+	if keyType := string(crypto.KeyTypeOf(key)); keyType != backup.KeyType {
+		return nil, nil, errcode.Errorf(errcode.InvalidBackup, "identity backup declares a %s key but holds %s", backup.KeyType, keyType)
+	}
+	return &backup, key, nil
+}
+
+// Import 用备份替换 client 和 store 的当前身份
+// 本设备已注册另一个身份时需要 opts.Overwrite；先以备份中的身份向后端查询最后一次心跳，
+// 身份最近在另一台设备上运行时拒绝导入，避免两台设备同时使用同一身份。调用前应停止使用 client 的后台任务
+func Import(ctx context.Context, client *api_client.APIClient, store crypto.KeyStore, data []byte, passphrase string, opts ImportOptions) (*BackupInfo, error) {
+	return importBackup(ctx, client, store, data, passphrase, opts, sysinfo.HardwareID())
+}
+
+func importBackup(ctx context.Context, client *api_client.APIClient, store crypto.KeyStore, data []byte, passphrase string, opts ImportOptions, hardwareID string) (*BackupInfo, error) {
+	backup, key, err := OpenBackup(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	cfg := client.Config
+	if current := cfg.Get(config.KeyClientId); current != "" && current != backup.ClientID && cfg.Get(config.KeySN) != "" && !opts.Overwrite {
+		return nil, errcode.Errorf(errcode.IdentityInUse, "this device is registered as %s, set overwrite to replace it", current)
+	}
+	keyPair := crypto.NewKeyPair(key)
+	// 备份时尚未注册的身份不会出现在后端
+	if backup.SerialNumber != "" {
+		if err := checkPresence(ctx, client, backup.ClientID, keyPair, hardwareID, opts.Force); err != nil {
+			return nil, err
+		}
+	}
+
+	// 配置保存失败时恢复原来的私钥，私钥和配置中的客户端 ID 不会属于不同的身份
+	previous, err := store.Load(crypto.KeyFileName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read the current key: %w", err)
+	}
+	if err := store.Save(crypto.KeyFileName, key); err != nil {
+		return nil, fmt.Errorf("failed to save the restored key: %w", err)
+	}
+	// 身份在本设备上恢复，记录本设备的硬件标识，克隆检测不会把它当作复制的身份
+	if err := cfg.SetAndSaveAll(map[string]string{
+		config.KeyClientId:         backup.ClientID,
+		config.KeySN:               backup.SerialNumber,
+		config.USER_ID:             backup.UserID,
+		config.EMAIL:               backup.Email,
+		config.KeyHardwareID:       hardwareID,
+		config.KeyBaseInfoHash:     "",
+		config.KeyPreviousKeyUntil: "",
+	}); err != nil {
+		restoreKey(store, previous)
+		return nil, err
+	}
+	// 轮换中的新密钥和旧密钥属于被替换的身份
+	if err := crypto.DiscardPendingKeyPair(store); err != nil {
+		log.Printf("Failed to remove the pending key: %v", err)
+	}
+	if err := crypto.RemovePreviousKeyPair(store); err != nil {
+		log.Printf("Failed to remove the previous key: %v", err)
+	}
+	client.SetIdentity(backup.ClientID, keyPair)
+	log.Printf("Restored node identity %s from a backup made at %s", backup.ClientID, time.Unix(backup.CreatedAt, 0).Format(time.RFC3339))
+	info := backup.Info()
+	return &info, nil
+}
+
+// restoreKey 把私钥恢复为导入前的 previous，导入前没有私钥时删除导入的私钥
+func restoreKey(store crypto.KeyStore, previous crypto.PrivateKey) {
+	var err error
+	if previous != nil {
+		err = store.Save(crypto.KeyFileName, previous)
+	} else {
+		err = store.Remove(crypto.KeyFileName)
+	}
+	if err != nil {
+		log.Printf("Failed to restore the previous key after a failed import: %v", err)
+	}
+}
+
+// checkPresence 以备份中的身份查询最后一次心跳，身份最近在另一台设备上运行时返回 IdentityInUse
+// 查询使用 /api/liteNode/node/presence，目前只有 mockbackend 提供；后端没有该接口时查询失败，
+// 导入需要 force 跳过检查
+func checkPresence(ctx context.Context, client *api_client.APIClient, clientID string, keyPair *crypto.KeyPair, hardwareID string, force bool) error {
+	probe := api_client.NewAPIClient(client.URL(), clientID, keyPair)
+	probe.Config = client.Config
+	probe.Events = client.Events
+	probe.Clock = client.Clock
+	probe.Transport = client.Transport
+	probe.HttpClient = client.HttpClient
+
+	resp, err := probe.NodePresence(ctx)
+	if err != nil {
+		if errcode.Of(err) == errcode.AuthFailed {
+			// 备份之后密钥被轮换过，或身份已被重新注册
+			return errcode.Errorf(errcode.InvalidBackup, "backend no longer accepts the key in the backup: %w", err)
+		}
+		if force {
+			log.Printf("Cannot confirm identity %s is not in use elsewhere, restoring anyway: %v", clientID, err)
+			return nil
+		}
+		return fmt.Errorf("cannot confirm identity %s is not in use elsewhere (set force to skip the check): %w", clientID, err)
+	}
+	if resp.Data.LastSeen == 0 || resp.Data.HardwareID == hardwareID {
+		return nil
+	}
+	lastSeen := time.UnixMilli(resp.Data.LastSeen)
+	if since := client.Now().Sub(lastSeen); since < ActiveWindow {
+		return errcode.Errorf(errcode.IdentityInUse, "identity %s is active on another device (last heartbeat %s ago), stop that node first", clientID, since.Round(time.Second))
+	}
+	return nil
+}
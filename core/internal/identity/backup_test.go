@@ -0,0 +1,142 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/errcode"
+	"aro-ext-app/core/internal/mockbackend"
+)
+
+func TestBackupRoundTrip(t *testing.T) {
+	b := mockbackend.Start()
+	defer b.Close()
+	store := crypto.NewMemoryKeyStore()
+	c := newClient(t, b, store)
+	if _, err := SignUp(context.Background(), c, store); err != nil {
+		t.Fatal(err)
+	}
+	c.Config.SetAndSave(config.EMAIL, "user@example.com")
+
+	data, err := export(c.Config, store, "correct horse", "device-a", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(c.ClientID)) || bytes.Contains(data, []byte("PRIVATE KEY")) {
+		t.Fatal("expected the identity to be encrypted in the backup")
+	}
+
+	if _, _, err := OpenBackup(data, "battery staple"); errcode.Of(err) != errcode.InvalidBackup || !errors.Is(err, crypto.ErrWrongPassphrase) {
+		t.Errorf("expected a wrong passphrase error, got %v", err)
+	}
+	corrupted := bytes.Replace(data, []byte("\n\n"), []byte("\n\nAAAA"), 1)
+	if _, _, err := OpenBackup(corrupted, "correct horse"); !errors.Is(err, crypto.ErrCorrupted) {
+		t.Errorf("expected a corrupted backup to be detected, got %v", err)
+	}
+
+	// 在另一台设备上恢复
+	newStore := crypto.NewMemoryKeyStore()
+	restored := newClient(t, b, newStore)
+	info, err := importBackup(context.Background(), restored, newStore, data, "correct horse", ImportOptions{}, "device-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ClientID != c.ClientID || info.Email != "user@example.com" || restored.ClientID != c.ClientID {
+		t.Fatalf("expected the identity to be restored, got %+v", info)
+	}
+	if restored.Config.Get(config.KeySN) != c.Config.Get(config.KeySN) || restored.Config.Get(config.KeyHardwareID) != "device-b" {
+		t.Error("expected the serial number and this device's hardware id to be saved")
+	}
+	saved, err := crypto.LoadKeyPair(newStore)
+	if err != nil || !saved.PrivateKey.Equal(c.PrivateKey) {
+		t.Fatalf("expected the restored key to be saved: %v", err)
+	}
+	if _, err := restored.GetNodeStat(); err != nil {
+		t.Errorf("expected the restored identity to be accepted: %v", err)
+	}
+}
+
+func TestImportRefusesActiveIdentity(t *testing.T) {
+	b := mockbackend.Start()
+	defer b.Close()
+	store := crypto.NewMemoryKeyStore()
+	c := newClient(t, b, store)
+	if _, err := c.NodeSignUp(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := export(c.Config, store, "secret", "device-a", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.NodeHeartbeat([]api_client.Heartbeat{{Timestamp: c.Now().UnixMilli(), HardwareID: "device-a"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	newStore := crypto.NewMemoryKeyStore()
+	other := newClient(t, b, newStore)
+	if _, err := importBackup(context.Background(), other, newStore, data, "secret", ImportOptions{Force: true}, "device-b"); errcode.Of(err) != errcode.IdentityInUse {
+		t.Fatalf("expected an identity active on another device to be refused, got %v", err)
+	}
+	if other.ClientID == c.ClientID {
+		t.Fatal("expected the refused import to leave the client unchanged")
+	}
+	// 同一台设备重装后恢复不受影响
+	if _, err := importBackup(context.Background(), other, newStore, data, "secret", ImportOptions{}, "device-a"); err != nil {
+		t.Errorf("expected a restore on the same device to pass, got %v", err)
+	}
+
+	// 本设备已注册另一个身份时需要 Overwrite
+	thirdStore := crypto.NewMemoryKeyStore()
+	third := newClient(t, b, thirdStore)
+	if _, err := third.NodeSignUp(); err != nil {
+		t.Fatal(err)
+	}
+	b.Now = func() time.Time { return time.Now().Add(ActiveWindow + time.Minute) }
+	if _, err := importBackup(context.Background(), third, thirdStore, data, "secret", ImportOptions{}, "device-c"); errcode.Of(err) != errcode.IdentityInUse {
+		t.Fatalf("expected a registered device to need overwrite, got %v", err)
+	}
+	if _, err := importBackup(context.Background(), third, thirdStore, data, "secret", ImportOptions{Overwrite: true}, "device-c"); err != nil {
+		t.Errorf("expected the import to pass once the other device went quiet, got %v", err)
+	}
+}
+
+func TestImportRestoresKeyWhenConfigFails(t *testing.T) {
+	b := mockbackend.Start()
+	defer b.Close()
+	store := crypto.NewMemoryKeyStore()
+	c := newClient(t, b, store)
+	data, err := export(c.Config, store, "secret", "device-a", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 配置目录换成普通文件，保存 config.env 失败
+	dir := t.TempDir()
+	newStore := crypto.NewMemoryKeyStore()
+	other := newClient(t, b, newStore)
+	other.Config = config.New(dir)
+	original := other.KeyPair()
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importBackup(context.Background(), other, newStore, data, "secret", ImportOptions{}, "device-b"); err == nil {
+		t.Fatal("expected the import to fail when the config cannot be saved")
+	}
+	saved, err := crypto.LoadKeyPair(newStore)
+	if err != nil || !saved.PrivateKey.Equal(original.PrivateKey) {
+		t.Errorf("expected the previous key to be restored: %v", err)
+	}
+	if other.ID() == c.ClientID {
+		t.Error("expected the failed import to leave the client unchanged")
+	}
+}
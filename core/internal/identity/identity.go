@@ -0,0 +1,243 @@
+// Package identity 管理节点身份（密钥对和客户端 ID）：密钥轮换、重新注册和克隆检测
+//
+// 轮换：生成新密钥并保存为 aro_rsa.next，通过当前密钥签名的请求把新公钥、新旧两把密钥对同一消息的
+// 签名提交给后端，后端确认后原子替换 aro_rsa，旧密钥保存为 aro_rsa.old，在后端给出的宽限期内保留。
+// 任一步中断后再次轮换会继续使用 aro_rsa.next，后端对同一把新密钥的重复请求返回成功。
+//
+// 密钥算法：新密钥使用 KEY_TYPE 配置的算法，轮换可以把旧的 RSA 密钥换成 Ed25519 等算法；
+// 注册或轮换时后端不接受该算法，则改用后端支持的算法生成新密钥再提交一次。
+//
+// 克隆检测：首次运行时记录硬件标识（HARDWARE_ID），之后硬件标识不同说明数据目录被复制到了另一台设备；
+// 心跳同时上报硬件标识，后端发现同一客户端 ID 来自多台设备时在心跳响应中提示。
+// 被复制的设备应调用 Reregister，生成新的客户端 ID 和密钥重新注册。
+//
+// 备份：Export 把私钥、客户端 ID、序列号和绑定用户导出为用口令加密的文件，重装或换设备后用 Import 恢复；
+// 身份仍在另一台设备上运行时拒绝恢复，需要先停止那台设备上的节点
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/sysinfo"
+)
+
+// DefaultGracePeriod 后端没有给出宽限期时保留旧密钥的时间
+const DefaultGracePeriod = 24 * time.Hour
+
+// RotateResult 密钥轮换结果
+type RotateResult struct {
+	PublicKey  string `json:"public_key"`  // 新公钥（base64 编码的 PEM）
+	GraceUntil int64  `json:"grace_until"` // 旧密钥保留到的 Unix 秒
+	Resumed    bool   `json:"resumed"`     // 继续了之前中断的轮换
+}
+
+// CloneStatus 克隆检测结果
+type CloneStatus struct {
+	HardwareID string `json:"hardware_id"` // 当前设备的硬件标识
+	Recorded   string `json:"recorded"`    // 身份创建时记录的硬件标识
+	Cloned     bool   `json:"cloned"`      // 身份来自另一台设备
+}
+
+// SignUp 注册节点，后端不接受当前密钥的算法时换用后端支持的算法生成新密钥，保存到 store 后再注册一次
+// 被拒绝的密钥没有注册过，可以直接替换
+func SignUp(ctx context.Context, client *api_client.APIClient, store crypto.KeyStore) (*api_client.APIResponseWith[api_client.SignUpData], error) {
+	resp, err := client.NodeSignUpContext(ctx)
+	var keyErr *api_client.KeyTypeError
+	if !errors.As(err, &keyErr) {
+		return resp, err
+	}
+	keyType, ok := negotiateKeyType(crypto.KeyTypeFromConfig(client.Config), keyErr)
+	if !ok {
+		return nil, err
+	}
+	log.Printf("Backend does not accept %s keys, signing up with a new %s key", keyErr.KeyType, keyType)
+	newKey, err := crypto.GenerateKeyPair(keyType)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Save(crypto.KeyFileName, newKey.PrivateKey); err != nil {
+		return nil, fmt.Errorf("failed to save the new key: %w", err)
+	}
+	client.SetKeyPair(newKey, nil, time.Time{})
+	return client.NodeSignUpContext(ctx)
+}
+
+// negotiateKeyType 从后端支持的算法中选择：优先使用配置的算法，否则使用后端的首选算法
+func negotiateKeyType(preferred crypto.KeyType, keyErr *api_client.KeyTypeError) (crypto.KeyType, bool) {
+	if slices.Contains(keyErr.Supported, preferred) {
+		return preferred, true
+	}
+	for _, t := range keyErr.Supported {
+		if t != keyErr.KeyType {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+// Rotate 为 client 生成并提交 KEY_TYPE 算法的新密钥，成功后替换 store 中的 aro_rsa 并切换 client 的签名密钥
+// 调用期间 client 的其他请求仍使用旧密钥
+func Rotate(ctx context.Context, client *api_client.APIClient, store crypto.KeyStore) (*RotateResult, error) {
+	result := &RotateResult{}
+	newKey, err := crypto.LoadPendingKeyPair(store)
+	switch {
+	case err == nil:
+		result.Resumed = true
+		log.Printf("Resuming an interrupted key rotation")
+	case errors.Is(err, os.ErrNotExist):
+		if newKey, err = newPendingKey(store, crypto.KeyTypeFromConfig(client.Config)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("failed to load the pending key: %w", err)
+	}
+
+	resp, err := client.NodeRotateKey(ctx, newKey)
+	var keyErr *api_client.KeyTypeError
+	if errors.As(err, &keyErr) {
+		keyType, ok := negotiateKeyType(crypto.KeyTypeFromConfig(client.Config), keyErr)
+		if !ok {
+			return nil, fmt.Errorf("backend rejected the key rotation: %w", err)
+		}
+		// 后端不会接受 aro_rsa.next，换成后端支持的算法重新提交
+		log.Printf("Backend does not accept %s keys, rotating to a %s key", keyErr.KeyType, keyType)
+		if newKey, err = newPendingKey(store, keyType); err != nil {
+			return nil, err
+		}
+		resp, err = client.NodeRotateKey(ctx, newKey)
+	}
+	if err != nil {
+		// 新密钥保留在 aro_rsa.next，下次轮换时重新提交
+		return nil, fmt.Errorf("backend rejected the key rotation: %w", err)
+	}
+
+	previous, _ := crypto.LoadKeyPair(store)
+	if _, err := crypto.CommitPendingKeyPair(store); err != nil {
+		return nil, fmt.Errorf("failed to install the new key: %w", err)
+	}
+	grace := time.Duration(resp.Data.GracePeriod) * time.Second
+	if grace <= 0 {
+		grace = DefaultGracePeriod
+	}
+	until := client.Now().Add(grace)
+	if err := client.Config.SetAndSave(config.KeyPreviousKeyUntil, strconv.FormatInt(until.Unix(), 10)); err != nil {
+		log.Printf("Failed to save the key rotation grace period: %v", err)
+	}
+	if previous != nil {
+		client.SetKeyPair(newKey, previous.PrivateKey, until)
+	} else {
+		client.SetKeyPair(newKey, nil, time.Time{})
+	}
+
+	result.PublicKey, _ = crypto.ExportPublicKeyToPEM(newKey.PublicKey)
+	result.GraceUntil = until.Unix()
+	log.Printf("Key rotated, the previous key is kept until %s", until.Format(time.RFC3339))
+	return result, nil
+}
+
+// newPendingKey 生成 keyType 类型的新密钥并保存为 aro_rsa.next
+func newPendingKey(store crypto.KeyStore, keyType crypto.KeyType) (*crypto.KeyPair, error) {
+	newKey, err := crypto.GenerateKeyPair(keyType)
+	if err != nil {
+		return nil, err
+	}
+	if err := crypto.SavePendingKeyPair(store, newKey); err != nil {
+		return nil, err
+	}
+	return newKey, nil
+}
+
+// LoadPreviousKey 在宽限期内把轮换前的密钥交给 client 作为备用签名密钥，宽限期结束后删除 aro_rsa.old
+// 节点启动时调用
+func LoadPreviousKey(client *api_client.APIClient, store crypto.KeyStore) error {
+	until, err := strconv.ParseInt(client.Config.Get(config.KeyPreviousKeyUntil), 10, 64)
+	if err != nil || until == 0 {
+		return nil
+	}
+	if client.Now().Unix() >= until {
+		log.Printf("Key rotation grace period is over, removing the previous key")
+		if err := crypto.RemovePreviousKeyPair(store); err != nil {
+			return err
+		}
+		return client.Config.SetAndSave(config.KeyPreviousKeyUntil, "")
+	}
+	previous, err := crypto.LoadPreviousKeyPair(store)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to load the previous key: %w", err)
+	}
+	client.SetKeyPair(client.KeyPair(), previous.PrivateKey, time.Unix(until, 0))
+	return nil
+}
+
+// CheckClone 比较当前硬件标识与身份创建时记录的标识，尚未记录时记录当前标识
+// 取不到硬件标识（见 sysinfo.HardwareIDFrom）时不检测
+func CheckClone(cfg *config.Config) CloneStatus {
+	return checkClone(cfg, sysinfo.HardwareID())
+}
+
+func checkClone(cfg *config.Config, hardwareID string) CloneStatus {
+	st := CloneStatus{HardwareID: hardwareID, Recorded: cfg.Get(config.KeyHardwareID)}
+	if hardwareID == "" {
+		return st
+	}
+	// 旧版本记录的标识包含 CPU 型号和内存，无法与当前格式比较，按尚未记录处理
+	legacy := !strings.HasPrefix(st.Recorded, sysinfo.HardwareIDPrefix) && strings.HasPrefix(hardwareID, sysinfo.HardwareIDPrefix)
+	if st.Recorded == "" || legacy {
+		if err := cfg.SetAndSave(config.KeyHardwareID, hardwareID); err != nil {
+			log.Printf("Failed to record the hardware id: %v", err)
+		}
+		st.Recorded = hardwareID
+		return st
+	}
+	st.Cloned = st.Recorded != hardwareID
+	if st.Cloned {
+		log.Printf("Node identity was created on another device (hardware id %s, recorded %s); re-register this node", hardwareID, st.Recorded)
+	}
+	return st
+}
+
+// Reregister 放弃当前身份，生成新的客户端 ID 和 KEY_TYPE 算法的密钥并重新注册
+// 用于克隆出来的设备，原设备的身份不受影响；调用前应停止使用 client 的后台任务
+func Reregister(ctx context.Context, client *api_client.APIClient, store crypto.KeyStore) (*api_client.APIResponseWith[api_client.SignUpData], error) {
+	return reregister(ctx, client, store, sysinfo.HardwareID())
+}
+
+func reregister(ctx context.Context, client *api_client.APIClient, store crypto.KeyStore, hardwareID string) (*api_client.APIResponseWith[api_client.SignUpData], error) {
+	newKey, err := newPendingKey(store, crypto.KeyTypeFromConfig(client.Config))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := crypto.CommitPendingKeyPair(store); err != nil {
+		return nil, fmt.Errorf("failed to install the new key: %w", err)
+	}
+	// 旧身份属于原设备，不需要保留
+	if err := crypto.RemovePreviousKeyPair(store); err != nil {
+		log.Printf("Failed to remove the previous key: %v", err)
+	}
+
+	cfg := client.Config
+	values := map[string]string{config.KeyHardwareID: hardwareID}
+	for _, key := range []string{config.KeyClientId, config.KeySN, config.USER_ID, config.EMAIL, config.KeyBaseInfoHash, config.KeyPreviousKeyUntil} {
+		values[key] = ""
+	}
+	if err := cfg.SetAndSaveAll(values); err != nil {
+		return nil, err
+	}
+	client.SetIdentity(crypto.ClientIDFrom(cfg), newKey)
+	log.Printf("Node re-registering as %s", client.ID())
+	return SignUp(ctx, client, store)
+}
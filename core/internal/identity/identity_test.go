@@ -0,0 +1,245 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/clock"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/mockbackend"
+	"aro-ext-app/core/internal/sysinfo"
+)
+
+// newClient 创建使用 RSA 密钥的客户端，即旧版本的节点；配置的 KEY_TYPE 为默认的 ed25519
+func newClient(t *testing.T, b *mockbackend.Backend, store crypto.KeyStore) *api_client.APIClient {
+	t.Helper()
+	keyPair, err := crypto.LoadOrCreateKeyPair(store, crypto.KeyTypeRSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.New(t.TempDir())
+	c := api_client.NewAPIClient(b.URL(), crypto.ClientIDFrom(cfg), keyPair)
+	c.Config = cfg
+	c.Clock = clock.New(cfg)
+	c.Transport = api_client.NewTransport(api_client.RetryPolicy{Timeout: 2 * time.Second, BreakerThreshold: 100, BreakerCooldown: time.Minute})
+	return c
+}
+
+func TestRotate(t *testing.T) {
+	b := mockbackend.Start()
+	defer b.Close()
+	store := crypto.NewMemoryKeyStore()
+	c := newClient(t, b, store)
+	if _, err := c.NodeSignUp(); err != nil {
+		t.Fatal(err)
+	}
+	oldKey := c.KeyPair()
+
+	res, err := Rotate(context.Background(), c, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Resumed {
+		t.Error("expected a fresh rotation")
+	}
+	n, _ := b.Node(c.ClientID)
+	if !n.PublicKey.Equal(c.PublicKey) || n.PublicKey.Equal(oldKey.PublicKey) || n.Rotations != 1 {
+		t.Fatalf("expected backend to hold the new key, rotations %d", n.Rotations)
+	}
+	if keyType := crypto.KeyTypeOf(c.PrivateKey); keyType != crypto.KeyTypeEd25519 {
+		t.Errorf("expected the RSA node to rotate to an ed25519 key, got %s", keyType)
+	}
+	saved, err := crypto.LoadKeyPair(store)
+	if err != nil || !saved.PrivateKey.Equal(c.PrivateKey) {
+		t.Fatalf("expected the store to hold the new key: %v", err)
+	}
+	if previous, err := crypto.LoadPreviousKeyPair(store); err != nil || !previous.PrivateKey.Equal(oldKey.PrivateKey) {
+		t.Fatalf("expected aro_rsa.old to hold the previous key: %v", err)
+	}
+	if _, err := c.GetNodeStat(); err != nil {
+		t.Errorf("expected requests signed with the new key to pass: %v", err)
+	}
+
+	// 另一个仍持有旧密钥的进程在宽限期内可以继续工作，之后被拒绝
+	stale := api_client.NewAPIClient(b.URL(), c.ClientID, oldKey)
+	stale.Config = config.New(t.TempDir())
+	stale.Clock = clock.New(nil)
+	if _, err := stale.GetNodeStat(); err != nil {
+		t.Errorf("expected the previous key to be accepted during the grace period: %v", err)
+	}
+	b.Now = func() time.Time { return time.Now().Add(2 * mockbackend.DefaultKeyGracePeriod) }
+	if _, err := stale.GetNodeStat(); err == nil {
+		t.Error("expected the previous key to be rejected after the grace period")
+	}
+}
+
+func TestRotateResumesAcceptedKey(t *testing.T) {
+	b := mockbackend.Start()
+	defer b.Close()
+	store := crypto.NewMemoryKeyStore()
+	c := newClient(t, b, store)
+	if _, err := c.NodeSignUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟后端已接受新密钥、本地尚未替换 aro_rsa 时中断
+	pending, err := crypto.GenerateRSAKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crypto.SavePendingKeyPair(store, pending); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.NodeRotateKey(context.Background(), pending); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Rotate(context.Background(), c, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Resumed || !c.PrivateKey.Equal(pending.PrivateKey) {
+		t.Error("expected the pending key to be committed")
+	}
+	if n, _ := b.Node(c.ClientID); n.Rotations != 1 {
+		t.Errorf("expected a single rotation on the backend, got %d", n.Rotations)
+	}
+	if _, err := crypto.LoadPendingKeyPair(store); err == nil {
+		t.Error("expected aro_rsa.next to be removed")
+	}
+}
+
+func TestLoadPreviousKeyExpires(t *testing.T) {
+	b := mockbackend.Start()
+	defer b.Close()
+	store := crypto.NewMemoryKeyStore()
+	c := newClient(t, b, store)
+	if _, err := c.NodeSignUp(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Rotate(context.Background(), c, store); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Config.Set(config.KeyPreviousKeyUntil, "1")
+	if err := LoadPreviousKey(c, store); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := crypto.LoadPreviousKeyPair(store); err == nil {
+		t.Error("expected aro_rsa.old to be removed after the grace period")
+	}
+	if got := c.Config.Get(config.KeyPreviousKeyUntil); got != "" {
+		t.Errorf("expected grace period to be cleared, got %q", got)
+	}
+}
+
+func TestCloneAndReregister(t *testing.T) {
+	b := mockbackend.Start()
+	defer b.Close()
+	store := crypto.NewMemoryKeyStore()
+	c := newClient(t, b, store)
+	if _, err := c.NodeSignUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	if st := checkClone(c.Config, "device-a"); st.Cloned || st.Recorded != "device-a" {
+		t.Fatalf("expected first run to record the hardware id, got %+v", st)
+	}
+	if st := checkClone(c.Config, "device-b"); !st.Cloned {
+		t.Fatal("expected a different device to be reported as cloned")
+	}
+
+	// 两台设备使用同一身份发送心跳，后端提示克隆
+	for _, hwid := range []string{"device-a", "device-b"} {
+		resp, err := c.NodeHeartbeat([]api_client.Heartbeat{{Timestamp: c.Now().UnixMilli(), HardwareID: hwid}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := hwid == "device-b"; resp.Data.CloneSuspected != want {
+			t.Errorf("heartbeat from %s: expected cloneSuspected %v", hwid, want)
+		}
+	}
+
+	oldID := c.ClientID
+	if _, err := reregister(context.Background(), c, store, "device-b"); err != nil {
+		t.Fatal(err)
+	}
+	if c.ClientID == oldID || c.Config.Get(config.KeyClientId) != c.ClientID {
+		t.Errorf("expected a new client id, got %s", c.ClientID)
+	}
+	if n, ok := b.Node(c.ClientID); !ok || !n.PublicKey.Equal(c.PublicKey) {
+		t.Error("expected the new identity to be registered with the new key")
+	}
+	if st := checkClone(c.Config, "device-b"); st.Cloned {
+		t.Error("expected the new identity to belong to this device")
+	}
+}
+
+func TestLegacyHardwareIDIsReplaced(t *testing.T) {
+	b := mockbackend.Start()
+	defer b.Close()
+	c := newClient(t, b, crypto.NewMemoryKeyStore())
+
+	// 旧版本记录的标识没有前缀，升级后按当前格式重新记录，不视为克隆
+	c.Config.Set(config.KeyHardwareID, "legacy-digest")
+	current := sysinfo.HardwareIDPrefix + "digest"
+	if st := checkClone(c.Config, current); st.Cloned || st.Recorded != current {
+		t.Fatalf("expected the legacy hardware id to be re-recorded, got %+v", st)
+	}
+	if st := checkClone(c.Config, sysinfo.HardwareIDPrefix+"other"); !st.Cloned {
+		t.Error("expected a different device to be reported as cloned")
+	}
+}
+
+func TestSignUpNegotiatesKeyType(t *testing.T) {
+	b := mockbackend.Start()
+	defer b.Close()
+	b.KeyTypes = []string{string(crypto.KeyTypeECDSA), string(crypto.KeyTypeRSA)}
+	store := crypto.NewMemoryKeyStore()
+	keyPair, err := crypto.LoadOrCreateKeyPair(store, crypto.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newClient(t, b, store)
+	if !c.PrivateKey.Equal(keyPair.PrivateKey) {
+		t.Fatal("expected the client to use the ed25519 key")
+	}
+
+	var keyErr *api_client.KeyTypeError
+	if _, err := c.NodeSignUp(); !errors.As(err, &keyErr) || len(keyErr.Supported) != 2 {
+		t.Fatalf("expected a key type error listing the backend's key types, got %v", err)
+	}
+	if _, err := SignUp(context.Background(), c, store); err != nil {
+		t.Fatal(err)
+	}
+	if keyType := crypto.KeyTypeOf(c.PrivateKey); keyType != crypto.KeyTypeECDSA {
+		t.Fatalf("expected the backend's preferred key type, got %s", keyType)
+	}
+	saved, err := crypto.LoadKeyPair(store)
+	if err != nil || !saved.PrivateKey.Equal(c.PrivateKey) {
+		t.Fatalf("expected the store to hold the negotiated key: %v", err)
+	}
+	if n, ok := b.Node(c.ClientID); !ok || !n.PublicKey.Equal(c.PublicKey) {
+		t.Fatal("expected the node to be registered with the negotiated key")
+	}
+
+	// 不支持新算法的后端上，轮换换用后端支持的算法
+	b.KeyTypes = []string{string(crypto.KeyTypeRSA), string(crypto.KeyTypeECDSA)}
+	if _, err := Rotate(context.Background(), c, store); err != nil {
+		t.Fatal(err)
+	}
+	if keyType := crypto.KeyTypeOf(c.PrivateKey); keyType != crypto.KeyTypeRSA {
+		t.Errorf("expected the rotation to fall back to rsa, got %s", keyType)
+	}
+	if _, err := crypto.LoadPendingKeyPair(store); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no pending key after the rotation, got %v", err)
+	}
+	if _, err := c.GetNodeStat(); err != nil {
+		t.Errorf("expected requests signed with the rotated key to pass: %v", err)
+	}
+}
@@ -0,0 +1,367 @@
+// Package ledger 本地收益和活动账本：按小时记录节点实际完成的工作（代理流量、连接数、
+// 带宽测试、在线时长）和后端给出的积分，保存在节点的本地存储（storage 包）中
+//
+// 后端的 GetRewards、GetNodeStat 只有当前的汇总，账本让用户可以查看任意时间段内节点做了什么，
+// 并通过 Reconcile 找出本地活动和后端积分对不上的小时
+package ledger
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/events"
+	"aro-ext-app/core/internal/proxy_worker"
+	"aro-ext-app/core/internal/storage"
+)
+
+// 默认参数
+const (
+	// DefaultSampleInterval 采集流量和在线时长的间隔
+	DefaultSampleInterval = time.Minute
+	// DefaultRewardsInterval 查询后端积分的间隔
+	DefaultRewardsInterval = 15 * time.Minute
+	// DefaultRetention 账本保留的时长，更早的小时在查询积分时删除
+	DefaultRetention = 90 * 24 * time.Hour
+)
+
+// 记入账本的任务类型，与 events.TaskEvent.Kind 一致
+// NAT 探测包括任务流下发的探测任务和本地发起的 STUN 检测（nat 子命令、控制接口 /nat）
+const (
+	TaskBandwidthTest = "bandwidth_test"
+	TaskNATProbe      = "nat_probe"
+)
+
+// Totals 一段时间内的活动和积分
+type Totals struct {
+	InputBytes           uint64  `json:"input_bytes"`     // 代理服务接收的字节数
+	OutputBytes          uint64  `json:"output_bytes"`    // 代理服务发送的字节数
+	Connections          uint64  `json:"connections"`     // 代理服务接受的连接数
+	BandwidthTests       int     `json:"bandwidth_tests"` // 成功完成的带宽测试任务
+	BandwidthTestsFailed int     `json:"bandwidth_tests_failed"`
+	NATProbes            int     `json:"nat_probes"` // 成功完成的 NAT 探测
+	NATProbesFailed      int     `json:"nat_probes_failed"`
+	OnlineSeconds        int64   `json:"online_seconds"` // 隧道保持连接的时长
+	Points               float64 `json:"points"`         // 后端积分在这段时间内的增长
+}
+
+func (t *Totals) add(o Totals) {
+	t.InputBytes += o.InputBytes
+	t.OutputBytes += o.OutputBytes
+	t.Connections += o.Connections
+	t.BandwidthTests += o.BandwidthTests
+	t.BandwidthTestsFailed += o.BandwidthTestsFailed
+	t.NATProbes += o.NATProbes
+	t.NATProbesFailed += o.NATProbesFailed
+	t.OnlineSeconds += o.OnlineSeconds
+	t.Points += o.Points
+}
+
+// active 是否有本地活动
+func (t Totals) active() bool {
+	return t.OnlineSeconds > 0 || t.Connections > 0 || t.InputBytes > 0 || t.OutputBytes > 0 ||
+		t.BandwidthTests > 0 || t.NATProbes > 0
+}
+
+// Hour 一个小时（UTC 整点开始）的账本记录
+type Hour struct {
+	Start int64 `json:"start"` // Unix 秒
+	Totals
+	// RewardsSynced 这个小时内查询过后端积分，为 false 时 Points 为 0 不代表后端没有给积分
+	RewardsSynced bool `json:"rewards_synced"`
+}
+
+// 账本使用的 bucket
+var (
+	// hours 小时记录，key 为 Start 的十进制字符串（同样位数，按字母顺序即按时间顺序）
+	hours = storage.NewBucket[Hour]("ledger_hours")
+	// state 计算增量需要的状态
+	state = storage.NewBucket[float64]("ledger_state")
+)
+
+// rewardsTotalKey state 中上次查询到的后端累计积分
+const rewardsTotalKey = "rewards_total"
+
+// Options 账本参数
+type Options struct {
+	// Store 保存账本的存储
+	Store *storage.Storage
+	// Worker 采集代理流量和隧道状态，为空时不记录流量和在线时长
+	Worker *proxy_worker.Manager
+	// Events 接收任务完成事件，为空时不记录任务
+	Events *events.Bus
+	// Client 查询后端积分，为空且 Rewards 为空时不查询
+	Client *api_client.APIClient
+	// Rewards 返回后端的累计积分，为空时使用 Client.GetRewardsContext 的 totalRewards
+	Rewards func(ctx context.Context) (float64, error)
+	// SampleInterval 采集间隔，为 0 时使用 DefaultSampleInterval
+	SampleInterval time.Duration
+	// RewardsInterval 查询积分的间隔，为 0 时使用 DefaultRewardsInterval
+	RewardsInterval time.Duration
+	// Retention 保留时长，为 0 时使用 DefaultRetention
+	Retention time.Duration
+	// Now 时钟，为空时使用 Client.Now（按服务端时间校正，与后端的结算小时一致），测试可替换
+	Now func() time.Time
+}
+
+// Ledger 本地账本
+type Ledger struct {
+	opts Options
+
+	// mu 保护增量采集的状态
+	mu         sync.Mutex
+	traffic    proxy_worker.Traffic // 上次采集时 worker 的累计流量
+	lastSample time.Time
+	wasOnline  bool
+}
+
+// New 创建账本，调用 Run 开始记录
+func New(opts Options) *Ledger {
+	if opts.Now == nil {
+		if opts.Client != nil {
+			opts.Now = opts.Client.Now
+		} else {
+			opts.Now = time.Now
+		}
+	}
+	if opts.Rewards == nil && opts.Client != nil {
+		client := opts.Client
+		opts.Rewards = func(ctx context.Context) (float64, error) {
+			resp, err := client.GetRewardsContext(ctx)
+			if err != nil {
+				return 0, err
+			}
+			return float64(resp.Data.TotalRewards), nil
+		}
+	}
+	if opts.SampleInterval <= 0 {
+		opts.SampleInterval = DefaultSampleInterval
+	}
+	if opts.RewardsInterval <= 0 {
+		opts.RewardsInterval = DefaultRewardsInterval
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = DefaultRetention
+	}
+	return &Ledger{opts: opts}
+}
+
+// Run 记录任务事件，定时采集流量和在线时长、查询后端积分并删除过期的记录，直到 ctx 结束
+func (l *Ledger) Run(ctx context.Context) {
+	var taskEvents <-chan events.Event
+	if l.opts.Events != nil {
+		ch, cancel := l.opts.Events.Subscribe(0)
+		defer cancel()
+		taskEvents = ch
+	}
+
+	sample := time.NewTicker(l.opts.SampleInterval)
+	defer sample.Stop()
+	rewards := time.NewTicker(l.opts.RewardsInterval)
+	defer rewards.Stop()
+
+	// 积分在第一个间隔后才查询：启动时应用通常自己会调用 GetRewards，结果同样记入账本
+	l.Sample()
+	for {
+		select {
+		case <-ctx.Done():
+			l.Sample()
+			return
+		case ev := <-taskEvents:
+			if task, ok := ev.Data.(events.TaskEvent); ok && ev.Type == events.TaskCompleted {
+				if err := l.RecordTask(task); err != nil {
+					log.Printf("Ledger: failed to record task %s: %v", task.TaskID, err)
+				}
+			}
+		case <-sample.C:
+			l.Sample()
+		case <-rewards.C:
+			l.syncRewards(ctx)
+		}
+	}
+}
+
+// syncRewards 查询后端积分并删除过期的记录
+func (l *Ledger) syncRewards(ctx context.Context) {
+	if l.opts.Rewards != nil {
+		total, err := l.opts.Rewards(ctx)
+		if err == nil {
+			err = l.RecordRewards(total)
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Ledger: failed to sync rewards: %v", err)
+		}
+	}
+	if err := l.Prune(l.opts.Now().Add(-l.opts.Retention)); err != nil {
+		log.Printf("Ledger: failed to prune: %v", err)
+	}
+}
+
+// Sample 采集 worker 的流量增量和隧道连接时长，记入当前小时
+// 在线时长只计算前后两次采集都已连接的间隔，间隔超过两倍采集周期（如系统休眠）时不计
+func (l *Ledger) Sample() {
+	if l.opts.Worker == nil {
+		return
+	}
+	l.record(l.opts.Now(), l.opts.Worker.GetStatus())
+}
+
+// record 把 now 时采集到的 worker 状态记入账本
+func (l *Ledger) record(now time.Time, st proxy_worker.WorkerStatus) {
+	online := st.IsRunning && st.TunnelState == proxy_worker.TunnelStateConnected
+
+	l.mu.Lock()
+	var delta Totals
+	if st.IsRunning {
+		// worker 重启后计数从 0 开始
+		prev := l.traffic
+		if st.Traffic.TotalConns < prev.TotalConns || st.Traffic.InputBytes < prev.InputBytes ||
+			st.Traffic.OutputBytes < prev.OutputBytes {
+			prev = proxy_worker.Traffic{}
+		}
+		delta.Connections = st.Traffic.TotalConns - prev.TotalConns
+		delta.InputBytes = st.Traffic.InputBytes - prev.InputBytes
+		delta.OutputBytes = st.Traffic.OutputBytes - prev.OutputBytes
+		l.traffic = st.Traffic
+	} else {
+		l.traffic = proxy_worker.Traffic{}
+	}
+	var from time.Time
+	if online && l.wasOnline && !l.lastSample.IsZero() && now.Sub(l.lastSample) <= 2*l.opts.SampleInterval {
+		from = l.lastSample
+	}
+	l.lastSample, l.wasOnline = now, online
+	l.mu.Unlock()
+
+	if !delta.active() && from.IsZero() {
+		return
+	}
+	err := l.opts.Store.Update(func(tx storage.Tx) error {
+		if delta.active() {
+			if err := addTo(tx, now, func(h *Hour) { h.add(delta) }); err != nil {
+				return err
+			}
+		}
+		// 跨整点的在线时长分到两个小时
+		for !from.IsZero() && from.Before(now) {
+			end := hourStart(from).Add(time.Hour)
+			if end.After(now) {
+				end = now
+			}
+			seconds := int64(end.Sub(from) / time.Second)
+			if err := addTo(tx, from, func(h *Hour) { h.OnlineSeconds += seconds }); err != nil {
+				return err
+			}
+			from = end
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Ledger: failed to record activity: %v", err)
+	}
+}
+
+// RecordTask 记录一个完成（成功或失败）的任务，未知类型的任务忽略
+func (l *Ledger) RecordTask(ev events.TaskEvent) error {
+	var apply func(h *Hour)
+	switch ev.Kind {
+	case TaskBandwidthTest:
+		apply = func(h *Hour) {
+			if ev.Success {
+				h.BandwidthTests++
+			} else {
+				h.BandwidthTestsFailed++
+			}
+		}
+	case TaskNATProbe:
+		apply = func(h *Hour) {
+			if ev.Success {
+				h.NATProbes++
+			} else {
+				h.NATProbesFailed++
+			}
+		}
+	default:
+		return nil
+	}
+	now := l.opts.Now()
+	return l.opts.Store.Update(func(tx storage.Tx) error { return addTo(tx, now, apply) })
+}
+
+// RecordRewards 记录后端的累计积分 total，与上次记录的差值记入当前小时
+// 第一次记录只作为基准；累计积分减少（后端重置、切换了账号）时重新作为基准
+func (l *Ledger) RecordRewards(total float64) error {
+	now := l.opts.Now()
+	return l.opts.Store.Update(func(tx storage.Tx) error {
+		prev, ok, err := state.Get(tx, rewardsTotalKey)
+		if err != nil {
+			return err
+		}
+		if err := state.Put(tx, rewardsTotalKey, total); err != nil {
+			return err
+		}
+		return addTo(tx, now, func(h *Hour) {
+			if ok && total > prev {
+				h.Points += total - prev
+			}
+			h.RewardsSynced = true
+		})
+	})
+}
+
+// Hours 返回 [from, to) 内有记录的小时，按时间顺序
+func (l *Ledger) Hours(from, to time.Time) ([]Hour, error) {
+	var list []Hour
+	err := l.opts.Store.View(func(tx storage.Tx) error {
+		lo, hi := hourStart(from).Unix(), to.Unix()
+		for _, key := range hours.Keys(tx) {
+			start, err := strconv.ParseInt(key, 10, 64)
+			if err != nil || start < lo || start >= hi {
+				continue
+			}
+			h, _, err := hours.Get(tx, key)
+			if err != nil {
+				return err
+			}
+			list = append(list, h)
+		}
+		return nil
+	})
+	return list, err
+}
+
+// Prune 删除 before 之前开始的小时
+func (l *Ledger) Prune(before time.Time) error {
+	return l.opts.Store.Update(func(tx storage.Tx) error {
+		for _, key := range hours.Keys(tx) {
+			if start, err := strconv.ParseInt(key, 10, 64); err == nil && start >= before.Unix() {
+				continue
+			}
+			if err := hours.Delete(tx, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// hourStart 返回 t 所在小时的 UTC 整点
+func hourStart(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Hour)
+}
+
+// addTo 修改 t 所在小时的记录
+func addTo(tx storage.Tx, t time.Time, apply func(h *Hour)) error {
+	start := hourStart(t).Unix()
+	key := strconv.FormatInt(start, 10)
+	h, _, err := hours.Get(tx, key)
+	if err != nil {
+		return err
+	}
+	h.Start = start
+	apply(&h)
+	return hours.Put(tx, key, h)
+}
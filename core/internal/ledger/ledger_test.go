@@ -0,0 +1,235 @@
+package ledger
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"aro-ext-app/core/internal/events"
+	"aro-ext-app/core/internal/proxy_worker"
+	"aro-ext-app/core/internal/storage"
+)
+
+// base 测试使用的起始时间，UTC 整点
+var base = time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newLedger(t *testing.T, opts Options) (*Ledger, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{now: base}
+	if opts.Store == nil {
+		opts.Store = storage.New()
+	}
+	opts.Now = clock.Now
+	return New(opts), clock
+}
+
+func connected(traffic proxy_worker.Traffic) proxy_worker.WorkerStatus {
+	return proxy_worker.WorkerStatus{IsRunning: true, TunnelState: proxy_worker.TunnelStateConnected, Traffic: traffic}
+}
+
+func TestRecordSplitsActivityByHour(t *testing.T) {
+	l, _ := newLedger(t, Options{})
+	l.record(base.Add(58*time.Minute), connected(proxy_worker.Traffic{TotalConns: 2, InputBytes: 100, OutputBytes: 1000}))
+	l.record(base.Add(59*time.Minute), connected(proxy_worker.Traffic{TotalConns: 3, InputBytes: 150, OutputBytes: 1500}))
+	// 跨过整点
+	l.record(base.Add(60*time.Minute+30*time.Second), connected(proxy_worker.Traffic{TotalConns: 5, InputBytes: 200, OutputBytes: 2000}))
+	// worker 重启后计数从 0 开始
+	l.record(base.Add(61*time.Minute), proxy_worker.WorkerStatus{IsRunning: true, TunnelState: proxy_worker.TunnelStateConnecting, Traffic: proxy_worker.Traffic{TotalConns: 1, InputBytes: 10}})
+	// 断线后的间隔不计入在线时长
+	l.record(base.Add(62*time.Minute), connected(proxy_worker.Traffic{TotalConns: 1, InputBytes: 10}))
+
+	list, err := l.Hours(base, base.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected 2 hours, got %+v", list)
+	}
+	first, second := list[0], list[1]
+	if first.Start != base.Unix() || first.OnlineSeconds != 120 || first.Connections != 3 || first.InputBytes != 150 || first.OutputBytes != 1500 {
+		t.Errorf("unexpected first hour %+v", first)
+	}
+	if second.OnlineSeconds != 30 || second.Connections != 3 || second.InputBytes != 60 || second.OutputBytes != 500 {
+		t.Errorf("unexpected second hour %+v", second)
+	}
+}
+
+func TestRecordTasksAndRewards(t *testing.T) {
+	path := filepath.Join(t.TempDir(), storage.FileName)
+	store, err := storage.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, clock := newLedger(t, Options{Store: store})
+
+	l.RecordTask(events.TaskEvent{Kind: TaskBandwidthTest, Success: true})
+	l.RecordTask(events.TaskEvent{Kind: TaskBandwidthTest})
+	l.RecordTask(events.TaskEvent{Kind: TaskNATProbe, Success: true})
+	l.RecordTask(events.TaskEvent{Kind: TaskNATProbe, Success: true})
+	l.RecordTask(events.TaskEvent{Kind: TaskNATProbe, Error: "timeout"})
+	l.RecordTask(events.TaskEvent{Kind: "unknown", Success: true})
+	if err := l.RecordRewards(100); err != nil {
+		t.Fatal(err)
+	}
+	clock.now = base.Add(time.Hour)
+	l.RecordRewards(112.5)
+	clock.now = base.Add(2 * time.Hour)
+	// 累计积分减少时重新作为基准
+	l.RecordRewards(10)
+	store.Close()
+
+	// 账本保存在存储中，重新打开后仍在
+	store, err = storage.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	l, clock = newLedger(t, Options{Store: store})
+	clock.now = base.Add(3 * time.Hour)
+	l.RecordRewards(15)
+
+	list, err := l.Hours(base, base.Add(4*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 4 {
+		t.Fatalf("expected 4 hours, got %+v", list)
+	}
+	if h := list[0]; h.BandwidthTests != 1 || h.BandwidthTestsFailed != 1 || h.NATProbes != 2 || h.NATProbesFailed != 1 ||
+		h.Points != 0 || !h.RewardsSynced {
+		t.Errorf("unexpected first hour %+v", h)
+	}
+	for i, want := range []float64{0, 12.5, 0, 5} {
+		if list[i].Points != want {
+			t.Errorf("hour %d: expected %v points, got %v", i, want, list[i].Points)
+		}
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	l, clock := newLedger(t, Options{})
+	for i := 0; i < 30; i++ {
+		clock.now = base.Add(time.Duration(i) * time.Hour)
+		l.RecordTask(events.TaskEvent{Kind: TaskBandwidthTest, Success: true})
+	}
+
+	hours, err := l.Aggregate(base, base.Add(30*time.Hour), ByHour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hours) != 30 || hours[0].BandwidthTests != 1 || hours[0].To-hours[0].From != 3600 {
+		t.Errorf("unexpected hourly summary %+v", hours)
+	}
+
+	// base 为 UTC 10 点，第一天有 14 个小时
+	days, err := l.Aggregate(base, base.Add(30*time.Hour), ByDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 2 || days[0].Hours != 14 || days[1].Hours != 16 || days[1].From != base.Add(14*time.Hour).Unix() {
+		t.Errorf("unexpected daily summary %+v", days)
+	}
+	// 其他时区按当地的自然日划分
+	tz := time.FixedZone("UTC+8", 8*3600)
+	days, _ = l.Aggregate(base.In(tz), base.Add(30*time.Hour), ByDay)
+	if len(days) != 2 || days[0].Hours != 6 || days[1].Hours != 24 {
+		t.Errorf("unexpected UTC+8 daily summary %+v", days)
+	}
+
+	total, _ := l.Aggregate(base.Add(time.Hour), base.Add(3*time.Hour), ByTotal)
+	if len(total) != 1 || total[0].Hours != 2 || total[0].BandwidthTests != 2 {
+		t.Errorf("unexpected total %+v", total)
+	}
+	if _, err := l.Aggregate(base, base.Add(time.Hour), "week"); err == nil {
+		t.Error("expected an unknown granularity to be rejected")
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	l, clock := newLedger(t, Options{})
+	online := func(hour int, minutes int) {
+		start := base.Add(time.Duration(hour) * time.Hour)
+		for m := 0; m <= minutes; m++ {
+			l.record(start.Add(time.Duration(m)*time.Minute), connected(proxy_worker.Traffic{}))
+		}
+	}
+	rewards := func(hour int, total float64) {
+		clock.now = base.Add(time.Duration(hour) * time.Hour)
+		l.RecordRewards(total)
+	}
+
+	rewards(0, 0)
+	online(0, 59) // 在第 1 小时结算，获得积分
+	rewards(1, 10)
+	online(1, 59) // 在线但第 2 小时没有积分
+	rewards(2, 10)
+	rewards(3, 20) // 第 2 小时没有活动却有积分
+	online(4, 59)  // 第 5 小时没有查询积分，无法对账
+
+	report, err := l.Reconcile(base, base.Add(5*time.Hour), ReconcileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 3 || report.Unchecked != 1 || report.SettleLag != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if len(report.Discrepancies) != 2 {
+		t.Fatalf("expected 2 discrepancies, got %+v", report.Discrepancies)
+	}
+	if d := report.Discrepancies[0]; d.Hour != base.Add(time.Hour).Unix() || d.Issue != UnrewardedActivity || d.OnlineSeconds != 3540 {
+		t.Errorf("unexpected discrepancy %+v", d)
+	}
+	if d := report.Discrepancies[1]; d.Hour != base.Add(2*time.Hour).Unix() || d.Issue != RewardWithoutActivity || d.Points != 10 {
+		t.Errorf("unexpected discrepancy %+v", d)
+	}
+}
+
+func TestRunRecordsTaskEventsAndPrunes(t *testing.T) {
+	bus := events.NewBus(16)
+	var polls atomic.Int32
+	l, clock := newLedger(t, Options{
+		Events: bus,
+		Rewards: func(ctx context.Context) (float64, error) {
+			return float64(polls.Add(1) * 10), nil
+		},
+		RewardsInterval: 20 * time.Millisecond,
+		Retention:       24 * time.Hour,
+	})
+	// 超过保留时长的记录在查询积分时删除
+	clock.now = base.Add(-48 * time.Hour)
+	l.RecordTask(events.TaskEvent{Kind: TaskBandwidthTest, Success: true})
+	clock.now = base
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		l.Run(ctx)
+		close(done)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for polls.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	bus.Publish(events.TaskCompleted, events.TaskEvent{Kind: TaskBandwidthTest, TaskID: "t1", Success: true})
+	bus.Publish(events.TaskReceived, events.TaskEvent{Kind: TaskBandwidthTest, TaskID: "t2"})
+	var list []Hour
+	for time.Now().Before(deadline) {
+		list, _ = l.Hours(base.Add(-72*time.Hour), base.Add(time.Hour))
+		if len(list) == 1 && list[0].BandwidthTests == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if len(list) != 1 || list[0].Start != base.Unix() || list[0].BandwidthTests != 1 || !list[0].RewardsSynced {
+		t.Errorf("expected only the current hour with one bandwidth test, got %+v", list)
+	}
+}
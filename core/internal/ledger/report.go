@@ -0,0 +1,166 @@
+package ledger
+
+import (
+	"time"
+
+	"aro-ext-app/core/internal/errcode"
+)
+
+// Granularity 汇总的粒度
+type Granularity string
+
+const (
+	ByHour  Granularity = "hour"
+	ByDay   Granularity = "day"
+	ByTotal Granularity = "total"
+)
+
+// Summary 一个时间段的汇总
+type Summary struct {
+	From  int64 `json:"from"`  // Unix 秒，包含
+	To    int64 `json:"to"`    // Unix 秒，不包含
+	Hours int   `json:"hours"` // 有记录的小时数
+	Totals
+}
+
+// Aggregate 按粒度汇总 [from, to) 内的记录，只返回有记录的时间段
+// ByDay 按 from 所在时区的自然日划分，其他时区的用户传入对应时区的时间即可
+func (l *Ledger) Aggregate(from, to time.Time, by Granularity) ([]Summary, error) {
+	var period func(t time.Time) (time.Time, time.Time)
+	switch by {
+	case ByHour:
+		period = func(t time.Time) (time.Time, time.Time) {
+			start := hourStart(t)
+			return start, start.Add(time.Hour)
+		}
+	case ByDay:
+		loc := from.Location()
+		period = func(t time.Time) (time.Time, time.Time) {
+			t = t.In(loc)
+			start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+			return start, start.AddDate(0, 0, 1)
+		}
+	case ByTotal, "":
+		period = func(time.Time) (time.Time, time.Time) { return from, to }
+	default:
+		return nil, errcode.Errorf(errcode.InvalidParams, "unknown granularity %q", by)
+	}
+
+	list, err := l.Hours(from, to)
+	if err != nil {
+		return nil, err
+	}
+	var out []Summary
+	for _, h := range list {
+		start, end := period(time.Unix(h.Start, 0))
+		if len(out) == 0 || out[len(out)-1].From != start.Unix() {
+			out = append(out, Summary{From: start.Unix(), To: end.Unix()})
+		}
+		s := &out[len(out)-1]
+		s.Hours++
+		s.add(h.Totals)
+	}
+	return out, nil
+}
+
+// 对账发现的问题
+const (
+	// UnrewardedActivity 节点在线但后端在结算时没有给积分
+	UnrewardedActivity = "unrewarded_activity"
+	// RewardWithoutActivity 后端给了积分但本地没有任何活动
+	RewardWithoutActivity = "reward_without_activity"
+)
+
+// DefaultMinOnline 对账时视为应当获得积分的最短在线时长
+const DefaultMinOnline = 30 * time.Minute
+
+// ReconcileOptions 对账参数
+type ReconcileOptions struct {
+	// SettleLag 后端结算的延迟：一个小时的积分在之后第几个小时内查询到，为 0 时为 1
+	SettleLag int `json:"settle_lag"`
+	// MinOnline 在线时长达到多少时视为应当获得积分，为 0 时使用 DefaultMinOnline
+	MinOnline time.Duration `json:"-"`
+}
+
+// Discrepancy 一个对不上的小时
+type Discrepancy struct {
+	Hour          int64   `json:"hour"` // 活动所在小时，Unix 秒
+	Issue         string  `json:"issue"`
+	OnlineSeconds int64   `json:"online_seconds"`
+	Connections   uint64  `json:"connections"`
+	Tasks         int     `json:"tasks"` // 成功完成的带宽测试和 NAT 探测
+	Points        float64 `json:"points"` // 结算小时内查询到的积分
+}
+
+// Report 对账报告
+type Report struct {
+	From      int64 `json:"from"`
+	To        int64 `json:"to"`
+	SettleLag int   `json:"settle_lag"`
+	// Checked 结算小时内查询过后端积分、可以对账的小时数
+	Checked int `json:"checked"`
+	// Unchecked 有本地活动但结算小时内没有查询过积分（节点离线、后端不可用）的小时数
+	Unchecked     int           `json:"unchecked"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// Reconcile 对比 [from, to) 内每个小时的本地活动和后端积分
+// 一个小时的活动与 SettleLag 小时之后查询到的积分对比，结算小时内没有查询过积分的不对账
+func (l *Ledger) Reconcile(from, to time.Time, opts ReconcileOptions) (*Report, error) {
+	if opts.SettleLag < 0 {
+		return nil, errcode.Errorf(errcode.InvalidParams, "invalid settle lag %d", opts.SettleLag)
+	}
+	if opts.SettleLag == 0 {
+		opts.SettleLag = 1
+	}
+	if opts.MinOnline <= 0 {
+		opts.MinOnline = DefaultMinOnline
+	}
+	lag := time.Duration(opts.SettleLag) * time.Hour
+	list, err := l.Hours(from, to.Add(lag))
+	if err != nil {
+		return nil, err
+	}
+	byStart := make(map[int64]Hour, len(list))
+	for _, h := range list {
+		byStart[h.Start] = h
+	}
+
+	report := &Report{From: from.Unix(), To: to.Unix(), SettleLag: opts.SettleLag, Discrepancies: []Discrepancy{}}
+	if len(list) == 0 {
+		return report, nil
+	}
+	// 第一条记录之前没有数据，不必逐小时检查（from 可能很早）
+	first := hourStart(from)
+	if earliest := time.Unix(list[0].Start, 0).UTC(); earliest.After(first) {
+		first = earliest
+	}
+	for start := first; start.Before(to); start = start.Add(time.Hour) {
+		h := byStart[start.Unix()]
+		settled := byStart[start.Add(lag).Unix()]
+		if !settled.RewardsSynced {
+			if h.active() {
+				report.Unchecked++
+			}
+			continue
+		}
+		report.Checked++
+		d := Discrepancy{
+			Hour:          start.Unix(),
+			OnlineSeconds: h.OnlineSeconds,
+			Connections:   h.Connections,
+			Tasks:         h.BandwidthTests + h.NATProbes,
+			Points:        settled.Points,
+		}
+		switch {
+		case time.Duration(h.OnlineSeconds)*time.Second >= opts.MinOnline && settled.Points == 0:
+			d.Issue = UnrewardedActivity
+		case !h.active() && settled.Points > 0:
+			d.Issue = RewardWithoutActivity
+		default:
+			continue
+		}
+		report.Discrepancies = append(report.Discrepancies, d)
+	}
+	return report, nil
+}
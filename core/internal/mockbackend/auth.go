@@ -0,0 +1,155 @@
+package mockbackend
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/auth"
+	"aro-ext-app/core/internal/crypto"
+)
+
+// verifier 使用当前的 MaxSkew、Now 和 RequireV2 设置创建签名校验器，nonce 和已使用 v2 的客户端记录在整个后端共享
+func (b *Backend) verifier() *auth.Verifier {
+	return &auth.Verifier{MaxSkew: b.MaxSkew, Now: b.Now, RequireV2: b.RequireV2, Nonces: b.nonces, Pins: b.pins}
+}
+
+// confirmScheme 与真实后端一样，在 v2 请求的响应中返回 X-Aro-Auth-Version: 2
+func confirmScheme(w http.ResponseWriter, v *auth.Verified) {
+	if v != nil && v.Version == auth.SchemeV2 {
+		w.Header().Set(auth.HeaderAuthVersion, fmt.Sprint(auth.SchemeV2))
+	}
+}
+
+// readBody 读取请求体并放回，供签名校验后的 handler 再次读取
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, err
+}
+
+// authenticate 用节点当前的公钥校验请求签名（v1 或 v2），返回客户端 ID 和签名方案
+// 密钥轮换后的宽限期内，当前公钥校验失败时再用轮换前的公钥校验
+func (b *Backend) authenticate(r *http.Request) (*auth.Verified, error) {
+	body, err := readBody(r)
+	if err != nil {
+		return &auth.Verified{}, err
+	}
+	v, err := b.verifier().Verify(r, body, func(clientID string) (crypto.PublicKey, error) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		n, ok := b.nodes[clientID]
+		if !ok {
+			return nil, fmt.Errorf("node %s not registered", clientID)
+		}
+		return n.PublicKey, nil
+	})
+	if err == nil {
+		return v, nil
+	}
+	// nonce 只在签名通过后记录，用旧公钥再校验一次不会被当作重放
+	if pv, perr := b.verifier().Verify(r, body, b.previousKey); perr == nil {
+		return pv, nil
+	}
+	return v, err
+}
+
+// keyTypes 返回接受的密钥算法
+func (b *Backend) keyTypes() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.KeyTypes)
+}
+
+// acceptsKeyType 判断是否接受 keyType 的公钥
+func (b *Backend) acceptsKeyType(keyType crypto.KeyType) bool {
+	return slices.Contains(b.keyTypes(), string(keyType))
+}
+
+// previousKey 返回节点在宽限期内的旧公钥
+func (b *Backend) previousKey(clientID string) (crypto.PublicKey, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n, ok := b.nodes[clientID]
+	if !ok || n.PreviousKey == nil || !b.Now().Before(n.PreviousKeyUntil) {
+		return nil, fmt.Errorf("no previous key for node %s", clientID)
+	}
+	return n.PreviousKey, nil
+}
+
+// signUp 校验请求体中的公钥和签名，注册节点或返回已有的序列号
+// Bearer 头必须由同一把私钥签名，防止替他人注册
+func (b *Backend) signUp(w http.ResponseWriter, r *http.Request) string {
+	body, err := readBody(r)
+	var req api_client.NodeSignUpRequest
+	if err == nil {
+		err = json.Unmarshal(body, &req)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, 400, "invalid request body", nil)
+		return ""
+	}
+	pub, err := crypto.ParsePublicKeyFromPEM(req.PublicKey)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, 400, err.Error(), nil)
+		return req.ClientID
+	}
+	// 未声明算法的请求来自 RSA 节点
+	keyType := crypto.KeyTypeOf(pub)
+	if declared := cmp.Or(req.KeyType, string(crypto.KeyTypeRSA)); declared != string(keyType) {
+		writeJSON(w, http.StatusBadRequest, 400, fmt.Sprintf("keyType %s does not match the %s public key", declared, keyType), nil)
+		return req.ClientID
+	}
+	if !b.acceptsKeyType(keyType) {
+		writeJSON(w, http.StatusBadRequest, 400, fmt.Sprintf("key type %s is not supported", keyType),
+			api_client.SignUpData{KeyTypes: b.keyTypes()})
+		return req.ClientID
+	}
+	if err := crypto.VerifySignature(pub, fmt.Sprintf("%s:%d", req.ClientID, req.Timestamp), req.Signature); err != nil {
+		writeJSON(w, http.StatusUnauthorized, 401, "invalid signature", nil)
+		return req.ClientID
+	}
+
+	verified, err := b.verifier().Verify(r, body, func(clientID string) (crypto.PublicKey, error) {
+		if clientID != req.ClientID {
+			return nil, fmt.Errorf("bearer client %s does not match %s", clientID, req.ClientID)
+		}
+		return pub, nil
+	})
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, 401, err.Error(), nil)
+		return req.ClientID
+	}
+
+	b.mu.Lock()
+	n, ok := b.nodes[req.ClientID]
+	if ok && !n.PublicKey.Equal(pub) {
+		b.mu.Unlock()
+		writeJSON(w, http.StatusForbidden, 403, "client id registered with a different key", nil)
+		return req.ClientID
+	}
+	if !ok {
+		b.nextSN++
+		n = &Node{
+			ClientID:     req.ClientID,
+			SerialNumber: fmt.Sprintf("MOCK%08d", b.nextSN),
+			PublicKey:    pub,
+		}
+		b.nodes[req.ClientID] = n
+	}
+	sn := n.SerialNumber
+	b.mu.Unlock()
+
+	confirmScheme(w, verified)
+	writeJSON(w, http.StatusOK, 200, "success", api_client.SignUpData{SerialNumber: sn})
+	return req.ClientID
+}
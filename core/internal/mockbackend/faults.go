@@ -0,0 +1,204 @@
+package mockbackend
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"aro-ext-app/core/internal/storage"
+)
+
+// Fault 注入的故障，匹配的请求不再交给正常的接口处理
+type Fault struct {
+	// Path 路径前缀，例如 /api/liteNode/stat 或 /api/keeper/ota/
+	Path string `json:"path"`
+	// Method 为空时匹配所有方法
+	Method string `json:"method,omitempty"`
+	// Status HTTP 状态码，0 表示 200
+	Status int `json:"status,omitempty"`
+	// Code 响应体中的业务码，0 时与 Status 相同
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Body 非空时原样作为响应体返回，用于构造畸形响应
+	Body string `json:"body,omitempty"`
+	// Header 附加的响应头，例如 Retry-After
+	Header map[string]string `json:"header,omitempty"`
+	// DelayMs 响应前的延迟，用于触发客户端超时
+	DelayMs int `json:"delay_ms,omitempty"`
+	// Drop 为 true 时直接断开连接
+	Drop bool `json:"drop,omitempty"`
+	// Times 生效次数，0 表示一直生效直到 ClearFaults
+	Times int `json:"times,omitempty"`
+}
+
+// Script 后端初始状态，独立运行时通过 -script 文件或 POST /__mock/script 加载
+type Script struct {
+	Releases   []Release              `json:"releases"`
+	Rewards    map[string]interface{} `json:"rewards"`
+	ProxyUsers []ProxyUser            `json:"proxy_users"`
+	Faults     []Fault                `json:"faults"`
+}
+
+// Inject 注入故障，先注入的故障优先匹配
+func (b *Backend) Inject(f Fault) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.faults = append(b.faults, &f)
+}
+
+// ClearFaults 清除所有故障
+func (b *Backend) ClearFaults() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.faults = nil
+}
+
+// takeFault 返回匹配请求的故障并扣减剩余次数
+func (b *Backend) takeFault(method, path string) *Fault {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, f := range b.faults {
+		if !strings.HasPrefix(path, f.Path) || (f.Method != "" && !strings.EqualFold(f.Method, method)) {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				b.faults = append(b.faults[:i:i], b.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// serve 按故障描述写响应
+func (f *Fault) serve(w http.ResponseWriter, r *http.Request) {
+	if f.DelayMs > 0 {
+		select {
+		case <-time.After(time.Duration(f.DelayMs) * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if f.Drop {
+		// net/http 收到 ErrAbortHandler 时直接断开连接且不记录日志
+		panic(http.ErrAbortHandler)
+	}
+	for k, v := range f.Header {
+		w.Header().Set(k, v)
+	}
+	status := f.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if f.Body != "" {
+		w.WriteHeader(status)
+		w.Write([]byte(f.Body))
+		return
+	}
+	code := f.Code
+	if code == 0 {
+		code = status
+	}
+	message := f.Message
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	writeJSON(w, status, code, message, nil)
+}
+
+// Load 应用脚本中的版本、奖励、代理账号和故障
+func (b *Backend) Load(s Script) {
+	for _, r := range s.Releases {
+		b.SetRelease(r)
+	}
+	if s.Rewards != nil {
+		b.mu.Lock()
+		b.rewardsRaw = s.Rewards
+		b.mu.Unlock()
+	}
+	for _, u := range s.ProxyUsers {
+		b.AddProxyUser(u)
+	}
+	for _, f := range s.Faults {
+		b.Inject(f)
+	}
+}
+
+// LoadFile 从 JSON 文件加载脚本
+func (b *Backend) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var s Script
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	b.Load(s)
+	return nil
+}
+
+// serveAdmin 管理接口：
+//   - POST   /__mock/script    加载 Script
+//   - POST   /__mock/faults    注入 Fault
+//   - DELETE /__mock/faults    清除故障
+//   - POST   /__mock/bind      {"client_id", "uuid", "email"} 绑定节点
+//   - GET    /__mock/nodes     已注册节点
+//   - GET    /__mock/requests  请求记录
+//   - POST   /__mock/reset     清空所有状态
+func (b *Backend) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimPrefix(r.URL.Path, AdminPathPrefix) + " " + r.Method {
+	case "script POST":
+		var s Script
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			writeJSON(w, http.StatusBadRequest, 400, err.Error(), nil)
+			return
+		}
+		b.Load(s)
+	case "faults POST":
+		var f Fault
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+			writeJSON(w, http.StatusBadRequest, 400, err.Error(), nil)
+			return
+		}
+		b.Inject(f)
+	case "faults DELETE":
+		b.ClearFaults()
+	case "bind POST":
+		var req struct {
+			ClientID string `json:"client_id"`
+			UUID     string `json:"uuid"`
+			Email    string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, 400, err.Error(), nil)
+			return
+		}
+		if err := b.Bind(req.ClientID, storage.BindUser{UUID: req.UUID, Email: req.Email}); err != nil {
+			writeJSON(w, http.StatusNotFound, 404, err.Error(), nil)
+			return
+		}
+	case "nodes GET":
+		b.mu.Lock()
+		nodes := make([]Node, 0, len(b.nodes))
+		for _, n := range b.nodes {
+			nodes = append(nodes, *n)
+		}
+		b.mu.Unlock()
+		writeJSON(w, http.StatusOK, 200, "success", nodes)
+		return
+	case "requests GET":
+		writeJSON(w, http.StatusOK, 200, "success", b.Requests())
+		return
+	case "reset POST":
+		b.Reset()
+	default:
+		writeJSON(w, http.StatusNotFound, 404, "not found", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, 200, "success", nil)
+}
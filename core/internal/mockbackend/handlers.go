@@ -0,0 +1,200 @@
+package mockbackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/crashdump"
+	"aro-ext-app/core/internal/crypto"
+)
+
+// stat 返回节点序列号和绑定状态
+func (b *Backend) stat(w http.ResponseWriter, r *http.Request, n *Node) {
+	b.mu.Lock()
+	data := api_client.NodeStatData{
+		SerialNumber: n.SerialNumber,
+		Bind:         n.BindUser != nil,
+		BindUser:     n.BindUser,
+	}
+	b.mu.Unlock()
+	writeJSON(w, http.StatusOK, 200, "success", data)
+}
+
+// getRewards 返回 SetRewards 设置的奖励数据
+func (b *Backend) getRewards(w http.ResponseWriter, r *http.Request, n *Node) {
+	b.mu.Lock()
+	data := map[string]interface{}{
+		"lastNetworkPoints": b.rewards.LastNetworkPoints,
+		"totalRewards":      b.rewards.TotalRewards,
+		"weeklyRewards":     b.rewards.WeeklyRewards,
+		"rewardInfo":        b.rewards.RewardInfo,
+	}
+	for k, v := range b.rewardsRaw {
+		data[k] = v
+	}
+	b.mu.Unlock()
+	writeJSON(w, http.StatusOK, 200, "success", data)
+}
+
+// reportBaseInfo 保存节点上报的系统信息
+func (b *Backend) reportBaseInfo(w http.ResponseWriter, r *http.Request, n *Node) {
+	var info api_client.NodeReportBaseInfoRequest
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		writeJSON(w, http.StatusBadRequest, 400, "invalid request body", nil)
+		return
+	}
+	b.mu.Lock()
+	n.BaseInfo = &info
+	b.mu.Unlock()
+	writeJSON(w, http.StatusOK, 200, "success", nil)
+}
+
+// reportCrash 统计节点上传的崩溃报告
+func (b *Backend) reportCrash(w http.ResponseWriter, r *http.Request, n *Node) {
+	var report crashdump.Report
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil || report.ID == "" {
+		writeJSON(w, http.StatusBadRequest, 400, "invalid crash report", nil)
+		return
+	}
+	b.mu.Lock()
+	n.Crashes++
+	b.mu.Unlock()
+	writeJSON(w, http.StatusOK, 200, "success", nil)
+}
+
+// heartbeat 保存节点上报的心跳，响应中带上 HeartbeatInterval
+func (b *Backend) heartbeat(w http.ResponseWriter, r *http.Request, n *Node) {
+	var req api_client.NodeHeartbeatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Beats) == 0 {
+		writeJSON(w, http.StatusBadRequest, 400, "invalid heartbeat", nil)
+		return
+	}
+	b.mu.Lock()
+	accepted := 0
+	for _, beat := range req.Beats {
+		// 重发的心跳（ID 已保存）只保存一次
+		if beat.ID != "" && slices.ContainsFunc(n.Heartbeats, func(h api_client.Heartbeat) bool { return h.ID == beat.ID }) {
+			continue
+		}
+		n.Heartbeats = append(n.Heartbeats, beat)
+		accepted++
+		if beat.HardwareID != "" && !slices.Contains(n.HardwareIDs, beat.HardwareID) {
+			n.HardwareIDs = append(n.HardwareIDs, beat.HardwareID)
+		}
+	}
+	n.LastSeen = b.Now()
+	n.LastHardwareID = req.Beats[len(req.Beats)-1].HardwareID
+	data := api_client.HeartbeatData{Accepted: accepted, Interval: b.HeartbeatInterval, CloneSuspected: len(n.HardwareIDs) > 1}
+	b.mu.Unlock()
+	writeJSON(w, http.StatusOK, 200, "success", data)
+}
+
+// presence 返回节点最后一次心跳的时间和硬件标识
+func (b *Backend) presence(w http.ResponseWriter, r *http.Request, n *Node) {
+	b.mu.Lock()
+	data := api_client.PresenceData{HardwareID: n.LastHardwareID}
+	if !n.LastSeen.IsZero() {
+		data.LastSeen = n.LastSeen.UnixMilli()
+	}
+	b.mu.Unlock()
+	writeJSON(w, http.StatusOK, 200, "success", data)
+}
+
+// rotateKey 校验新旧两把密钥的签名后替换节点公钥，旧公钥在 KeyGracePeriod 内仍然有效
+// 重复提交已生效的新公钥时直接返回成功，客户端可以在轮换中断后重试
+func (b *Backend) rotateKey(w http.ResponseWriter, r *http.Request, n *Node) {
+	var req api_client.NodeRotateKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ClientID != n.ClientID {
+		writeJSON(w, http.StatusBadRequest, 400, "invalid rotation request", nil)
+		return
+	}
+	newKey, err := crypto.ParsePublicKeyFromPEM(req.NewPublicKey)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, 400, err.Error(), nil)
+		return
+	}
+	if keyType := crypto.KeyTypeOf(newKey); !b.acceptsKeyType(keyType) {
+		writeJSON(w, http.StatusBadRequest, 400, fmt.Sprintf("key type %s is not supported", keyType),
+			api_client.SignUpData{KeyTypes: b.keyTypes()})
+		return
+	}
+	if err := b.verifier().CheckTimestamp(req.Timestamp); err != nil {
+		writeJSON(w, http.StatusUnauthorized, 401, err.Error(), nil)
+		return
+	}
+	message := api_client.KeyRotationMessage(req.ClientID, req.NewPublicKey, req.Timestamp)
+	if err := crypto.VerifySignature(newKey, message, req.NewSignature); err != nil {
+		writeJSON(w, http.StatusUnauthorized, 401, "invalid new key signature", nil)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !n.PublicKey.Equal(newKey) {
+		if err := crypto.VerifySignature(n.PublicKey, message, req.OldSignature); err != nil {
+			writeJSON(w, http.StatusUnauthorized, 401, "invalid current key signature", nil)
+			return
+		}
+		n.PreviousKey = n.PublicKey
+		n.PreviousKeyUntil = b.Now().Add(b.KeyGracePeriod)
+		n.PublicKey = newKey
+		n.Rotations++
+	}
+	grace := int64(n.PreviousKeyUntil.Sub(b.Now()) / time.Second)
+	writeJSON(w, http.StatusOK, 200, "success", api_client.RotateKeyData{GracePeriod: max(grace, 0)})
+}
+
+// lastVersion 处理 /api/keeper/ota/{program}/{env}/{isa}/{os}/lastest
+// 真实后端的令牌使用后端公钥加密，这里只检查请求携带了令牌
+func (b *Backend) lastVersion(w http.ResponseWriter, r *http.Request) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); !ok || token == "" {
+		writeJSON(w, http.StatusUnauthorized, 401, "missing bearer token", nil)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, OTAPathPrefix), "/")
+	if len(parts) != 5 || parts[4] != "lastest" {
+		writeJSON(w, http.StatusNotFound, 404, "not found", nil)
+		return
+	}
+	b.mu.Lock()
+	release, ok := b.releases[releaseKey(parts[0], parts[1])]
+	b.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusOK, 200, "success", api_client.LastVersionData{})
+		return
+	}
+	writeJSON(w, http.StatusOK, 200, "success", release.LastVersionData)
+}
+
+// proxyAuth 处理 gost aro auther 的账号校验请求
+func (b *Backend) proxyAuth(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Port     string `json:"port"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, 400, "invalid request body", nil)
+		return
+	}
+	b.mu.Lock()
+	u, ok := b.proxyUsers[req.Username]
+	b.mu.Unlock()
+	if !ok || u.Password != req.Password {
+		writeJSON(w, http.StatusUnauthorized, 401, "invalid username or password", nil)
+		return
+	}
+	ttl := time.Duration(u.TTLSeconds) * time.Second
+	if ttl == 0 {
+		ttl = time.Hour
+	}
+	writeJSON(w, http.StatusOK, 200, "success", map[string]interface{}{
+		"ip_resource": u.IPResource,
+		"date_end":    b.Now().Add(ttl).Unix(),
+	})
+}
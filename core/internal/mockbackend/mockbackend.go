@@ -0,0 +1,323 @@
+// Package mockbackend 进程内的 ARO 后端替身，用于不访问 staging-api.aro.network 的集成测试
+//
+// 实现 liteNode 注册、统计、奖励、基础信息上报、心跳、密钥轮换、在线状态、服务端时间、OTA 查询和代理认证接口，
+// 校验 RSA、Ed25519 或 ECDSA P-256 密钥的 "aro:" Bearer 签名（v1）和方法、路径、请求体、nonce 签名（v2），
+// 注册时协商密钥算法，并支持按路径注入故障。
+// 测试中使用 Start 启动 httptest 服务，也可以通过 cmd/mockbackend 作为独立进程运行，
+// 独立运行时通过 /__mock/ 下的管理接口编排状态和故障。
+package mockbackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/auth"
+	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/storage"
+)
+
+// 后端接口路径
+const (
+	SignUpPath         = "/api/liteNode/signUp"
+	StatPath           = "/api/liteNode/stat"
+	RewardsPath        = "/api/liteNode/rewards"
+	ReportBaseInfoPath = "/api/liteNode/node/reportBaseInfo"
+	ReportCrashPath    = "/api/liteNode/node/reportCrash"
+	HeartbeatPath      = "/api/liteNode/node/heartbeat"
+	RotateKeyPath      = "/api/liteNode/node/rotateKey"
+	PresencePath       = "/api/liteNode/node/presence"
+	TimePath           = api_client.ServerTimePath
+	OTAPathPrefix      = "/api/keeper/ota/"
+	// ProxyAuthPath 代理认证接口，对应 gost aro auther 的 backUrl
+	ProxyAuthPath = "/api/liteNode/proxy/auth"
+	// AdminPathPrefix 管理接口前缀，不需要认证
+	AdminPathPrefix = "/__mock/"
+)
+
+// DefaultMaxSkew 默认允许的签名时间戳偏差
+const DefaultMaxSkew = auth.DefaultMaxSkew
+
+// DefaultKeyGracePeriod 密钥轮换后默认继续接受旧密钥的时间
+const DefaultKeyGracePeriod = time.Hour
+
+// Release 某个程序和渠道的最新版本
+type Release struct {
+	Program string `json:"program"`
+	Channel string `json:"channel"`
+	api_client.LastVersionData
+}
+
+// ProxyUser 代理认证接口接受的账号
+type ProxyUser struct {
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	IPResource string `json:"ip_resource"`
+	// TTLSeconds 认证结果有效期，0 表示一小时
+	TTLSeconds int64 `json:"ttl_seconds"`
+}
+
+// Node 已注册的节点
+type Node struct {
+	ClientID     string                                `json:"client_id"`
+	SerialNumber string                                `json:"serial_number"`
+	PublicKey    crypto.PublicKey                      `json:"-"`
+	BindUser     *storage.BindUser                     `json:"bind_user,omitempty"`
+	BaseInfo     *api_client.NodeReportBaseInfoRequest `json:"base_info,omitempty"`
+	Crashes      int                                   `json:"crashes"`
+	Heartbeats   []api_client.Heartbeat                `json:"heartbeats,omitempty"`
+	// PreviousKey 轮换前的公钥，PreviousKeyUntil 之前仍然接受
+	PreviousKey      crypto.PublicKey `json:"-"`
+	PreviousKeyUntil time.Time        `json:"previous_key_until,omitempty"`
+	Rotations        int              `json:"rotations"`
+	// HardwareIDs 心跳中出现过的硬件标识，多于一个时认为身份被克隆
+	HardwareIDs []string `json:"hardware_ids,omitempty"`
+	// LastSeen 最后一次收到心跳的服务端时间，LastHardwareID 为该心跳中的硬件标识
+	LastSeen       time.Time `json:"last_seen,omitempty"`
+	LastHardwareID string    `json:"last_hardware_id,omitempty"`
+}
+
+// Request 收到的请求记录
+type Request struct {
+	Time     time.Time `json:"time"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	ClientID string    `json:"client_id,omitempty"`
+	Status   int       `json:"status"`
+	Fault    bool      `json:"fault,omitempty"`
+}
+
+// Backend 模拟后端，可直接作为 http.Handler 使用
+type Backend struct {
+	// MaxSkew 签名时间戳与服务端时间的最大偏差
+	MaxSkew time.Duration
+	// RequireV2 只接受 v2 签名（方法、路径、请求体和 nonce），拒绝 v1 令牌
+	RequireV2 bool
+	// Now 服务端时钟，测试可替换
+	Now func() time.Time
+	// HeartbeatInterval 心跳响应中要求的心跳间隔（秒），0 表示不调整
+	HeartbeatInterval int
+	// KeyGracePeriod 密钥轮换后继续接受旧密钥的时间
+	KeyGracePeriod time.Duration
+	// KeyTypes 注册和轮换时接受的密钥算法，不支持时在 400 响应的 data.keyTypes 中返回
+	KeyTypes []string
+
+	mu         sync.Mutex
+	nodes      map[string]*Node // key: clientID
+	releases   map[string]Release
+	rewards    api_client.RewardsData
+	rewardsRaw map[string]interface{}
+	proxyUsers map[string]ProxyUser
+	faults     []*Fault
+	requests   []Request
+	nextSN     int
+	nonces     *auth.NonceCache
+	pins       *auth.SchemePins
+
+	server *httptest.Server
+}
+
+// New 创建空的模拟后端
+func New() *Backend {
+	return &Backend{
+		MaxSkew:        DefaultMaxSkew,
+		Now:            time.Now,
+		KeyGracePeriod: DefaultKeyGracePeriod,
+		KeyTypes:       []string{string(crypto.KeyTypeEd25519), string(crypto.KeyTypeECDSA), string(crypto.KeyTypeRSA)},
+		nodes:          make(map[string]*Node),
+		releases:       make(map[string]Release),
+		proxyUsers:     make(map[string]ProxyUser),
+		nonces:         &auth.NonceCache{},
+		pins:           &auth.SchemePins{},
+	}
+}
+
+// Start 创建模拟后端并在本地随机端口启动，测试结束时调用 Close
+func Start() *Backend {
+	b := New()
+	b.server = httptest.NewServer(b)
+	return b
+}
+
+// URL 返回 Start 启动的服务地址
+func (b *Backend) URL() string {
+	if b.server == nil {
+		return ""
+	}
+	return b.server.URL
+}
+
+// Close 关闭 Start 启动的服务
+func (b *Backend) Close() {
+	if b.server != nil {
+		b.server.Close()
+	}
+}
+
+// SetRelease 设置程序和渠道的最新版本
+func (b *Backend) SetRelease(r Release) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.releases[releaseKey(r.Program, r.Channel)] = r
+}
+
+// SetRewards 设置 /rewards 返回的数据，extra 中的字段原样附加到响应中
+func (b *Backend) SetRewards(r api_client.RewardsData, extra map[string]interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rewards = r
+	b.rewardsRaw = extra
+}
+
+// AddProxyUser 添加代理认证账号
+func (b *Backend) AddProxyUser(u ProxyUser) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.proxyUsers[u.Username] = u
+}
+
+// Bind 把节点绑定到用户
+func (b *Backend) Bind(clientID string, user storage.BindUser) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n, ok := b.nodes[clientID]
+	if !ok {
+		return fmt.Errorf("node %s not registered", clientID)
+	}
+	n.BindUser = &user
+	return nil
+}
+
+// Node 返回已注册节点的副本
+func (b *Backend) Node(clientID string) (Node, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n, ok := b.nodes[clientID]
+	if !ok {
+		return Node{}, false
+	}
+	cp := *n
+	cp.Heartbeats = append([]api_client.Heartbeat(nil), n.Heartbeats...)
+	cp.HardwareIDs = append([]string(nil), n.HardwareIDs...)
+	return cp, true
+}
+
+// Requests 返回收到的请求记录
+func (b *Backend) Requests() []Request {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Request(nil), b.requests...)
+}
+
+// Reset 清空节点、版本、奖励、账号、故障、请求记录、已使用的 nonce 和已使用 v2 的客户端
+func (b *Backend) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nodes = make(map[string]*Node)
+	b.releases = make(map[string]Release)
+	b.rewards = api_client.RewardsData{}
+	b.rewardsRaw = nil
+	b.proxyUsers = make(map[string]ProxyUser)
+	b.faults = nil
+	b.requests = nil
+	b.nonces.Reset()
+	b.pins.Reset()
+}
+
+// ServeHTTP 实现 http.Handler
+func (b *Backend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, AdminPathPrefix) {
+		b.serveAdmin(w, r)
+		return
+	}
+
+	// Date 头使用后端时钟，客户端据此校正时钟偏差
+	w.Header().Set("Date", b.Now().UTC().Format(http.TimeFormat))
+	rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+	entry := Request{Time: b.Now(), Method: r.Method, Path: r.URL.Path}
+	defer func() {
+		entry.Status = rec.status
+		b.mu.Lock()
+		b.requests = append(b.requests, entry)
+		b.mu.Unlock()
+	}()
+
+	if f := b.takeFault(r.Method, r.URL.Path); f != nil {
+		entry.Fault = true
+		f.serve(rec, r)
+		return
+	}
+
+	switch {
+	case r.URL.Path == SignUpPath && r.Method == http.MethodPost:
+		entry.ClientID = b.signUp(rec, r)
+	case r.URL.Path == StatPath && r.Method == http.MethodGet:
+		entry.ClientID = b.withNode(rec, r, b.stat)
+	case r.URL.Path == RewardsPath && r.Method == http.MethodGet:
+		entry.ClientID = b.withNode(rec, r, b.getRewards)
+	case r.URL.Path == ReportBaseInfoPath && r.Method == http.MethodPost:
+		entry.ClientID = b.withNode(rec, r, b.reportBaseInfo)
+	case r.URL.Path == ReportCrashPath && r.Method == http.MethodPost:
+		entry.ClientID = b.withNode(rec, r, b.reportCrash)
+	case r.URL.Path == HeartbeatPath && r.Method == http.MethodPost:
+		entry.ClientID = b.withNode(rec, r, b.heartbeat)
+	case r.URL.Path == RotateKeyPath && r.Method == http.MethodPost:
+		entry.ClientID = b.withNode(rec, r, b.rotateKey)
+	case r.URL.Path == PresencePath && r.Method == http.MethodGet:
+		entry.ClientID = b.withNode(rec, r, b.presence)
+	case r.URL.Path == TimePath && r.Method == http.MethodGet:
+		writeJSON(rec, http.StatusOK, 200, "success", api_client.ServerTimeData{Timestamp: b.Now().UnixMilli()})
+	case strings.HasPrefix(r.URL.Path, OTAPathPrefix) && r.Method == http.MethodGet:
+		b.lastVersion(rec, r)
+	case r.URL.Path == ProxyAuthPath && r.Method == http.MethodPost:
+		b.proxyAuth(rec, r)
+	default:
+		writeJSON(rec, http.StatusNotFound, 404, "not found", nil)
+	}
+}
+
+// withNode 校验 aro Bearer 签名后调用 handler，返回请求的客户端 ID
+func (b *Backend) withNode(w http.ResponseWriter, r *http.Request, handler func(http.ResponseWriter, *http.Request, *Node)) string {
+	v, err := b.authenticate(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, 401, err.Error(), nil)
+		return v.ClientID
+	}
+	b.mu.Lock()
+	n := b.nodes[v.ClientID]
+	b.mu.Unlock()
+	confirmScheme(w, v)
+	handler(w, r, n)
+	return v.ClientID
+}
+
+// recorder 记录响应状态码
+type recorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// writeJSON 写入与真实后端相同的 {code, message, data} 响应
+func writeJSON(w http.ResponseWriter, status int, code int, message string, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":    code,
+		"message": message,
+		"data":    data,
+	})
+}
+
+func releaseKey(program, channel string) string {
+	return program + "/" + channel
+}
@@ -0,0 +1,262 @@
+package mockbackend
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/auth"
+	"aro-ext-app/core/internal/clock"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/constant"
+	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/errcode"
+	"aro-ext-app/core/internal/events"
+	"aro-ext-app/core/internal/storage"
+
+	auth_plugin "github.com/go-gost/x/auth/plugin"
+)
+
+func newClient(t *testing.T, b *Backend) *api_client.APIClient {
+	t.Helper()
+	keyPair, err := crypto.GenerateRSAKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.New(t.TempDir())
+	c := api_client.NewAPIClient(b.URL(), crypto.ClientIDFrom(cfg), keyPair)
+	c.Config = cfg
+	c.Events = events.NewBus(16)
+	c.Clock = clock.New(cfg)
+	c.Transport = api_client.NewTransport(api_client.RetryPolicy{
+		MaxRetries:       2,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         5 * time.Millisecond,
+		Timeout:          2 * time.Second,
+		BreakerThreshold: 100,
+		BreakerCooldown:  time.Minute,
+	})
+	return c
+}
+
+func TestSignUpAndSignedRequests(t *testing.T) {
+	b := Start()
+	defer b.Close()
+	c := newClient(t, b)
+
+	signUp, err := c.NodeSignUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, ok := b.Node(c.ClientID)
+	if !ok || n.SerialNumber != signUp.Data.SerialNumber {
+		t.Fatalf("expected node registered with %s, got %+v", signUp.Data.SerialNumber, n)
+	}
+
+	if err := b.Bind(c.ClientID, storage.BindUser{UUID: "u-1", Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := c.GetNodeStat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stat.Data.Bind || c.Config.Get(config.USER_ID) != "u-1" {
+		t.Errorf("expected bound stat to be saved, got %+v", stat.Data)
+	}
+
+	if _, err := c.NodeReportBaseInfo(api_client.NodeReportBaseInfoRequest{SysPlatform: "linux", SysCPU: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := b.Node(c.ClientID); n.BaseInfo == nil || n.BaseInfo.SysCPU != 4 {
+		t.Errorf("expected base info to be stored, got %+v", n.BaseInfo)
+	}
+
+	b.SetRelease(Release{Program: string(constant.PROGRAM_APP), Channel: "beta", LastVersionData: api_client.LastVersionData{
+		Version: "9.9.9", URL: "https://example.com/lib.zip",
+	}})
+	latest, err := c.GetLastVersion(constant.PROGRAM_APP, "beta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Data.Version != "9.9.9" {
+		t.Errorf("expected release 9.9.9, got %+v", latest.Data)
+	}
+}
+
+func TestRejectsUnregisteredAndForgedClients(t *testing.T) {
+	b := Start()
+	defer b.Close()
+	c := newClient(t, b)
+
+	if _, err := c.GetRewards(); errcode.Of(err) != errcode.AuthFailed {
+		t.Errorf("expected AUTH_FAILED before sign up, got %v", err)
+	}
+	if _, err := c.NodeSignUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 另一把密钥冒用同一个客户端 ID
+	other := newClient(t, b)
+	other.ClientID = c.ClientID
+	if _, err := other.GetRewards(); errcode.Of(err) != errcode.AuthFailed {
+		t.Errorf("expected forged signature to be rejected, got %v", err)
+	}
+}
+
+func TestRejectsReplayedAndV1Requests(t *testing.T) {
+	b := Start()
+	defer b.Close()
+	b.RequireV2 = true
+	c := newClient(t, b)
+	if _, err := c.NodeSignUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte(`{"sysPlatform":"linux"}`)
+	req, _ := http.NewRequest(http.MethodPost, b.URL()+ReportBaseInfoPath, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if err := auth.NewSigner(c.ClientID, c.PrivateKey).Sign(req, body); err != nil {
+		t.Fatal(err)
+	}
+	send := func(req *http.Request) int {
+		req.Body = http.NoBody
+		if req.Method == http.MethodPost {
+			req.Body, _ = req.GetBody()
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := send(req); code != http.StatusOK {
+		t.Fatalf("expected signed request to be accepted, got %d", code)
+	}
+	if code := send(req); code != http.StatusUnauthorized {
+		t.Errorf("expected replayed request to be rejected, got %d", code)
+	}
+
+	// 只带 v1 令牌的请求
+	v1, _ := http.NewRequest(http.MethodGet, b.URL()+RewardsPath, nil)
+	v1.Header.Set("Authorization", auth.NewAuthCredentials(c.ClientID, c.PrivateKey).GetAuthHeader())
+	if code := send(v1); code != http.StatusUnauthorized {
+		t.Errorf("expected v1 token to be rejected, got %d", code)
+	}
+}
+
+func TestClockSkewCorrected(t *testing.T) {
+	b := Start()
+	defer b.Close()
+	c := newClient(t, b)
+	if _, err := c.NodeSignUp(); err != nil {
+		t.Fatal(err)
+	}
+	sub, cancel := c.Events.Subscribe(4)
+	defer cancel()
+
+	// 后端时钟比本地快一小时，第一次请求被拒绝后按 Date 头校正并重试
+	b.Now = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, err := c.GetRewards(); err != nil {
+		t.Fatalf("expected request to succeed after clock correction, got %v", err)
+	}
+	st := c.ClockStatus()
+	if !st.Skewed || st.Source != clock.SourceDate || st.Offset < 3598000 || st.Offset > 3602000 {
+		t.Errorf("expected a one hour offset from the Date header, got %+v", st)
+	}
+	if got := c.Config.Get(config.KeyClockOffset); got != fmt.Sprint(st.Offset) {
+		t.Errorf("expected offset to be saved, got %q", got)
+	}
+	select {
+	case ev := <-sub:
+		if ev.Type != events.ClockSkewed {
+			t.Errorf("expected clock.skewed event, got %s", ev.Type)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected clock.skewed event")
+	}
+
+	// 之后的请求直接使用校正后的时间
+	before := len(b.Requests())
+	if _, err := c.GetRewards(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(b.Requests()) - before; n != 1 {
+		t.Errorf("expected a single request with the corrected clock, got %d", n)
+	}
+
+	st, err := c.SyncClock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Offset < 3598000 || st.Offset > 3602000 {
+		t.Errorf("expected time endpoint to keep the offset, got %+v", st)
+	}
+
+	// 新建的时钟从配置中恢复偏差
+	if restored := clock.New(c.Config).Status(); restored.Offset != st.Offset || !restored.Skewed {
+		t.Errorf("expected offset to be restored from config, got %+v", restored)
+	}
+}
+
+func TestFaultInjection(t *testing.T) {
+	b := Start()
+	defer b.Close()
+	c := newClient(t, b)
+	if _, err := c.NodeSignUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 一次 503 由 Transport 重试吸收
+	b.Inject(Fault{Path: RewardsPath, Status: http.StatusServiceUnavailable, Times: 1})
+	if _, err := c.GetRewards(); err != nil {
+		t.Errorf("expected retry to recover from one 503, got %v", err)
+	}
+
+	b.Inject(Fault{Path: RewardsPath, Code: 500, Message: "boom", Times: 1})
+	if _, err := c.GetRewards(); errcode.Of(err) != errcode.BackendError {
+		t.Errorf("expected BACKEND_ERROR, got %v", err)
+	}
+
+	b.Inject(Fault{Path: StatPath, Body: `{"code":200,"data":`, Times: 1})
+	if _, err := c.GetNodeStat(); errcode.Of(err) != errcode.BackendError {
+		t.Errorf("expected malformed body to be a BACKEND_ERROR, got %v", err)
+	}
+
+	b.Inject(Fault{Path: StatPath, Drop: true})
+	if _, err := c.GetNodeStatContext(context.Background()); errcode.Of(err) != errcode.BackendUnreachable {
+		t.Errorf("expected dropped connection to be BACKEND_UNREACHABLE, got %v", err)
+	}
+	b.ClearFaults()
+	if _, err := c.GetNodeStat(); err != nil {
+		t.Errorf("expected recovery after ClearFaults, got %v", err)
+	}
+
+	faults := 0
+	for _, r := range b.Requests() {
+		if r.Fault {
+			faults++
+		}
+	}
+	if faults < 4 {
+		t.Errorf("expected injected faults to be recorded, got %d", faults)
+	}
+}
+
+func TestProxyAuth(t *testing.T) {
+	b := Start()
+	defer b.Close()
+	b.AddProxyUser(ProxyUser{Username: "user", Password: "secret", IPResource: "1.2.3.4"})
+
+	auther := auth_plugin.NewAROAuthenticator(b.URL() + ProxyAuthPath)
+	if id, ok := auther.Authenticate(context.Background(), "user", "secret"); !ok || id != "user" {
+		t.Errorf("expected valid credentials to be accepted, got %q %v", id, ok)
+	}
+	if _, ok := auther.Authenticate(context.Background(), "user", "wrong"); ok {
+		t.Error("expected wrong password to be rejected")
+	}
+}
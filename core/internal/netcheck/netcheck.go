@@ -0,0 +1,145 @@
+package netcheck
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+)
+
+// NAT 类型
+// 只依赖普通 Binding Request，无法区分 Full/Restricted/Port Restricted Cone，统一归为 Cone
+const (
+	NatOpenPublic   = "OpenPublic"   // 映射地址与本机地址一致，没有 NAT
+	NatCone         = "Cone"         // 不同服务器看到的映射端口一致（Endpoint-Independent Mapping）
+	NatSymmetric    = "Symmetric"    // 不同服务器看到的映射端口不同
+	NatBlocked      = "Blocked"      // 所有 STUN 服务器都没有响应，UDP 可能被阻断
+	NatInconclusive = "Inconclusive" // 只有一个服务器响应，无法比较映射行为
+)
+
+// DefaultServers 默认 STUN 服务器
+var DefaultServers = []string{
+	"stun.l.google.com:19302",
+	"stun1.l.google.com:19302",
+	"stun.cloudflare.com:3478",
+}
+
+// DefaultTimeout 单个 STUN 服务器的默认超时时间
+const DefaultTimeout = 3 * time.Second
+
+// Result NAT 检测结果
+type Result struct {
+	NatType     string            `json:"nat_type"`
+	LocalAddr   string            `json:"local_addr"`
+	PublicIP    string            `json:"public_ip,omitempty"`
+	MappedAddrs map[string]string `json:"mapped_addrs"` // STUN 服务器 -> 映射地址
+	Errors      map[string]string `json:"errors,omitempty"`
+	Duration    int64             `json:"duration_ms"`
+}
+
+// Detect 使用同一个本地 UDP 端口向多个 STUN 服务器发送 Binding Request，
+// 根据映射地址推断 NAT 类型。servers 为空时使用 DefaultServers
+func Detect(ctx context.Context, servers []string, timeout time.Duration) (*Result, error) {
+	if len(servers) == 0 {
+		servers = DefaultServers
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open UDP socket: %w", err)
+	}
+	defer conn.Close()
+
+	// ctx 取消时关闭 socket，让阻塞中的读立即返回
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	start := time.Now()
+	result := &Result{
+		MappedAddrs: make(map[string]string),
+		Errors:      make(map[string]string),
+	}
+
+	var mapped []*net.UDPAddr
+	for _, server := range servers {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		addr, err := bind(conn, server, timeout)
+		if err != nil {
+			log.Printf("netcheck: %s: %v", server, err)
+			result.Errors[server] = err.Error()
+			continue
+		}
+		result.MappedAddrs[server] = addr.String()
+		mapped = append(mapped, addr)
+	}
+
+	result.LocalAddr = localAddr(conn)
+	result.NatType = classify(mapped, localIPs())
+	if len(mapped) > 0 {
+		result.PublicIP = mapped[0].IP.String()
+	}
+	result.Duration = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+// classify 根据映射地址推断 NAT 类型
+func classify(mapped []*net.UDPAddr, local []net.IP) string {
+	if len(mapped) == 0 {
+		return NatBlocked
+	}
+	for _, ip := range local {
+		if ip.Equal(mapped[0].IP) {
+			return NatOpenPublic
+		}
+	}
+	if len(mapped) == 1 {
+		return NatInconclusive
+	}
+	for _, addr := range mapped[1:] {
+		if !addr.IP.Equal(mapped[0].IP) || addr.Port != mapped[0].Port {
+			return NatSymmetric
+		}
+	}
+	return NatCone
+}
+
+// localAddr 返回 socket 实际使用的本地地址（用出口 IP 替换 0.0.0.0）
+func localAddr(conn *net.UDPConn) string {
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	ip := outboundIP()
+	if ip == nil {
+		return conn.LocalAddr().String()
+	}
+	return (&net.UDPAddr{IP: ip, Port: port}).String()
+}
+
+// outboundIP 获取默认路由的出口 IP（UDP Dial 不会真正发包）
+func outboundIP() net.IP {
+	conn, err := net.Dial("udp4", "8.8.8.8:80")
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP
+}
+
+// localIPs 返回本机所有网卡上的 IPv4 地址
+func localIPs() []net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+	return ips
+}
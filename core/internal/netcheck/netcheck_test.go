@@ -0,0 +1,112 @@
+package netcheck
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// serveSTUN 启动一个本地 STUN 服务器，对每个 Binding Request 回复请求方地址
+func serveSTUN(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if n < stunHeaderSize {
+				continue
+			}
+			var txID [12]byte
+			copy(txID[:], buf[8:20])
+			conn.WriteToUDP(bindingResponse(txID, from), from)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func bindingResponse(txID [12]byte, addr *net.UDPAddr) []byte {
+	ip := addr.IP.To4()
+	value := make([]byte, 8)
+	value[1] = familyIPv4
+	binary.BigEndian.PutUint16(value[2:4], uint16(addr.Port)^uint16(stunMagicCookie>>16))
+	binary.BigEndian.PutUint32(value[4:8], binary.BigEndian.Uint32(ip)^stunMagicCookie)
+
+	msg := make([]byte, stunHeaderSize+4+len(value))
+	binary.BigEndian.PutUint16(msg[0:2], stunBindingResponse)
+	binary.BigEndian.PutUint16(msg[2:4], uint16(4+len(value)))
+	binary.BigEndian.PutUint32(msg[4:8], stunMagicCookie)
+	copy(msg[8:20], txID[:])
+	binary.BigEndian.PutUint16(msg[20:22], attrXorMappedAddress)
+	binary.BigEndian.PutUint16(msg[22:24], uint16(len(value)))
+	copy(msg[24:], value)
+	return msg
+}
+
+func TestParseBindingResponse(t *testing.T) {
+	var txID [12]byte
+	copy(txID[:], "0123456789ab")
+	want := &net.UDPAddr{IP: net.IPv4(203, 0, 113, 7), Port: 54321}
+
+	got, err := parseBindingResponse(bindingResponse(txID, want), txID)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !got.IP.Equal(want.IP) || got.Port != want.Port {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	var other [12]byte
+	if _, err := parseBindingResponse(bindingResponse(txID, want), other); err == nil {
+		t.Error("expected transaction ID mismatch error")
+	}
+}
+
+func TestClassify(t *testing.T) {
+	a := &net.UDPAddr{IP: net.IPv4(203, 0, 113, 7), Port: 1000}
+	b := &net.UDPAddr{IP: net.IPv4(203, 0, 113, 7), Port: 2000}
+
+	tests := []struct {
+		name   string
+		mapped []*net.UDPAddr
+		local  []net.IP
+		want   string
+	}{
+		{"blocked", nil, nil, NatBlocked},
+		{"open", []*net.UDPAddr{a}, []net.IP{a.IP}, NatOpenPublic},
+		{"single", []*net.UDPAddr{a}, nil, NatInconclusive},
+		{"cone", []*net.UDPAddr{a, a}, nil, NatCone},
+		{"symmetric", []*net.UDPAddr{a, b}, nil, NatSymmetric},
+	}
+	for _, tt := range tests {
+		if got := classify(tt.mapped, tt.local); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestDetectAgainstLocalServer(t *testing.T) {
+	server := serveSTUN(t)
+
+	result, err := Detect(context.Background(), []string{server, server}, time.Second)
+	if err != nil {
+		t.Fatalf("detect: %v", err)
+	}
+	if len(result.MappedAddrs) != 1 {
+		t.Fatalf("expected one mapped address, got %v", result.MappedAddrs)
+	}
+	// 本地回环地址也在本机网卡上，应识别为无 NAT
+	if result.NatType != NatOpenPublic {
+		t.Errorf("expected %s, got %s", NatOpenPublic, result.NatType)
+	}
+}
@@ -0,0 +1,174 @@
+package netcheck
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// STUN (RFC 5389) 协议常量
+const (
+	stunMagicCookie     uint32 = 0x2112A442
+	stunHeaderSize             = 20
+	stunBindingRequest  uint16 = 0x0001
+	stunBindingResponse uint16 = 0x0101
+
+	attrMappedAddress    uint16 = 0x0001
+	attrXorMappedAddress uint16 = 0x0020
+
+	familyIPv4 byte = 0x01
+	familyIPv6 byte = 0x02
+)
+
+var errNotBindingResponse = errors.New("not a STUN binding response")
+
+// newBindingRequest 构造一个不带属性的 Binding Request，返回报文和事务 ID
+func newBindingRequest() ([]byte, [12]byte, error) {
+	var txID [12]byte
+	if _, err := rand.Read(txID[:]); err != nil {
+		return nil, txID, err
+	}
+
+	msg := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(msg[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint16(msg[2:4], 0)
+	binary.BigEndian.PutUint32(msg[4:8], stunMagicCookie)
+	copy(msg[8:20], txID[:])
+	return msg, txID, nil
+}
+
+// parseBindingResponse 解析 Binding Response，返回映射地址
+// 优先使用 XOR-MAPPED-ADDRESS，兼容只返回 MAPPED-ADDRESS 的旧服务器
+func parseBindingResponse(msg []byte, txID [12]byte) (*net.UDPAddr, error) {
+	if len(msg) < stunHeaderSize {
+		return nil, errNotBindingResponse
+	}
+	if binary.BigEndian.Uint16(msg[0:2]) != stunBindingResponse ||
+		binary.BigEndian.Uint32(msg[4:8]) != stunMagicCookie {
+		return nil, errNotBindingResponse
+	}
+	if string(msg[8:20]) != string(txID[:]) {
+		return nil, fmt.Errorf("transaction ID mismatch")
+	}
+
+	length := int(binary.BigEndian.Uint16(msg[2:4]))
+	if stunHeaderSize+length > len(msg) {
+		return nil, fmt.Errorf("truncated STUN message")
+	}
+	attrs := msg[stunHeaderSize : stunHeaderSize+length]
+
+	var mapped *net.UDPAddr
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:2])
+		size := int(binary.BigEndian.Uint16(attrs[2:4]))
+		if 4+size > len(attrs) {
+			return nil, fmt.Errorf("truncated STUN attribute")
+		}
+		value := attrs[4 : 4+size]
+
+		switch typ {
+		case attrXorMappedAddress:
+			return decodeAddress(value, true, txID)
+		case attrMappedAddress:
+			if addr, err := decodeAddress(value, false, txID); err == nil {
+				mapped = addr
+			}
+		}
+
+		// 属性按 4 字节对齐
+		padded := (size + 3) &^ 3
+		if 4+padded > len(attrs) {
+			break
+		}
+		attrs = attrs[4+padded:]
+	}
+
+	if mapped == nil {
+		return nil, fmt.Errorf("no mapped address in STUN response")
+	}
+	return mapped, nil
+}
+
+// decodeAddress 解码 (XOR-)MAPPED-ADDRESS 属性值
+func decodeAddress(value []byte, xor bool, txID [12]byte) (*net.UDPAddr, error) {
+	if len(value) < 4 {
+		return nil, fmt.Errorf("invalid address attribute")
+	}
+	family := value[1]
+	port := binary.BigEndian.Uint16(value[2:4])
+
+	var ip net.IP
+	switch family {
+	case familyIPv4:
+		if len(value) < 8 {
+			return nil, fmt.Errorf("invalid IPv4 address attribute")
+		}
+		ip = make(net.IP, net.IPv4len)
+		copy(ip, value[4:8])
+	case familyIPv6:
+		if len(value) < 20 {
+			return nil, fmt.Errorf("invalid IPv6 address attribute")
+		}
+		ip = make(net.IP, net.IPv6len)
+		copy(ip, value[4:20])
+	default:
+		return nil, fmt.Errorf("unknown address family %d", family)
+	}
+
+	if xor {
+		port ^= uint16(stunMagicCookie >> 16)
+		var key [16]byte
+		binary.BigEndian.PutUint32(key[0:4], stunMagicCookie)
+		copy(key[4:], txID[:])
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+
+	return &net.UDPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// bind 通过 conn 向 STUN 服务器发送 Binding Request，返回公网映射地址
+func bind(conn *net.UDPConn, server string, timeout time.Duration) (*net.UDPAddr, error) {
+	serverAddr, err := net.ResolveUDPAddr("udp4", server)
+	if err != nil {
+		return nil, fmt.Errorf("resolve STUN server %s: %w", server, err)
+	}
+
+	req, txID, err := newBindingRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	// UDP 可能丢包，在超时时间内重传 3 次
+	buf := make([]byte, 1500)
+	attempt := timeout / 3
+	for i := 0; i < 3; i++ {
+		if _, err := conn.WriteToUDP(req, serverAddr); err != nil {
+			return nil, fmt.Errorf("send STUN request: %w", err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(attempt))
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				var ne net.Error
+				if errors.As(err, &ne) && ne.Timeout() {
+					break
+				}
+				return nil, err
+			}
+			if !from.IP.Equal(serverAddr.IP) {
+				continue
+			}
+			addr, err := parseBindingResponse(buf[:n], txID)
+			if err != nil {
+				continue
+			}
+			return addr, nil
+		}
+	}
+	return nil, fmt.Errorf("no response from STUN server %s", server)
+}
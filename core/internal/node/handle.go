@@ -0,0 +1,60 @@
+package node
+
+import (
+	"sync"
+
+	"aro-ext-app/core/internal/errcode"
+)
+
+// Handle 交给 FFI 调用方的不透明句柄，0 表示无效
+type Handle int64
+
+// 句柄表：FFI 不能持有 Go 指针，调用方只保存句柄
+var (
+	handlesMu  sync.RWMutex
+	handles    = make(map[Handle]*Node)
+	nextHandle Handle
+)
+
+// Register 登记节点并返回新句柄
+func Register(n *Node) Handle {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	nextHandle++
+	handles[nextHandle] = n
+	return nextHandle
+}
+
+// Lookup 根据句柄查找节点
+func Lookup(h Handle) (*Node, error) {
+	handlesMu.RLock()
+	defer handlesMu.RUnlock()
+	n, ok := handles[h]
+	if !ok {
+		return nil, errcode.Errorf(errcode.NodeNotFound, "invalid node handle %d", h)
+	}
+	return n, nil
+}
+
+// Release 注销句柄并返回对应节点，调用方负责 Close
+func Release(h Handle) (*Node, error) {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	n, ok := handles[h]
+	if !ok {
+		return nil, errcode.Errorf(errcode.NodeNotFound, "invalid node handle %d", h)
+	}
+	delete(handles, h)
+	return n, nil
+}
+
+// Handles 返回所有有效句柄
+func Handles() []Handle {
+	handlesMu.RLock()
+	defer handlesMu.RUnlock()
+	list := make([]Handle, 0, len(handles))
+	for h := range handles {
+		list = append(list, h)
+	}
+	return list
+}
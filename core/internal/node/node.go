@@ -0,0 +1,410 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/clock"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/datadir"
+	"aro-ext-app/core/internal/errcode"
+	"aro-ext-app/core/internal/events"
+	"aro-ext-app/core/internal/heartbeat"
+	"aro-ext-app/core/internal/identity"
+	"aro-ext-app/core/internal/ledger"
+	"aro-ext-app/core/internal/proxy_worker"
+	"aro-ext-app/core/internal/speedtest"
+	"aro-ext-app/core/internal/storage"
+)
+
+// Options 节点实例参数
+type Options struct {
+	// Dir 节点数据目录，保存密钥对和 config.env，多个节点必须使用不同目录
+	Dir string `json:"dir"`
+	// APIURL 后端 API 地址，为空时使用节点环境的地址
+	APIURL string `json:"api_url"`
+	// Profile 后端环境（见 config.Profile），非空时写入节点的 config.env，为空时使用 config.env 中的环境
+	Profile string `json:"profile"`
+}
+
+// Node 一个节点实例，拥有自己的配置、密钥对（保存在按 KEY_PROTECTION 加密的 Keys 中）、API 客户端、时钟校正、worker、心跳、测速和存储，
+// 同一进程中可以同时运行多个互相隔离的节点
+type Node struct {
+	Name      string
+	Dir       string
+	ClientID  string
+	Config    *config.Config
+	KeyPair   *crypto.KeyPair
+	Keys      crypto.KeyStore
+	API       *api_client.APIClient
+	Worker    *proxy_worker.Manager
+	Heartbeat *heartbeat.Service
+	Ledger    *ledger.Ledger
+	Speedtest *speedtest.Service
+	Storage   *storage.Storage
+	Events    *events.Bus
+	// Clone 启动时的克隆检测结果，Cloned 为 true 时应调用 Reregister
+	Clone identity.CloneStatus
+
+	mu            sync.Mutex
+	stopBaseInfo  context.CancelFunc
+	stopHeartbeat context.CancelFunc
+	stopConfig    context.CancelFunc
+}
+
+// seq 用于生成进程内唯一的实例名
+var seq atomic.Int64
+
+// New 在 opts.Dir 下创建一个独立的节点实例，密钥对和客户端 ID 不存在时自动生成
+func New(opts Options) (*Node, error) {
+	if opts.Dir == "" {
+		return nil, errcode.New(errcode.InvalidParams, "node dir is required")
+	}
+	dir, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create node dir: %w", err)
+	}
+
+	cfg := config.New(dir)
+	if opts.Profile != "" {
+		if err := cfg.SetProfile(opts.Profile); err != nil {
+			return nil, err
+		}
+	}
+	if opts.APIURL == "" {
+		opts.APIURL = cfg.Get(config.KeyAPIURL)
+	}
+	keys, err := crypto.OpenKeyStore(cfg, dir)
+	if err != nil {
+		return nil, err
+	}
+	keyPair, err := crypto.LoadOrCreateKeyPair(keys, crypto.KeyTypeFromConfig(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keypair: %w", err)
+	}
+
+	store, err := storage.Open(filepath.Join(cfg.IdentityDir(dir), storage.FileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage: %w", err)
+	}
+
+	bus := events.NewBus(events.DefaultCapacity)
+	name := fmt.Sprintf("node%d", seq.Add(1))
+	n := &Node{
+		Name:     name,
+		Dir:      dir,
+		ClientID: crypto.ClientIDFrom(cfg),
+		Config:   cfg,
+		KeyPair:  keyPair,
+		Keys:     keys,
+		Worker:   proxy_worker.NewManager(name, bus),
+		Storage:  store,
+		Events:   bus,
+	}
+	n.API = api_client.NewAPIClient(opts.APIURL, n.ClientID, keyPair)
+	n.API.Config = cfg
+	n.API.Events = bus
+	n.API.Transport = api_client.NewTransport(api_client.RetryPolicyFromConfig(cfg))
+	n.API.HttpClient = n.API.Transport.Client
+	n.API.DataDir = dir
+	n.API.Clock = clock.New(cfg)
+	n.Heartbeat = heartbeat.New(heartbeat.Options{Client: n.API, Worker: n.Worker, OnResult: n.recordConnectStatus})
+	n.Ledger = ledger.New(ledger.Options{Store: n.Storage, Worker: n.Worker, Events: n.Events, Client: n.API})
+	n.Speedtest = speedtest.NewService(cfg, bus, n.API.Clock)
+	n.Speedtest.Transport = n.API.Transport
+	n.loadIdentity()
+	return n, nil
+}
+
+// NewDefault 使用进程级单例（全局配置、全局 worker、全局事件总线）和数据目录（见 datadir 包）创建节点，
+// 即 InitLibstudy 之前的行为，供旧的无句柄导出函数使用
+func NewDefault(apiURL string) (*Node, error) {
+	keys, err := crypto.OpenKeyStore(config.GetConfig(), "")
+	if err != nil {
+		return nil, err
+	}
+	keyPair, err := crypto.LoadOrCreateKeyPair(keys, crypto.KeyTypeFromConfig(config.GetConfig()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keypair: %w", err)
+	}
+	dir := datadir.Get()
+	clientID := crypto.GenerateClientID()
+	n := &Node{
+		Name:     "default",
+		Dir:      dir,
+		ClientID: clientID,
+		Config:   config.GetConfig(),
+		KeyPair:  keyPair,
+		Keys:     keys,
+		API:      api_client.NewAPIClient(apiURL, clientID, keyPair),
+		Worker:   proxy_worker.GetManager(),
+		Storage:  storage.GetStorage(),
+		Events:   events.GetBus(),
+	}
+	n.API.DataDir = dir
+	n.Heartbeat = heartbeat.New(heartbeat.Options{Client: n.API, Worker: n.Worker, OnResult: n.recordConnectStatus})
+	n.Ledger = ledger.New(ledger.Options{Store: n.Storage, Worker: n.Worker, Events: n.Events, Client: n.API})
+	n.Speedtest = speedtest.GetService()
+	n.loadIdentity()
+	return n, nil
+}
+
+// loadIdentity 加载密钥轮换宽限期内的旧密钥并检测身份是否从另一台设备复制而来；
+// 上次运行保存的连接状态已经过时，重置为 idle，心跳开始后更新
+func (n *Node) loadIdentity() {
+	if err := identity.LoadPreviousKey(n.API, n.Keys); err != nil {
+		log.Printf("%s: %v", n.Name, err)
+	}
+	n.Clone = identity.CheckClone(n.Config)
+	n.Storage.UpdateConnectStatus(storage.StatusIdle)
+}
+
+// saveNodeInfo 把当前的客户端 ID 和公钥保存到存储中，在身份变化（注册、轮换、重新注册、恢复）后调用
+func (n *Node) saveNodeInfo() {
+	publicKey, err := crypto.ExportPublicKeyToPEM(n.API.KeyPair().PublicKey)
+	if err != nil {
+		log.Printf("%s: failed to export the public key: %v", n.Name, err)
+		return
+	}
+	n.Storage.SetNodeInfo(&storage.NodeInfo{NodeID: n.API.ID(), PublicKey: publicKey})
+}
+
+// GetNodeStat 查询节点的绑定状态，成功时把绑定信息保存到存储中
+func (n *Node) GetNodeStat(ctx context.Context) (*api_client.APIResponseWith[api_client.NodeStatData], error) {
+	resp, err := n.API.GetNodeStatContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	n.Storage.SetUserInfo(&storage.BindInfo{
+		SerialNumber: resp.Data.SerialNumber,
+		Bind:         resp.Data.Bind,
+		BindUser:     resp.Data.BindUser,
+	})
+	return resp, nil
+}
+
+// recordConnectStatus 按心跳结果更新连接状态（见 storage.ConnectStatusOf），心跳停止后才返回的结果不再改变状态
+func (n *Node) recordConnectStatus(err error) {
+	n.mu.Lock()
+	running := n.stopHeartbeat != nil
+	n.mu.Unlock()
+	if running {
+		n.Storage.UpdateConnectStatus(storage.ConnectStatusOf(err))
+	}
+}
+
+// SignUp 注册节点，后端不接受当前密钥的算法时换用后端支持的算法重新生成密钥
+func (n *Node) SignUp(ctx context.Context) (*api_client.APIResponseWith[api_client.SignUpData], error) {
+	resp, err := identity.SignUp(ctx, n.API, n.Keys)
+	n.KeyPair = n.API.KeyPair()
+	if err == nil {
+		n.saveNodeInfo()
+	}
+	return resp, err
+}
+
+// RotateKey 轮换节点密钥，期间停止后台任务，结束后恢复轮换前在运行的后台任务：
+// 成功时使用新密钥，失败时继续使用原来的密钥
+func (n *Node) RotateKey(ctx context.Context) (*identity.RotateResult, error) {
+	baseInfo, heartbeat := n.backgroundRunning()
+	n.StopBackground()
+	defer n.resumeBackground(baseInfo, heartbeat)
+	res, err := identity.Rotate(ctx, n.API, n.Keys)
+	if err != nil {
+		return nil, err
+	}
+	n.KeyPair = n.API.KeyPair()
+	n.saveNodeInfo()
+	return res, nil
+}
+
+// backgroundRunning 返回系统信息上报和心跳是否在运行
+func (n *Node) backgroundRunning() (baseInfo, heartbeat bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.stopBaseInfo != nil, n.stopHeartbeat != nil
+}
+
+// resumeBackground 重新启动 backgroundRunning 报告在运行的后台任务
+func (n *Node) resumeBackground(baseInfo, heartbeat bool) {
+	if baseInfo {
+		n.StartBaseInfoReporter()
+	}
+	if heartbeat {
+		n.StartHeartbeat()
+	}
+}
+
+// Reregister 以新的客户端 ID 和密钥重新注册节点，用于被复制到另一台设备的身份
+// 期间停止后台任务，成功后以新身份恢复之前在运行的后台任务，失败时后台任务保持停止
+func (n *Node) Reregister(ctx context.Context) (*api_client.APIResponseWith[api_client.SignUpData], error) {
+	baseInfo, heartbeat := n.backgroundRunning()
+	n.StopBackground()
+	resp, err := identity.Reregister(ctx, n.API, n.Keys)
+	if err != nil {
+		return nil, err
+	}
+	defer n.resumeBackground(baseInfo, heartbeat)
+	n.ClientID = n.API.ID()
+	n.KeyPair = n.API.KeyPair()
+	n.Clone = identity.CloneStatus{HardwareID: n.Clone.HardwareID, Recorded: n.Clone.HardwareID}
+	// 绑定信息属于原来的身份，下次 GetNodeStat 时重新保存
+	n.Storage.SetUserInfo(nil)
+	n.saveNodeInfo()
+	return resp, nil
+}
+
+// ExportIdentity 导出用 passphrase 加密的身份备份
+func (n *Node) ExportIdentity(passphrase string) ([]byte, error) {
+	return identity.Export(n.Config, n.Keys, passphrase)
+}
+
+// ImportIdentity 用备份替换节点身份，期间停止后台任务，成功后以新身份恢复之前在运行的后台任务，
+// 失败时后台任务保持停止
+func (n *Node) ImportIdentity(ctx context.Context, data []byte, passphrase string, opts identity.ImportOptions) (*identity.BackupInfo, error) {
+	baseInfo, heartbeat := n.backgroundRunning()
+	n.StopBackground()
+	info, err := identity.Import(ctx, n.API, n.Keys, data, passphrase, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer n.resumeBackground(baseInfo, heartbeat)
+	n.ClientID = n.API.ID()
+	n.KeyPair = n.API.KeyPair()
+	n.Clone = identity.CheckClone(n.Config)
+	n.Storage.SetUserInfo(nil)
+	n.saveNodeInfo()
+	return info, nil
+}
+
+// WorkerConfig 补全 worker 配置：代理认证地址为空时使用节点环境的 PROXY_AUTH_URL，
+// 认证缓存保存在节点的身份目录，同一进程中的多个节点不共用缓存
+func (n *Node) WorkerConfig(c proxy_worker.ProxyWorkerConfig) proxy_worker.ProxyWorkerConfig {
+	c.ApplyProfile(n.Config.Profile().ProxyAuthURL)
+	if c.AuthCacheDir == "" {
+		c.AuthCacheDir = n.Config.IdentityDir(n.Dir)
+	}
+	return c
+}
+
+// StartBaseInfoReporter 在后台定期采集系统指纹，有变化时上报，重复调用无效果
+// 应在注册成功后调用，StopBackground 或 Close 时停止
+func (n *Node) StartBaseInfoReporter() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopBaseInfo != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	n.stopBaseInfo = cancel
+	go n.API.WatchBaseInfo(ctx, api_client.DefaultBaseInfoInterval)
+}
+
+// StartHeartbeat 在后台定时发送心跳并记录本地账本（见 ledger 包），重复调用无效果
+// 应在注册成功后调用，StopBackground 或 Close 时停止
+func (n *Node) StartHeartbeat() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopHeartbeat != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	n.stopHeartbeat = cancel
+	n.Storage.UpdateConnectStatus(storage.StatusConnecting)
+	go n.Heartbeat.Run(ctx)
+	go n.Ledger.Run(ctx)
+}
+
+// StartConfigWatch 在后台监视节点的配置文件，修改后重新加载并应用到 API 地址、重试策略和心跳间隔，
+// 发布 config.reloaded 事件；无效的修改被拒绝，保留之前的配置并发布 config.rejected 事件
+// 重复调用无效果，StopConfigWatch 或 Close 时停止
+func (n *Node) StartConfigWatch() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopConfig != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	unsubscribe := n.Config.Subscribe(n.applyConfig)
+	n.stopConfig = func() {
+		cancel()
+		unsubscribe()
+	}
+	go n.Config.Watch(ctx, 0)
+}
+
+// StopConfigWatch 停止监视配置文件
+func (n *Node) StopConfigWatch() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopConfig != nil {
+		n.stopConfig()
+		n.stopConfig = nil
+	}
+}
+
+// applyConfig 把重新加载的配置应用到正在运行的组件
+func (n *Node) applyConfig(ev config.ReloadEvent) {
+	if ev.Err != nil {
+		n.Events.Publish(events.ConfigRejected, events.ConfigEvent{Error: ev.Err.Error()})
+		return
+	}
+	if ev.Changed(config.KeyAPIURL) {
+		n.API.SetBaseURL(ev.Settings.API.URL)
+	}
+	if ev.Changed(config.KeyHeartbeatInterval) {
+		n.Heartbeat.SetInterval(time.Duration(ev.Settings.API.HeartbeatInterval) * time.Second)
+	}
+	if ev.Changed(config.KeyRetryCount, config.KeyRetryInterval, config.KeyTimeout) {
+		n.API.Transport.SetPolicy(api_client.RetryPolicyFromConfig(n.Config))
+	}
+	// WORKER_RESTART_DELAY 只由 aro-node run 的 worker 监督使用，在 run 的订阅者中更新；
+	// 节点本身不自动重启崩溃的 worker（libstudy 由应用调用 RestartProxyWorker），这里不需要处理
+	keys := make([]string, len(ev.Changes))
+	for i, ch := range ev.Changes {
+		keys[i] = ch.Key
+	}
+	n.Events.Publish(events.ConfigReloaded, events.ConfigEvent{Keys: keys})
+}
+
+// StopBackground 停止系统信息上报、心跳和账本记录
+func (n *Node) StopBackground() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopHeartbeat != nil {
+		n.Storage.UpdateConnectStatus(storage.StatusIdle)
+	}
+	for _, stop := range []*context.CancelFunc{&n.stopBaseInfo, &n.stopHeartbeat} {
+		if *stop != nil {
+			(*stop)()
+			*stop = nil
+		}
+	}
+}
+
+// Close 停止节点的 worker、后台任务和配置监视并关闭存储，节点之后不应再使用
+func (n *Node) Close() error {
+	n.StopBackground()
+	n.StopConfigWatch()
+	var err error
+	if n.Worker.IsRunning() {
+		err = n.Worker.Stop()
+	}
+	if n.Storage != nil && n.Storage != storage.GetStorage() {
+		if cerr := n.Storage.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
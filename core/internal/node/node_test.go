@@ -0,0 +1,260 @@
+package node
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/events"
+	"aro-ext-app/core/internal/identity"
+	"aro-ext-app/core/internal/mockbackend"
+	"aro-ext-app/core/internal/proxy_worker"
+	"aro-ext-app/core/internal/storage"
+)
+
+func TestNodesAreIsolated(t *testing.T) {
+	t.Setenv("KEY_SECRET_FILE", filepath.Join(t.TempDir(), "machine.secret"))
+	n1, err := New(Options{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n2, err := New(Options{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n1.ClientID == n2.ClientID {
+		t.Error("expected distinct client IDs")
+	}
+	if n1.KeyPair.PrivateKey.Equal(n2.KeyPair.PrivateKey) {
+		t.Error("expected distinct key pairs")
+	}
+	if n1.Worker == n2.Worker || n1.Events == n2.Events || n1.Config == n2.Config || n1.Storage == n2.Storage {
+		t.Error("expected nodes not to share worker, events, config or storage")
+	}
+	if n1.API.Config != n1.Config || n1.API.Events != n1.Events {
+		t.Error("expected API client to use the node's config and event bus")
+	}
+	if n1.Speedtest.Config != n1.Config || n1.Speedtest.Events != n1.Events || n1.Speedtest.Clock != n1.API.Clock {
+		t.Error("expected speedtest to use the node's config, event bus and clock")
+	}
+	if _, err := os.Stat(filepath.Join(n1.Dir, crypto.KeyFileName)); err != nil {
+		t.Errorf("expected key pair in node dir: %v", err)
+	}
+	worker := proxy_worker.ProxyWorkerConfig{EnableAuth: true}
+	c1, c2 := n1.WorkerConfig(worker), n2.WorkerConfig(worker)
+	if c1.AuthCacheDir != n1.Dir || c2.AuthCacheDir != n2.Dir {
+		t.Errorf("expected auth cache in node dirs, got %q and %q", c1.AuthCacheDir, c2.AuthCacheDir)
+	}
+	if c1.AuthURL == "" {
+		t.Error("expected the profile's proxy auth URL")
+	}
+}
+
+func TestNodeIdentityPerProfile(t *testing.T) {
+	t.Setenv("KEY_SECRET_FILE", filepath.Join(t.TempDir(), "machine.secret"))
+	dir := t.TempDir()
+	staging, err := New(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mainnet, err := New(Options{Dir: dir, Profile: config.ProfileMainnet})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if staging.ClientID == mainnet.ClientID || staging.KeyPair.PrivateKey.Equal(mainnet.KeyPair.PrivateKey) {
+		t.Error("expected each profile to have its own identity")
+	}
+	if mainnet.API.URL() != "https://api.aro.network" {
+		t.Errorf("expected the mainnet API URL, got %s", mainnet.API.URL())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "profiles", config.ProfileMainnet, crypto.KeyFileName)); err != nil {
+		t.Errorf("expected the mainnet key in its profile dir: %v", err)
+	}
+
+	again, err := New(Options{Dir: dir, Profile: config.ProfileStaging})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ClientID != staging.ClientID || !again.KeyPair.PrivateKey.Equal(staging.KeyPair.PrivateKey) {
+		t.Error("expected switching back to restore the staging identity")
+	}
+}
+
+func TestNodeReopensSameIdentity(t *testing.T) {
+	t.Setenv("KEY_SECRET_FILE", filepath.Join(t.TempDir(), "machine.secret"))
+	dir := t.TempDir()
+	n1, err := New(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n2, err := New(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n1.ClientID != n2.ClientID || !n1.KeyPair.PrivateKey.Equal(n2.KeyPair.PrivateKey) {
+		t.Error("expected the same identity when reopening a node dir")
+	}
+	if n1.Name == n2.Name {
+		t.Error("expected unique instance names")
+	}
+}
+
+func TestHandles(t *testing.T) {
+	n := &Node{Name: "test"}
+	h := Register(n)
+	if got, err := Lookup(h); err != nil || got != n {
+		t.Fatalf("lookup: %v", err)
+	}
+	if _, err := Release(h); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Lookup(h); err == nil {
+		t.Error("expected released handle to be invalid")
+	}
+	if _, err := Release(h); err == nil {
+		t.Error("expected double release to fail")
+	}
+}
+
+func TestNodeAppliesConfigChanges(t *testing.T) {
+	t.Setenv("KEY_SECRET_FILE", filepath.Join(t.TempDir(), "machine.secret"))
+	n, err := New(Options{Dir: t.TempDir(), APIURL: "http://127.0.0.1:1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+	n.StartConfigWatch()
+	n.StartConfigWatch()
+
+	path := filepath.Join(n.Dir, "config.env")
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, append(saved, "API_URL=http://127.0.0.1:2\nHEARTBEAT_INTERVAL=30\n"...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.Config.ReloadChecked(); err != nil {
+		t.Fatal(err)
+	}
+	if n.API.URL() != "http://127.0.0.1:2" || n.Heartbeat.Interval() != 30*time.Second {
+		t.Errorf("expected the new API URL and heartbeat interval, got %s %v", n.API.URL(), n.Heartbeat.Interval())
+	}
+
+	if err := os.WriteFile(path, append(saved, "HEARTBEAT_INTERVAL=often\n"...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.Config.ReloadChecked(); err == nil {
+		t.Fatal("expected an invalid edit to be rejected")
+	}
+	if n.Heartbeat.Interval() != 30*time.Second {
+		t.Errorf("expected the previous interval to be kept, got %v", n.Heartbeat.Interval())
+	}
+
+	batch := n.Events.Since(0, 0)
+	if len(batch.Events) != 2 || batch.Events[0].Type != events.ConfigReloaded || batch.Events[1].Type != events.ConfigRejected {
+		t.Fatalf("expected one reloaded and one rejected event, got %+v", batch.Events)
+	}
+	if keys := batch.Events[0].Data.(events.ConfigEvent).Keys; len(keys) != 2 || keys[0] != config.KeyAPIURL {
+		t.Errorf("unexpected changed keys %v", keys)
+	}
+}
+
+func TestNodePersistsStateInStorage(t *testing.T) {
+	t.Setenv("KEY_SECRET_FILE", filepath.Join(t.TempDir(), "machine.secret"))
+	b := mockbackend.Start()
+	defer b.Close()
+	dir := t.TempDir()
+	n, err := New(Options{Dir: dir, APIURL: b.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.SignUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if info := n.Storage.GetNodeInfo(); info == nil || info.NodeID != n.ClientID || info.PublicKey == "" {
+		t.Errorf("expected the node info to be saved, got %+v", info)
+	}
+	if _, err := n.GetNodeStat(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if info := n.Storage.GetUserInfo(); info == nil || info.SerialNumber != n.Config.Get(config.KeySN) {
+		t.Errorf("expected the bind info to be saved, got %+v", info)
+	}
+
+	n.StartHeartbeat()
+	deadline := time.Now().Add(5 * time.Second)
+	for n.Storage.GetConnectStatus() != storage.StatusConnected && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := n.Storage.GetConnectStatus(); status != storage.StatusConnected {
+		t.Fatalf("expected a successful heartbeat to mark the node connected, got %s", status)
+	}
+	n.StopBackground()
+	if status := n.Storage.GetConnectStatus(); status != storage.StatusIdle {
+		t.Errorf("expected stopping the heartbeat to mark the node idle, got %s", status)
+	}
+	n.Close()
+
+	// 进程异常退出时保存的状态不会被重置
+	store, err := storage.Open(filepath.Join(dir, storage.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetConnectStatus(storage.StatusConnected)
+	store.Close()
+
+	reopened, err := New(Options{Dir: dir, APIURL: b.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if status := reopened.Storage.GetConnectStatus(); status != storage.StatusIdle {
+		t.Errorf("expected the connect status to be reset on start, got %s", status)
+	}
+	if reopened.Storage.GetUserInfo() == nil || reopened.Storage.GetNodeInfo() == nil {
+		t.Error("expected the bind and node info to survive a restart")
+	}
+}
+
+func TestIdentityChangesRestoreRunningBackground(t *testing.T) {
+	t.Setenv("KEY_SECRET_FILE", filepath.Join(t.TempDir(), "machine.secret"))
+	b := mockbackend.Start()
+	defer b.Close()
+	n, err := New(Options{Dir: t.TempDir(), APIURL: b.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+	if _, err := n.SignUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有运行后台任务的节点在重新注册后也不启动
+	if _, err := n.Reregister(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if baseInfo, heartbeat := n.backgroundRunning(); baseInfo || heartbeat {
+		t.Errorf("expected no background tasks after reregister, got base info %v, heartbeat %v", baseInfo, heartbeat)
+	}
+
+	n.StartHeartbeat()
+	if _, err := n.Reregister(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if baseInfo, heartbeat := n.backgroundRunning(); baseInfo || !heartbeat {
+		t.Errorf("expected only the heartbeat to be restored, got base info %v, heartbeat %v", baseInfo, heartbeat)
+	}
+
+	if _, err := n.ImportIdentity(context.Background(), []byte("not a backup"), "secret", identity.ImportOptions{}); err == nil {
+		t.Fatal("expected the import to fail")
+	}
+	if _, heartbeat := n.backgroundRunning(); heartbeat {
+		t.Error("expected a failed import not to restart the heartbeat")
+	}
+}
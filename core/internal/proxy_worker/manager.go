@@ -2,23 +2,34 @@ package proxy_worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"sync"
 	"time"
 
+	"aro-ext-app/core/internal/errcode"
+	"aro-ext-app/core/internal/events"
+
 	"github.com/go-gost/core/logger"
+	"github.com/go-gost/core/service"
 	"github.com/go-gost/x/config"
 	"github.com/go-gost/x/config/cmd"
-	gost_loader "github.com/go-gost/x/config/loader"
-	xlogger "github.com/go-gost/x/logger"
+	"github.com/go-gost/x/config/parsing"
+	chain_parser "github.com/go-gost/x/config/parsing/chain"
+	hop_parser "github.com/go-gost/x/config/parsing/hop"
+	logger_parser "github.com/go-gost/x/config/parsing/logger"
+	service_parser "github.com/go-gost/x/config/parsing/service"
 	"github.com/go-gost/x/registry"
 )
 
 // Manager 代理工作节点管理器（内嵌 GOST）
 type Manager struct {
 	mu        sync.RWMutex
+	name      string      // 实例名，作为注册到 GOST registry 的对象名前缀
+	bus       *events.Bus // worker/tunnel 事件发布到该总线
 	config    *ProxyWorkerConfig
 	services  []interface{ Serve() error }
 	ctx       context.Context
@@ -26,6 +37,14 @@ type Manager struct {
 	startTime int64
 	isRunning bool
 	errChan   chan error
+
+	tunnelServices map[string]bool // rtcp 服务名，用于识别隧道状态事件
+	tunnelState    string
+	traffic        map[string]Traffic // 代理服务名 -> 累计流量
+
+	// 本实例注册到 GOST registry 的对象，Stop 时注销
+	registeredHops   []string
+	registeredChains []string
 }
 
 var (
@@ -36,26 +55,37 @@ var (
 // GetManager 获取全局管理器实例
 func GetManager() *Manager {
 	globalManagerOnce.Do(func() {
-		ctx, cancel := context.WithCancel(context.Background())
-		globalManager = &Manager{
-			ctx:    ctx,
-			cancel: cancel,
-		}
+		globalManager = NewManager("default", events.GetBus())
 	})
 	return globalManager
 }
 
+// NewManager 创建独立的管理器实例，同一进程中的多个实例通过 name 区分，
+// name 必须唯一；bus 为空时使用全局事件总线
+func NewManager(name string, bus *events.Bus) *Manager {
+	if bus == nil {
+		bus = events.GetBus()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		name:   name,
+		bus:    bus,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
 // Start 启动代理工作节点（内嵌模式）
 func (m *Manager) Start(config ProxyWorkerConfig) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if m.isRunning {
-		return fmt.Errorf("proxy worker is already running")
+		return errcode.New(errcode.WorkerAlreadyRunning, "proxy worker is already running")
 	}
 
 	if err := m.validateConfig(&config); err != nil {
-		return fmt.Errorf("invalid configuration: %w", err)
+		return errcode.Errorf(errcode.InvalidConfig, "invalid configuration: %w", err)
 	}
 
 	// 构建 GOST 配置
@@ -64,31 +94,33 @@ func (m *Manager) Start(config ProxyWorkerConfig) error {
 		return fmt.Errorf("failed to build gost config: %w", err)
 	}
 
-	// 创建 logger (设置为Debug级别以输出调试信息)
-	lg := xlogger.NewLogger(
-		xlogger.LevelOption(logger.DebugLevel),
-	)
-	logger.SetDefault(lg)
-
-	// ⚠️ 关键：使用 gost_loader.Load 来注册 chains, hops, services 到 registry
-	// 这是 aro-proxy-worker 的正确启动方式
-	if err := gost_loader.Load(cfg); err != nil {
+	// 注册本实例的 chains、hops 并解析服务
+	// 不使用 gost_loader.Load：它会清空整个 registry，破坏同一进程中其他实例的服务
+	services, err := m.load(cfg)
+	if err != nil {
+		m.unregister()
 		return fmt.Errorf("failed to load config: %w", err)
 	}
-
-	// 从 registry 获取所有已注册的服务并启动
-	services, err := m.startGostServices(lg)
-	if err != nil {
-		return fmt.Errorf("failed to start gost services: %w", err)
+	m.tunnelServices = make(map[string]bool)
+	for _, svc := range cfg.Services {
+		if svc.Listener != nil && svc.Listener.Type == "rtcp" {
+			m.tunnelServices[svc.Name] = true
+		}
 	}
+	m.tunnelState = TunnelStateConnecting
+	m.traffic = make(map[string]Traffic)
+	m.errChan = make(chan error, 1)
 
 	m.config = &config
-	m.services = services
+	m.services = m.startGostServices(services)
 	m.isRunning = true
 	m.startTime = time.Now().Unix()
-	m.errChan = make(chan error, 1)
 
-	log.Println("Proxy worker started in embedded mode")
+	log.Printf("Proxy worker %s started in embedded mode", m.name)
+	m.bus.Publish(events.WorkerStarted, events.WorkerEvent{
+		TunnelID:  config.TunnelID,
+		LocalPort: config.LocalPort,
+	})
 	return nil
 }
 
@@ -98,7 +130,7 @@ func (m *Manager) Stop() error {
 	defer m.mu.Unlock()
 
 	if !m.isRunning {
-		return fmt.Errorf("proxy worker is not running")
+		return errcode.New(errcode.WorkerNotRunning, "proxy worker is not running")
 	}
 
 	log.Println("Stopping proxy worker services...")
@@ -116,6 +148,7 @@ func (m *Manager) Stop() error {
 
 	// 清空服务列表
 	m.services = nil
+	m.unregister()
 
 	// 取消上下文，停止所有 goroutines
 	m.cancel()
@@ -126,10 +159,13 @@ func (m *Manager) Stop() error {
 	// 等待端口完全释放
 	time.Sleep(1 * time.Second)
 
+	tunnelID := m.config.TunnelID
 	m.isRunning = false
 	m.config = nil
+	m.tunnelState = ""
 
-	log.Println("Proxy worker stopped")
+	log.Printf("Proxy worker %s stopped", m.name)
+	m.bus.Publish(events.WorkerStopped, events.WorkerEvent{TunnelID: tunnelID})
 	return nil
 }
 
@@ -144,6 +180,10 @@ func (m *Manager) GetStatus() WorkerStatus {
 		StartTime: m.startTime,
 	}
 
+	if m.isRunning {
+		status.TunnelState = m.tunnelState
+		status.Traffic = m.totalTraffic()
+	}
 	if m.config != nil {
 		status.LocalPort = m.config.LocalPort
 		status.FixedPort = m.config.FixedPort
@@ -163,12 +203,24 @@ func (m *Manager) IsRunning() bool {
 
 // Restart 重启代理工作节点
 func (m *Manager) Restart() error {
+	return m.RestartWith(nil)
+}
+
+// RestartWith 与 Restart 相同，update 非空时在启动前用它修改之前的配置（如补全代理认证地址）
+func (m *Manager) RestartWith(update func(*ProxyWorkerConfig)) error {
 	m.mu.RLock()
-	config := m.config
+	var config *ProxyWorkerConfig
+	if m.config != nil {
+		c := *m.config
+		config = &c
+	}
 	m.mu.RUnlock()
 
 	if config == nil {
-		return fmt.Errorf("no configuration available for restart")
+		return errcode.New(errcode.WorkerNotRunning, "no configuration available for restart")
+	}
+	if update != nil {
+		update(config)
 	}
 
 	if err := m.Stop(); err != nil {
@@ -202,6 +254,9 @@ func (m *Manager) validateConfig(config *ProxyWorkerConfig) error {
 	if config.NatType == 1 && config.FixedPort <= 0 {
 		return fmt.Errorf("FixedPort is required for static IP")
 	}
+	if config.EnableAuth && config.AuthURL == "" {
+		return fmt.Errorf("AuthURL is required when EnableAuth is set")
+	}
 	return nil
 }
 
@@ -288,6 +343,20 @@ func (m *Manager) buildGostConfig(config *ProxyWorkerConfig) (*config.Config, er
 		}
 	}
 
+	// 代理认证：auto handler 通过 metadata 启用 ARO auther（见 vendor-x/handler/auto）
+	if config.EnableAuth {
+		for _, svc := range cfg.Services {
+			if svc.Handler != nil && svc.Handler.Type == "auto" {
+				if svc.Handler.Metadata == nil {
+					svc.Handler.Metadata = map[string]any{}
+				}
+				svc.Handler.Metadata["enableAroAuther"] = true
+				svc.Handler.Metadata["backUrl"] = config.AuthURL
+				svc.Handler.Metadata["cacheDir"] = authCacheDir(config)
+			}
+		}
+	}
+
 	// 调试：打印生成的配置（修复后）
 	log.Printf("DEBUG: serviceStrs = %v", serviceStrs)
 	log.Printf("DEBUG: nodeStrs = %v", nodeStrs)
@@ -310,12 +379,130 @@ func (m *Manager) buildGostConfig(config *ProxyWorkerConfig) (*config.Config, er
 	return cfg, nil
 }
 
-// startGostServices 启动 GOST 服务（从 registry 获取）
-func (m *Manager) startGostServices(lg logger.Logger) ([]interface{ Serve() error }, error) {
-	services := make([]interface{ Serve() error }, 0)
+// load 把 GOST 配置中的对象加上实例名前缀后注册到 registry，返回解析好的服务
+func (m *Manager) load(cfg *config.Config) ([]service.Service, error) {
+	// 与 gost_loader.Load 相同的全局设置，对所有实例一致
+	logger.SetDefault(logger_parser.ParseLogger(&config.LoggerConfig{Log: &config.LogConfig{}}))
+	tlsCfg, err := parsing.BuildDefaultTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	parsing.SetDefaultTLSConfig(tlsCfg)
 
-	// 从 registry 获取所有已注册的服务
-	for _, svc := range registry.ServiceRegistry().GetAll() {
+	m.namespace(cfg)
+
+	// 服务解析时按名称引用 observer，需要先注册
+	obsName := m.observerName()
+	registry.ObserverRegistry().Unregister(obsName)
+	if err := registry.ObserverRegistry().Register(obsName, &workerObserver{m: m}); err != nil {
+		return nil, fmt.Errorf("failed to register observer: %w", err)
+	}
+
+	for _, hopCfg := range cfg.Hops {
+		hop, err := hop_parser.ParseHop(hopCfg, logger.Default())
+		if err != nil {
+			return nil, err
+		}
+		registry.HopRegistry().Unregister(hopCfg.Name)
+		if err := registry.HopRegistry().Register(hopCfg.Name, hop); err != nil {
+			return nil, err
+		}
+		m.registeredHops = append(m.registeredHops, hopCfg.Name)
+	}
+
+	for _, chainCfg := range cfg.Chains {
+		c, err := chain_parser.ParseChain(chainCfg, logger.Default())
+		if err != nil {
+			return nil, err
+		}
+		registry.ChainRegistry().Unregister(chainCfg.Name)
+		if err := registry.ChainRegistry().Register(chainCfg.Name, c); err != nil {
+			return nil, err
+		}
+		m.registeredChains = append(m.registeredChains, chainCfg.Name)
+	}
+
+	services := make([]service.Service, 0, len(cfg.Services))
+	for _, svcCfg := range cfg.Services {
+		svc, err := service_parser.ParseService(svcCfg)
+		if err != nil {
+			for _, s := range services {
+				s.Close()
+			}
+			return nil, err
+		}
+		if svc != nil {
+			services = append(services, svc)
+		}
+	}
+	return services, nil
+}
+
+// namespace 给服务、chain、hop 名称加上实例名前缀，并同步更新引用
+func (m *Manager) namespace(cfg *config.Config) {
+	prefix := m.name + "-"
+	rename := func(name string) string {
+		if name == "" {
+			return ""
+		}
+		return prefix + name
+	}
+
+	for _, hop := range cfg.Hops {
+		hop.Name = rename(hop.Name)
+	}
+	for _, chain := range cfg.Chains {
+		chain.Name = rename(chain.Name)
+		for _, hop := range chain.Hops {
+			hop.Name = rename(hop.Name)
+		}
+	}
+	for _, svc := range cfg.Services {
+		svc.Name = rename(svc.Name)
+		// 所有服务的状态事件都交给本实例的 workerObserver 处理
+		svc.Observer = m.observerName()
+		// 代理服务开启流量统计，由 observer 定期上报
+		if svc.Listener == nil || svc.Listener.Type != "rtcp" {
+			if svc.Metadata == nil {
+				svc.Metadata = make(map[string]any)
+			}
+			svc.Metadata[parsing.MDKeyEnableStats] = true
+			svc.Metadata[parsing.MDKeyObserverPeriod] = statsPeriod
+		}
+		if svc.Handler != nil {
+			svc.Handler.Chain = rename(svc.Handler.Chain)
+		}
+		if svc.Listener != nil {
+			svc.Listener.Chain = rename(svc.Listener.Chain)
+		}
+		if svc.Forwarder != nil {
+			svc.Forwarder.Hop = rename(svc.Forwarder.Hop)
+		}
+	}
+}
+
+// unregister 注销本实例注册的 chains、hops 和 observer
+func (m *Manager) unregister() {
+	for _, name := range m.registeredChains {
+		registry.ChainRegistry().Unregister(name)
+	}
+	for _, name := range m.registeredHops {
+		registry.HopRegistry().Unregister(name)
+	}
+	registry.ObserverRegistry().Unregister(m.observerName())
+	m.registeredChains = nil
+	m.registeredHops = nil
+}
+
+func (m *Manager) observerName() string {
+	return observerName + "-" + m.name
+}
+
+// startGostServices 在单独的 goroutine 中启动本实例的服务
+func (m *Manager) startGostServices(svcs []service.Service) []interface{ Serve() error } {
+	services := make([]interface{ Serve() error }, 0, len(svcs))
+
+	for _, svc := range svcs {
 		svc := svc // 捕获循环变量
 		services = append(services, svc)
 
@@ -323,6 +510,10 @@ func (m *Manager) startGostServices(lg logger.Logger) ([]interface{ Serve() erro
 		go func() {
 			if err := svc.Serve(); err != nil {
 				log.Printf("Service error: %v", err)
+				// Stop 关闭服务时 Serve 返回 net.ErrClosed，不属于崩溃
+				if !errors.Is(err, net.ErrClosed) {
+					m.bus.Publish(events.WorkerCrashed, events.WorkerEvent{Error: err.Error()})
+				}
 				select {
 				case m.errChan <- err:
 				default:
@@ -331,6 +522,6 @@ func (m *Manager) startGostServices(lg logger.Logger) ([]interface{ Serve() erro
 		}()
 	}
 
-	log.Printf("Started %d services from registry", len(services))
-	return services, nil
+	log.Printf("Started %d services for worker %s", len(services), m.name)
+	return services
 }
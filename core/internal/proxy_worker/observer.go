@@ -0,0 +1,119 @@
+package proxy_worker
+
+import (
+	"context"
+	"log"
+
+	"aro-ext-app/core/internal/events"
+
+	"github.com/go-gost/core/observer"
+	xstats "github.com/go-gost/x/observer/stats"
+	xservice "github.com/go-gost/x/service"
+)
+
+// observerName 注册到 GOST observer registry 的名称前缀，加上实例名后每个 Manager 一个 observer
+const observerName = "aro-worker"
+
+// statsPeriod 代理服务上报流量统计的间隔
+const statsPeriod = "5s"
+
+// 隧道状态
+const (
+	TunnelStateConnecting   = "connecting"
+	TunnelStateConnected    = "connected"
+	TunnelStateDisconnected = "disconnected"
+)
+
+// workerObserver 接收 GOST 服务的状态事件，转换为隧道连接事件发布到事件总线；
+// 同时接收代理服务的流量统计事件
+//
+// rtcp 服务在 Accept 中通过 chain 建立反向隧道：建立失败时服务进入 failed 状态并重试，
+// 恢复后（接受到第一个连接）重新进入 ready 状态，因此 rtcp 服务的状态即隧道状态
+type workerObserver struct {
+	m *Manager
+}
+
+// Observe 实现 observer.Observer 接口
+func (o *workerObserver) Observe(ctx context.Context, evs []observer.Event, opts ...observer.Option) error {
+	for _, e := range evs {
+		switch ev := e.(type) {
+		case xservice.ServiceEvent:
+			o.m.handleServiceEvent(ev)
+		case xstats.StatsEvent:
+			o.m.handleStatsEvent(ev)
+		}
+	}
+	return nil
+}
+
+// handleServiceEvent 处理服务状态变化，只关心隧道（rtcp）服务
+// 服务创建时的 running 状态在 Start 持有 m.mu 期间同步上报，必须在加锁前忽略，否则死锁
+func (m *Manager) handleServiceEvent(ev xservice.ServiceEvent) {
+	var state string
+	switch ev.State {
+	case xservice.StateReady:
+		state = TunnelStateConnected
+	case xservice.StateFailed, xservice.StateClosed:
+		state = TunnelStateDisconnected
+	default:
+		return
+	}
+
+	m.mu.Lock()
+	if !m.tunnelServices[ev.Service] {
+		m.mu.Unlock()
+		return
+	}
+
+	// failed 状态在每次重试时都会上报，只在状态真正变化时发布事件
+	if state == m.tunnelState {
+		m.mu.Unlock()
+		return
+	}
+	m.tunnelState = state
+	tunnelID := ""
+	if m.config != nil {
+		tunnelID = m.config.TunnelID
+	}
+	m.mu.Unlock()
+
+	log.Printf("Tunnel %s: %s", state, ev.Msg)
+	typ := events.TunnelConnected
+	if state == TunnelStateDisconnected {
+		typ = events.TunnelDisconnected
+	}
+	m.bus.Publish(typ, events.TunnelEvent{
+		TunnelID: tunnelID,
+		Service:  ev.Service,
+		Message:  ev.Msg,
+	})
+}
+
+// handleStatsEvent 记录代理服务的最新累计流量，隧道服务转发的是同一份流量，不重复统计
+func (m *Manager) handleStatsEvent(ev xstats.StatsEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.traffic == nil || m.tunnelServices[ev.Service] {
+		return
+	}
+	m.traffic[ev.Service] = Traffic{
+		TotalConns:   ev.TotalConns,
+		CurrentConns: ev.CurrentConns,
+		InputBytes:   ev.InputBytes,
+		OutputBytes:  ev.OutputBytes,
+		TotalErrs:    ev.TotalErrs,
+	}
+}
+
+// totalTraffic 汇总所有代理服务的流量，调用方持有 m.mu
+func (m *Manager) totalTraffic() Traffic {
+	var total Traffic
+	for _, t := range m.traffic {
+		total.TotalConns += t.TotalConns
+		total.CurrentConns += t.CurrentConns
+		total.InputBytes += t.InputBytes
+		total.OutputBytes += t.OutputBytes
+		total.TotalErrs += t.TotalErrs
+	}
+	return total
+}
@@ -1,5 +1,7 @@
 package proxy_worker
 
+import "aro-ext-app/core/internal/datadir"
+
 // ProxyWorkerConfig 代理工作节点配置
 type ProxyWorkerConfig struct {
 	SN              string `json:"sn"`
@@ -14,6 +16,26 @@ type ProxyWorkerConfig struct {
 	DisableTLS bool   `json:"disable_tls"` // 是否禁用 TLS，默认 false（即默认使用 wss）
 	TLSSecure  bool   `json:"tls_secure"`  // 是否验证服务器证书，默认 false（跳过验证）
 	ServerName string `json:"server_name"` // TLS ServerName，用于证书验证，为空时使用 ProxyServerIP
+	// 代理认证：启用后本地代理服务通过后端的代理认证接口（ARO auther）校验客户端
+	EnableAuth bool   `json:"enable_auth"`
+	AuthURL    string `json:"auth_url,omitempty"` // 代理认证接口地址，调用方为空时填入环境的地址（PROXY_AUTH_URL）
+	// AuthCacheDir 代理认证缓存（aro_auth_cache.enc）的目录，为空时使用数据目录
+	AuthCacheDir string `json:"auth_cache_dir,omitempty"`
+}
+
+// authCacheDir 返回代理认证缓存的目录
+func authCacheDir(c *ProxyWorkerConfig) string {
+	if c.AuthCacheDir != "" {
+		return c.AuthCacheDir
+	}
+	return datadir.Get()
+}
+
+// ApplyProfile 启用代理认证且未指定地址时使用 authURL（当前环境的 PROXY_AUTH_URL）
+func (c *ProxyWorkerConfig) ApplyProfile(authURL string) {
+	if c.EnableAuth && c.AuthURL == "" {
+		c.AuthURL = authURL
+	}
 }
 
 // WorkerStatus 工作节点状态
@@ -24,5 +46,18 @@ type WorkerStatus struct {
 	FixedPort int    `json:"fixed_port"`
 	TunnelID  string `json:"tunnel_id"`
 	StartTime int64  `json:"start_time"`
-	Error     string `json:"error,omitempty"`
+	// TunnelState 隧道状态: connecting, connected, disconnected（未运行时为空）
+	TunnelState string `json:"tunnel_state,omitempty"`
+	// Traffic 本次启动以来代理服务的流量统计
+	Traffic Traffic `json:"traffic"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// Traffic 代理流量计数，worker 每次启动时清零
+type Traffic struct {
+	TotalConns   uint64 `json:"total_conns"`
+	CurrentConns uint64 `json:"current_conns"`
+	InputBytes   uint64 `json:"input_bytes"`
+	OutputBytes  uint64 `json:"output_bytes"`
+	TotalErrs    uint64 `json:"total_errs"`
 }
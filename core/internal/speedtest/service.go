@@ -1,16 +1,30 @@
 package speedtest
 
 import (
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/clock"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/events"
 	"context"
 	"encoding/json"
-	"enreach-agent/database/model"
+	"fmt"
 	"log"
 	"sync"
 	"time"
 )
 
-// Service manages bandwidth test execution
+// Service manages bandwidth test execution for one node
 type Service struct {
+	// Config provides the speedtest limits, the serial number and the backend
+	// public key of the node's profile
+	Config *config.Config
+	// Events receives task.received and task.completed events
+	Events *events.Bus
+	// Clock checks task expiry against server time
+	Clock *clock.Clock
+	// Transport carries the uploads; nil uses a transport configured from Config
+	Transport *api_client.Transport
+
 	mu       sync.Mutex
 	running  bool
 	uploader *Uploader
@@ -21,21 +35,47 @@ var (
 	serviceOnce     sync.Once
 )
 
-// GetService returns the singleton Service instance
+// NewService creates a Service that uses a node's config, event bus and clock
+func NewService(cfg *config.Config, bus *events.Bus, clk *clock.Clock) *Service {
+	return &Service{Config: cfg, Events: bus, Clock: clk}
+}
+
+// GetService returns the process-wide Service, which uses the global config,
+// event bus and clock
 func GetService() *Service {
 	serviceOnce.Do(func() {
-		serviceInstance = &Service{}
+		serviceInstance = NewService(config.GetConfig(), events.GetBus(), clock.GetClock())
 	})
 	return serviceInstance
 }
 
 // HandleTask processes a bandwidth test task from gRPC message
 func (s *Service) HandleTask(message string) {
+	// Parse task
+	var task BandwidthTestTask
+	if err := json.Unmarshal([]byte(message), &task); err != nil {
+		log.Printf("Failed to parse bandwidth test task: %v", err)
+		return
+	}
+
+	result, err := s.RunTask(&task)
+	if err != nil {
+		log.Printf("Bandwidth test failed: %v", err)
+		return
+	}
+
+	// Log result
+	throughput := result.CalculateThroughput()
+	log.Printf("Bandwidth test result: test_id=%s, throughput=%.2f Mbps, total_bytes=%d, duration=%v, success=%v",
+		result.TestID, throughput, result.TotalBytes, result.Duration, result.Success)
+}
+
+// RunTask validates and runs a bandwidth test task, blocking until it finishes
+func (s *Service) RunTask(task *BandwidthTestTask) (*TestResult, error) {
 	s.mu.Lock()
 	if s.running {
 		s.mu.Unlock()
-		log.Printf("Bandwidth test already running, skipping new task")
-		return
+		return nil, fmt.Errorf("bandwidth test already running")
 	}
 	s.running = true
 	s.mu.Unlock()
@@ -47,17 +87,16 @@ func (s *Service) HandleTask(message string) {
 		s.mu.Unlock()
 	}()
 
-	// Parse task
-	var task model.BandwidthTestTask
-	if err := json.Unmarshal([]byte(message), &task); err != nil {
-		log.Printf("Failed to parse bandwidth test task: %v", err)
-		return
-	}
+	s.Events.Publish(events.TaskReceived, events.TaskEvent{Kind: "bandwidth_test", TaskID: task.TestID})
+	completed := events.TaskEvent{Kind: "bandwidth_test", TaskID: task.TestID}
+	defer func() {
+		s.Events.Publish(events.TaskCompleted, completed)
+	}()
 
 	// Validate task
-	if err := s.validateTask(&task); err != nil {
-		log.Printf("Invalid bandwidth test task: %v", err)
-		return
+	if err := s.validateTask(task); err != nil {
+		completed.Error = err.Error()
+		return nil, fmt.Errorf("invalid bandwidth test task: %w", err)
 	}
 
 	log.Printf("Starting bandwidth test: test_id=%s, checker=%s:%d, concurrency=%d, chunks_per_stream=%d",
@@ -65,26 +104,35 @@ func (s *Service) HandleTask(message string) {
 		task.Challenge.Concurrency, task.Challenge.PerStreamTotalChunks)
 
 	// Create uploader
-	s.uploader = NewUploader(&task)
+	bearerToken, err := api_client.GenerateBearerToken(s.Config)
+	if err != nil {
+		completed.Error = err.Error()
+		return nil, fmt.Errorf("failed to generate bearer token: %w", err)
+	}
+	transport := s.Transport
+	if transport == nil {
+		transport = api_client.NewTransport(api_client.RetryPolicyFromConfig(s.Config))
+	}
+	uploader := NewUploader(task, bearerToken, s.Clock, transport)
+	s.mu.Lock()
+	s.uploader = uploader
+	s.mu.Unlock()
 
 	// Run test with context
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(task.Challenge.DurationMs+10000)*time.Millisecond)
 	defer cancel()
 
-	result, err := s.uploader.Run(ctx)
+	result, err := uploader.Run(ctx)
 	if err != nil {
-		log.Printf("Bandwidth test failed: %v", err)
-		return
+		completed.Error = err.Error()
+		return nil, err
 	}
-
-	// Log result
-	throughput := result.CalculateThroughput()
-	log.Printf("Bandwidth test result: test_id=%s, throughput=%.2f Mbps, total_bytes=%d, duration=%v, success=%v",
-		result.TestID, throughput, result.TotalBytes, result.Duration, result.Success)
+	completed.Success = result.Success
+	return result, nil
 }
 
 // validateTask validates the bandwidth test task
-func (s *Service) validateTask(task *model.BandwidthTestTask) error {
+func (s *Service) validateTask(task *BandwidthTestTask) error {
 	if task.TestID == "" {
 		return &ValidationError{Field: "test_id", Message: "test_id is required"}
 	}
@@ -109,7 +157,14 @@ func (s *Service) validateTask(task *model.BandwidthTestTask) error {
 	if task.Challenge.PerStreamTotalChunks <= 0 {
 		return &ValidationError{Field: "challenge.per_stream_total_chunks", Message: "per_stream_total_chunks must be positive"}
 	}
-	if task.Challenge.ExpiresAt > 0 && time.Now().Unix() > task.Challenge.ExpiresAt {
+	limits, _ := s.Config.Settings()
+	if max := limits.Speedtest.MaxDuration * 1000; task.Challenge.DurationMs > max {
+		return &ValidationError{Field: "challenge.duration_ms", Message: fmt.Sprintf("duration_ms must not exceed %d (speedtest.max_duration)", max)}
+	}
+	if max := limits.Speedtest.MaxConcurrency; task.Challenge.Concurrency > max {
+		return &ValidationError{Field: "challenge.concurrency", Message: fmt.Sprintf("concurrency must not exceed %d (speedtest.max_concurrency)", max)}
+	}
+	if task.Challenge.ExpiresAt > 0 && s.Clock.Now().Unix() > task.Challenge.ExpiresAt {
 		return &ValidationError{Field: "challenge.expires_at", Message: "task has expired"}
 	}
 	return nil
@@ -1,4 +1,4 @@
-package model
+package speedtest
 
 // BandwidthTestTask represents the bandwidth test task from scheduler
 type BandwidthTestTask struct {
@@ -3,30 +3,38 @@ package speedtest
 import (
 	"bytes"
 	"context"
-	"enreach-agent/constant"
-	"enreach-agent/util"
-	"enreach-agent/database/model"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"sync"
 	"time"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/clock"
 )
 
 // Uploader handles concurrent chunk uploads for bandwidth test
-	task       *model.BandwidthTestTask
-	httpClient *http.Client
-	mu         sync.Mutex
-	running    bool
+type Uploader struct {
+	task        *BandwidthTestTask
+	bearerToken string
+	clock       *clock.Clock
+	httpClient  *http.Client
+	mu          sync.Mutex
+	running     bool
 }
 
-// NewUploader creates a new Uploader instance
-func NewUploader(task *model.BandwidthTestTask) *Uploader {
+// NewUploader creates a new Uploader instance; bearerToken authenticates the
+// uploads (see api_client.GenerateBearerToken), clk checks the task expiry and
+// the uploads go through transport's circuit breaker
+func NewUploader(task *BandwidthTestTask, bearerToken string, clk *clock.Clock, transport *api_client.Transport) *Uploader {
 	return &Uploader{
-		task: task,
+		task:        task,
+		bearerToken: bearerToken,
+		clock:       clk,
 		httpClient: &http.Client{
-			Timeout: time.Duration(task.Challenge.DurationMs+5000) * time.Millisecond,
+			Transport: transport,
+			Timeout:   time.Duration(task.Challenge.DurationMs+5000) * time.Millisecond,
 		},
 	}
 }
@@ -67,8 +75,8 @@ func (u *Uploader) Run(ctx context.Context) (*TestResult, error) {
 		u.mu.Unlock()
 	}()
 
-	// Check if task is expired
-	if time.Now().Unix() > u.task.Challenge.ExpiresAt {
+	// Check if task is expired; ExpiresAt is in server time
+	if u.clock.Now().Unix() > u.task.Challenge.ExpiresAt {
 		return nil, fmt.Errorf("bandwidth test task expired")
 	}
 
@@ -90,7 +98,7 @@ func (u *Uploader) Run(ctx context.Context) (*TestResult, error) {
 		wg.Add(1)
 		go func(sid int) {
 			defer wg.Done()
-			defer util.RecoverFromPanic()
+			defer recoverFromPanic()
 			result := u.uploadStream(testCtx, sid)
 			resultChan <- result
 		}(streamID)
@@ -156,20 +164,13 @@ func (u *Uploader) uploadStream(ctx context.Context, streamID int) StreamResult
 		streamID,
 	)
 
-	// Generate bearer token
-	bearerToken, err := util.GenerateBearerToken(constant.SERIAL_NUMBER)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to generate bearer token: %w", err)
-		return result
-	}
-
 	// Create pipe for streaming upload
 	pr, pw := io.Pipe()
 
 	// Start goroutine to write chunks to pipe
 	go func() {
 		defer pw.Close()
-		defer util.RecoverFromPanic()
+		defer recoverFromPanic()
 
 		totalChunks := u.task.Challenge.PerStreamTotalChunks
 		for seq := 0; seq < totalChunks; seq++ {
@@ -198,7 +199,7 @@ func (u *Uploader) uploadStream(ctx context.Context, streamID int) StreamResult
 	}
 
 	req.Header.Set("Content-Type", "application/octet-stream")
-	req.Header.Set("Authorization", "Bearer "+bearerToken)
+	req.Header.Set("Authorization", "Bearer "+u.bearerToken)
 
 	// Send request
 	resp, err := u.httpClient.Do(req)
@@ -274,3 +275,10 @@ func (w *chunkWriter) Read(p []byte) (n int, err error) {
 
 	return w.buffer.Read(p)
 }
+
+// recoverFromPanic logs a panic in an upload goroutine instead of crashing the host app
+func recoverFromPanic() {
+	if r := recover(); r != nil {
+		log.Printf("Bandwidth test goroutine panic: %v", r)
+	}
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrReadOnly 在只读事务（View）中写入
+var ErrReadOnly = errors.New("storage: write in a read-only transaction")
+
+// Tx 一个事务中的读写，值以 JSON 保存，按 bucket 分组
+// Update 的回调返回错误时事务中的写入全部丢弃
+type Tx interface {
+	// Get 把 bucket 中 key 的值解码到 v，key 不存在时返回 false
+	Get(bucket, key string, v any) (bool, error)
+	// Put 把 v 编码为 JSON 写入 bucket 中的 key
+	Put(bucket, key string, v any) error
+	// Delete 删除 bucket 中的 key，key 不存在时无效果
+	Delete(bucket, key string) error
+	// Keys 返回 bucket 中按字母顺序排列的 key
+	Keys(bucket string) []string
+	// Buckets 返回所有非空的 bucket
+	Buckets() []string
+}
+
+// Backend 事务型键值存储
+// MemoryBackend 只保存在内存中，用于测试；FileBackend 保存在追加写入的 JSON 日志中
+type Backend interface {
+	// View 执行只读事务
+	View(fn func(Tx) error) error
+	// Update 执行读写事务，fn 返回 nil 时原子地提交所有写入
+	Update(fn func(Tx) error) error
+	Close() error
+}
+
+// data bucket -> key -> JSON 值
+type data map[string]map[string]json.RawMessage
+
+// op 事务中的一次写入，Value 为空表示删除；也是 FileBackend 日志记录的格式
+type op struct {
+	Bucket string          `json:"b"`
+	Key    string          `json:"k"`
+	Value  json.RawMessage `json:"v,omitempty"`
+}
+
+// apply 把写入应用到 d
+func (d data) apply(ops []op) {
+	for _, o := range ops {
+		if o.Value == nil {
+			if b := d[o.Bucket]; b != nil {
+				delete(b, o.Key)
+				if len(b) == 0 {
+					delete(d, o.Bucket)
+				}
+			}
+			continue
+		}
+		b := d[o.Bucket]
+		if b == nil {
+			b = make(map[string]json.RawMessage)
+			d[o.Bucket] = b
+		}
+		b[o.Key] = o.Value
+	}
+}
+
+// tx 在 base 之上记录写入，提交前 base 不变
+type tx struct {
+	base     data
+	writable bool
+	ops      []op
+	// pending 本事务写入后的值，nil 表示已删除
+	pending map[string]map[string]json.RawMessage
+}
+
+func newTx(base data, writable bool) *tx {
+	return &tx{base: base, writable: writable, pending: make(map[string]map[string]json.RawMessage)}
+}
+
+func (t *tx) lookup(bucket, key string) (json.RawMessage, bool) {
+	if b, ok := t.pending[bucket]; ok {
+		if v, ok := b[key]; ok {
+			return v, v != nil
+		}
+	}
+	v, ok := t.base[bucket][key]
+	return v, ok
+}
+
+func (t *tx) Get(bucket, key string, v any) (bool, error) {
+	raw, ok := t.lookup(bucket, key)
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+func (t *tx) write(bucket, key string, raw json.RawMessage) error {
+	if !t.writable {
+		return ErrReadOnly
+	}
+	b := t.pending[bucket]
+	if b == nil {
+		b = make(map[string]json.RawMessage)
+		t.pending[bucket] = b
+	}
+	b[key] = raw
+	t.ops = append(t.ops, op{Bucket: bucket, Key: key, Value: raw})
+	return nil
+}
+
+func (t *tx) Put(bucket, key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return t.write(bucket, key, raw)
+}
+
+func (t *tx) Delete(bucket, key string) error {
+	if _, ok := t.lookup(bucket, key); !ok {
+		return nil
+	}
+	return t.write(bucket, key, nil)
+}
+
+func (t *tx) Keys(bucket string) []string {
+	var keys []string
+	for key := range t.base[bucket] {
+		if _, ok := t.lookup(bucket, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	for key, v := range t.pending[bucket] {
+		if _, inBase := t.base[bucket][key]; !inBase && v != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (t *tx) Buckets() []string {
+	seen := make(map[string]bool)
+	var buckets []string
+	for _, m := range []map[string]map[string]json.RawMessage{t.base, t.pending} {
+		for bucket := range m {
+			if !seen[bucket] && len(t.Keys(bucket)) > 0 {
+				seen[bucket] = true
+				buckets = append(buckets, bucket)
+			}
+		}
+	}
+	sort.Strings(buckets)
+	return buckets
+}
+
+// MemoryBackend 内存中的 Backend，进程退出后数据丢失
+type MemoryBackend struct {
+	mu   sync.RWMutex
+	data data
+}
+
+// NewMemoryBackend 创建空的内存存储
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{data: make(data)}
+}
+
+func (m *MemoryBackend) View(fn func(Tx) error) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return fn(newTx(m.data, false))
+}
+
+func (m *MemoryBackend) Update(fn func(Tx) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := newTx(m.data, true)
+	if err := fn(t); err != nil {
+		return err
+	}
+	m.data.apply(t.ops)
+	return nil
+}
+
+func (m *MemoryBackend) Close() error {
+	return nil
+}
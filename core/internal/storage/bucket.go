@@ -0,0 +1,103 @@
+package storage
+
+import "fmt"
+
+// Bucket 值类型为 T 的 bucket，在事务中按类型读写
+type Bucket[T any] struct {
+	Name string
+}
+
+// NewBucket 创建名为 name 的类型化 bucket
+func NewBucket[T any](name string) Bucket[T] {
+	return Bucket[T]{Name: name}
+}
+
+// Get 读取 key，不存在时返回零值和 false
+func (b Bucket[T]) Get(tx Tx, key string) (T, bool, error) {
+	var v T
+	ok, err := tx.Get(b.Name, key, &v)
+	return v, ok, err
+}
+
+// Put 写入 key
+func (b Bucket[T]) Put(tx Tx, key string, v T) error {
+	return tx.Put(b.Name, key, v)
+}
+
+// Delete 删除 key
+func (b Bucket[T]) Delete(tx Tx, key string) error {
+	return tx.Delete(b.Name, key)
+}
+
+// Keys 返回所有 key
+func (b Bucket[T]) Keys(tx Tx) []string {
+	return tx.Keys(b.Name)
+}
+
+// Storage 使用的 bucket
+var (
+	// Values Set / Get 读写的通用值
+	Values = NewBucket[any]("values")
+	// BindInfos 节点绑定的用户信息，当前节点的保存在 currentKey
+	BindInfos = NewBucket[BindInfo]("bind_info")
+	// NodeInfos 节点信息，当前节点的保存在 currentKey
+	NodeInfos = NewBucket[NodeInfo]("node_info")
+
+	// meta 存储自身的元数据（schema 版本），Clear 不删除
+	meta = NewBucket[int]("meta")
+)
+
+// currentKey 当前节点在 BindInfos、NodeInfos 中的 key
+const currentKey = "current"
+
+// schemaVersionKey meta 中保存 schema 版本的 key
+const schemaVersionKey = "schema_version"
+
+// Migration 把存储从 Version-1 升级到 Version 的迁移，在一个事务中执行
+type Migration struct {
+	Version int
+	Name    string
+	Apply   func(Tx) error
+}
+
+// migrations 按版本排列的迁移，修改 bucket 或值的格式时追加，不要修改已发布的迁移
+var migrations = []Migration{
+	{Version: 1, Name: "initial schema: values, bind_info and node_info buckets"},
+}
+
+// SchemaVersion 当前代码的 schema 版本
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// migrate 依次执行未执行的迁移；存储由更新的版本写入（版本高于 SchemaVersion）时返回错误，避免旧代码破坏数据
+func migrate(b Backend, list []Migration) error {
+	var current int
+	if err := b.View(func(tx Tx) error {
+		v, _, err := meta.Get(tx, schemaVersionKey)
+		current = v
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to read the storage schema version: %w", err)
+	}
+	if latest := list[len(list)-1].Version; current > latest {
+		return fmt.Errorf("storage schema version %d is newer than supported version %d", current, latest)
+	}
+	for _, m := range list {
+		if m.Version <= current {
+			continue
+		}
+		err := b.Update(func(tx Tx) error {
+			if m.Apply != nil {
+				if err := m.Apply(tx); err != nil {
+					return err
+				}
+			}
+			return meta.Put(tx, schemaVersionKey, m.Version)
+		})
+		if err != nil {
+			return fmt.Errorf("storage migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"aro-ext-app/core/internal/fsutil"
+)
+
+// DefaultCompactAfter FileBackend 在追加这么多条事务记录后压缩日志
+const DefaultCompactAfter = 1000
+
+// record 日志中的一行：一个已提交的事务
+type record struct {
+	Ops []op `json:"ops"`
+}
+
+// FileBackend 保存在追加写入的 JSON 日志（每行一个已提交的事务）中的 Backend
+//
+// 每次提交追加一行并 fsync，崩溃时最多丢失未写完的最后一行，打开时忽略它；
+// 记录数超过 CompactAfter 后把当前数据写成一条记录，通过 fsutil.WriteFile 原子地替换日志
+// 提交时持有进程间文件锁 path.lock，并先读入其他进程追加的记录，共用数据目录的进程看到一致的数据
+type FileBackend struct {
+	// CompactAfter 追加多少条记录后压缩日志，<= 0 时使用 DefaultCompactAfter
+	CompactAfter int
+
+	mu      sync.RWMutex
+	path    string
+	data    data
+	info    os.FileInfo // 已读入的日志文件，被压缩替换后需要重新读取
+	offset  int64       // 已读入的完整记录的长度
+	records int         // 日志中的记录数
+}
+
+// OpenFileBackend 打开 path 上的日志，不存在时创建
+func OpenFileBackend(path string) (*FileBackend, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create the storage dir: %w", err)
+	}
+	b := &FileBackend{path: path, data: make(data)}
+	lock, err := fsutil.LockFile(path + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+	if err := b.refresh(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// refresh 读入其他进程追加的记录，日志被压缩替换后重新读取整个文件，调用方持有 b.mu 和文件锁
+func (b *FileBackend) refresh() error {
+	info, err := os.Stat(b.path)
+	if os.IsNotExist(err) {
+		f, err := os.OpenFile(b.path, os.O_WRONLY|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		f.Close()
+		if info, err = os.Stat(b.path); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	if b.info == nil || !os.SameFile(b.info, info) || info.Size() < b.offset {
+		b.data, b.offset, b.records = make(data), 0, 0
+	}
+	b.info = info
+	if info.Size() == b.offset {
+		return nil
+	}
+
+	f, err := os.Open(b.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(b.offset, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// 没有换行的最后一行是崩溃时未写完的记录，下次提交前截掉
+			if len(line) > 0 {
+				log.Printf("Ignoring an incomplete record at the end of %s", b.path)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var rec record
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			log.Printf("Ignoring %s from offset %d: corrupted record: %v", b.path, b.offset, err)
+			return nil
+		}
+		b.data.apply(rec.Ops)
+		b.offset += int64(len(line))
+		b.records++
+	}
+}
+
+func (b *FileBackend) View(fn func(Tx) error) error {
+	b.mu.Lock()
+	lock, err := fsutil.LockFile(b.path + ".lock")
+	if err == nil {
+		err = b.refresh()
+		lock.Unlock()
+	}
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return fn(newTx(b.data, false))
+}
+
+func (b *FileBackend) Update(fn func(Tx) error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lock, err := fsutil.LockFile(b.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err := b.refresh(); err != nil {
+		return err
+	}
+
+	t := newTx(b.data, true)
+	if err := fn(t); err != nil {
+		return err
+	}
+	if len(t.ops) == 0 {
+		return nil
+	}
+	if err := b.append(record{Ops: t.ops}); err != nil {
+		return err
+	}
+	b.data.apply(t.ops)
+	if limit := b.compactAfter(); b.records > limit {
+		if err := b.compact(); err != nil {
+			log.Printf("Failed to compact %s: %v", b.path, err)
+		}
+	}
+	return nil
+}
+
+func (b *FileBackend) compactAfter() int {
+	if b.CompactAfter > 0 {
+		return b.CompactAfter
+	}
+	return DefaultCompactAfter
+}
+
+// append 在日志末尾追加一条记录并同步到磁盘，先截掉未写完或损坏的尾部
+func (b *FileBackend) append(rec record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	f, err := os.OpenFile(b.path, os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if b.info.Size() > b.offset {
+		if err := f.Truncate(b.offset); err != nil {
+			return err
+		}
+	}
+	if _, err := f.WriteAt(line, b.offset); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	b.offset += int64(len(line))
+	b.records++
+	b.info, err = f.Stat()
+	return err
+}
+
+// compact 把当前数据写成一条记录替换日志
+func (b *FileBackend) compact() error {
+	var ops []op
+	for bucket, keys := range b.data {
+		for key, value := range keys {
+			ops = append(ops, op{Bucket: bucket, Key: key, Value: value})
+		}
+	}
+	line, err := json.Marshal(record{Ops: ops})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if err := fsutil.WriteFile(b.path, line, 0600); err != nil {
+		return err
+	}
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return err
+	}
+	b.info, b.offset, b.records = info, int64(len(line)), 1
+	return nil
+}
+
+func (b *FileBackend) Close() error {
+	return nil
+}
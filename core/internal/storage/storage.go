@@ -1,8 +1,10 @@
 package storage
 
 import (
-	"encoding/json"
+	"log"
 	"sync"
+
+	"aro-ext-app/core/internal/errcode"
 )
 
 // UserInfo 用户信息
@@ -20,9 +22,8 @@ type BindUser struct {
 
 // NodeInfo 节点信息
 type NodeInfo struct {
-	NodeID     string `json:"nodeId"`
-	PrivateKey string `json:"privateKey"`
-	PublicKey  string `json:"publicKey"`
+	NodeID    string `json:"nodeId"`
+	PublicKey string `json:"publicKey"`
 }
 
 // ConnectStatus 连接状态
@@ -35,10 +36,27 @@ const (
 	StatusForbidden  ConnectStatus = "forbidden"
 )
 
+// ConnectStatusOf 返回心跳结果对应的连接状态：成功为 connected，后端拒绝节点凭证为 forbidden，
+// 其他失败为 connecting（心跳继续重试）
+func ConnectStatusOf(err error) ConnectStatus {
+	switch {
+	case err == nil:
+		return StatusConnected
+	case errcode.Of(err) == errcode.AuthFailed:
+		return StatusForbidden
+	default:
+		return StatusConnecting
+	}
+}
+
+// FileName 持久化存储在节点身份目录中的文件名
+const FileName = "storage.jsonl"
+
 // Storage 本地存储管理
+// New 创建的存储只在内存中，Open 创建的存储保存在文件中（见 FileBackend），重启后保留
 type Storage struct {
-	mu   sync.RWMutex
-	data map[string]interface{}
+	mu      sync.RWMutex
+	backend Backend
 }
 
 // 全局单例变量和初始化锁
@@ -48,28 +66,99 @@ var (
 )
 
 // GetStorage 获取全局 Storage 单例实例
-// 使用 sync.Once 确保只初始化一次，线程安全
+// 使用 sync.Once 确保只初始化一次，线程安全；InitLibstudy 通过 Attach 把它切换到数据目录中的文件
 func GetStorage() *Storage {
 	once.Do(func() {
-		instance = &Storage{
-			data: make(map[string]interface{}),
-		}
+		instance = New()
 	})
 	return instance
 }
 
-// Set 设置值
-func (s *Storage) Set(key string, value interface{}) {
+// New 创建独立的内存 Storage 实例，用于测试
+func New() *Storage {
+	s, _ := NewWithBackend(NewMemoryBackend())
+	return s
+}
+
+// Open 打开 path 上的持久化 Storage，执行未执行的 schema 迁移
+func Open(path string) (*Storage, error) {
+	b, err := OpenFileBackend(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewWithBackend(b)
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewWithBackend 使用 b 创建 Storage，执行未执行的 schema 迁移
+func NewWithBackend(b Backend) (*Storage, error) {
+	if err := migrate(b, migrations); err != nil {
+		return nil, err
+	}
+	return &Storage{backend: b}, nil
+}
+
+// Attach 把 s 切换到 path 上的持久化存储并关闭之前的后端，已经持有 s 的调用方随之切换
+// 之前后端中的数据不会复制
+func (s *Storage) Attach(path string) error {
+	next, err := Open(path)
+	if err != nil {
+		return err
+	}
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.data[key] = value
+	prev := s.backend
+	s.backend = next.backend
+	s.mu.Unlock()
+	return prev.Close()
 }
 
-// Get 获取值
-func (s *Storage) Get(key string) (interface{}, bool) {
+func (s *Storage) current() Backend {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	val, exists := s.data[key]
+	return s.backend
+}
+
+// View 执行只读事务
+func (s *Storage) View(fn func(Tx) error) error {
+	return s.current().View(fn)
+}
+
+// Update 执行读写事务，fn 返回错误时所有写入都被丢弃
+func (s *Storage) Update(fn func(Tx) error) error {
+	return s.current().Update(fn)
+}
+
+// Close 关闭存储
+func (s *Storage) Close() error {
+	return s.current().Close()
+}
+
+// Set 设置值，value 以 JSON 保存；写入失败时记录日志
+func (s *Storage) Set(key string, value interface{}) {
+	if err := s.Update(func(tx Tx) error { return Values.Put(tx, key, value) }); err != nil {
+		log.Printf("storage: failed to set %s: %v", key, err)
+	}
+}
+
+// Get 获取值，值经过 JSON 往返：字符串和布尔值不变，数字为 float64，结构体为 map[string]interface{}
+func (s *Storage) Get(key string) (interface{}, bool) {
+	var (
+		val    interface{}
+		exists bool
+	)
+	err := s.View(func(tx Tx) error {
+		var err error
+		val, exists, err = Values.Get(tx, key)
+		return err
+	})
+	if err != nil {
+		log.Printf("storage: failed to get %s: %v", key, err)
+		return nil, false
+	}
 	return val, exists
 }
 
@@ -85,44 +174,58 @@ func (s *Storage) GetString(key string) string {
 	return ""
 }
 
-// GetUserInfo 获取用户信息
-func (s *Storage) GetUserInfo() *BindInfo {
-	val, exists := s.Get("userInfo")
+// getCurrent 读取类型化 bucket 中当前节点的值
+func getCurrent[T any](s *Storage, b Bucket[T]) *T {
+	var (
+		val    T
+		exists bool
+	)
+	err := s.View(func(tx Tx) error {
+		var err error
+		val, exists, err = b.Get(tx, currentKey)
+		return err
+	})
+	if err != nil {
+		log.Printf("storage: failed to read %s: %v", b.Name, err)
+		return nil
+	}
 	if !exists {
 		return nil
 	}
-	if data, ok := val.(string); ok {
-		var userInfo BindInfo
-		json.Unmarshal([]byte(data), &userInfo)
-		return &userInfo
+	return &val
+}
+
+// setCurrent 写入类型化 bucket 中当前节点的值，nil 表示删除
+func setCurrent[T any](s *Storage, b Bucket[T], v *T) {
+	err := s.Update(func(tx Tx) error {
+		if v == nil {
+			return b.Delete(tx, currentKey)
+		}
+		return b.Put(tx, currentKey, *v)
+	})
+	if err != nil {
+		log.Printf("storage: failed to write %s: %v", b.Name, err)
 	}
-	return nil
+}
+
+// GetUserInfo 获取用户信息
+func (s *Storage) GetUserInfo() *BindInfo {
+	return getCurrent(s, BindInfos)
 }
 
 // SetUserInfo 设置用户信息
 func (s *Storage) SetUserInfo(userInfo *BindInfo) {
-	data, _ := json.Marshal(userInfo)
-	s.Set("userInfo", string(data))
+	setCurrent(s, BindInfos, userInfo)
 }
 
 // GetNodeInfo 获取节点信息
 func (s *Storage) GetNodeInfo() *NodeInfo {
-	val, exists := s.Get("nodeInfo")
-	if !exists {
-		return nil
-	}
-	if data, ok := val.(string); ok {
-		var nodeInfo NodeInfo
-		json.Unmarshal([]byte(data), &nodeInfo)
-		return &nodeInfo
-	}
-	return nil
+	return getCurrent(s, NodeInfos)
 }
 
 // SetNodeInfo 设置节点信息
 func (s *Storage) SetNodeInfo(nodeInfo *NodeInfo) {
-	data, _ := json.Marshal(nodeInfo)
-	s.Set("nodeInfo", string(data))
+	setCurrent(s, NodeInfos, nodeInfo)
 }
 
 // SetConnectStatus 设置连接状态
@@ -130,15 +233,35 @@ func (s *Storage) SetConnectStatus(status ConnectStatus) {
 	s.Set("connectStatus", string(status))
 }
 
+// UpdateConnectStatus 设置连接状态，状态不变时不写入
+func (s *Storage) UpdateConnectStatus(status ConnectStatus) {
+	if s.GetConnectStatus() != status {
+		s.SetConnectStatus(status)
+	}
+}
+
 // GetConnectStatus 获取连接状态
 func (s *Storage) GetConnectStatus() ConnectStatus {
 	status := s.GetString("connectStatus")
 	return ConnectStatus(status)
 }
 
-// Clear 清空存储
+// Clear 清空存储（schema 版本保留）
 func (s *Storage) Clear() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.data = make(map[string]interface{})
+	err := s.Update(func(tx Tx) error {
+		for _, bucket := range tx.Buckets() {
+			if bucket == meta.Name {
+				continue
+			}
+			for _, key := range tx.Keys(bucket) {
+				if err := tx.Delete(bucket, key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("storage: failed to clear: %v", err)
+	}
 }
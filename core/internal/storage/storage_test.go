@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"aro-ext-app/core/internal/errcode"
+)
+
+func TestStoragePersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set(PUBLIC_KEY, "pem")
+	s.SetConnectStatus(StatusConnected)
+	s.SetUserInfo(&BindInfo{Bind: true, BindUser: &BindUser{Email: "a@example.com"}})
+	s.SetNodeInfo(&NodeInfo{NodeID: "node-1"})
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.GetString(PUBLIC_KEY) != "pem" || s.GetConnectStatus() != StatusConnected {
+		t.Errorf("values not persisted: %q %q", s.GetString(PUBLIC_KEY), s.GetConnectStatus())
+	}
+	if u := s.GetUserInfo(); u == nil || u.BindUser == nil || u.BindUser.Email != "a@example.com" {
+		t.Errorf("bind info not persisted: %+v", u)
+	}
+	if n := s.GetNodeInfo(); n == nil || n.NodeID != "node-1" {
+		t.Errorf("node info not persisted: %+v", n)
+	}
+
+	s.Clear()
+	if s.GetUserInfo() != nil || s.GetString(PUBLIC_KEY) != "" {
+		t.Error("expected Clear to remove all values")
+	}
+	if err := s.View(func(tx Tx) error {
+		v, _, err := meta.Get(tx, schemaVersionKey)
+		if v != SchemaVersion() {
+			t.Errorf("expected Clear to keep schema version %d, got %d", SchemaVersion(), v)
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateRollsBackOnError(t *testing.T) {
+	for name, b := range map[string]func(t *testing.T) Backend{
+		"memory": func(t *testing.T) Backend { return NewMemoryBackend() },
+		"file": func(t *testing.T) Backend {
+			b, err := OpenFileBackend(filepath.Join(t.TempDir(), FileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return b
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, err := NewWithBackend(b(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.Set("a", "1")
+			boom := errors.New("boom")
+			err = s.Update(func(tx Tx) error {
+				if err := Values.Put(tx, "a", "2"); err != nil {
+					return err
+				}
+				if err := Values.Put(tx, "b", "2"); err != nil {
+					return err
+				}
+				if v, _, _ := Values.Get(tx, "a"); v != "2" {
+					t.Errorf("expected the transaction to see its own write, got %v", v)
+				}
+				return boom
+			})
+			if err != boom {
+				t.Fatalf("expected the callback error, got %v", err)
+			}
+			if s.GetString("a") != "1" {
+				t.Errorf("expected the write to be rolled back, got %q", s.GetString("a"))
+			}
+			if _, ok := s.Get("b"); ok {
+				t.Error("expected the new key to be rolled back")
+			}
+			if err := s.View(func(tx Tx) error { return Values.Put(tx, "a", "3") }); err != ErrReadOnly {
+				t.Errorf("expected ErrReadOnly, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFileBackendIgnoresIncompleteTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set("a", "1")
+	s.Close()
+
+	// 模拟提交时崩溃：最后一行没有写完
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"ops":[{"b":"values","k":"a","v":"2"}`)
+	f.Close()
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.GetString("a") != "1" {
+		t.Errorf("expected the committed value, got %q", s.GetString("a"))
+	}
+	s.Set("b", "1")
+	s.Close()
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.GetString("a") != "1" || s.GetString("b") != "1" {
+		t.Errorf("expected the tail to be replaced by the next commit, got %q %q", s.GetString("a"), s.GetString("b"))
+	}
+}
+
+func TestFileBackendCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	b, err := OpenFileBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.CompactAfter = 5
+	s, err := NewWithBackend(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		s.Set("counter", i)
+	}
+	s.Set("gone", true)
+	s.Update(func(tx Tx) error { return tx.Delete(Values.Name, "gone") })
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(raw), "\n"); lines > 6 {
+		t.Errorf("expected the log to be compacted, got %d records", lines)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if v, _ := reopened.Get("counter"); v != float64(19) {
+		t.Errorf("expected the last value after compaction, got %v", v)
+	}
+	if _, ok := reopened.Get("gone"); ok {
+		t.Error("expected the deleted key to stay deleted")
+	}
+}
+
+func TestFileBackendSeesOtherWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	a, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	a.Set("from", "a")
+	if b.GetString("from") != "a" {
+		t.Errorf("expected the second handle to read the first one's write, got %q", b.GetString("from"))
+	}
+	b.Set("from", "b")
+	if a.GetString("from") != "b" {
+		t.Errorf("expected the first handle to read the second one's write, got %q", a.GetString("from"))
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	b := NewMemoryBackend()
+	if _, err := NewWithBackend(b); err != nil {
+		t.Fatal(err)
+	}
+
+	// v2 把 values 中的 legacy 移到新的 bucket
+	list := append(append([]Migration(nil), migrations...), Migration{
+		Version: SchemaVersion() + 1,
+		Name:    "move legacy",
+		Apply: func(tx Tx) error {
+			var v string
+			if ok, err := tx.Get(Values.Name, "legacy", &v); err != nil || !ok {
+				return err
+			}
+			if err := tx.Put("moved", "legacy", v); err != nil {
+				return err
+			}
+			return tx.Delete(Values.Name, "legacy")
+		},
+	})
+	b.Update(func(tx Tx) error { return Values.Put(tx, "legacy", "x") })
+	if err := migrate(b, list); err != nil {
+		t.Fatal(err)
+	}
+	b.View(func(tx Tx) error {
+		var v string
+		if ok, _ := tx.Get("moved", "legacy", &v); !ok || v != "x" {
+			t.Errorf("expected the migration to move the value, got %q", v)
+		}
+		if version, _, _ := meta.Get(tx, schemaVersionKey); version != SchemaVersion()+1 {
+			t.Errorf("expected schema version %d, got %d", SchemaVersion()+1, version)
+		}
+		return nil
+	})
+
+	// 旧代码打开新版本写入的存储
+	if _, err := NewWithBackend(b); err == nil {
+		t.Error("expected a newer schema version to be rejected")
+	}
+
+	failing := append(append([]Migration(nil), list...), Migration{
+		Version: SchemaVersion() + 2,
+		Name:    "fail",
+		Apply: func(tx Tx) error {
+			tx.Put("moved", "partial", true)
+			return errors.New("boom")
+		},
+	})
+	if err := migrate(b, failing); err == nil {
+		t.Fatal("expected the failing migration to return an error")
+	}
+	b.View(func(tx Tx) error {
+		if version, _, _ := meta.Get(tx, schemaVersionKey); version != SchemaVersion()+1 {
+			t.Errorf("expected a failed migration to keep version %d, got %d", SchemaVersion()+1, version)
+		}
+		if ok, _ := tx.Get("moved", "partial", new(bool)); ok {
+			t.Error("expected a failed migration to be rolled back")
+		}
+		return nil
+	})
+}
+
+func TestConnectStatusOf(t *testing.T) {
+	cases := []struct {
+		err  error
+		want ConnectStatus
+	}{
+		{nil, StatusConnected},
+		{errcode.New(errcode.AuthFailed, "bad signature"), StatusForbidden},
+		{errcode.New(errcode.BackendUnreachable, "dial failed"), StatusConnecting},
+		{errors.New("unexpected"), StatusConnecting},
+	}
+	for _, c := range cases {
+		if got := ConnectStatusOf(c.err); got != c.want {
+			t.Errorf("ConnectStatusOf(%v) = %s, want %s", c.err, got, c.want)
+		}
+	}
+}
@@ -1,6 +1,6 @@
 package storage
 
+// 私钥只保存在 crypto.KeyStore 中，不放入 Storage
 const (
-	PRIVATE_KEY = "private_key"
-	PUBLIC_KEY  = "public_key"
+	PUBLIC_KEY = "public_key"
 )
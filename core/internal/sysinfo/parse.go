@@ -0,0 +1,109 @@
+package sysinfo
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+)
+
+// parseOSRelease 解析 /etc/os-release，返回 PRETTY_NAME（缺失时使用 NAME VERSION_ID）
+func parseOSRelease(data string) string {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		values[key] = strings.Trim(value, `"'`)
+	}
+	if name := values["PRETTY_NAME"]; name != "" {
+		return name
+	}
+	return strings.TrimSpace(values["NAME"] + " " + values["VERSION_ID"])
+}
+
+// parseCPUModel 从 /proc/cpuinfo 读取 CPU 型号，兼容 x86 的 model name 和 ARM 的 Hardware/Processor
+func parseCPUModel(data string) string {
+	fallback := ""
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "model name":
+			return value
+		case "Hardware", "Processor", "cpu model", "uarch":
+			if fallback == "" {
+				fallback = value
+			}
+		}
+	}
+	return fallback
+}
+
+// parseMemTotal 从 /proc/meminfo 读取 MemTotal（字节）
+func parseMemTotal(data string) uint64 {
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0
+			}
+			return kb * 1024
+		}
+	}
+	return 0
+}
+
+// containerFromCgroup 根据 /proc/1/cgroup 判断容器运行时
+func containerFromCgroup(data string) string {
+	switch {
+	case strings.Contains(data, "kubepods"):
+		return "kubernetes"
+	case strings.Contains(data, "docker"):
+		return "docker"
+	case strings.Contains(data, "libpod"):
+		return "podman"
+	case strings.Contains(data, "lxc"):
+		return "lxc"
+	case strings.Contains(data, "containerd"):
+		return "containerd"
+	}
+	return ""
+}
+
+// hasCPUFlag 判断 /proc/cpuinfo 的 flags 中是否包含 flag
+func hasCPUFlag(cpuinfo, flag string) bool {
+	scanner := bufio.NewScanner(strings.NewReader(cpuinfo))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(key) != "flags" {
+			continue
+		}
+		for _, f := range strings.Fields(value) {
+			if f == flag {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// parseIOPlatformUUID 从 ioreg -rd1 -c IOPlatformExpertDevice 的输出中读取 IOPlatformUUID
+func parseIOPlatformUUID(data string) string {
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if ok && strings.Trim(strings.TrimSpace(key), `"`) == "IOPlatformUUID" {
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package sysinfo
+
+import (
+	"net"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// darwinSource 通过 sysctl 读取 macOS/iOS 系统信息
+type darwinSource struct{}
+
+func newSource() Source {
+	return darwinSource{}
+}
+
+func (darwinSource) OSRelease() (string, string) {
+	product, _ := unix.Sysctl("kern.osproductversion")
+	kernel, _ := unix.Sysctl("kern.osrelease")
+	name := "macOS"
+	if runtime.GOOS == "ios" {
+		name = "iOS"
+	}
+	return strings.TrimSpace(name + " " + product), kernel
+}
+
+func (darwinSource) CPUModel() string {
+	model, _ := unix.Sysctl("machdep.cpu.brand_string")
+	return model
+}
+
+func (darwinSource) MemoryTotal() uint64 {
+	mem, _ := unix.SysctlUint64("hw.memsize")
+	return mem
+}
+
+func (darwinSource) DiskUsage(path string) (uint64, uint64) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, 0
+	}
+	return st.Blocks * uint64(st.Bsize), st.Bavail * uint64(st.Bsize)
+}
+
+func (darwinSource) InterfaceType(iface net.Interface) string {
+	return classifyByName(iface)
+}
+
+func (darwinSource) Locale() string {
+	if locale := localeFromEnv(); locale != "" {
+		return locale
+	}
+	// 从 Finder/Flutter 启动时没有 LANG，读取用户的系统语言设置
+	if runtime.GOOS == "darwin" {
+		if out, err := exec.Command("defaults", "read", "-g", "AppleLocale").Output(); err == nil {
+			return strings.TrimSpace(string(out))
+		}
+	}
+	return ""
+}
+
+func (darwinSource) Container() string {
+	return ""
+}
+
+func (darwinSource) Virtualization() string {
+	if present, err := unix.SysctlUint32("kern.hv_vmm_present"); err == nil && present == 1 {
+		return "hypervisor"
+	}
+	return ""
+}
+
+func (darwinSource) MachineID() string {
+	if runtime.GOOS != "darwin" {
+		return ""
+	}
+	out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+	if err != nil {
+		return ""
+	}
+	return parseIOPlatformUUID(string(out))
+}
@@ -0,0 +1,147 @@
+package sysinfo
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// linuxSource 读取 /proc、/sys 和 /etc，Android 额外使用 getprop
+type linuxSource struct{}
+
+func newSource() Source {
+	return linuxSource{}
+}
+
+func readFile(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// getprop 读取 Android 系统属性
+func getprop(name string) string {
+	out, err := exec.Command("getprop", name).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func (linuxSource) OSRelease() (string, string) {
+	kernel := strings.TrimSpace(readFile("/proc/sys/kernel/osrelease"))
+	if runtime.GOOS == "android" {
+		if release := getprop("ro.build.version.release"); release != "" {
+			return "Android " + release, kernel
+		}
+		return "Android", kernel
+	}
+	return parseOSRelease(readFile("/etc/os-release")), kernel
+}
+
+func (linuxSource) CPUModel() string {
+	return parseCPUModel(readFile("/proc/cpuinfo"))
+}
+
+func (linuxSource) MemoryTotal() uint64 {
+	return parseMemTotal(readFile("/proc/meminfo"))
+}
+
+func (linuxSource) DiskUsage(path string) (uint64, uint64) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0
+	}
+	return st.Blocks * uint64(st.Bsize), st.Bavail * uint64(st.Bsize)
+}
+
+// InterfaceType 根据 /sys/class/net 判断接口类型：wireless 目录表示 Wi-Fi，
+// 没有 device 链接的是虚拟接口，移动网络按驱动命名识别
+func (linuxSource) InterfaceType(iface net.Interface) string {
+	if iface.Flags&net.FlagLoopback != 0 {
+		return InterfaceLoopback
+	}
+	dir := filepath.Join("/sys/class/net", iface.Name)
+	if _, err := os.Stat(dir); err != nil {
+		return classifyByName(iface)
+	}
+	if exists(filepath.Join(dir, "wireless")) || exists(filepath.Join(dir, "phy80211")) {
+		return InterfaceWiFi
+	}
+	if hasAnyPrefix(iface.Name, "rmnet", "ccmni", "wwan") {
+		return InterfaceCellular
+	}
+	if !exists(filepath.Join(dir, "device")) {
+		return InterfaceVirtual
+	}
+	if strings.TrimSpace(readFile(filepath.Join(dir, "type"))) == "1" {
+		return InterfaceEthernet
+	}
+	return InterfaceOther
+}
+
+func (linuxSource) Locale() string {
+	if locale := localeFromEnv(); locale != "" {
+		return locale
+	}
+	if runtime.GOOS == "android" {
+		if locale := getprop("persist.sys.locale"); locale != "" {
+			return locale
+		}
+		return getprop("ro.product.locale")
+	}
+	return ""
+}
+
+func (linuxSource) Container() string {
+	switch {
+	case exists("/.dockerenv"):
+		return "docker"
+	case exists("/run/.containerenv"):
+		return "podman"
+	case os.Getenv("KUBERNETES_SERVICE_HOST") != "":
+		return "kubernetes"
+	}
+	if c := containerFromCgroup(readFile("/proc/1/cgroup")); c != "" {
+		return c
+	}
+	if strings.Contains(strings.ToLower(readFile("/proc/sys/kernel/osrelease")), "microsoft") {
+		return "wsl"
+	}
+	return ""
+}
+
+func (linuxSource) Virtualization() string {
+	vendor := readFile("/sys/class/dmi/id/sys_vendor")
+	product := readFile("/sys/class/dmi/id/product_name")
+	if v := virtualizationFromVendor(vendor, product); v != "" {
+		return v
+	}
+	if hasCPUFlag(readFile("/proc/cpuinfo"), "hypervisor") {
+		return "hypervisor"
+	}
+	return ""
+}
+
+func (linuxSource) MachineID() string {
+	if runtime.GOOS == "android" {
+		return getprop("ro.serialno")
+	}
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if id := strings.TrimSpace(readFile(path)); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
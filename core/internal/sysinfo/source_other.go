@@ -0,0 +1,24 @@
+//go:build !linux && !darwin && !windows
+
+package sysinfo
+
+import (
+	"net"
+)
+
+// genericSource 没有专门实现的平台只采集可移植的信息
+type genericSource struct{}
+
+func newSource() Source {
+	return genericSource{}
+}
+
+func (genericSource) OSRelease() (string, string)              { return "", "" }
+func (genericSource) CPUModel() string                         { return "" }
+func (genericSource) MemoryTotal() uint64                      { return 0 }
+func (genericSource) DiskUsage(string) (uint64, uint64)        { return 0, 0 }
+func (genericSource) InterfaceType(iface net.Interface) string { return classifyByName(iface) }
+func (genericSource) Locale() string                           { return localeFromEnv() }
+func (genericSource) Container() string                        { return "" }
+func (genericSource) Virtualization() string                   { return "" }
+func (genericSource) MachineID() string                        { return "" }
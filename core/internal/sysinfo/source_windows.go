@@ -0,0 +1,106 @@
+package sysinfo
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// windowsSource 通过注册表和 Win32 API 读取系统信息
+type windowsSource struct{}
+
+func newSource() Source {
+	return windowsSource{}
+}
+
+// registryString 读取 HKLM 下的字符串值
+func registryString(path, name string) string {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE)
+	if err != nil {
+		return ""
+	}
+	defer key.Close()
+	value, _, err := key.GetStringValue(name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
+
+func (windowsSource) OSRelease() (string, string) {
+	v := windows.RtlGetVersion()
+	name := registryString(`SOFTWARE\Microsoft\Windows NT\CurrentVersion`, "ProductName")
+	if name == "" {
+		name = "Windows"
+	}
+	return name, fmt.Sprintf("%d.%d.%d", v.MajorVersion, v.MinorVersion, v.BuildNumber)
+}
+
+func (windowsSource) CPUModel() string {
+	return registryString(`HARDWARE\DESCRIPTION\System\CentralProcessor\0`, "ProcessorNameString")
+}
+
+// memoryStatusEx GlobalMemoryStatusEx 的参数结构
+type memoryStatusEx struct {
+	Length               uint32
+	MemoryLoad           uint32
+	TotalPhys            uint64
+	AvailPhys            uint64
+	TotalPageFile        uint64
+	AvailPageFile        uint64
+	TotalVirtual         uint64
+	AvailVirtual         uint64
+	AvailExtendedVirtual uint64
+}
+
+var procGlobalMemoryStatusEx = windows.NewLazySystemDLL("kernel32.dll").NewProc("GlobalMemoryStatusEx")
+
+func (windowsSource) MemoryTotal() uint64 {
+	st := memoryStatusEx{}
+	st.Length = uint32(unsafe.Sizeof(st))
+	if ok, _, _ := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&st))); ok == 0 {
+		return 0
+	}
+	return st.TotalPhys
+}
+
+func (windowsSource) DiskUsage(path string) (uint64, uint64) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0
+	}
+	var free, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &free, &total, &totalFree); err != nil {
+		return 0, 0
+	}
+	return total, free
+}
+
+func (windowsSource) InterfaceType(iface net.Interface) string {
+	return classifyByName(iface)
+}
+
+func (windowsSource) Locale() string {
+	langs, err := windows.GetUserPreferredUILanguages(windows.MUI_LANGUAGE_NAME)
+	if err != nil || len(langs) == 0 {
+		return ""
+	}
+	return langs[0]
+}
+
+func (windowsSource) Container() string {
+	return ""
+}
+
+func (windowsSource) Virtualization() string {
+	const bios = `HARDWARE\DESCRIPTION\System\BIOS`
+	return virtualizationFromVendor(registryString(bios, "SystemManufacturer"), registryString(bios, "SystemProductName"))
+}
+
+func (windowsSource) MachineID() string {
+	return registryString(`SOFTWARE\Microsoft\Cryptography`, "MachineGuid")
+}
@@ -0,0 +1,274 @@
+// Package sysinfo 采集节点的系统指纹（操作系统、CPU、内存、磁盘、时区、语言、网络、容器/虚拟化），
+// 用于 NodeReportBaseInfo 自动上报，调用方不再需要手动填写系统信息
+//
+// 平台相关的部分由 Source 接口抽象，每个平台在 source_<os>.go 中实现
+package sysinfo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"aro-ext-app/core/internal/datadir"
+)
+
+// 网络接口类型
+const (
+	InterfaceEthernet = "ethernet"
+	InterfaceWiFi     = "wifi"
+	InterfaceCellular = "cellular"
+	InterfaceLoopback = "loopback"
+	InterfaceVirtual  = "virtual"
+	InterfaceOther    = "other"
+)
+
+// Interface 网络接口
+type Interface struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Up   bool   `json:"up"`
+}
+
+// Info 系统指纹
+type Info struct {
+	OS             string      `json:"os"`               // runtime.GOOS
+	OSName         string      `json:"os_name"`          // 发行版或产品名，如 Ubuntu 22.04.3 LTS、macOS 14.2、Android 14
+	OSVersion      string      `json:"os_version"`       // 内核或系统版本号
+	Arch           string      `json:"arch"`             // runtime.GOARCH
+	CPUModel       string      `json:"cpu_model"`        // CPU 型号
+	CPUCores       int         `json:"cpu_cores"`        // 逻辑核心数
+	MemoryTotal    uint64      `json:"memory_total"`     // 内存总量（字节）
+	DiskTotal      uint64      `json:"disk_total"`       // 数据目录所在磁盘总量（字节）
+	DiskFree       uint64      `json:"disk_free"`        // 数据目录所在磁盘可用量（字节）
+	TimeZone       string      `json:"time_zone"`        // IANA 时区名，未知时为空
+	TimeZoneOffset string      `json:"time_zone_offset"` // UTC 偏移，如 +08:00
+	Locale         string      `json:"locale"`           // BCP 47 语言标签，如 en-US
+	Interfaces     []Interface `json:"interfaces"`
+	Container      string      `json:"container,omitempty"`      // docker、podman、kubernetes、lxc、wsl
+	Virtualization string      `json:"virtualization,omitempty"` // kvm、vmware、virtualbox、hyperv 等
+}
+
+// Source 平台相关的采集实现，取不到的值返回零值
+type Source interface {
+	// OSRelease 返回系统名称和版本
+	OSRelease() (name, version string)
+	CPUModel() string
+	MemoryTotal() uint64
+	// DiskUsage 返回 path 所在文件系统的总量和可用量
+	DiskUsage(path string) (total, free uint64)
+	// InterfaceType 返回网络接口类型（Interface* 常量）
+	InterfaceType(iface net.Interface) string
+	// Locale 返回系统语言设置，格式不限，由 NormalizeLocale 统一
+	Locale() string
+	Container() string
+	Virtualization() string
+	// MachineID 返回系统安装时生成的机器标识，取不到时返回空
+	MachineID() string
+}
+
+// Collect 使用当前平台的 Source 采集系统指纹，dir 为数据目录（用于磁盘统计），为空时使用 datadir.Get()
+func Collect(dir string) Info {
+	return CollectFrom(newSource(), dir)
+}
+
+// CollectFrom 使用指定的 Source 采集系统指纹
+func CollectFrom(src Source, dir string) Info {
+	if dir == "" {
+		dir = datadir.Get()
+	}
+	info := Info{
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		CPUCores: runtime.NumCPU(),
+	}
+	info.OSName, info.OSVersion = src.OSRelease()
+	info.CPUModel = src.CPUModel()
+	info.MemoryTotal = src.MemoryTotal()
+	info.DiskTotal, info.DiskFree = src.DiskUsage(dir)
+	info.TimeZone, info.TimeZoneOffset = timeZone(time.Now())
+	info.Locale = NormalizeLocale(src.Locale())
+	info.Interfaces = interfaces(src)
+	info.Container = src.Container()
+	info.Virtualization = src.Virtualization()
+	return info
+}
+
+// NetworkTypes 返回已启用的非回环接口类型（去重、排序）
+func (i Info) NetworkTypes() []string {
+	seen := map[string]bool{}
+	types := []string{}
+	for _, iface := range i.Interfaces {
+		if !iface.Up || iface.Type == InterfaceLoopback || seen[iface.Type] {
+			continue
+		}
+		seen[iface.Type] = true
+		types = append(types, iface.Type)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Language 返回语言标签中的语言部分，如 en-US 返回 en
+func (i Info) Language() string {
+	lang, _, _ := strings.Cut(i.Locale, "-")
+	return lang
+}
+
+// Fingerprint 返回 v 的 JSON 摘要，调用方负责去掉磁盘可用量等易变字段
+func Fingerprint(v interface{}) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// HardwareID 返回本机硬件标识的摘要，用于发现被复制到其他设备的节点身份
+func HardwareID() string {
+	return HardwareIDFrom(newSource())
+}
+
+// HardwareIDPrefix 当前格式的硬件标识的前缀；没有前缀的是旧版本记录的、包含 CPU 型号和内存的标识
+const HardwareIDPrefix = "v2-"
+
+// HardwareIDFrom 使用指定的 Source 计算硬件标识摘要
+// 只由机器标识和架构组成：CPU 型号、内存等会随硬件升级或虚拟机调整而变化，不用于判断是否换了设备；
+// 取不到机器标识时返回空，调用方不做检测
+func HardwareIDFrom(src Source) string {
+	machineID := src.MachineID()
+	if machineID == "" {
+		return ""
+	}
+	return HardwareIDPrefix + Fingerprint(struct {
+		MachineID string `json:"machine_id"`
+		Arch      string `json:"arch"`
+	}{
+		MachineID: machineID,
+		Arch:      runtime.GOARCH,
+	})
+}
+
+// NormalizeLocale 把 en_US.UTF-8、en-US、zh_CN@euro 等格式统一为 en-US，C/POSIX 返回空
+func NormalizeLocale(locale string) string {
+	locale = strings.TrimSpace(locale)
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return ""
+	}
+	parts := strings.FieldsFunc(locale, func(r rune) bool { return r == '_' || r == '-' })
+	for i, p := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(p)
+		case len(p) == 2:
+			parts[i] = strings.ToUpper(p)
+		case len(p) == 4:
+			parts[i] = strings.ToUpper(p[:1]) + strings.ToLower(p[1:])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// localeFromEnv 按 POSIX 优先级读取语言环境变量
+func localeFromEnv() string {
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// timeZone 返回本地时区名和 UTC 偏移
+func timeZone(now time.Time) (name, offset string) {
+	name = os.Getenv("TZ")
+	if name == "" && time.Local.String() != "Local" {
+		name = time.Local.String()
+	}
+	if name == "" {
+		name = localTimeZoneName()
+	}
+	_, secs := now.Zone()
+	sign := '+'
+	if secs < 0 {
+		sign = '-'
+		secs = -secs
+	}
+	return name, fmt.Sprintf("%c%02d:%02d", sign, secs/3600, secs%3600/60)
+}
+
+// interfaces 列出网络接口及其类型
+func interfaces(src Source) []Interface {
+	list := []Interface{}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return list
+	}
+	for _, iface := range ifaces {
+		list = append(list, Interface{
+			Name: iface.Name,
+			Type: src.InterfaceType(iface),
+			Up:   iface.Flags&net.FlagUp != 0,
+		})
+	}
+	return list
+}
+
+// classifyByName 根据接口名猜测类型，供无法查询驱动信息的平台使用
+func classifyByName(iface net.Interface) string {
+	if iface.Flags&net.FlagLoopback != 0 {
+		return InterfaceLoopback
+	}
+	name := strings.ToLower(iface.Name)
+	switch {
+	case hasAnyPrefix(name, "wl", "wi-fi", "wifi", "wireless", "ath"):
+		return InterfaceWiFi
+	case hasAnyPrefix(name, "rmnet", "ccmni", "wwan", "pdp_ip", "cellular", "mobile"):
+		return InterfaceCellular
+	case hasAnyPrefix(name, "docker", "br-", "bridge", "veth", "virbr", "vmnet", "vboxnet", "vethernet", "utun", "tun", "tap", "zt", "tailscale", "wg", "awdl", "llw", "anpi", "gif", "stf"):
+		return InterfaceVirtual
+	case hasAnyPrefix(name, "eth", "en", "em", "eno", "ens", "enp", "ethernet", "local area connection"):
+		return InterfaceEthernet
+	}
+	return InterfaceOther
+}
+
+func hasAnyPrefix(s string, prefixes ...string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// virtualizationFromVendor 根据 DMI/BIOS 厂商和产品名识别虚拟化平台
+func virtualizationFromVendor(vendor, product string) string {
+	s := strings.ToLower(vendor + " " + product)
+	switch {
+	case strings.Contains(s, "kvm"), strings.Contains(s, "qemu"):
+		return "kvm"
+	case strings.Contains(s, "vmware"):
+		return "vmware"
+	case strings.Contains(s, "virtualbox"), strings.Contains(s, "innotek"):
+		return "virtualbox"
+	case strings.Contains(s, "xen"):
+		return "xen"
+	case strings.Contains(s, "microsoft corporation") && strings.Contains(s, "virtual"):
+		return "hyperv"
+	case strings.Contains(s, "amazon ec2"):
+		return "aws"
+	case strings.Contains(s, "google compute engine"):
+		return "gce"
+	case strings.Contains(s, "parallels"):
+		return "parallels"
+	}
+	return ""
+}
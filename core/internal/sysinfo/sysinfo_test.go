@@ -0,0 +1,174 @@
+package sysinfo
+
+import (
+	"net"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+type fakeSource struct{}
+
+func (fakeSource) OSRelease() (string, string)       { return "Ubuntu 22.04.3 LTS", "6.1.0" }
+func (fakeSource) CPUModel() string                  { return "Test CPU" }
+func (fakeSource) MemoryTotal() uint64               { return 8 << 30 }
+func (fakeSource) DiskUsage(string) (uint64, uint64) { return 100, 40 }
+func (fakeSource) InterfaceType(iface net.Interface) string {
+	return classifyByName(iface)
+}
+func (fakeSource) Locale() string         { return "zh_CN.UTF-8" }
+func (fakeSource) Container() string      { return "docker" }
+func (fakeSource) Virtualization() string { return "kvm" }
+func (fakeSource) MachineID() string      { return "0123456789abcdef" }
+
+func TestCollectFrom(t *testing.T) {
+	info := CollectFrom(fakeSource{}, t.TempDir())
+	if info.OS != runtime.GOOS || info.Arch != runtime.GOARCH || info.CPUCores != runtime.NumCPU() {
+		t.Errorf("unexpected runtime fields: %+v", info)
+	}
+	if info.OSName != "Ubuntu 22.04.3 LTS" || info.MemoryTotal != 8<<30 || info.DiskFree != 40 {
+		t.Errorf("expected source values, got %+v", info)
+	}
+	if info.Locale != "zh-CN" || info.Language() != "zh" {
+		t.Errorf("expected normalized locale, got %q", info.Locale)
+	}
+	if info.TimeZoneOffset == "" {
+		t.Error("expected a time zone offset")
+	}
+}
+
+func TestCollectCurrentPlatform(t *testing.T) {
+	info := Collect(t.TempDir())
+	if info.OS == "" || info.CPUCores == 0 {
+		t.Errorf("expected basic fields, got %+v", info)
+	}
+}
+
+func TestNormalizeLocale(t *testing.T) {
+	cases := map[string]string{
+		"en_US.UTF-8": "en-US",
+		"zh-hans-cn":  "zh-Hans-CN",
+		"de_DE@euro":  "de-DE",
+		"C":           "",
+		"POSIX":       "",
+		"fr":          "fr",
+	}
+	for in, want := range cases {
+		if got := NormalizeLocale(in); got != want {
+			t.Errorf("NormalizeLocale(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestClassifyByName(t *testing.T) {
+	cases := map[string]string{
+		"wlan0":          InterfaceWiFi,
+		"Wi-Fi":          InterfaceWiFi,
+		"rmnet_data0":    InterfaceCellular,
+		"pdp_ip0":        InterfaceCellular,
+		"docker0":        InterfaceVirtual,
+		"utun3":          InterfaceVirtual,
+		"eth0":           InterfaceEthernet,
+		"Ethernet 2":     InterfaceEthernet,
+		"something-else": InterfaceOther,
+	}
+	for name, want := range cases {
+		if got := classifyByName(net.Interface{Name: name}); got != want {
+			t.Errorf("classifyByName(%q) = %q, want %q", name, got, want)
+		}
+	}
+	if got := classifyByName(net.Interface{Name: "lo", Flags: net.FlagLoopback}); got != InterfaceLoopback {
+		t.Errorf("expected loopback, got %q", got)
+	}
+}
+
+func TestNetworkTypes(t *testing.T) {
+	info := Info{Interfaces: []Interface{
+		{Name: "lo", Type: InterfaceLoopback, Up: true},
+		{Name: "wlan0", Type: InterfaceWiFi, Up: true},
+		{Name: "eth0", Type: InterfaceEthernet, Up: true},
+		{Name: "eth1", Type: InterfaceEthernet, Up: true},
+		{Name: "rmnet0", Type: InterfaceCellular, Up: false},
+	}}
+	if got := info.NetworkTypes(); !reflect.DeepEqual(got, []string{InterfaceEthernet, InterfaceWiFi}) {
+		t.Errorf("unexpected network types %v", got)
+	}
+}
+
+func TestParsers(t *testing.T) {
+	if got := parseOSRelease("NAME=\"Debian GNU/Linux\"\nVERSION_ID=\"12\"\n"); got != "Debian GNU/Linux 12" {
+		t.Errorf("parseOSRelease = %q", got)
+	}
+	if got := parseOSRelease("PRETTY_NAME=\"Ubuntu 22.04.3 LTS\"\nNAME=Ubuntu\n"); got != "Ubuntu 22.04.3 LTS" {
+		t.Errorf("parseOSRelease = %q", got)
+	}
+
+	x86 := "processor\t: 0\nmodel name\t: Intel(R) Xeon(R) CPU\nflags\t\t: fpu vme hypervisor\n"
+	if got := parseCPUModel(x86); got != "Intel(R) Xeon(R) CPU" {
+		t.Errorf("parseCPUModel = %q", got)
+	}
+	if !hasCPUFlag(x86, "hypervisor") || hasCPUFlag(x86, "hyper") {
+		t.Error("hasCPUFlag mismatch")
+	}
+	if got := parseCPUModel("processor\t: 0\nBogoMIPS\t: 48.00\nHardware\t: Qualcomm SM8250\n"); got != "Qualcomm SM8250" {
+		t.Errorf("parseCPUModel (arm) = %q", got)
+	}
+
+	if got := parseMemTotal("MemTotal:       16318480 kB\nMemFree:         1000 kB\n"); got != 16318480*1024 {
+		t.Errorf("parseMemTotal = %d", got)
+	}
+
+	if got := containerFromCgroup("0::/kubepods/besteffort/pod1/abc\n"); got != "kubernetes" {
+		t.Errorf("containerFromCgroup = %q", got)
+	}
+	if got := containerFromCgroup("0::/init.scope\n"); got != "" {
+		t.Errorf("containerFromCgroup = %q", got)
+	}
+
+	if got := virtualizationFromVendor("QEMU", "Standard PC (Q35 + ICH9, 2009)"); got != "kvm" {
+		t.Errorf("virtualizationFromVendor = %q", got)
+	}
+	if got := virtualizationFromVendor("Dell Inc.", "PowerEdge R740"); got != "" {
+		t.Errorf("virtualizationFromVendor = %q", got)
+	}
+
+	ioreg := "+-o J314sAP  <class IOPlatformExpertDevice>\n    {\n      \"IOPlatformSerialNumber\" = \"C02XX\"\n      \"IOPlatformUUID\" = \"4C4C4544-0032-5A10-8052-B7C04F4A4D32\"\n    }\n"
+	if got := parseIOPlatformUUID(ioreg); got != "4C4C4544-0032-5A10-8052-B7C04F4A4D32" {
+		t.Errorf("parseIOPlatformUUID = %q", got)
+	}
+}
+
+// otherMachine 复制了身份的另一台设备
+type otherMachine struct{ fakeSource }
+
+func (otherMachine) MachineID() string { return "fedcba9876543210" }
+
+// upgradedMachine 同一台设备换了 CPU、加了内存
+type upgradedMachine struct{ fakeSource }
+
+func (upgradedMachine) CPUModel() string    { return "Other CPU" }
+func (upgradedMachine) MemoryTotal() uint64 { return 64 << 30 }
+
+// noMachineID 取不到机器标识的平台
+type noMachineID struct{ fakeSource }
+
+func (noMachineID) MachineID() string { return "" }
+
+func TestHardwareID(t *testing.T) {
+	id := HardwareIDFrom(fakeSource{})
+	if id == "" || id != HardwareIDFrom(fakeSource{}) {
+		t.Fatalf("expected a stable hardware id, got %q", id)
+	}
+	if HardwareIDFrom(otherMachine{}) == id {
+		t.Error("expected a different machine to have a different hardware id")
+	}
+	if HardwareIDFrom(upgradedMachine{}) != id {
+		t.Error("expected a hardware upgrade to keep the hardware id")
+	}
+	if got := HardwareIDFrom(noMachineID{}); got != "" {
+		t.Errorf("expected no hardware id without a machine id, got %q", got)
+	}
+	if HardwareID() != HardwareID() {
+		t.Error("expected the current machine's hardware id to be stable")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package sysinfo
+
+// localTimeZoneName 其他平台无法可靠获取 IANA 时区名，只上报 UTC 偏移
+func localTimeZoneName() string {
+	return ""
+}
@@ -0,0 +1,20 @@
+//go:build linux || darwin
+
+package sysinfo
+
+import (
+	"os"
+	"strings"
+)
+
+// localTimeZoneName 从 /etc/localtime 符号链接解析 IANA 时区名
+func localTimeZoneName() string {
+	target, err := os.Readlink("/etc/localtime")
+	if err != nil {
+		return ""
+	}
+	if _, name, ok := strings.Cut(target, "zoneinfo/"); ok {
+		return name
+	}
+	return ""
+}
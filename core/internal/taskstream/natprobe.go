@@ -0,0 +1,159 @@
+package taskstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+)
+
+// NAT 探测的参数
+const (
+	// ProbePort 探测使用的本地 UDP 端口，被占用时使用随机端口
+	ProbePort = 53000
+	// probeStages 一个任务最多发送的探测阶段数，之后的阶段由 checker 在 ACK 中指定
+	probeStages = 4
+	// probeRounds 每个阶段发送的轮数，每轮 probeBurst 个包
+	probeRounds = 3
+	probeBurst  = 3
+	// probeRoundWait 一轮发送后等待 ACK 的时间，超过后发送下一轮
+	probeRoundWait = 50 * time.Millisecond
+	// probeTimeout 一个阶段等待 ACK 的总时长
+	probeTimeout = 6 * time.Second
+)
+
+// NATProbeTask 调度下发的 NAT 探测任务
+type NATProbeTask struct {
+	Type        string `json:"type"`
+	TaskID      string `json:"task_id"`      // 主探测任务 ID
+	SubTaskID   string `json:"sub_task_id"`  // 子探测任务 ID
+	CheckerIP   string `json:"checker_ip"`   // 第一阶段的 checker 地址
+	CheckerPort uint32 `json:"checker_port"` // 第一阶段的 checker 端口
+}
+
+// probePayload 发给 checker 的探测包
+type probePayload struct {
+	TaskID    string `json:"task_id"`
+	SubTaskID string `json:"sub_task_id"`
+	NodeID    string `json:"node_id"`
+	Round     int    `json:"round"`
+	Seq       int    `json:"seq"`
+	Timestamp int64  `json:"timestamp"`
+	Token     string `json:"token"`
+	Stage     int    `json:"stage"`
+}
+
+// probeAck checker 的应答，CheckerIP/CheckerPort/Stage 指定下一阶段
+type probeAck struct {
+	TaskID      string `json:"task_id"`
+	SubTaskID   string `json:"sub_task_id"`
+	NodeID      string `json:"node_id"`
+	Round       int    `json:"round"`
+	Seq         int    `json:"seq"`
+	Timestamp   int64  `json:"time_stamp"`
+	Stage       int    `json:"stage"`
+	CheckerIP   string `json:"checker_ip"`
+	CheckerPort int    `json:"checker_port"`
+}
+
+// ProbeNAT 执行 NAT 探测任务：从 task 指定的 checker 开始，每个阶段发送探测包并等待 ACK，
+// 下一阶段发往 ACK 中的 checker，共 probeStages 个阶段；所有阶段使用同一个本地端口
+// nodeID 和 token 写入探测包，供 checker 识别和验证节点
+func ProbeNAT(ctx context.Context, task NATProbeTask, nodeID, token string) error {
+	conn, err := listenProbe()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// 取消时关闭连接，结束正在等待的读取
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	next := probePayload{
+		TaskID:    task.TaskID,
+		SubTaskID: task.SubTaskID,
+		NodeID:    nodeID,
+		Token:     token,
+	}
+	addr := net.JoinHostPort(task.CheckerIP, strconv.FormatUint(uint64(task.CheckerPort), 10))
+	for stage := 0; stage < probeStages; stage++ {
+		ack, err := probeStage(ctx, conn, addr, next)
+		if err != nil {
+			return fmt.Errorf("stage %d: %w", stage, err)
+		}
+		next.TaskID, next.SubTaskID, next.Stage = ack.TaskID, ack.SubTaskID, ack.Stage
+		addr = net.JoinHostPort(ack.CheckerIP, strconv.Itoa(ack.CheckerPort))
+	}
+	return nil
+}
+
+// listenProbe 监听 ProbePort，无法监听（如端口被占用）时使用随机端口
+func listenProbe() (*net.UDPConn, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: ProbePort})
+	if err != nil {
+		conn, err = net.ListenUDP("udp", &net.UDPAddr{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listen UDP: %w", err)
+	}
+	return conn, nil
+}
+
+// probeStage 向 addr 发送最多 probeRounds 轮探测包，返回收到的第一个 ACK
+func probeStage(ctx context.Context, conn *net.UDPConn, addr string, payload probePayload) (*probeAck, error) {
+	checker, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("resolve checker %s: %w", addr, err)
+	}
+	deadline := time.Now().Add(probeTimeout)
+	buf := make([]byte, 2048)
+	for round := 1; round <= probeRounds; round++ {
+		payload.Round = round
+		for seq := 1; seq <= probeBurst; seq++ {
+			payload.Seq = seq
+			payload.Timestamp = time.Now().UnixMilli()
+			data, _ := json.Marshal(payload)
+			if _, err := conn.WriteToUDP(data, checker); err != nil {
+				return nil, fmt.Errorf("send probe to %s: %w", addr, err)
+			}
+		}
+		// 最后一轮之后一直等到 probeTimeout
+		wait := deadline
+		if round < probeRounds {
+			wait = time.Now().Add(probeRoundWait)
+		}
+		ack, err := readAck(conn, buf, wait)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if ack != nil || err != nil {
+			return ack, err
+		}
+	}
+	log.Printf("No ACK from NAT checker %s after %d rounds", addr, probeRounds)
+	return nil, fmt.Errorf("no ACK from %s after %d rounds", addr, probeRounds)
+}
+
+// readAck 读取 ACK 直到 deadline，忽略无法解析的包；超时返回 nil, nil
+func readAck(conn *net.UDPConn, buf []byte, deadline time.Time) (*probeAck, error) {
+	conn.SetReadDeadline(deadline)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("read ACK: %w", err)
+		}
+		var ack probeAck
+		if json.Unmarshal(buf[:n], &ack) == nil {
+			return &ack, nil
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Package taskstream 任务流客户端：通过 gRPC 双向流（message.ChatService/Chat）接收调度下发的
+// NAT 探测和带宽测试任务并执行，断线后指数退避重连
+package taskstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+
+	message "aro-ext-app/core/grpc/gen/grpc/message"
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/auth"
+	"aro-ext-app/core/internal/events"
+	"aro-ext-app/core/internal/speedtest"
+)
+
+// 任务类型，与 events.TaskEvent.Kind 一致
+const (
+	TaskNATProbe      = "nat_probe"
+	TaskBandwidthTest = "bandwidth_test"
+)
+
+// 默认参数
+const (
+	// DefaultMinBackoff 断线后第一次重连的等待时间
+	DefaultMinBackoff = time.Second
+	// DefaultMaxBackoff 连续重连失败时等待时间的上限
+	DefaultMaxBackoff = 5 * time.Minute
+	// stableAfter 连接保持超过这个时长后，下次断线重新从 MinBackoff 开始等待
+	stableAfter = time.Minute
+	// maxMessageSize 收发消息的大小上限
+	maxMessageSize = 16 * 1024 * 1024
+)
+
+// ProbeFunc 执行 NAT 探测任务
+type ProbeFunc func(ctx context.Context, task NATProbeTask, nodeID, token string) error
+
+// Options 任务流客户端的参数
+type Options struct {
+	// Address 任务流地址（GRPC_URL）：http:// 使用明文连接，https:// 或不带 scheme 使用 TLS，
+	// 未指定端口时使用 443（明文为 80）
+	Address string
+	// Client 提供节点 ID 和密钥，每次连接时生成 authtoken
+	Client *api_client.APIClient
+	// Speedtest 执行带宽测试任务，nil 使用全局的 speedtest.Service
+	Speedtest *speedtest.Service
+	// Events 接收 NAT 探测任务的 task.received 和 task.completed 事件，nil 使用全局事件总线
+	// 带宽测试任务的事件由 Speedtest 发布
+	Events *events.Bus
+	// Probe 执行 NAT 探测任务，nil 使用 ProbeNAT
+	Probe ProbeFunc
+	// MinBackoff、MaxBackoff 重连等待时间的范围，为 0 时使用默认值
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Stream 任务流客户端
+type Stream struct {
+	opts  Options
+	probe sync.Mutex     // NAT 探测共用 ProbePort，同一时间只执行一个
+	tasks sync.WaitGroup // 执行中的任务
+}
+
+// New 创建任务流客户端
+func New(opts Options) *Stream {
+	if opts.Speedtest == nil {
+		opts.Speedtest = speedtest.GetService()
+	}
+	if opts.Events == nil {
+		opts.Events = events.GetBus()
+	}
+	if opts.Probe == nil {
+		opts.Probe = ProbeNAT
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = DefaultMinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	return &Stream{opts: opts}
+}
+
+// Run 连接任务流并执行收到的任务，断线后指数退避重连，阻塞直到 ctx 结束
+// ctx 结束时关闭连接并取消执行中的 NAT 探测，返回前等待所有任务结束
+func (s *Stream) Run(ctx context.Context) {
+	defer s.tasks.Wait()
+
+	backoff := s.opts.MinBackoff
+	for {
+		start := time.Now()
+		err := s.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) >= stableAfter {
+			backoff = s.opts.MinBackoff
+		}
+		log.Printf("Task stream disconnected: %v, reconnecting in %v", err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > s.opts.MaxBackoff {
+			backoff = s.opts.MaxBackoff
+		}
+	}
+}
+
+// session 建立一次连接并接收任务，直到连接断开或 ctx 结束
+func (s *Stream) session(ctx context.Context) error {
+	target, creds, err := dialTarget(s.opts.Address)
+	if err != nil {
+		return err
+	}
+	conn, err := grpc.NewClient(target,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMessageSize), grpc.MaxCallSendMsgSize(maxMessageSize)),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                30 * time.Second,
+			Timeout:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("dial %s: %w", target, err)
+	}
+	defer conn.Close()
+
+	nodeID := s.opts.Client.ID()
+	token := auth.NewAuthCredentialsAt(nodeID, s.opts.Client.KeyPair().PrivateKey, s.opts.Client.Now()).Token
+	streamCtx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(ctx, "authtoken", token))
+	defer cancel()
+	stream, err := message.NewChatServiceClient(conn).Chat(streamCtx)
+	if err != nil {
+		return fmt.Errorf("open task stream: %w", err)
+	}
+	log.Printf("Task stream connected: %s", target)
+
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if msg.GetMessage() == "" {
+			continue
+		}
+		s.tasks.Add(1)
+		go func() {
+			defer s.tasks.Done()
+			s.handle(ctx, msg.GetMessage(), nodeID, token)
+		}()
+	}
+}
+
+// handle 按消息的 type 执行任务，未知类型按 NAT 探测任务处理
+func (s *Stream) handle(ctx context.Context, msg, nodeID, token string) {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal([]byte(msg), &head); err != nil {
+		log.Printf("Failed to parse task: %v", err)
+		return
+	}
+	if head.Type == TaskBandwidthTest {
+		s.opts.Speedtest.HandleTask(msg)
+		return
+	}
+
+	var task NATProbeTask
+	if err := json.Unmarshal([]byte(msg), &task); err != nil {
+		log.Printf("Failed to parse NAT probe task: %v", err)
+		return
+	}
+	s.opts.Events.Publish(events.TaskReceived, events.TaskEvent{Kind: TaskNATProbe, TaskID: task.TaskID})
+	s.probe.Lock()
+	err := s.opts.Probe(ctx, task, nodeID, token)
+	s.probe.Unlock()
+	completed := events.TaskEvent{Kind: TaskNATProbe, TaskID: task.TaskID, Success: err == nil}
+	if err != nil {
+		log.Printf("NAT probe %s failed: %v", task.TaskID, err)
+		completed.Error = err.Error()
+	}
+	s.opts.Events.Publish(events.TaskCompleted, completed)
+}
+
+// dialTarget 解析任务流地址，返回 gRPC 的目标地址和传输层凭证
+func dialTarget(address string) (string, credentials.TransportCredentials, error) {
+	if address == "" {
+		return "", nil, errors.New("task stream address is empty")
+	}
+	scheme, host := "https", address
+	if u, err := url.Parse(address); err == nil && u.Host != "" {
+		scheme, host = u.Scheme, u.Host
+	}
+	var creds credentials.TransportCredentials
+	port := "443"
+	switch scheme {
+	case "https":
+		creds = credentials.NewClientTLSFromCert(nil, "")
+	case "http":
+		creds = insecure.NewCredentials()
+		port = "80"
+	default:
+		return "", nil, fmt.Errorf("unsupported task stream scheme %q", scheme)
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, port)
+	}
+	return "dns:///" + host, creds, nil
+}
@@ -0,0 +1,185 @@
+package taskstream
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	message "aro-ext-app/core/grpc/gen/grpc/message"
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/events"
+)
+
+// chatServer 第一次连接发送一个 NAT 探测任务后断开，之后的连接保持到客户端退出
+type chatServer struct {
+	message.UnimplementedChatServiceServer
+	mu     sync.Mutex
+	tokens []string
+}
+
+func (s *chatServer) Chat(stream message.ChatService_ChatServer) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	s.mu.Lock()
+	s.tokens = append(s.tokens, strings.Join(md.Get("authtoken"), ","))
+	first := len(s.tokens) == 1
+	s.mu.Unlock()
+	if !first {
+		<-stream.Context().Done()
+		return nil
+	}
+	task, _ := json.Marshal(NATProbeTask{Type: TaskNATProbe, TaskID: "task-1", CheckerIP: "127.0.0.1", CheckerPort: 9})
+	return stream.Send(&message.GrpcMessage{Id: "1", Message: string(task)})
+}
+
+func (s *chatServer) connects() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tokens)
+}
+
+func TestStreamRunsTasksAndReconnects(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &chatServer{}
+	gs := grpc.NewServer()
+	message.RegisterChatServiceServer(gs, srv)
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	keyPair, err := crypto.GenerateKeyPair(crypto.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := api_client.NewAPIClient("http://127.0.0.1", "node-1", keyPair)
+	bus := events.NewBus(16)
+	ch, unsubscribe := bus.Subscribe(16)
+	defer unsubscribe()
+
+	probed := make(chan NATProbeTask, 1)
+	s := New(Options{
+		Address: "http://" + lis.Addr().String(),
+		Client:  client,
+		Events:  bus,
+		Probe: func(ctx context.Context, task NATProbeTask, nodeID, token string) error {
+			if nodeID != "node-1" || token == "" {
+				t.Errorf("probe got node %q, token %q", nodeID, token)
+			}
+			probed <- task
+			return nil
+		},
+		MinBackoff: 10 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case task := <-probed:
+		if task.TaskID != "task-1" || task.CheckerPort != 9 {
+			t.Fatalf("task = %+v", task)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("NAT probe task was not run")
+	}
+	var completed *events.TaskEvent
+	for completed == nil {
+		select {
+		case ev := <-ch:
+			if ev.Type == events.TaskCompleted {
+				te := ev.Data.(events.TaskEvent)
+				completed = &te
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no task.completed event")
+		}
+	}
+	if completed.Kind != TaskNATProbe || !completed.Success {
+		t.Fatalf("completed = %+v", completed)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.connects() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("client did not reconnect after the stream closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	srv.mu.Lock()
+	for i, token := range srv.tokens {
+		if token == "" {
+			t.Errorf("connection %d has no authtoken", i)
+		}
+	}
+	srv.mu.Unlock()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+}
+
+func TestProbeNATFollowsCheckers(t *testing.T) {
+	// 两个 checker：第一个把节点转到第二个，第二个应答后续的所有阶段
+	var mu sync.Mutex
+	var stages []int
+	startChecker := func(next func() (string, int)) *net.UDPConn {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			buf := make([]byte, 2048)
+			for {
+				n, addr, err := conn.ReadFromUDP(buf)
+				if err != nil {
+					return
+				}
+				var p probePayload
+				if json.Unmarshal(buf[:n], &p) != nil || p.Token != "token" || p.NodeID != "node-1" {
+					continue
+				}
+				mu.Lock()
+				if len(stages) > 0 && stages[len(stages)-1] == p.Stage {
+					mu.Unlock()
+					continue
+				}
+				stages = append(stages, p.Stage)
+				mu.Unlock()
+				ip, port := next()
+				ack, _ := json.Marshal(probeAck{TaskID: p.TaskID, SubTaskID: p.SubTaskID, Stage: p.Stage + 1, CheckerIP: ip, CheckerPort: port})
+				conn.WriteToUDP(ack, addr)
+			}
+		}()
+		return conn
+	}
+	var second *net.UDPConn
+	second = startChecker(func() (string, int) { return "127.0.0.1", second.LocalAddr().(*net.UDPAddr).Port })
+	defer second.Close()
+	first := startChecker(func() (string, int) { return "127.0.0.1", second.LocalAddr().(*net.UDPAddr).Port })
+	defer first.Close()
+
+	task := NATProbeTask{TaskID: "task-1", CheckerIP: "127.0.0.1", CheckerPort: uint32(first.LocalAddr().(*net.UDPAddr).Port)}
+	if err := ProbeNAT(context.Background(), task, "node-1", "token"); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(stages) != probeStages || stages[0] != 0 || stages[probeStages-1] != probeStages-1 {
+		t.Fatalf("stages = %v", stages)
+	}
+}
@@ -0,0 +1,189 @@
+package updater
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxSignatureSize 分离签名文件的最大字节数
+const maxSignatureSize = 4096
+
+// download 断点续传下载 url 到 path：已有部分内容时发送 Range 请求，
+// 服务器不支持 Range（返回 200）时从头下载
+func download(ctx context.Context, client *http.Client, url, path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// 上次已下载完整，交给校验步骤判断
+		return nil
+	default:
+		return fmt.Errorf("download failed with HTTP %d", resp.StatusCode)
+	}
+
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return fmt.Errorf("download interrupted: %w", err)
+	}
+	return f.Sync()
+}
+
+// fetchSignature 下载分离签名文件（<url>.sig）
+func fetchSignature(ctx context.Context, client *http.Client, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+".sig", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch signature: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch signature: HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSignatureSize))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// verify 校验制品的摘要和签名
+// checksum 为 md5（32 位）或 sha256（64 位）十六进制，为空时跳过；
+// signature 为 base64 编码的 Ed25519 签名，签名内容为制品的 SHA-256 摘要，必须存在
+func verify(path, checksum, signature string, key ed25519.PublicKey) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sum256 := sha256.New()
+	writers := []io.Writer{sum256}
+	var sumChecksum hash.Hash
+	checksum = strings.ToLower(strings.TrimSpace(checksum))
+	switch len(checksum) {
+	case 0:
+	case md5.Size * 2:
+		sumChecksum = md5.New()
+	case sha256.Size * 2:
+		sumChecksum = sha256.New()
+	default:
+		return fmt.Errorf("%w: unsupported checksum %q", ErrChecksumMismatch, checksum)
+	}
+	if sumChecksum != nil {
+		writers = append(writers, sumChecksum)
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return err
+	}
+
+	if sumChecksum != nil {
+		if got := hex.EncodeToString(sumChecksum.Sum(nil)); got != checksum {
+			return fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, checksum, got)
+		}
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("%w: malformed signature", ErrBadSignature)
+	}
+	if !ed25519.Verify(key, sum256.Sum(nil), sig) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// extract 将制品写到 dst：zip 制品提取名为 member 的文件，其他制品原样复制
+func extract(src, dst, member string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return fmt.Errorf("failed to open update archive: %w", err)
+		}
+		data = nil
+		for _, zf := range zr.File {
+			if zf.FileInfo().IsDir() || filepath.Base(zf.Name) != member {
+				continue
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			data, err = io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			break
+		}
+		if data == nil {
+			return fmt.Errorf("%s not found in update archive", member)
+		}
+	}
+	return writeFileSync(dst, data, 0755)
+}
+
+// writeFileSync 写入文件并落盘
+func writeFileSync(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
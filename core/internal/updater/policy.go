@@ -0,0 +1,142 @@
+package updater
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/constant"
+)
+
+// 更新渠道，对应 GetLastVersion 的 env 参数
+const (
+	ChannelDev     = "dev"
+	ChannelTestnet = "testnet"
+	ChannelMainnet = "mainnet"
+	ChannelBeta    = "beta"
+)
+
+// Channels 支持的更新渠道
+var Channels = []string{ChannelDev, ChannelTestnet, ChannelMainnet, ChannelBeta}
+
+// ValidateChannel 检查渠道名是否受支持
+func ValidateChannel(channel string) error {
+	for _, c := range Channels {
+		if c == channel {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown update channel %q, expected one of %v", channel, Channels)
+}
+
+// Policy 更新策略，由配置和节点身份决定
+type Policy struct {
+	// Channel 更新渠道
+	Channel string `json:"channel"`
+	// PinVersion 固定版本，非空时只会更新到该版本（用于冻结整个机群）
+	PinVersion string `json:"pin_version,omitempty"`
+	// ClientID 节点客户端 ID，用于计算灰度分桶
+	ClientID string `json:"-"`
+	// CurrentVersion 当前运行的版本
+	CurrentVersion string `json:"current_version"`
+}
+
+// PolicyFromConfig 从配置读取渠道和固定版本，未配置或配置非法时使用 constant.ENV 渠道
+func PolicyFromConfig(cfg *config.Config, clientID, currentVersion string) Policy {
+	channel := cfg.Get(config.KeyUpdateChannel)
+	if ValidateChannel(channel) != nil {
+		channel = constant.ENV
+	}
+	return Policy{
+		Channel:        channel,
+		PinVersion:     cfg.Get(config.KeyUpdatePinVersion),
+		ClientID:       clientID,
+		CurrentVersion: currentVersion,
+	}
+}
+
+// Decision 策略对某个发布版本的判定结果
+type Decision struct {
+	Update bool `json:"update"`
+	// Forced 当前版本低于最低支持版本，必须更新（不受灰度比例限制）
+	Forced bool `json:"forced"`
+	// Unsupported 当前版本低于最低支持版本但被固定版本阻止更新
+	Unsupported bool `json:"unsupported,omitempty"`
+	// Bucket 本节点在该版本灰度中的分桶（0-99），Bucket < 灰度比例时可以更新
+	Bucket int    `json:"bucket"`
+	Reason string `json:"reason"`
+}
+
+// Decide 判断是否应更新到 rel：
+//  1. 固定版本优先：只允许更新到固定的版本，即使当前版本已低于最低支持版本
+//  2. 当前版本低于 rel.MinVersion 时强制更新，忽略灰度比例
+//  3. 否则按 rel.RolloutPercent 灰度：以客户端 ID 和目标版本计算分桶，分桶落在比例内才更新
+func (p Policy) Decide(rel Release) Decision {
+	d := Decision{Bucket: RolloutBucket(p.ClientID, rel.Version)}
+	belowMin := rel.MinVersion != "" && Compare(p.CurrentVersion, rel.MinVersion) < 0
+
+	if rel.Version == "" || Compare(rel.Version, p.CurrentVersion) <= 0 {
+		d.Unsupported = belowMin
+		d.Reason = "already up to date"
+		return d
+	}
+
+	if p.PinVersion != "" {
+		if Compare(rel.Version, p.PinVersion) != 0 {
+			d.Unsupported = belowMin
+			d.Reason = fmt.Sprintf("pinned to version %s", p.PinVersion)
+			return d
+		}
+		d.Update = true
+		d.Forced = belowMin
+		d.Reason = "pinned version available"
+		return d
+	}
+
+	if belowMin {
+		d.Update = true
+		d.Forced = true
+		d.Reason = fmt.Sprintf("version %s is below the minimum supported version %s", p.CurrentVersion, rel.MinVersion)
+		return d
+	}
+
+	percent := 100
+	if rel.RolloutPercent != nil {
+		percent = *rel.RolloutPercent
+	}
+	if d.Bucket >= percent {
+		d.Reason = fmt.Sprintf("not in rollout (bucket %d, rollout %d%%)", d.Bucket, percent)
+		return d
+	}
+	d.Update = true
+	d.Reason = fmt.Sprintf("in rollout (bucket %d, rollout %d%%)", d.Bucket, percent)
+	return d
+}
+
+// RolloutBucket 根据客户端 ID 和版本计算稳定的灰度分桶（0-99）
+// 分桶与版本相关，避免每次都是同一批节点先收到更新
+func RolloutBucket(clientID, version string) int {
+	sum := sha256.Sum256([]byte(clientID + ":" + version))
+	return int(binary.BigEndian.Uint32(sum[:4]) % 100)
+}
+
+// FetchRelease 查询渠道的最新发布版本
+func FetchRelease(ctx context.Context, client *api_client.APIClient, channel string) (Release, error) {
+	resp, err := client.GetLastVersionContext(ctx, constant.PROGRAM_APP, channel)
+	if err != nil {
+		return Release{}, err
+	}
+	latest := resp.Data
+	return Release{
+		Version:        latest.Version,
+		URL:            latest.URL,
+		Checksum:       latest.Checksum,
+		Signature:      latest.Signature,
+		ReleaseNotes:   latest.ReleaseNotes,
+		MinVersion:     latest.MinVersion,
+		RolloutPercent: latest.RolloutPercent,
+	}, nil
+}
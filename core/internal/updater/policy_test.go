@@ -0,0 +1,57 @@
+package updater
+
+import (
+	"fmt"
+	"testing"
+)
+
+func percent(p int) *int { return &p }
+
+func TestPolicyDecide(t *testing.T) {
+	base := Policy{Channel: ChannelMainnet, ClientID: "node-1", CurrentVersion: "1.0.0"}
+	bucket := RolloutBucket("node-1", "1.1.0")
+
+	tests := []struct {
+		name        string
+		policy      Policy
+		rel         Release
+		update      bool
+		forced      bool
+		unsupported bool
+	}{
+		{"up to date", base, Release{Version: "1.0.0"}, false, false, false},
+		{"full rollout", base, Release{Version: "1.1.0"}, true, false, false},
+		{"inside rollout", base, Release{Version: "1.1.0", RolloutPercent: percent(bucket + 1)}, true, false, false},
+		{"outside rollout", base, Release{Version: "1.1.0", RolloutPercent: percent(bucket)}, false, false, false},
+		{"below minimum ignores rollout", base, Release{Version: "1.1.0", MinVersion: "1.0.1", RolloutPercent: percent(0)}, true, true, false},
+		{"pin blocks other versions", withPin(base, "1.0.5"), Release{Version: "1.1.0"}, false, false, false},
+		{"pin allows pinned version", withPin(base, "1.1.0"), Release{Version: "1.1.0", RolloutPercent: percent(0)}, true, false, false},
+		{"pin wins over minimum", withPin(base, "1.0.0"), Release{Version: "1.1.0", MinVersion: "1.1.0"}, false, false, true},
+	}
+	for _, tt := range tests {
+		d := tt.policy.Decide(tt.rel)
+		if d.Update != tt.update || d.Forced != tt.forced || d.Unsupported != tt.unsupported {
+			t.Errorf("%s: got %+v", tt.name, d)
+		}
+	}
+}
+
+func withPin(p Policy, pin string) Policy {
+	p.PinVersion = pin
+	return p
+}
+
+func TestRolloutBucketDistribution(t *testing.T) {
+	in := 0
+	for i := 0; i < 1000; i++ {
+		if RolloutBucket(fmt.Sprintf("node-%d", i), "1.1.0") < 25 {
+			in++
+		}
+	}
+	if in < 180 || in > 320 {
+		t.Errorf("expected roughly 25%% of nodes in a 25%% rollout, got %d/1000", in)
+	}
+	if RolloutBucket("node-1", "1.1.0") != RolloutBucket("node-1", "1.1.0") {
+		t.Error("expected a stable bucket")
+	}
+}
@@ -0,0 +1,81 @@
+package updater
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Compare 按语义化版本比较 a 和 b，a<b 返回 -1，相等返回 0，a>b 返回 1
+// 允许 "v" 前缀和缺省的 minor/patch；预发布版本（1.2.0-beta.1）低于对应正式版本，
+// 构建元数据（+build）不参与比较
+func Compare(a, b string) int {
+	aCore, aPre := splitVersion(a)
+	bCore, bPre := splitVersion(b)
+
+	for i := 0; i < 3; i++ {
+		if c := compareInt(aCore[i], bCore[i]); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case aPre == "" && bPre == "":
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return comparePrerelease(aPre, bPre)
+}
+
+// splitVersion 拆分出 major.minor.patch 和预发布部分，无法解析的数字按 0 处理
+func splitVersion(v string) ([3]int, string) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		v = v[:i]
+	}
+	pre := ""
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		v, pre = v[:i], v[i+1:]
+	}
+	var core [3]int
+	for i, part := range strings.SplitN(v, ".", 3) {
+		core[i], _ = strconv.Atoi(part)
+	}
+	return core, pre
+}
+
+func comparePrerelease(a, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		aNum, aErr := strconv.Atoi(aParts[i])
+		bNum, bErr := strconv.Atoi(bParts[i])
+		var c int
+		switch {
+		case aErr == nil && bErr == nil:
+			c = compareInt(aNum, bNum)
+		case aErr == nil:
+			c = -1 // 数字标识符低于字母标识符
+		case bErr == nil:
+			c = 1
+		default:
+			c = strings.Compare(aParts[i], bParts[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareInt(len(aParts), len(bParts))
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,373 @@
+package updater
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/errcode"
+)
+
+// 更新流程：
+//  1. Stage：下载（断点续传）→ 校验摘要和签名 → 解包到 staged/，状态变为 staged
+//  2. Apply：下次启动时在使用目标文件之前调用，把目标文件硬链接到 backup/，
+//     再把 staged 文件 rename 覆盖目标文件（原子替换），状态变为 trial
+//  3. 新版本启动后调用 Startup 记录试运行次数，首次健康检查通过后 Confirm，
+//     失败则 Rollback 恢复 backup/ 中的旧版本；试运行启动次数超过上限
+//     （新版本在健康检查前崩溃）时 Startup 自动回滚
+
+// StateFileName 更新状态文件名
+const StateFileName = "update.json"
+
+// DefaultMaxTrialStarts 新版本未通过健康检查时允许的最大启动次数
+const DefaultMaxTrialStarts = 2
+
+var (
+	ErrNoReleaseKey     = errcode.New(errcode.UpdateRejected, "no release key embedded, refusing to install unsigned updates")
+	ErrChecksumMismatch = errcode.New(errcode.UpdateRejected, "update checksum mismatch")
+	ErrBadSignature     = errcode.New(errcode.UpdateRejected, "update signature verification failed")
+	ErrNotNewer         = errcode.New(errcode.UpdateRejected, "release is not newer than the current version")
+	ErrRolledBack       = errors.New("update rolled back")
+)
+
+// Status 更新状态
+type Status string
+
+const (
+	StatusIdle   Status = "idle"   // 没有待处理的更新
+	StatusStaged Status = "staged" // 已下载校验，等待下次启动时替换
+	StatusTrial  Status = "trial"  // 已替换，等待新版本通过首次健康检查
+)
+
+// Release 待安装的版本，对应 api_client.LastVersionData
+type Release struct {
+	Version  string `json:"version"`
+	URL      string `json:"url"`
+	Checksum string `json:"checksum"`
+	// Signature base64 编码的 Ed25519 签名（签名内容为制品的 SHA-256 摘要），
+	// 为空时从 URL + ".sig" 下载
+	Signature    string `json:"signature"`
+	ReleaseNotes string `json:"release_notes,omitempty"`
+	// MinVersion 最低支持版本，低于该版本的节点必须更新
+	MinVersion string `json:"min_version,omitempty"`
+	// RolloutPercent 灰度比例（0-100），为空表示全量
+	RolloutPercent *int `json:"rollout_percent,omitempty"`
+}
+
+// State 持久化的更新状态
+type State struct {
+	Status          Status `json:"status"`
+	Version         string `json:"version,omitempty"`
+	PreviousVersion string `json:"previous_version,omitempty"`
+	// TrialStarts 新版本试运行期间的启动次数
+	TrialStarts int `json:"trial_starts,omitempty"`
+	// Failed 回滚过的版本，不会再自动安装
+	Failed    []string `json:"failed,omitempty"`
+	LastError string   `json:"last_error,omitempty"`
+	UpdatedAt int64    `json:"updated_at"`
+}
+
+// Options 更新器参数
+type Options struct {
+	// Dir 状态、下载、暂存和备份目录，必须与 Target 位于同一文件系统以保证 rename 原子性
+	Dir string
+	// Target 被更新的文件（动态库或可执行文件）
+	Target string
+	// CurrentVersion 当前运行的版本
+	CurrentVersion string
+	// PublicKey 发布签名公钥，为空时拒绝安装任何更新
+	PublicKey ed25519.PublicKey
+	// ArchiveMember 制品为 zip 时要提取的文件名，默认为 Target 的文件名
+	ArchiveMember string
+	// MaxTrialStarts 默认 DefaultMaxTrialStarts
+	MaxTrialStarts int
+	// HTTPClient 下载制品和签名，默认经过 api_client.Transport（熔断、连接失败和 5xx 时重试，
+	// 断点续传不受单次请求超时限制，由调用方的 ctx 控制）
+	HTTPClient *http.Client
+}
+
+// Updater 下载、暂存、替换和回滚单个目标文件
+type Updater struct {
+	opts Options
+	mu   sync.Mutex
+}
+
+// New 创建更新器
+func New(opts Options) (*Updater, error) {
+	if opts.Target == "" {
+		return nil, fmt.Errorf("update target is required")
+	}
+	if opts.Dir == "" {
+		opts.Dir = filepath.Join(filepath.Dir(opts.Target), "updates")
+	}
+	if opts.ArchiveMember == "" {
+		opts.ArchiveMember = filepath.Base(opts.Target)
+	}
+	if opts.MaxTrialStarts <= 0 {
+		opts.MaxTrialStarts = DefaultMaxTrialStarts
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Transport: api_client.NewTransport(api_client.RetryPolicyFromConfig(config.GetConfig()))}
+	}
+	for _, sub := range []string{"download", "staged", "backup"} {
+		if err := os.MkdirAll(filepath.Join(opts.Dir, sub), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create update dir: %w", err)
+		}
+	}
+	return &Updater{opts: opts}, nil
+}
+
+// ParsePublicKey 解析 base64 编码的 Ed25519 公钥，空字符串返回 nil
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	if s == "" {
+		return nil, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(data) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid release public key")
+	}
+	return ed25519.PublicKey(data), nil
+}
+
+// State 返回当前更新状态
+func (u *Updater) State() (State, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.load()
+}
+
+// Available 判断 rel 是否比当前版本新且没有被回滚过
+func (u *Updater) Available(rel Release) bool {
+	if rel.Version == "" || rel.URL == "" || Compare(rel.Version, u.opts.CurrentVersion) <= 0 {
+		return false
+	}
+	st, err := u.State()
+	if err != nil {
+		return true
+	}
+	for _, v := range st.Failed {
+		if v == rel.Version {
+			return false
+		}
+	}
+	return true
+}
+
+// Stage 下载、校验并暂存 rel，下次启动时由 Apply 替换目标文件
+// 下载中断后再次调用会从断点继续；校验失败时删除已下载内容
+func (u *Updater) Stage(ctx context.Context, rel Release) error {
+	if len(u.opts.PublicKey) == 0 {
+		return ErrNoReleaseKey
+	}
+	if !u.Available(rel) {
+		return ErrNotNewer
+	}
+
+	part := filepath.Join(u.opts.Dir, "download", filepath.Base(rel.Version)+".part")
+	if err := download(ctx, u.opts.HTTPClient, rel.URL, part); err != nil {
+		return err
+	}
+	signature := rel.Signature
+	if signature == "" {
+		var err error
+		if signature, err = fetchSignature(ctx, u.opts.HTTPClient, rel.URL); err != nil {
+			return err
+		}
+	}
+	if err := verify(part, rel.Checksum, signature, u.opts.PublicKey); err != nil {
+		os.Remove(part)
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	staged := u.stagedPath()
+	if err := extract(part, staged+".tmp", u.opts.ArchiveMember); err != nil {
+		os.Remove(staged + ".tmp")
+		return err
+	}
+	if err := os.Rename(staged+".tmp", staged); err != nil {
+		return err
+	}
+	os.Remove(part)
+
+	st, err := u.load()
+	if err != nil {
+		return err
+	}
+	st.Status = StatusStaged
+	st.Version = rel.Version
+	st.PreviousVersion = u.opts.CurrentVersion
+	st.TrialStarts = 0
+	st.LastError = ""
+	log.Printf("Update %s staged for %s", rel.Version, u.opts.Target)
+	return u.save(st)
+}
+
+// Apply 用暂存的新版本原子替换目标文件，没有暂存版本时返回 false
+// 必须在目标文件被加载/执行之前调用；替换后需要重启才会运行新版本
+func (u *Updater) Apply() (bool, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	st, err := u.load()
+	if err != nil || st.Status != StatusStaged {
+		return false, err
+	}
+
+	staged := u.stagedPath()
+	backup := u.backupPath()
+	info, err := os.Stat(u.opts.Target)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat update target: %w", err)
+	}
+	if err := os.Chmod(staged, info.Mode().Perm()); err != nil {
+		return false, err
+	}
+	os.Remove(backup)
+	if err := os.Link(u.opts.Target, backup); err != nil {
+		// 不支持硬链接（或 Windows 上目标文件正在运行不能被覆盖）时先移走旧文件
+		if err := os.Rename(u.opts.Target, backup); err != nil {
+			return false, fmt.Errorf("failed to back up %s: %w", u.opts.Target, err)
+		}
+	}
+	if err := os.Rename(staged, u.opts.Target); err != nil {
+		os.Rename(backup, u.opts.Target)
+		return false, fmt.Errorf("failed to replace %s: %w", u.opts.Target, err)
+	}
+
+	st.Status = StatusTrial
+	st.TrialStarts = 0
+	log.Printf("Update %s applied to %s, previous version backed up", st.Version, u.opts.Target)
+	return true, u.save(st)
+}
+
+// Startup 在每次启动时调用：当前运行的是试运行中的新版本时累加启动次数，
+// 超过 MaxTrialStarts 仍未确认则回滚并返回 ErrRolledBack（调用方应重启以运行旧版本）
+func (u *Updater) Startup() (State, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	st, err := u.load()
+	if err != nil || st.Status != StatusTrial || st.Version != u.opts.CurrentVersion {
+		return st, err
+	}
+	st.TrialStarts++
+	if st.TrialStarts > u.opts.MaxTrialStarts {
+		return u.rollback(st, fmt.Sprintf("not confirmed after %d starts", st.TrialStarts-1))
+	}
+	return st, u.save(st)
+}
+
+// Confirm 新版本通过健康检查，删除备份并结束试运行
+func (u *Updater) Confirm() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	st, err := u.load()
+	if err != nil || st.Status != StatusTrial {
+		return err
+	}
+	os.Remove(u.backupPath())
+	log.Printf("Update %s confirmed", st.Version)
+	st.Status = StatusIdle
+	st.TrialStarts = 0
+	st.LastError = ""
+	return u.save(st)
+}
+
+// Rollback 恢复备份的旧版本并把新版本记为失败，调用方应重启以运行旧版本
+func (u *Updater) Rollback(reason string) (State, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	st, err := u.load()
+	if err != nil {
+		return st, err
+	}
+	if st.Status != StatusTrial {
+		return st, fmt.Errorf("no update in trial to roll back")
+	}
+	return u.rollback(st, reason)
+}
+
+// HealthCheck 当前运行的是试运行中的新版本时执行 check：通过则 Confirm，失败则回滚并返回 ErrRolledBack
+func (u *Updater) HealthCheck(ctx context.Context, check func(context.Context) error) error {
+	st, err := u.State()
+	if err != nil || st.Status != StatusTrial || st.Version != u.opts.CurrentVersion {
+		return err
+	}
+	if err := check(ctx); err != nil {
+		if _, rbErr := u.Rollback(fmt.Sprintf("health check failed: %v", err)); rbErr != nil {
+			return rbErr
+		}
+		return ErrRolledBack
+	}
+	return u.Confirm()
+}
+
+// rollback 调用方需持有 mu
+func (u *Updater) rollback(st State, reason string) (State, error) {
+	if err := os.Rename(u.backupPath(), u.opts.Target); err != nil {
+		return st, fmt.Errorf("failed to restore previous version: %w", err)
+	}
+	log.Printf("Update %s rolled back to %s: %s", st.Version, st.PreviousVersion, reason)
+	st.Failed = append(st.Failed, st.Version)
+	st.Status = StatusIdle
+	st.TrialStarts = 0
+	st.LastError = reason
+	if err := u.save(st); err != nil {
+		return st, err
+	}
+	return st, ErrRolledBack
+}
+
+func (u *Updater) stagedPath() string {
+	return filepath.Join(u.opts.Dir, "staged", filepath.Base(u.opts.Target))
+}
+
+func (u *Updater) backupPath() string {
+	return filepath.Join(u.opts.Dir, "backup", filepath.Base(u.opts.Target))
+}
+
+// load 读取状态文件，不存在时返回 idle，调用方需持有 mu
+func (u *Updater) load() (State, error) {
+	st := State{Status: StatusIdle}
+	data, err := os.ReadFile(filepath.Join(u.opts.Dir, StateFileName))
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return State{Status: StatusIdle}, fmt.Errorf("corrupt update state: %w", err)
+	}
+	return st, nil
+}
+
+// save 原子写入状态文件，调用方需持有 mu
+func (u *Updater) save(st State) error {
+	st.UpdatedAt = time.Now().Unix()
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(u.opts.Dir, StateFileName)
+	if err := writeFileSync(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,250 @@
+package updater
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// release 本地 HTTP 替身提供的发布制品
+type release struct {
+	artifact  []byte
+	signature string
+}
+
+func newRelease(t *testing.T, priv ed25519.PrivateKey, member string, content []byte) release {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("dist/" + member)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(content)
+	zw.Close()
+	sum := sha256.Sum256(buf.Bytes())
+	return release{
+		artifact:  buf.Bytes(),
+		signature: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, sum[:])),
+	}
+}
+
+// serve 启动支持 Range 的本地发布服务器，记录收到的 Range 请求数
+func serve(t *testing.T, rel release, ranged *atomic.Int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/lib.zip":
+			if r.Header.Get("Range") != "" {
+				ranged.Add(1)
+			}
+			http.ServeContent(w, r, "lib.zip", time.Time{}, bytes.NewReader(rel.artifact))
+		case "/lib.zip.sig":
+			w.Write([]byte(rel.signature + "\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newUpdater(t *testing.T, dir, target, current string, pub ed25519.PublicKey) *Updater {
+	t.Helper()
+	u, err := New(Options{Dir: filepath.Join(dir, "updates"), Target: target, CurrentVersion: current, PublicKey: pub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"0.0.5", "0.0.5", 0},
+		{"0.0.5", "0.0.10", -1},
+		{"v1.2", "1.2.0", 0},
+		{"1.2.0-beta.1", "1.2.0", -1},
+		{"1.2.0-beta.2", "1.2.0-beta.10", -1},
+		{"1.2.0-alpha", "1.2.0-1", 1},
+		{"2.0.0+build.5", "2.0.0", 0},
+		{"1.10.0", "1.9.9", 1},
+	}
+	for _, tt := range tests {
+		if got := Compare(tt.a, tt.b); got != tt.want {
+			t.Errorf("Compare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestStageApplyConfirm(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	dir := t.TempDir()
+	target := filepath.Join(dir, "libstudy.so")
+	os.WriteFile(target, []byte("v1"), 0755)
+
+	rel := newRelease(t, priv, "libstudy.so", []byte("v2"))
+	var ranged atomic.Int32
+	srv := serve(t, rel, &ranged)
+	md5sum := md5.Sum(rel.artifact)
+
+	// 模拟上次下载中断：已有前半部分
+	u := newUpdater(t, dir, target, "1.0.0", pub)
+	os.WriteFile(filepath.Join(dir, "updates", "download", "1.1.0.part"), rel.artifact[:len(rel.artifact)/2], 0600)
+
+	r := Release{Version: "1.1.0", URL: srv.URL + "/lib.zip", Checksum: hex.EncodeToString(md5sum[:])}
+	if err := u.Stage(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if ranged.Load() != 1 {
+		t.Errorf("expected the download to resume with a Range request")
+	}
+	if got := readFile(t, target); got != "v1" {
+		t.Fatalf("target replaced before Apply: %q", got)
+	}
+
+	applied, err := u.Apply()
+	if err != nil || !applied {
+		t.Fatalf("apply = %v, %v", applied, err)
+	}
+	if got := readFile(t, target); got != "v2" {
+		t.Fatalf("target = %q after Apply", got)
+	}
+
+	// 新版本启动并通过健康检查
+	u2 := newUpdater(t, dir, target, "1.1.0", pub)
+	if st, err := u2.Startup(); err != nil || st.Status != StatusTrial || st.TrialStarts != 1 {
+		t.Fatalf("startup = %+v, %v", st, err)
+	}
+	if err := u2.HealthCheck(context.Background(), func(context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := u2.State(); st.Status != StatusIdle {
+		t.Errorf("status = %s after confirm", st.Status)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "updates", "backup", "libstudy.so")); !os.IsNotExist(err) {
+		t.Error("expected backup to be removed after confirm")
+	}
+}
+
+func TestHealthCheckFailureRollsBack(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	dir := t.TempDir()
+	target := filepath.Join(dir, "aro-node")
+	os.WriteFile(target, []byte("v1"), 0755)
+
+	rel := newRelease(t, priv, "aro-node", []byte("v2"))
+	var ranged atomic.Int32
+	srv := serve(t, rel, &ranged)
+
+	u := newUpdater(t, dir, target, "1.0.0", pub)
+	r := Release{Version: "1.1.0", URL: srv.URL + "/lib.zip", Signature: rel.signature}
+	if err := u.Stage(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Apply(); err != nil {
+		t.Fatal(err)
+	}
+
+	u2 := newUpdater(t, dir, target, "1.1.0", pub)
+	u2.Startup()
+	err := u2.HealthCheck(context.Background(), func(context.Context) error { return errors.New("backend unreachable") })
+	if !errors.Is(err, ErrRolledBack) {
+		t.Fatalf("expected rollback, got %v", err)
+	}
+	if got := readFile(t, target); got != "v1" {
+		t.Fatalf("target = %q after rollback", got)
+	}
+	if u.Available(r) {
+		t.Error("expected rolled back version not to be offered again")
+	}
+}
+
+func TestUnconfirmedStartsRollBack(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	dir := t.TempDir()
+	target := filepath.Join(dir, "aro-node")
+	os.WriteFile(target, []byte("v1"), 0755)
+	rel := newRelease(t, priv, "aro-node", []byte("v2"))
+	var ranged atomic.Int32
+	srv := serve(t, rel, &ranged)
+
+	u := newUpdater(t, dir, target, "1.0.0", pub)
+	if err := u.Stage(context.Background(), Release{Version: "1.1.0", URL: srv.URL + "/lib.zip"}); err != nil {
+		t.Fatal(err)
+	}
+	u.Apply()
+
+	// 新版本每次都在健康检查前崩溃
+	u2 := newUpdater(t, dir, target, "1.1.0", pub)
+	var err error
+	for i := 0; i <= DefaultMaxTrialStarts && err == nil; i++ {
+		_, err = u2.Startup()
+	}
+	if !errors.Is(err, ErrRolledBack) {
+		t.Fatalf("expected rollback after %d starts, got %v", DefaultMaxTrialStarts, err)
+	}
+	if got := readFile(t, target); got != "v1" {
+		t.Fatalf("target = %q after rollback", got)
+	}
+}
+
+func TestStageRejectsBadArtifacts(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	_, otherPriv, _ := ed25519.GenerateKey(nil)
+	dir := t.TempDir()
+	target := filepath.Join(dir, "libstudy.so")
+	os.WriteFile(target, []byte("v1"), 0755)
+
+	good := newRelease(t, priv, "libstudy.so", []byte("v2"))
+	forged := newRelease(t, otherPriv, "libstudy.so", []byte("evil"))
+	var ranged atomic.Int32
+	srv := serve(t, forged, &ranged)
+
+	u := newUpdater(t, dir, target, "1.0.0", pub)
+	url := srv.URL + "/lib.zip"
+	if err := u.Stage(context.Background(), Release{Version: "1.1.0", URL: url}); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("forged signature: got %v", err)
+	}
+	if err := u.Stage(context.Background(), Release{Version: "1.1.0", URL: url, Signature: good.signature}); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("signature for another artifact: got %v", err)
+	}
+	if err := u.Stage(context.Background(), Release{Version: "1.1.0", URL: url, Checksum: strings.Repeat("0", 32), Signature: forged.signature}); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("bad checksum: got %v", err)
+	}
+	if err := u.Stage(context.Background(), Release{Version: "0.9.0", URL: url}); !errors.Is(err, ErrNotNewer) {
+		t.Errorf("older release: got %v", err)
+	}
+	if st, _ := u.State(); st.Status != StatusIdle {
+		t.Errorf("status = %s after rejected artifacts", st.Status)
+	}
+
+	unsigned := newUpdater(t, dir, target, "1.0.0", nil)
+	if err := unsigned.Stage(context.Background(), Release{Version: "1.1.0", URL: url}); !errors.Is(err, ErrNoReleaseKey) {
+		t.Errorf("missing release key: got %v", err)
+	}
+}
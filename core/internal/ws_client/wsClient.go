@@ -57,15 +57,15 @@ func SetWsClientUrl(wsurl string) {
 func GetWebSocketClient() *WebSocketClient {
 
 	once.Do(func() {
-		cfg := config.GetConfig()
+		settings, _ := config.GetConfig().Settings()
 
 		// 创建带重连配置的客户端
 		wsConfig := WSConfig{
-			AutoConnect:          false,                                                                  // 默认 false
-			Reconnection:         true,                                                                   // 默认 true
-			ReconnectionAttempts: 5,                                                                      // 默认 5
-			ReconnectionDelay:    time.Duration(cfg.GetInt("RECONNECTION_DELAY")) * time.Millisecond,     // 默认 5000
-			ReconnectionDelayMax: time.Duration(cfg.GetInt("RECONNECTION_DELAY_MAX")) * time.Millisecond, // 默认 10000
+			AutoConnect:          false,                                                              // 默认 false
+			Reconnection:         true,                                                               // 默认 true
+			ReconnectionAttempts: 5,                                                                  // 默认 5
+			ReconnectionDelay:    time.Duration(settings.WS.ReconnectionDelay) * time.Millisecond,    // ws.reconnection_delay
+			ReconnectionDelayMax: time.Duration(settings.WS.ReconnectionDelayMax) * time.Millisecond, // ws.reconnection_delay_max
 		}
 
 		websocketClientInstance = &WebSocketClient{
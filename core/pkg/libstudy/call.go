@@ -0,0 +1,44 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import "unsafe"
+
+// 在 Go 侧调用导出函数的辅助函数，负责 C 字符串的分配和释放
+// _test.go 不能使用 cgo，端到端测试通过这些函数驱动导出接口
+
+// takeCString 转换导出函数返回的 C 字符串并释放
+func takeCString(s *C.char) string {
+	if s == nil {
+		return ""
+	}
+	defer C.free(unsafe.Pointer(s))
+	return C.GoString(s)
+}
+
+// callNoArgs 调用无参数的导出函数
+func callNoArgs(fn func() *C.char) string {
+	return takeCString(fn())
+}
+
+// callString 调用以一个字符串为参数的导出函数
+func callString(fn func(*C.char) *C.char, arg string) string {
+	cs := C.CString(arg)
+	defer C.free(unsafe.Pointer(cs))
+	return takeCString(fn(cs))
+}
+
+// callHandle 调用以节点句柄为参数的导出函数
+func callHandle(fn func(C.longlong) *C.char, handle int64) string {
+	return takeCString(fn(C.longlong(handle)))
+}
+
+// callHandleString 调用以节点句柄和一个字符串为参数的导出函数
+func callHandleString(fn func(C.longlong, *C.char) *C.char, handle int64, arg string) string {
+	cs := C.CString(arg)
+	defer C.free(unsafe.Pointer(cs))
+	return takeCString(fn(C.longlong(handle), cs))
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/clock"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/constant"
+	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/datadir"
+	"aro-ext-app/core/internal/errcode"
+	"aro-ext-app/core/internal/events"
+	"aro-ext-app/core/internal/identity"
+	"aro-ext-app/core/internal/ledger"
+	"aro-ext-app/core/internal/mockbackend"
+	"aro-ext-app/core/internal/storage"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 端到端测试：通过导出函数驱动 libstudy，后端为进程内的 mockbackend
+
+var backend *mockbackend.Backend
+
+func TestMain(m *testing.M) {
+	os.Exit(runMain(m))
+}
+
+func runMain(m *testing.M) int {
+	logrus.SetOutput(os.Stderr)
+
+	// 密钥对、config.env、日志、崩溃报告都写在数据目录，测试在临时目录中运行
+	dir, err := os.MkdirTemp("", "libstudy-e2e")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+	os.Setenv("HOME", dir)
+	datadir.Set(filepath.Join(dir, "data"))
+	config.GetConfig().Reload()
+
+	backend = mockbackend.Start()
+	defer backend.Close()
+	return m.Run()
+}
+
+// ffiResponse 导出函数返回的 JSON
+type ffiResponse struct {
+	Code      int             `json:"code"`
+	Message   string          `json:"message"`
+	ErrorCode errcode.Code    `json:"error_code"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func decode(t *testing.T, name, out string) ffiResponse {
+	t.Helper()
+	var resp ffiResponse
+	if err := json.Unmarshal([]byte(out), &resp); err != nil {
+		t.Fatalf("%s returned invalid JSON %q: %v", name, out, err)
+	}
+	return resp
+}
+
+// mustOK 检查导出函数成功（包括原样返回的后端响应也带有 error_code）并把 data 解码到 v
+func mustOK(t *testing.T, name, out string, v interface{}) {
+	t.Helper()
+	resp := decode(t, name, out)
+	if resp.Code != 200 || resp.ErrorCode != errcode.OK {
+		t.Fatalf("%s failed: %s", name, out)
+	}
+	if v != nil {
+		if err := json.Unmarshal(resp.Data, v); err != nil {
+			t.Fatalf("%s data: %v", name, err)
+		}
+	}
+}
+
+func initLibstudy(t *testing.T) string {
+	t.Helper()
+	params := fmt.Sprintf(`{"config":{"BaseAPIURL":%q}}`, backend.URL())
+	var details struct {
+		ClientID string `json:"client_id"`
+		APIURL   string `json:"api_url"`
+	}
+	mustOK(t, "InitLibstudy", callString(InitLibstudy, params), &details)
+	if details.APIURL != backend.URL() {
+		t.Fatalf("expected api_url %s, got %s", backend.URL(), details.APIURL)
+	}
+	return details.ClientID
+}
+
+func TestE2EDefaultNode(t *testing.T) {
+	clientID := initLibstudy(t)
+
+	var signUp api_client.SignUpData
+	mustOK(t, "NodeSignUp", callNoArgs(NodeSignUp), &signUp)
+	n, ok := backend.Node(clientID)
+	if !ok || n.SerialNumber != signUp.SerialNumber {
+		t.Fatalf("expected backend to register %s as %s, got %+v", clientID, signUp.SerialNumber, n)
+	}
+
+	mustOK(t, "NodeReportBaseInfo", callString(NodeReportBaseInfo, `{"sysPlatform":"linux","sysCpu":8,"language":"en"}`), nil)
+	if n, _ := backend.Node(clientID); n.BaseInfo == nil || n.BaseInfo.SysCPU != 8 {
+		t.Errorf("expected base info to reach the backend, got %+v", n.BaseInfo)
+	}
+	var sys struct {
+		Report api_client.NodeReportBaseInfoRequest `json:"report"`
+	}
+	mustOK(t, "GetSystemInfo", callNoArgs(GetSystemInfo), &sys)
+	if sys.Report.SysCPU != 8 || sys.Report.Arch == "" {
+		t.Errorf("expected collected info with overrides, got %+v", sys.Report)
+	}
+
+	var clk clock.Status
+	mustOK(t, "GetClockStatus", callNoArgs(GetClockStatus), &clk)
+	if clk.Skewed || clk.LastSync == 0 {
+		t.Errorf("expected the clock to be checked against the backend, got %+v", clk)
+	}
+
+	var clone identity.CloneStatus
+	mustOK(t, "GetIdentityStatus", callNoArgs(GetIdentityStatus), &clone)
+	if clone.Cloned || clone.HardwareID == "" {
+		t.Errorf("expected the identity to belong to this device, got %+v", clone)
+	}
+
+	var stat api_client.NodeStatData
+	mustOK(t, "GetNodeStat", callNoArgs(GetNodeStat), &stat)
+	if stat.Bind {
+		t.Errorf("expected unbound node, got %+v", stat)
+	}
+	backend.Bind(clientID, storage.BindUser{UUID: "user-1", Email: "user@example.com"})
+	mustOK(t, "GetNodeStat", callNoArgs(GetNodeStat), &stat)
+	if !stat.Bind || stat.BindUser == nil || stat.BindUser.UUID != "user-1" {
+		t.Errorf("expected bound node, got %+v", stat)
+	}
+	if got := config.GetConfig().Get(config.USER_ID); got != "user-1" {
+		t.Errorf("expected bound user to be saved, got %q", got)
+	}
+
+	// 奖励数据中未声明的字段原样返回给 Flutter
+	backend.SetRewards(api_client.RewardsData{TotalRewards: 42}, map[string]interface{}{"streakDays": 3})
+	var rewards map[string]interface{}
+	mustOK(t, "GetRewards", callNoArgs(GetRewards), &rewards)
+	if rewards["totalRewards"] != float64(42) || rewards["streakDays"] != float64(3) {
+		t.Errorf("unexpected rewards %v", rewards)
+	}
+
+	backend.SetRelease(mockbackend.Release{
+		Program: string(constant.PROGRAM_APP),
+		Channel: config.GetConfig().Get(config.KeyUpdateChannel),
+		LastVersionData: api_client.LastVersionData{
+			Version: "99.0.0",
+			URL:     backend.URL() + "/downloads/libstudy.zip",
+		},
+	})
+	cursor := events.GetBus().Cursor()
+	var latest api_client.LastVersionData
+	mustOK(t, "GetLastVersion", callNoArgs(GetLastVersion), &latest)
+	if latest.Version != "99.0.0" {
+		t.Errorf("expected release 99.0.0, got %+v", latest)
+	}
+	if !hasEvent(cursor, events.OTAAvailable) {
+		t.Error("expected ota.available event")
+	}
+}
+
+func TestE2EBackendFailures(t *testing.T) {
+	initLibstudy(t)
+	mustOK(t, "NodeSignUp", callNoArgs(NodeSignUp), nil)
+	defer backend.ClearFaults()
+
+	cursor := events.GetBus().Cursor()
+	backend.Inject(mockbackend.Fault{Path: mockbackend.StatPath, Status: 401, Message: "token expired", Times: 1})
+	resp := decode(t, "GetNodeStat", callNoArgs(GetNodeStat))
+	if resp.ErrorCode != errcode.AuthFailed {
+		t.Errorf("expected AUTH_FAILED, got %+v", resp)
+	}
+	if !hasEvent(cursor, events.AuthFailed) {
+		t.Error("expected auth.failed event")
+	}
+
+	backend.Inject(mockbackend.Fault{Path: mockbackend.RewardsPath, Code: 500, Message: "database down", Times: 1})
+	if resp := decode(t, "GetRewards", callNoArgs(GetRewards)); resp.ErrorCode != errcode.BackendError {
+		t.Errorf("expected BACKEND_ERROR, got %+v", resp)
+	}
+
+	backend.Inject(mockbackend.Fault{Path: mockbackend.StatPath, Body: `{"code":200,"data":{"bind":true}}`, Times: 1})
+	if resp := decode(t, "GetNodeStat", callNoArgs(GetNodeStat)); resp.ErrorCode != errcode.BackendError {
+		t.Errorf("expected stat without serialNumber to be rejected, got %+v", resp)
+	}
+
+	mustOK(t, "GetNodeStat", callNoArgs(GetNodeStat), nil)
+}
+
+func TestE2ENodeHandles(t *testing.T) {
+	opts, _ := json.Marshal(map[string]string{"dir": t.TempDir(), "api_url": backend.URL()})
+	var created struct {
+		Handle   int64  `json:"handle"`
+		ClientID string `json:"client_id"`
+	}
+	mustOK(t, "CreateNode", callString(CreateNode, string(opts)), &created)
+	defer callHandle(DestroyNode, created.Handle)
+
+	var signUp api_client.SignUpData
+	mustOK(t, "NodeHandleSignUp", callHandle(NodeHandleSignUp, created.Handle), &signUp)
+	if n, ok := backend.Node(created.ClientID); !ok || n.SerialNumber != signUp.SerialNumber {
+		t.Fatalf("expected handle node to be registered, got %+v", n)
+	}
+	mustOK(t, "NodeHandleGetNodeStat", callHandle(NodeHandleGetNodeStat, created.Handle), nil)
+
+	var rotated identity.RotateResult
+	mustOK(t, "NodeHandleRotateKey", callHandle(NodeHandleRotateKey, created.Handle), &rotated)
+	if n, _ := backend.Node(created.ClientID); n.Rotations != 1 || rotated.GraceUntil == 0 {
+		t.Errorf("expected the key to be rotated, got %+v", rotated)
+	}
+	mustOK(t, "NodeHandleGetNodeStat", callHandle(NodeHandleGetNodeStat, created.Handle), nil)
+
+	if resp := decode(t, "NodeHandleGetRewards", callHandle(NodeHandleGetRewards, created.Handle+1000)); resp.ErrorCode != errcode.NodeNotFound {
+		t.Errorf("expected NODE_NOT_FOUND for unknown handle, got %+v", resp)
+	}
+}
+
+// TestE2ELedger GetRewards 查询到的积分记入节点的本地账本
+func TestE2ELedger(t *testing.T) {
+	opts, _ := json.Marshal(map[string]string{"dir": t.TempDir(), "api_url": backend.URL()})
+	var created struct {
+		Handle int64 `json:"handle"`
+	}
+	mustOK(t, "CreateNode", callString(CreateNode, string(opts)), &created)
+	defer callHandle(DestroyNode, created.Handle)
+	mustOK(t, "NodeHandleSignUp", callHandle(NodeHandleSignUp, created.Handle), nil)
+
+	// 第一次查询只作为基准
+	backend.SetRewards(api_client.RewardsData{TotalRewards: 10}, nil)
+	mustOK(t, "NodeHandleGetRewards", callHandle(NodeHandleGetRewards, created.Handle), nil)
+	backend.SetRewards(api_client.RewardsData{TotalRewards: 25}, nil)
+	mustOK(t, "NodeHandleGetRewards", callHandle(NodeHandleGetRewards, created.Handle), nil)
+
+	var summaries []ledger.Summary
+	mustOK(t, "NodeHandleGetLedger", callHandleString(NodeHandleGetLedger, created.Handle, `{"granularity":"total"}`), &summaries)
+	if len(summaries) != 1 || summaries[0].Points != 15 {
+		t.Errorf("expected 15 points in the ledger, got %+v", summaries)
+	}
+	if resp := decode(t, "NodeHandleGetLedger", callHandleString(NodeHandleGetLedger, created.Handle, `{"granularity":"week"}`)); resp.ErrorCode != errcode.InvalidParams {
+		t.Errorf("expected INVALID_PARAMS for an unknown granularity, got %+v", resp)
+	}
+
+	// 带宽测试（这里是无效的任务）的结果记入节点的账本
+	if resp := decode(t, "NodeHandleRunSpeedtest", callHandleString(NodeHandleRunSpeedtest, created.Handle, `{}`)); resp.ErrorCode == errcode.OK {
+		t.Errorf("expected an invalid bandwidth test task to fail, got %+v", resp)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mustOK(t, "NodeHandleGetLedger", callHandleString(NodeHandleGetLedger, created.Handle, `{"granularity":"total"}`), &summaries)
+		if len(summaries) == 1 && summaries[0].BandwidthTestsFailed == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(summaries) != 1 || summaries[0].BandwidthTestsFailed != 1 {
+		t.Errorf("expected the failed bandwidth test in the ledger, got %+v", summaries)
+	}
+
+	var report ledger.Report
+	mustOK(t, "NodeHandleGetLedgerReconciliation", callHandleString(NodeHandleGetLedgerReconciliation, created.Handle, `{}`), &report)
+	if report.SettleLag != 1 || report.Discrepancies == nil {
+		t.Errorf("unexpected reconciliation report %+v", report)
+	}
+}
+
+// TestE2ERSANode 旧版本的 RSA 节点继续使用不带算法的令牌
+func TestE2ERSANode(t *testing.T) {
+	t.Setenv("KEY_TYPE", "rsa")
+	opts, _ := json.Marshal(map[string]string{"dir": t.TempDir(), "api_url": backend.URL()})
+	var created struct {
+		Handle   int64  `json:"handle"`
+		ClientID string `json:"client_id"`
+	}
+	mustOK(t, "CreateNode", callString(CreateNode, string(opts)), &created)
+	defer callHandle(DestroyNode, created.Handle)
+
+	mustOK(t, "NodeHandleSignUp", callHandle(NodeHandleSignUp, created.Handle), nil)
+	if n, ok := backend.Node(created.ClientID); !ok || crypto.KeyTypeOf(n.PublicKey) != crypto.KeyTypeRSA {
+		t.Fatalf("expected the node to be registered with an RSA key, got %+v", n)
+	}
+	mustOK(t, "NodeHandleGetNodeStat", callHandle(NodeHandleGetNodeStat, created.Handle), nil)
+}
+
+// TestE2EIdentityBackup 导出一个节点的身份，在另一个数据目录中恢复
+func TestE2EIdentityBackup(t *testing.T) {
+	createNode := func() (int64, string) {
+		opts, _ := json.Marshal(map[string]string{"dir": t.TempDir(), "api_url": backend.URL()})
+		var created struct {
+			Handle   int64  `json:"handle"`
+			ClientID string `json:"client_id"`
+		}
+		mustOK(t, "CreateNode", callString(CreateNode, string(opts)), &created)
+		return created.Handle, created.ClientID
+	}
+	original, clientID := createNode()
+	defer callHandle(DestroyNode, original)
+	mustOK(t, "NodeHandleSignUp", callHandle(NodeHandleSignUp, original), nil)
+
+	if resp := decode(t, "NodeHandleExportIdentity", callHandleString(NodeHandleExportIdentity, original, "")); resp.ErrorCode != errcode.InvalidParams {
+		t.Errorf("expected an empty passphrase to be rejected, got %+v", resp)
+	}
+	var exported struct {
+		Backup string `json:"backup"`
+	}
+	mustOK(t, "NodeHandleExportIdentity", callHandleString(NodeHandleExportIdentity, original, "secret"), &exported)
+
+	restored, _ := createNode()
+	defer callHandle(DestroyNode, restored)
+	params, _ := json.Marshal(map[string]string{"backup": exported.Backup, "passphrase": "wrong"})
+	if resp := decode(t, "NodeHandleImportIdentity", callHandleString(NodeHandleImportIdentity, restored, string(params))); resp.ErrorCode != errcode.InvalidBackup {
+		t.Errorf("expected INVALID_BACKUP for a wrong passphrase, got %+v", resp)
+	}
+	params, _ = json.Marshal(map[string]string{"backup": exported.Backup, "passphrase": "secret"})
+	var info identity.BackupInfo
+	mustOK(t, "NodeHandleImportIdentity", callHandleString(NodeHandleImportIdentity, restored, string(params)), &info)
+	if info.ClientID != clientID {
+		t.Fatalf("expected identity %s to be restored, got %+v", clientID, info)
+	}
+	mustOK(t, "NodeHandleGetNodeStat", callHandle(NodeHandleGetNodeStat, restored), nil)
+}
+
+// TestE2EDataDirMigration 旧版本保存在当前目录的身份在 InitLibstudy 时迁移到 data_dir
+func TestE2EDataDirMigration(t *testing.T) {
+	clientID := initLibstudy(t)
+	publicKey := defaultNode.KeyPair.PublicKey
+	previous := datadir.Get()
+	defer datadir.Set(previous)
+
+	// 模拟旧版本的布局：密钥和配置在当前目录
+	cwd, _ := os.Getwd()
+	for _, name := range []string{crypto.KeyFileName, crypto.KeyFileName + ".pub", "config.env"} {
+		if err := os.Rename(filepath.Join(previous, name), filepath.Join(cwd, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dataDir := t.TempDir()
+	params, _ := json.Marshal(map[string]interface{}{
+		"config":   map[string]string{"BaseAPIURL": backend.URL()},
+		"data_dir": dataDir,
+	})
+	var details struct {
+		ClientID string   `json:"client_id"`
+		DataDir  string   `json:"data_dir"`
+		Migrated []string `json:"migrated"`
+	}
+	mustOK(t, "InitLibstudy", callString(InitLibstudy, string(params)), &details)
+	if details.DataDir != dataDir || len(details.Migrated) != 3 {
+		t.Fatalf("expected the legacy files to move to %s, got %+v", dataDir, details)
+	}
+	if details.ClientID != clientID || !defaultNode.KeyPair.PublicKey.Equal(publicKey) {
+		t.Errorf("expected the migrated identity %s to be loaded, got %s", clientID, details.ClientID)
+	}
+	if _, err := os.Stat(filepath.Join(cwd, crypto.KeyFileName)); !os.IsNotExist(err) {
+		t.Error("expected the key to be removed from the working directory")
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "libstudy.log")); err != nil {
+		t.Errorf("expected the log in the data dir: %v", err)
+	}
+	logrus.SetOutput(os.Stderr)
+}
+
+func hasEvent(cursor uint64, typ events.Type) bool {
+	for _, e := range events.GetBus().Since(cursor, 0).Events {
+		if e.Type == typ {
+			return true
+		}
+	}
+	return false
+}
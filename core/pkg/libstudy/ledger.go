@@ -0,0 +1,140 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"aro-ext-app/core/internal/errcode"
+	"aro-ext-app/core/internal/ledger"
+	"aro-ext-app/core/internal/node"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ======================
+// 本地账本导出函数
+// ======================
+// 节点按小时记录代理流量、连接数、带宽测试、在线时长和后端积分（见 ledger 包），
+// 心跳运行期间（NodeSignUp 之后）持续记录，保存在数据目录的本地存储中
+
+// defaultLedgerRange 未指定 from 时查询的时长
+const defaultLedgerRange = 7 * 24 * time.Hour
+
+// ledgerParams GetLedger、GetLedgerReconciliation 的参数
+type ledgerParams struct {
+	From        int64              `json:"from"`
+	To          int64              `json:"to"`
+	Granularity ledger.Granularity `json:"granularity"`
+	UTCOffset   *int               `json:"utc_offset"`
+	SettleLag   int                `json:"settle_lag"`
+	MinOnline   int64              `json:"min_online"`
+}
+
+// parseLedgerParams 解析参数，返回时区已确定的 [from, to)
+func parseLedgerParams(paramsJSON string) (ledgerParams, time.Time, time.Time, error) {
+	var params ledgerParams
+	if paramsJSON != "" {
+		if err := json.Unmarshal([]byte(paramsJSON), &params); err != nil {
+			return params, time.Time{}, time.Time{}, errcode.Errorf(errcode.InvalidParams, "JSON parsing failed: %s", err.Error())
+		}
+	}
+	loc := time.Local
+	if params.UTCOffset != nil {
+		loc = time.FixedZone("", *params.UTCOffset)
+	}
+	to := time.Now().In(loc)
+	if params.To > 0 {
+		to = time.Unix(params.To, 0).In(loc)
+	}
+	from := to.Add(-defaultLedgerRange)
+	if params.From > 0 {
+		from = time.Unix(params.From, 0).In(loc)
+	}
+	if !from.Before(to) {
+		return params, from, to, errcode.Errorf(errcode.InvalidParams, "from (%d) must be before to (%d)", from.Unix(), to.Unix())
+	}
+	return params, from, to, nil
+}
+
+// GetLedger 查询本地账本
+// 参数 paramsJSON: JSON 格式，字段均可选：
+//   - from, to: 查询范围 [from, to)（Unix 秒），默认为最近 7 天
+//   - granularity: 汇总粒度 hour、day 或 total，默认 day
+//   - utc_offset: 按天汇总时使用的时区（相对 UTC 的秒数），默认为系统时区
+//
+// 返回：JSON 格式的响应，data 为按时间排列的汇总（只包含有记录的时间段），每项包含
+// from、to、hours（有记录的小时数）、input_bytes、output_bytes、connections、
+// bandwidth_tests、bandwidth_tests_failed、online_seconds 和 points（后端积分的增长）
+//
+//export GetLedger
+func GetLedger(paramsJSON *C.char) (ret *C.char) {
+	defer recoverAndLog("GetLedger", &ret)
+	if defaultNode == nil {
+		return replyError(errNotInitialized)
+	}
+	return getLedger(defaultNode, goStringFromC(paramsJSON))
+}
+
+func getLedger(n *node.Node, paramsJSON string) *C.char {
+	params, from, to, err := parseLedgerParams(paramsJSON)
+	if err != nil {
+		return replyError(err)
+	}
+	if params.Granularity == "" {
+		params.Granularity = ledger.ByDay
+	}
+	summaries, err := n.Ledger.Aggregate(from, to, params.Granularity)
+	if err != nil {
+		return replyError(err)
+	}
+	if summaries == nil {
+		summaries = []ledger.Summary{}
+	}
+	return reply(200, "Ledger fetched", summaries)
+}
+
+// GetLedgerReconciliation 对比本地活动和后端积分，找出对不上的小时
+// 参数 paramsJSON: JSON 格式，字段均可选：
+//   - from, to: 对账范围 [from, to)（Unix 秒），默认为最近 7 天
+//   - settle_lag: 后端结算的延迟（小时），一个小时的积分在之后第几个小时内查询到，默认 1
+//   - min_online: 在线多久（秒）的小时应当获得积分，默认 1800
+//
+// 返回：JSON 格式的响应，data 包含 from、to、settle_lag、checked（可以对账的小时数）、
+// unchecked（有活动但没有查询到结算的小时数）和 discrepancies；每个 discrepancy 包含
+// hour、issue（unrewarded_activity 在线但没有积分，reward_without_activity 没有活动却有积分）、
+// online_seconds、connections、tasks 和 points
+//
+//export GetLedgerReconciliation
+func GetLedgerReconciliation(paramsJSON *C.char) (ret *C.char) {
+	defer recoverAndLog("GetLedgerReconciliation", &ret)
+	if defaultNode == nil {
+		return replyError(errNotInitialized)
+	}
+	return getLedgerReconciliation(defaultNode, goStringFromC(paramsJSON))
+}
+
+func getLedgerReconciliation(n *node.Node, paramsJSON string) *C.char {
+	params, from, to, err := parseLedgerParams(paramsJSON)
+	if err != nil {
+		return replyError(err)
+	}
+	report, err := n.Ledger.Reconcile(from, to, ledger.ReconcileOptions{
+		SettleLag: params.SettleLag,
+		MinOnline: time.Duration(params.MinOnline) * time.Second,
+	})
+	if err != nil {
+		return replyError(err)
+	}
+	return reply(200, fmt.Sprintf("%d discrepancies", len(report.Discrepancies)), report)
+}
+
+// recordRewards 把 GetRewards 查询到的累计积分记入账本
+func recordRewards(n *node.Node, total float64) {
+	if err := n.Ledger.RecordRewards(total); err != nil {
+		log.Printf("Failed to record rewards in the ledger: %v", err)
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"aro-ext-app/core/internal/constant"
+	"aro-ext-app/core/internal/errcode"
+	"aro-ext-app/core/internal/node"
+	"aro-ext-app/core/internal/proxy_worker"
+	"aro-ext-app/core/internal/updater"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// ======================
+// 多实例（句柄）导出函数
+// ======================
+// CreateNode 返回不透明句柄，NodeHandle* 函数作用于句柄对应的节点，
+// 每个节点拥有独立的数据目录、身份、配置、worker 和事件总线，
+// 同一进程中可以同时运行多个节点（测试环境、多账号桌面端）
+
+// lookupNode 根据句柄查找节点，失败时返回错误响应
+func lookupNode(handle C.longlong) (*node.Node, *C.char) {
+	n, err := node.Lookup(node.Handle(handle))
+	if err != nil {
+		return nil, replyError(err)
+	}
+	return n, nil
+}
+
+// CreateNode 创建节点实例
+// 参数：optionsJSON - JSON 格式参数：
+//   - dir: 节点数据目录（必填，不同节点必须不同）
+//   - api_url: 后端 API 地址（可选，默认为节点环境的地址）
+//   - profile: 后端环境 staging、testnet、mainnet 或 local（可选，默认为节点 config.env 中的环境）
+//
+// 返回：JSON 格式的响应，data 包含 handle、client_id、dir、profile
+//
+//export CreateNode
+func CreateNode(optionsJSON *C.char) (ret *C.char) {
+	defer recoverAndLog("CreateNode", &ret)
+	log.Println("CreateNode called")
+	var opts node.Options
+	if err := json.Unmarshal([]byte(goStringFromC(optionsJSON)), &opts); err != nil {
+		return replyCode(errcode.InvalidParams, fmt.Sprintf("JSON parsing failed: %s", err.Error()), nil)
+	}
+	if opts.APIURL == "" {
+		opts.APIURL = serverConfig.BaseAPIURL
+	}
+
+	n, err := node.New(opts)
+	if err != nil {
+		return replyError(err)
+	}
+	n.StartConfigWatch()
+	h := node.Register(n)
+	return reply(200, "Node created successfully", map[string]interface{}{
+		"handle":    int64(h),
+		"client_id": n.ClientID,
+		"dir":       n.Dir,
+		"profile":   n.Config.Profile().Name,
+	})
+}
+
+// DestroyNode 停止节点的 worker 并释放句柄
+//
+//export DestroyNode
+func DestroyNode(handle C.longlong) (ret *C.char) {
+	defer recoverAndLog("DestroyNode", &ret)
+	log.Println("DestroyNode called")
+	n, err := node.Release(node.Handle(handle))
+	if err != nil {
+		return replyError(err)
+	}
+	if err := n.Close(); err != nil {
+		return replyError(err)
+	}
+	return reply(200, "Node destroyed successfully", nil)
+}
+
+// ListNodes 列出所有有效句柄
+//
+//export ListNodes
+func ListNodes() (ret *C.char) {
+	defer recoverAndLog("ListNodes", &ret)
+	list := make([]map[string]interface{}, 0)
+	for _, h := range node.Handles() {
+		if n, err := node.Lookup(h); err == nil {
+			list = append(list, map[string]interface{}{
+				"handle":    int64(h),
+				"client_id": n.ClientID,
+				"dir":       n.Dir,
+			})
+		}
+	}
+	return reply(200, "ok", list)
+}
+
+// NodeHandleSignUp 对应 NodeSignUp
+//
+//export NodeHandleSignUp
+func NodeHandleSignUp(handle C.longlong) (ret *C.char) {
+	defer recoverAndLog("NodeHandleSignUp", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	resp, err := n.SignUp(context.Background())
+	if err != nil {
+		return replyError(err)
+	}
+	n.StartBaseInfoReporter()
+	n.StartHeartbeat()
+	return replyBackend(resp)
+}
+
+// NodeHandleReportBaseInfo 对应 NodeReportBaseInfo
+//
+//export NodeHandleReportBaseInfo
+func NodeHandleReportBaseInfo(handle C.longlong, sysInfoJSON *C.char) (ret *C.char) {
+	defer recoverAndLog("NodeHandleReportBaseInfo", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	resp, err := reportBaseInfo(n, goStringFromC(sysInfoJSON))
+	if err != nil {
+		return replyError(err)
+	}
+	return replyBackend(resp)
+}
+
+// NodeHandleGetNodeStat 对应 GetNodeStat
+//
+//export NodeHandleGetNodeStat
+func NodeHandleGetNodeStat(handle C.longlong) (ret *C.char) {
+	defer recoverAndLog("NodeHandleGetNodeStat", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	resp, err := n.GetNodeStat(context.Background())
+	if err != nil {
+		return replyError(err)
+	}
+	return replyBackend(resp)
+}
+
+// NodeHandleGetRewards 对应 GetRewards
+//
+//export NodeHandleGetRewards
+func NodeHandleGetRewards(handle C.longlong) (ret *C.char) {
+	defer recoverAndLog("NodeHandleGetRewards", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	resp, err := n.API.GetRewards()
+	if err != nil {
+		return replyError(err)
+	}
+	recordRewards(n, float64(resp.Data.TotalRewards))
+	return replyBackend(resp)
+}
+
+// NodeHandleGetLastVersion 对应 GetLastVersion
+//
+//export NodeHandleGetLastVersion
+func NodeHandleGetLastVersion(handle C.longlong) (ret *C.char) {
+	defer recoverAndLog("NodeHandleGetLastVersion", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	channel := updater.PolicyFromConfig(n.Config, n.ClientID, Version).Channel
+	resp, err := n.API.GetLastVersion(constant.PROGRAM_APP, channel)
+	if err != nil {
+		return replyError(err)
+	}
+	return replyBackend(resp)
+}
+
+// NodeHandleStartProxyWorker 对应 StartProxyWorker，configJSON 格式相同
+// 注意：同一进程中的多个节点必须使用不同的 local_port / fixed_port
+//
+//export NodeHandleStartProxyWorker
+func NodeHandleStartProxyWorker(handle C.longlong, configJSON *C.char) (ret *C.char) {
+	defer recoverAndLog("NodeHandleStartProxyWorker", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	var config proxy_worker.ProxyWorkerConfig
+	if err := json.Unmarshal([]byte(goStringFromC(configJSON)), &config); err != nil {
+		return replyCode(errcode.InvalidParams, fmt.Sprintf("JSON parsing failed: %s", err.Error()), nil)
+	}
+	if err := n.Worker.Start(n.WorkerConfig(config)); err != nil {
+		return replyError(err)
+	}
+	return reply(200, "Proxy worker started successfully", n.Worker.GetStatus())
+}
+
+// NodeHandleStopProxyWorker 对应 StopProxyWorker
+//
+//export NodeHandleStopProxyWorker
+func NodeHandleStopProxyWorker(handle C.longlong) (ret *C.char) {
+	defer recoverAndLog("NodeHandleStopProxyWorker", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	if err := n.Worker.Stop(); err != nil {
+		return replyError(err)
+	}
+	return reply(200, "Proxy worker stopped successfully", nil)
+}
+
+// NodeHandleRestartProxyWorker 对应 RestartProxyWorker
+//
+//export NodeHandleRestartProxyWorker
+func NodeHandleRestartProxyWorker(handle C.longlong) (ret *C.char) {
+	defer recoverAndLog("NodeHandleRestartProxyWorker", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	if err := n.Worker.Restart(); err != nil {
+		return replyError(err)
+	}
+	return reply(200, "Proxy worker restarted successfully", n.Worker.GetStatus())
+}
+
+// NodeHandleGetProxyWorkerStatus 对应 GetProxyWorkerStatus
+//
+//export NodeHandleGetProxyWorkerStatus
+func NodeHandleGetProxyWorkerStatus(handle C.longlong) (ret *C.char) {
+	defer recoverAndLog("NodeHandleGetProxyWorkerStatus", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	return reply(200, "Proxy worker status fetched", n.Worker.GetStatus())
+}
+
+// NodeHandleGetHeartbeatStatus 对应 GetHeartbeatStatus
+//
+//export NodeHandleGetHeartbeatStatus
+func NodeHandleGetHeartbeatStatus(handle C.longlong) (ret *C.char) {
+	defer recoverAndLog("NodeHandleGetHeartbeatStatus", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	return reply(200, "Heartbeat status fetched", n.Heartbeat.Status())
+}
+
+// NodeHandleGetClockStatus 对应 GetClockStatus
+//
+//export NodeHandleGetClockStatus
+func NodeHandleGetClockStatus(handle C.longlong) (ret *C.char) {
+	defer recoverAndLog("NodeHandleGetClockStatus", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	return reply(200, "Clock status fetched", n.API.ClockStatus())
+}
+
+// NodeHandleGetConfigStatus 对应 GetConfigStatus，返回节点目录下配置文件的状态
+//
+//export NodeHandleGetConfigStatus
+func NodeHandleGetConfigStatus(handle C.longlong) (ret *C.char) {
+	defer recoverAndLog("NodeHandleGetConfigStatus", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	return reply(200, "Config status fetched", n.Config.Status())
+}
+
+// NodeHandleGetIdentityStatus 对应 GetIdentityStatus
+//
+//export NodeHandleGetIdentityStatus
+func NodeHandleGetIdentityStatus(handle C.longlong) (ret *C.char) {
+	defer recoverAndLog("NodeHandleGetIdentityStatus", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	return reply(200, "Identity status fetched", n.Clone)
+}
+
+// NodeHandleRotateKey 对应 RotateKey
+//
+//export NodeHandleRotateKey
+func NodeHandleRotateKey(handle C.longlong) (ret *C.char) {
+	defer recoverAndLog("NodeHandleRotateKey", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	return rotateKey(n)
+}
+
+// NodeHandleReregister 对应 Reregister
+//
+//export NodeHandleReregister
+func NodeHandleReregister(handle C.longlong) (ret *C.char) {
+	defer recoverAndLog("NodeHandleReregister", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	return reregister(n)
+}
+
+// NodeHandleExportIdentity 对应 ExportIdentity
+//
+//export NodeHandleExportIdentity
+func NodeHandleExportIdentity(handle C.longlong, passphrase *C.char) (ret *C.char) {
+	defer recoverAndLog("NodeHandleExportIdentity", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	return exportIdentity(n, goStringFromC(passphrase))
+}
+
+// NodeHandleImportIdentity 对应 ImportIdentity，paramsJSON 格式相同
+//
+//export NodeHandleImportIdentity
+func NodeHandleImportIdentity(handle C.longlong, paramsJSON *C.char) (ret *C.char) {
+	defer recoverAndLog("NodeHandleImportIdentity", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	return importIdentity(n, goStringFromC(paramsJSON))
+}
+
+// NodeHandleGetLedger 对应 GetLedger，paramsJSON 格式相同
+//
+//export NodeHandleGetLedger
+func NodeHandleGetLedger(handle C.longlong, paramsJSON *C.char) (ret *C.char) {
+	defer recoverAndLog("NodeHandleGetLedger", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	return getLedger(n, goStringFromC(paramsJSON))
+}
+
+// NodeHandleGetLedgerReconciliation 对应 GetLedgerReconciliation，paramsJSON 格式相同
+//
+//export NodeHandleGetLedgerReconciliation
+func NodeHandleGetLedgerReconciliation(handle C.longlong, paramsJSON *C.char) (ret *C.char) {
+	defer recoverAndLog("NodeHandleGetLedgerReconciliation", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	return getLedgerReconciliation(n, goStringFromC(paramsJSON))
+}
+
+// NodeHandleRunSpeedtest 对应 RunSpeedtest，taskJSON 格式相同，结果记入该节点的账本
+//
+//export NodeHandleRunSpeedtest
+func NodeHandleRunSpeedtest(handle C.longlong, taskJSON *C.char) (ret *C.char) {
+	defer recoverAndLog("NodeHandleRunSpeedtest", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	return runSpeedtest(n, goStringFromC(taskJSON))
+}
+
+// NodeHandlePollEvents 对应 PollEvents，只返回该节点的事件
+//
+//export NodeHandlePollEvents
+func NodeHandlePollEvents(handle C.longlong, cursor C.longlong, timeoutMs C.int) (ret *C.char) {
+	defer recoverAndLog("NodeHandlePollEvents", &ret)
+	n, errReply := lookupNode(handle)
+	if errReply != nil {
+		return errReply
+	}
+	return pollEvents(n.Events, cursor, timeoutMs)
+}
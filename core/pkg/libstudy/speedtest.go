@@ -0,0 +1,51 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"aro-ext-app/core/internal/errcode"
+	"aro-ext-app/core/internal/node"
+	"aro-ext-app/core/internal/speedtest"
+	"encoding/json"
+)
+
+// ======================
+// 带宽测试导出函数
+// ======================
+// 应用收到调度下发的带宽测试任务后调用，测试结果作为 task.completed 事件发布到节点的事件总线并记入本地账本
+
+// RunSpeedtest 执行带宽测试任务，阻塞直到测试结束
+// 参数 taskJSON: 任务，格式与调度下发的 bandwidth test 消息相同
+//
+// 返回：JSON 格式的响应，data 包含 test_id、success、total_bytes、total_chunks、duration_ms 和 throughput_mbps
+//
+//export RunSpeedtest
+func RunSpeedtest(taskJSON *C.char) (ret *C.char) {
+	defer recoverAndLog("RunSpeedtest", &ret)
+	if defaultNode == nil {
+		return replyError(errNotInitialized)
+	}
+	return runSpeedtest(defaultNode, goStringFromC(taskJSON))
+}
+
+func runSpeedtest(n *node.Node, taskJSON string) *C.char {
+	var task speedtest.BandwidthTestTask
+	if err := json.Unmarshal([]byte(taskJSON), &task); err != nil {
+		return replyError(errcode.Errorf(errcode.InvalidParams, "JSON parsing failed: %s", err.Error()))
+	}
+	result, err := n.Speedtest.RunTask(&task)
+	if err != nil {
+		return replyError(err)
+	}
+	return reply(200, "Bandwidth test finished", map[string]interface{}{
+		"test_id":         result.TestID,
+		"success":         result.Success,
+		"total_bytes":     result.TotalBytes,
+		"total_chunks":    result.TotalChunks,
+		"duration_ms":     result.Duration.Milliseconds(),
+		"throughput_mbps": result.CalculateThroughput(),
+	})
+}
@@ -13,34 +13,94 @@ import "C"
 
 import (
 	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/config"
 	"aro-ext-app/core/internal/constant"
+	"aro-ext-app/core/internal/crashdump"
 	"aro-ext-app/core/internal/crypto"
+	"aro-ext-app/core/internal/datadir"
+	"aro-ext-app/core/internal/errcode"
+	"aro-ext-app/core/internal/events"
+	"aro-ext-app/core/internal/identity"
+	"aro-ext-app/core/internal/node"
 	"aro-ext-app/core/internal/proxy_worker"
 	"aro-ext-app/core/internal/storage"
+	"aro-ext-app/core/internal/sysinfo"
+	"aro-ext-app/core/internal/updater"
+	"aro-ext-app/core/version"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// logFileName 日志文件名，保存在数据目录中
+const logFileName = "libstudy.log"
+
+// logFile 当前的日志文件，InitLibstudy 改变数据目录后切换
+var logFile *lumberjack.Logger
+
 // 日志初始化（Logrus + Lumberjack）
+// 日志文件在第一次写入时才创建，InitLibstudy 指定 data_dir 之前不会在默认数据目录中留下文件
 func init() {
 	logrus.SetFormatter(&logrus.TextFormatter{
 		FullTimestamp:   true,
 		TimestampFormat: "2006-01-02 15:04:05.000",
 	})
-	logrus.SetOutput(&lumberjack.Logger{
-		Filename:   "libstudy.log",
-		MaxSize:    10,    // MB
-		MaxBackups: 0,     // 不保留历史文件
-		MaxAge:     0,     // 不限制时间
-		Compress:   false, // 不压缩
-	})
+	setLogDir(datadir.Get(), config.DefaultSettings().Logging.MaxSize)
 	logrus.SetLevel(logrus.InfoLevel)
-	logrus.Info("==== libstudy started ====")
+}
+
+// setLogDir 把日志写到 dir 下的 libstudy.log，超过 maxSize（MB）后轮转
+func setLogDir(dir string, maxSize int) {
+	previous := logFile
+	logFile = &lumberjack.Logger{
+		Filename:   filepath.Join(dir, logFileName),
+		MaxSize:    maxSize, // MB
+		MaxBackups: 0,       // 不保留历史文件
+		MaxAge:     0,       // 不限制时间
+		Compress:   false,   // 不压缩
+	}
+	logrus.SetOutput(logFile)
+	if previous != nil {
+		previous.Close()
+	}
+}
+
+// logLevelOnce 全局配置的日志级别订阅只注册一次
+var logLevelOnce sync.Once
+
+// watchLogLevel 按 LOG_LEVEL（DEBUG=true 时为 debug）设置日志级别，配置重新加载后立即生效
+func watchLogLevel() {
+	settings, _ := config.GetConfig().Settings()
+	setLogLevel(settings.Logging)
+	logLevelOnce.Do(func() {
+		config.GetConfig().Subscribe(func(ev config.ReloadEvent) {
+			if ev.Err == nil && ev.Changed(config.KeyLogLevel, config.KeyDebug) {
+				setLogLevel(ev.Settings.Logging)
+			}
+		})
+	})
+}
+
+func setLogLevel(s config.LoggingSettings) {
+	level, err := logrus.ParseLevel(s.Level)
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	if s.Debug {
+		level = logrus.DebugLevel
+	}
+	logrus.SetLevel(level)
 }
 
 // goStringFromC 安全地将 C 字符串转换为 Go 字符串，处理 NULL 指针
@@ -51,28 +111,80 @@ func goStringFromC(s *C.char) string {
 	return C.GoString(s)
 }
 
-// recoverAndLog 捕获 panic 并返回错误 JSON
-func recoverAndLog(funcName string) {
+// errNotInitialized 在 InitLibstudy 之前调用依赖默认节点的导出函数时返回
+var errNotInitialized = errcode.New(errcode.NotInitialized, "apiClient not initialized, call InitLibstudy first")
+
+// Response 所有导出函数返回的 JSON 结构
+// code 为兼容旧调用方的 HTTP 风格数字码，error_code 为稳定的错误码（见 errcode 包）
+type Response struct {
+	Code      int          `json:"code"`
+	Message   string       `json:"message"`
+	ErrorCode errcode.Code `json:"error_code"`
+	Data      interface{}  `json:"data"`
+}
+
+// recoverAndLog 捕获 panic，把堆栈写入崩溃报告，并把返回值替换为 PANIC 错误 JSON
+// 导出函数必须使用命名返回值并以 defer recoverAndLog("Name", &ret) 调用，
+// 否则 panic 后返回 nil 指针会让 Dart 侧崩溃
+func recoverAndLog(funcName string, ret **C.char) {
 	if r := recover(); r != nil {
-		logrus.WithField("func", funcName).WithField("panic", r).Error("panic recovered")
+		stack := debug.Stack()
+		logrus.WithField("func", funcName).WithField("panic", r).Error("panic recovered\n" + string(stack))
+		data := map[string]interface{}{}
+		if path, err := crashdump.Write(funcName, r, stack); err != nil {
+			logrus.WithError(err).Error("failed to write crash report")
+		} else {
+			data["crash_file"] = path
+		}
+		*ret = replyCode(errcode.Panic, fmt.Sprintf("panic in %s: %v", funcName, r), data)
 	}
 }
 
+// toCStringJSON 序列化为 C 字符串，序列化失败时仍返回合法的 INTERNAL 错误 JSON
 func toCStringJSON(v interface{}) *C.char {
-	data, _ := json.Marshal(v)
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(Response{
+			Code:      errcode.Internal.Status(),
+			Message:   fmt.Sprintf("failed to encode response: %v", err),
+			ErrorCode: errcode.Internal,
+		})
+	}
 	logrus.WithField("json", string(data)).Info("response json")
 	return C.CString(string(data))
 }
 
+// reply 返回成功响应
 func reply(code int, message string, data interface{}) *C.char {
-	return toCStringJSON(api_client.APIResponse{
-		Code:    code,
-		Message: message,
-		Data:    data,
+	return toCStringJSON(Response{
+		Code:      code,
+		Message:   message,
+		ErrorCode: errcode.OK,
+		Data:      data,
+	})
+}
+
+// replyBackend 原样返回后端的 code、message 和 data（包括类型中未声明的字段），并加上 error_code
+func replyBackend[T any](resp *api_client.APIResponseWith[T]) *C.char {
+	return reply(resp.Code, resp.Message, resp.RawData())
+}
+
+// replyCode 返回指定错误码的响应
+func replyCode(code errcode.Code, message string, data interface{}) *C.char {
+	return toCStringJSON(Response{
+		Code:      code.Status(),
+		Message:   message,
+		ErrorCode: code,
+		Data:      data,
 	})
 }
 
-// ServerConfig 结构体用于管理服务器配置参数
+// replyError 根据错误链中的错误码返回错误响应
+func replyError(err error) *C.char {
+	return replyCode(errcode.Of(err), err.Error(), nil)
+}
+
+// ServerConfig 结构体用于管理服务器配置参数，为空时使用当前环境（见 InitParams.Profile）的地址
 type ServerConfig struct {
 	BaseAPIURL string
 	BaseWSURL  string
@@ -81,23 +193,26 @@ type ServerConfig struct {
 // InitParams 初始化参数结构体
 type InitParams struct {
 	Config ServerConfig `json:"config"`
+	// Profile 后端环境：staging、testnet、mainnet 或 local，非空时写入 config.env，为空时使用 config.env 中的环境
+	// 每个环境有独立的地址和节点身份（客户端 ID、SN、私钥），切换环境不会混用身份
+	Profile string       `json:"profile"`
+	Update  UpdateParams `json:"update"`
+	// DataDir 数据目录，保存密钥、config.env、日志和崩溃报告；为空时使用 ARO_DATA_DIR 或平台默认目录
+	// Android 应传入 Context.getFilesDir()
+	DataDir string `json:"data_dir"`
 }
 
 // Global variables
 var (
-	apiClient    *api_client.APIClient
-	keyPair      *crypto.KeyPair
-	clientID     string
-	serverConfig = &ServerConfig{
-		BaseAPIURL: constant.HTTP_SERVER_ENDPOINT,
-		BaseWSURL:  constant.WS_SERVER_ENDPOINT,
-	}
-	storageApi *storage.Storage
+	// defaultNode InitLibstudy 创建的默认节点，无句柄的导出函数都作用于它
+	// 需要在同一进程中运行多个节点时使用 CreateNode 返回的句柄（见 node.go）
+	defaultNode  *node.Node
+	serverConfig = &ServerConfig{}
+	storageApi   *storage.Storage
 )
 
-const (
-	Version string = "0.0.5"
-)
+// Version 当前库版本，构建时通过 ldflags 注入到 core/version
+var Version = version.VERSION
 
 // init package initialization function，automatically called when dynamic library is loaded
 // auto initialize keypair and apiClient
@@ -128,90 +243,116 @@ const (
 // 供动态加载该库的应用（如 Flutter）通过 FFI 调用
 
 // NodeSignUp 节点注册（/api/liteNode/signUp）
-// 参数：publicKeyPem - RSA 公钥（PEM 格式）
+// 后端不接受节点密钥的算法（KEY_TYPE）时自动换用后端支持的算法重新生成密钥
 // 返回：JSON formatted响应（包含用户和节点信息）
 //
 //export NodeSignUp
-func NodeSignUp() *C.char {
-	defer recoverAndLog("NodeSignUp")
+func NodeSignUp() (ret *C.char) {
+	defer recoverAndLog("NodeSignUp", &ret)
 	log.Println("NodeSignUp called")
-	if apiClient == nil {
-		return reply(500, "apiClient not initialized, call InitLibstudy first", nil)
+	if defaultNode == nil {
+		return replyError(errNotInitialized)
 	}
-	resp, err := apiClient.NodeSignUp()
+	resp, err := defaultNode.SignUp(context.Background())
 	if err != nil {
-		return reply(500, err.Error(), nil)
+		return replyError(err)
 	}
+	defaultNode.StartBaseInfoReporter()
+	defaultNode.StartHeartbeat()
 
 	data, _ := json.Marshal(resp)
 	log.Println("NodeSignUp response: ", string(data))
-	return toCStringJSON(resp)
+	return replyBackend(resp)
 }
 
 // NodeReportBaseInfo 上报节点基础信息（/api/liteNode/node/reportBaseInfo）
-// 参数：sysInfoJSON - JSON formatted系统信息
+// 系统信息由 core 自动采集，注册成功后也会在变化时自动上报
+// 参数：sysInfoJSON - 需要覆盖的字段（JSON），只替换其中出现的字段并在之后的自动上报中保留；
+// 为空时只上报采集值，传 {} 清除之前的覆盖
 // 返回：JSON formatted响应
 //
 //export NodeReportBaseInfo
-func NodeReportBaseInfo(sysInfoJSON *C.char) *C.char {
-	defer recoverAndLog("NodeReportBaseInfo")
+func NodeReportBaseInfo(sysInfoJSON *C.char) (ret *C.char) {
+	defer recoverAndLog("NodeReportBaseInfo", &ret)
 	log.Println("NodeReportBaseInfo called")
-	if apiClient == nil {
-		return reply(500, "apiClient not initialized, call InitLibstudy first", nil)
-	}
-	var sysInfo api_client.NodeReportBaseInfoRequest
-	if err := json.Unmarshal([]byte(goStringFromC(sysInfoJSON)), &sysInfo); err != nil {
-		return reply(400, fmt.Sprintf("JSON parsing failed: %s", err.Error()), nil)
+	if defaultNode == nil {
+		return replyError(errNotInitialized)
 	}
 
-	resp, err := apiClient.NodeReportBaseInfo(sysInfo)
+	resp, err := reportBaseInfo(defaultNode, goStringFromC(sysInfoJSON))
 	if err != nil {
-		return reply(500, err.Error(), nil)
+		return replyError(err)
 	}
 
 	data, _ := json.Marshal(resp)
 	log.Println("NodeReportBaseInfo response: ", string(data))
-	return toCStringJSON(resp)
+	return replyBackend(resp)
+}
+
+// reportBaseInfo 保存调用方的覆盖字段（非空时）并立即上报采集到的系统信息
+func reportBaseInfo(n *node.Node, overrides string) (*api_client.APIResponseWith[api_client.ReportBaseInfoData], error) {
+	if overrides != "" {
+		if err := n.API.SetBaseInfoOverrides(json.RawMessage(overrides)); err != nil {
+			return nil, err
+		}
+	}
+	return n.API.ReportSystemInfo()
+}
+
+// GetSystemInfo 返回 core 采集到的系统指纹，以及应用覆盖字段后实际上报的内容
+// 返回：JSON formatted响应，data 为 {"system": {...}, "report": {...}}
+//
+//export GetSystemInfo
+func GetSystemInfo() (ret *C.char) {
+	defer recoverAndLog("GetSystemInfo", &ret)
+	if defaultNode == nil {
+		return replyError(errNotInitialized)
+	}
+	return reply(200, "ok", map[string]interface{}{
+		"system": sysinfo.Collect(defaultNode.Dir),
+		"report": defaultNode.API.CollectBaseInfo(),
+	})
 }
 
 // GetNodeStat 获取节点统计信息（/api/liteNode/stat）
 // 返回：JSON formatted响应（包含用户信息、节点状态、积分等）
 //
 //export GetNodeStat
-func GetNodeStat() *C.char {
-	defer recoverAndLog("GetNodeStat")
+func GetNodeStat() (ret *C.char) {
+	defer recoverAndLog("GetNodeStat", &ret)
 	log.Println("GetNodeStat called")
-	if apiClient == nil {
-		return reply(500, "apiClient not initialized, call InitLibstudy first", nil)
+	if defaultNode == nil {
+		return replyError(errNotInitialized)
 	}
-	resp, err := apiClient.GetNodeStat()
+	resp, err := defaultNode.GetNodeStat(context.Background())
 	if err != nil {
-		return reply(500, err.Error(), nil)
+		return replyError(err)
 	}
 
 	data, _ := json.Marshal(resp)
 	log.Println("GetNodeStat response: ", string(data))
-	return toCStringJSON(resp)
+	return replyBackend(resp)
 }
 
 // GetRewards 获取奖励信息（/api/liteNode/rewards）
 // 返回：JSON formatted响应（包含最后网络点数、总奖励、7天数据等）
 //
 //export GetRewards
-func GetRewards() *C.char {
-	defer recoverAndLog("GetRewards")
+func GetRewards() (ret *C.char) {
+	defer recoverAndLog("GetRewards", &ret)
 	log.Println("GetRewards called")
-	if apiClient == nil {
-		return reply(500, "apiClient not initialized, call InitLibstudy first", nil)
+	if defaultNode == nil {
+		return replyError(errNotInitialized)
 	}
-	resp, err := apiClient.GetRewards()
+	resp, err := defaultNode.API.GetRewards()
 	if err != nil {
-		return reply(500, err.Error(), nil)
+		return replyError(err)
 	}
+	recordRewards(defaultNode, float64(resp.Data.TotalRewards))
 
 	data, _ := json.Marshal(resp)
 	log.Println("GetRewards response: ", string(data))
-	return toCStringJSON(resp)
+	return replyBackend(resp)
 }
 
 // ======================
@@ -263,14 +404,26 @@ func GetRewards() *C.char {
 // 	return reply(200, "WebSocket client start triggered", map[string]bool{"is_running": ws_client.IsWebSocketRunning()})
 // }
 
+// SetKeyPassphrase 设置私钥口令，KEY_PROTECTION=passphrase 时必须在 InitLibstudy / CreateNode 之前调用
+// 口令只保存在内存中，不会写入日志或配置文件
+// 参数：passphrase - 私钥口令，为空时使用环境变量 ARO_KEY_PASSPHRASE
+// 返回：JSON formatted响应
+//
+//export SetKeyPassphrase
+func SetKeyPassphrase(passphrase *C.char) (ret *C.char) {
+	defer recoverAndLog("SetKeyPassphrase", &ret)
+	crypto.SetKeyPassphrase(goStringFromC(passphrase))
+	return reply(200, "Key passphrase set", nil)
+}
+
 // InitLibstudy 初始化 libstudy 库
 // 加载或创建密钥对、初始化 API 客户端和 WebSocket 客户端
 // 参数：initParamsJSON - JSON 格式的初始化参数，包含 ServerConfig
 // 返回：JSON formatted响应（包含初始化状态和各个组件的信息）
 //
 //export InitLibstudy
-func InitLibstudy(initParamsJSON *C.char) *C.char {
-	defer recoverAndLog("InitLibstudy")
+func InitLibstudy(initParamsJSON *C.char) (ret *C.char) {
+	defer recoverAndLog("InitLibstudy", &ret)
 
 	log.Println("InitLibstudy called")
 
@@ -283,7 +436,7 @@ func InitLibstudy(initParamsJSON *C.char) *C.char {
 	if paramsStr != "" {
 		if err := json.Unmarshal([]byte(paramsStr), &initParams); err != nil {
 			details["params_error"] = err.Error()
-			return reply(400, fmt.Sprintf("Failed to parse init params: %v", err), details)
+			return replyCode(errcode.InvalidParams, fmt.Sprintf("Failed to parse init params: %v", err), details)
 		}
 
 		// 验证并更新服务器配置
@@ -295,39 +448,203 @@ func InitLibstudy(initParamsJSON *C.char) *C.char {
 		}
 	}
 
-	// 加载或创建密钥对
-	var err error
-	keyPair, err = crypto.GetOrCreateKeyPair("")
+	// 确定数据目录，把旧版本写在当前目录的文件迁移过去
+	if initParams.DataDir != "" {
+		datadir.Set(initParams.DataDir)
+	}
+	dataDir := datadir.Get()
+	details["data_dir"] = dataDir
+	setLogDir(dataDir, logFile.MaxSize)
+	logrus.Info("==== libstudy started ====")
+	if cwd, err := os.Getwd(); err == nil {
+		moved, err := datadir.Migrate(cwd, dataDir)
+		if err != nil {
+			log.Printf("Failed to migrate files to the data dir: %v", err)
+			details["migration_error"] = err.Error()
+		}
+		if len(moved) > 0 {
+			details["migrated"] = moved
+		}
+	}
+	// 先停止之前的默认节点，重新加载配置时它不应再应用新配置
+	if defaultNode != nil {
+		defaultNode.StopBackground()
+		defaultNode.StopConfigWatch()
+	}
+	config.GetConfig().Reload()
+	if initParams.Profile != "" {
+		if err := config.GetConfig().SetProfile(initParams.Profile); err != nil {
+			return replyCode(errcode.Of(err), fmt.Sprintf("Failed to switch profile: %v", err), details)
+		}
+	}
+	details["profile"] = config.GetConfig().Profile().Name
+	// 本地存储保存在当前环境的身份目录中，打开失败时仍使用内存存储
+	storePath := filepath.Join(config.GetConfig().IdentityDir(dataDir), storage.FileName)
+	if err := storage.GetStorage().Attach(storePath); err != nil {
+		log.Printf("Failed to open storage: %v", err)
+		details["storage_error"] = err.Error()
+	} else {
+		details["storage_path"] = storePath
+	}
+	// 配置中的无效项使用默认值，错误随初始化结果返回
+	settings, err := config.GetConfig().Settings()
+	if err != nil {
+		log.Printf("Invalid config: %v", err)
+		details["config_error"] = err.Error()
+	}
+	if settings.Logging.MaxSize != logFile.MaxSize {
+		setLogDir(dataDir, settings.Logging.MaxSize)
+	}
+
+	// 加载或创建密钥对、客户端 ID 和 API 客户端（默认节点使用进程级配置和数据目录）
+	n, err := node.NewDefault(serverConfig.BaseAPIURL)
 	if err != nil {
 		details["keypair_error"] = err.Error()
-		return reply(500, fmt.Sprintf("Failed to initialize libstudy: %v", err), details)
+		return replyCode(errcode.Of(err), fmt.Sprintf("Failed to initialize libstudy: %v", err), details)
 	}
+	defaultNode = n
+	n.StartConfigWatch()
+	watchLogLevel()
 	details["keypair_status"] = "loaded/created"
-	details["keypair_path"] = ""
+	details["keypair_path"] = n.Dir
 
 	// 更新全局 Server Config
-	details["api_url"] = serverConfig.BaseAPIURL
+	details["api_url"] = n.API.URL()
 	// details["ws_url"] = serverConfig.BaseWSURL
 
-	// 初始化客户端 ID
-	clientID = crypto.GenerateClientID()
-	details["client_id"] = clientID
-
-	// 初始化 API 客户端
-	apiClient = api_client.NewAPIClient(serverConfig.BaseAPIURL, clientID, keyPair)
+	details["client_id"] = n.ClientID
 	// ws_client.SetWsClientUrl(serverConfig.BaseWSURL)
 	details["api_client_status"] = "initialized"
 
+	// 安装已暂存的更新或回滚未通过健康检查的版本（见 update.go）
+	initUpdater(initParams.Update, details)
+
+	// 上传上次运行留下的崩溃报告
+	if reports, err := crashdump.Pending(); err == nil && len(reports) > 0 {
+		details["pending_crash_reports"] = len(reports)
+		go uploadCrashReports(n.API)
+	}
+
 	log.Println("InitLibstudy success")
 	os.Stderr.Sync() // 确保日志完全写入
 	return reply(200, "Libstudy initialized successfully", details)
 }
 
+// uploadCrashReports 后台上传崩溃报告，失败的报告留到下次启动
+func uploadCrashReports(client *api_client.APIClient) {
+	defer func() {
+		if r := recover(); r != nil {
+			logrus.WithField("panic", r).Error("panic while uploading crash reports")
+		}
+	}()
+	n, err := crashdump.UploadPending(func(report crashdump.Report) error {
+		_, err := client.ReportCrash(report)
+		return err
+	})
+	if err != nil {
+		log.Printf("Crash report upload stopped after %d reports: %v", n, err)
+		return
+	}
+	log.Printf("Uploaded %d crash reports", n)
+}
+
+// GetCrashReports 返回尚未上传的崩溃报告
+// 返回：JSON 格式的响应，data 为报告列表（id、time、func、panic、stack、version、os、arch）
+//
+//export GetCrashReports
+func GetCrashReports() (ret *C.char) {
+	defer recoverAndLog("GetCrashReports", &ret)
+	reports, err := crashdump.Pending()
+	if err != nil {
+		return replyError(err)
+	}
+	return reply(200, "ok", reports)
+}
+
+// GetErrorCodes 返回错误码目录，供调用方根据 error_code 做本地化提示
+// 返回：JSON 格式的响应，data 为列表（code、status、description）
+//
+//export GetErrorCodes
+func GetErrorCodes() (ret *C.char) {
+	defer recoverAndLog("GetErrorCodes", &ret)
+	return reply(200, "ok", errcode.Catalogue())
+}
+
+// GetConfigSchema 返回配置的 JSON Schema（draft-07），供 UI 生成设置界面和校验输入
+// 返回：JSON 格式的响应，data 为 Schema，每个字段的 x-env 为 config.env / 环境变量中的 key
+//
+//export GetConfigSchema
+func GetConfigSchema() (ret *C.char) {
+	defer recoverAndLog("GetConfigSchema", &ret)
+	return reply(200, "ok", config.Schema())
+}
+
+// GetConfigStatus 获取配置文件和热加载状态
+// 配置文件修改后自动重新加载，无效的修改被拒绝并保留之前的配置（同时发布 config.rejected 事件）
+// 返回：JSON 格式的状态信息，包含以下字段：
+//   - path / structured: 当前的 config.env 和 YAML/JSON 配置文件
+//   - watching: 是否正在监视配置文件
+//   - last_reload: 最近一次成功重新加载的时间（Unix 时间戳，0 表示尚未重新加载）
+//   - last_error: 最近一次被拒绝的修改的错误，之后成功重新加载时清空
+//   - errors: 当前配置中的无效配置项（path、key、message），这些配置项使用默认值
+//
+//export GetConfigStatus
+func GetConfigStatus() (ret *C.char) {
+	defer recoverAndLog("GetConfigStatus", &ret)
+	return reply(200, "Config status fetched", config.GetConfig().Status())
+}
+
+// GetSettings 返回当前的类型化配置
+// 返回：JSON 格式的响应，data 包含以下字段：
+//   - settings: 按分组嵌套的配置，无效的配置项使用默认值
+//   - errors: 无效的配置项（path、key、message），没有时为空列表
+//
+//export GetSettings
+func GetSettings() (ret *C.char) {
+	defer recoverAndLog("GetSettings", &ret)
+	settings, err := config.GetConfig().Settings()
+	fieldErrs := []config.FieldError{}
+	var verr *config.ValidationError
+	if errors.As(err, &verr) {
+		fieldErrs = verr.Fields
+	}
+	return reply(200, "ok", map[string]interface{}{"settings": settings, "errors": fieldErrs})
+}
+
+// setSettingParams SetSetting 的参数
+type setSettingParams struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// SetSetting 设置一个配置项并写入 config.env
+// 参数 paramsJSON: JSON 格式，包含以下字段：
+//   - name: 配置项路径（如 api.timeout）或 key（如 TIMEOUT）
+//   - value: 字符串、整数或布尔值
+//
+// 未知的配置项或不合法的取值返回 INVALID_CONFIG，配置不变
+// 返回：JSON 格式的响应
+//
+//export SetSetting
+func SetSetting(paramsJSON *C.char) (ret *C.char) {
+	defer recoverAndLog("SetSetting", &ret)
+	var params setSettingParams
+	dec := json.NewDecoder(strings.NewReader(goStringFromC(paramsJSON)))
+	dec.UseNumber()
+	if err := dec.Decode(&params); err != nil {
+		return replyCode(errcode.InvalidParams, fmt.Sprintf("JSON parsing failed: %s", err.Error()), nil)
+	}
+	if err := config.GetConfig().SetSetting(params.Name, params.Value); err != nil {
+		return replyError(err)
+	}
+	return reply(200, "Setting saved", nil)
+}
+
 // 返回：版本号字符串（C 字符串，调用方需要 free）
 //
 //export GetCurrentVersion
-func GetCurrentVersion() *C.char {
-	defer recoverAndLog("GetCurrentVersion")
+func GetCurrentVersion() (ret *C.char) {
+	defer recoverAndLog("GetCurrentVersion", &ret)
 	log.Println("GetCurrentVersion called")
 	// 从 core/version 包读取注入的版本信息
 	os.Stderr.Sync()
@@ -335,20 +652,76 @@ func GetCurrentVersion() *C.char {
 }
 
 //export GetLastVersion
-func GetLastVersion() *C.char {
-	defer recoverAndLog("GetLastVersion")
+func GetLastVersion() (ret *C.char) {
+	defer recoverAndLog("GetLastVersion", &ret)
 	log.Println("GetLastVersion called")
-	if apiClient == nil {
-		return reply(500, "apiClient not initialized, call InitLibstudy first", nil)
+	if defaultNode == nil {
+		return replyError(errNotInitialized)
 	}
-	resp, err := api_client.GetLastVersion(constant.PROGRAM_APP, constant.ENV)
+	policy := updater.PolicyFromConfig(defaultNode.Config, defaultNode.ClientID, Version)
+	resp, err := defaultNode.API.GetLastVersion(constant.PROGRAM_APP, policy.Channel)
 	if err != nil {
-		return reply(500, err.Error(), nil)
+		return replyError(err)
 	}
 
 	data, _ := json.Marshal(resp)
 	log.Println("GetLastVersion 14124 response: ", string(data))
-	return toCStringJSON(resp)
+
+	// 更新策略允许更新时发布 ota.available 事件
+	latest := resp.Data
+	decision := policy.Decide(updater.Release{
+		Version:        latest.Version,
+		MinVersion:     latest.MinVersion,
+		RolloutPercent: latest.RolloutPercent,
+	})
+	if decision.Update {
+		events.Publish(events.OTAAvailable, events.OTAEvent{
+			CurrentVersion: Version,
+			LatestVersion:  latest.Version,
+			URL:            latest.URL,
+			ReleaseNotes:   latest.ReleaseNotes,
+			Forced:         decision.Forced,
+		})
+	}
+	return replyBackend(resp)
+}
+
+// ======================
+// 事件相关导出函数
+// ======================
+
+// maxPollEvents 单次 PollEvents 返回的最大事件数
+const maxPollEvents = 256
+
+// PollEvents 拉取事件总线中游标之后的事件，替代对状态接口的定时轮询
+// 参数：
+//   - cursor: 上一次返回的 next_cursor，首次调用传 0
+//   - timeoutMs: 没有新事件时最长阻塞的毫秒数，0 表示立即返回
+//     （阻塞调用请在 Dart 的后台 isolate 中进行，避免卡住 UI 线程）
+//
+// 返回：JSON 格式的响应，data 包含以下字段：
+//   - events: 事件列表，每个事件包含 seq、type、time（毫秒）、data
+//   - next_cursor: 下一次调用应传入的游标
+//   - dropped: 因缓冲区溢出而丢失的事件数
+//
+//export PollEvents
+func PollEvents(cursor C.longlong, timeoutMs C.int) (ret *C.char) {
+	defer recoverAndLog("PollEvents", &ret)
+	return pollEvents(events.GetBus(), cursor, timeoutMs)
+}
+
+// pollEvents PollEvents 和 NodeHandlePollEvents 的共同实现
+func pollEvents(bus *events.Bus, cursor C.longlong, timeoutMs C.int) *C.char {
+	if cursor < 0 {
+		cursor = 0
+	}
+	if timeoutMs <= 0 {
+		return reply(200, "ok", bus.Since(uint64(cursor), maxPollEvents))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutMs)*time.Millisecond)
+	defer cancel()
+	return reply(200, "ok", bus.Wait(ctx, uint64(cursor), maxPollEvents))
 }
 
 // ======================
@@ -368,26 +741,30 @@ func GetLastVersion() *C.char {
 //   - disable_tls: 是否禁用 TLS（可选，默认 false，即默认使用 wss 加密连接）
 //   - tls_secure: 是否验证服务器证书（可选，默认 false，即跳过证书验证）
 //   - server_name: TLS ServerName（可选，用于证书验证，为空时使用 proxy_server_ip）
+//   - enable_auth: 是否启用代理认证（可选，默认 false）
+//   - auth_url: 代理认证接口地址（可选，为空时使用当前环境的地址）
 //
 // 返回：JSON 格式的响应，包含成功状态和错误信息
 //
 //export StartProxyWorker
-func StartProxyWorker(configJSON *C.char) *C.char {
-	defer recoverAndLog("StartProxyWorker")
+func StartProxyWorker(configJSON *C.char) (ret *C.char) {
+	defer recoverAndLog("StartProxyWorker", &ret)
 	log.Println("StartProxyWorker called")
-	var config proxy_worker.ProxyWorkerConfig
+	var workerConfig proxy_worker.ProxyWorkerConfig
 
 	// 解析 JSON 配置
-	if err := json.Unmarshal([]byte(goStringFromC(configJSON)), &config); err != nil {
-		return reply(400, fmt.Sprintf("JSON parsing failed: %s", err.Error()), nil)
+	if err := json.Unmarshal([]byte(goStringFromC(configJSON)), &workerConfig); err != nil {
+		return replyCode(errcode.InvalidParams, fmt.Sprintf("JSON parsing failed: %s", err.Error()), nil)
 	}
 
+	workerConfig.ApplyProfile(config.GetConfig().Profile().ProxyAuthURL)
+
 	// 获取管理器实例
 	manager := proxy_worker.GetManager()
 
 	// 启动 worker
-	if err := manager.Start(config); err != nil {
-		return reply(500, err.Error(), nil)
+	if err := manager.Start(workerConfig); err != nil {
+		return replyError(err)
 	}
 
 	// 获取状态
@@ -402,13 +779,13 @@ func StartProxyWorker(configJSON *C.char) *C.char {
 // 返回：JSON 格式的响应，包含成功状态和错误信息
 //
 //export StopProxyWorker
-func StopProxyWorker() *C.char {
-	defer recoverAndLog("StopProxyWorker")
+func StopProxyWorker() (ret *C.char) {
+	defer recoverAndLog("StopProxyWorker", &ret)
 	log.Println("StopProxyWorker called")
 	manager := proxy_worker.GetManager()
 
 	if err := manager.Stop(); err != nil {
-		return reply(500, err.Error(), nil)
+		return replyError(err)
 	}
 	return reply(200, "Proxy worker stopped successfully", nil)
 }
@@ -421,29 +798,191 @@ func StopProxyWorker() *C.char {
 //   - fixed_port: 固定端口（静态IP时使用）
 //   - tunnel_id: 隧道 ID
 //   - start_time: 启动时间（Unix 时间戳）
+//   - tunnel_state: 隧道状态（connecting/connected/disconnected）
+//   - traffic: 本次启动以来的代理流量（连接数、收发字节数）
 //   - error: 错误信息（如果有）
 //
 //export GetProxyWorkerStatus
-func GetProxyWorkerStatus() *C.char {
-	defer recoverAndLog("GetProxyWorkerStatus")
+func GetProxyWorkerStatus() (ret *C.char) {
+	defer recoverAndLog("GetProxyWorkerStatus", &ret)
 	log.Println("GetProxyWorkerStatus called")
 	manager := proxy_worker.GetManager()
 	status := manager.GetStatus()
 	return reply(200, "Proxy worker status fetched", status)
 }
 
+// GetHeartbeatStatus 获取心跳状态，注册成功后自动开始发送心跳
+// 返回：JSON 格式的状态信息，包含以下字段：
+//   - running: 心跳是否在运行
+//   - interval: 心跳间隔（秒）
+//   - last_success: 最近一次成功上报的时间（Unix 时间戳，0 表示从未成功）
+//   - last_attempt: 最近一次尝试上报的时间
+//   - last_error: 最近一次上报的错误（成功后清空）
+//   - pending: 离线期间缓存、等待补发的心跳数
+//
+//export GetHeartbeatStatus
+func GetHeartbeatStatus() (ret *C.char) {
+	defer recoverAndLog("GetHeartbeatStatus", &ret)
+	if defaultNode == nil {
+		return replyError(errNotInitialized)
+	}
+	return reply(200, "Heartbeat status fetched", defaultNode.Heartbeat.Status())
+}
+
+// GetClockStatus 获取本地时钟与后端的偏差，core 根据每次响应的 Date 头和时间接口自动校正签名时间戳
+// 返回：JSON 格式的状态信息，包含以下字段：
+//   - offset: 服务端时间 - 本地时间（毫秒）
+//   - skewed: 偏差超过阈值，应提示用户同步系统时间
+//   - threshold: 告警阈值（秒，CLOCK_SKEW_THRESHOLD）
+//   - source: 偏差来源（config、date、time_api）
+//   - last_sync: 最近一次观测的时间（Unix 时间戳，0 表示尚未观测）
+//   - rtt: 最近一次观测的往返时间（毫秒）
+//
+//export GetClockStatus
+func GetClockStatus() (ret *C.char) {
+	defer recoverAndLog("GetClockStatus", &ret)
+	if defaultNode == nil {
+		return replyError(errNotInitialized)
+	}
+	return reply(200, "Clock status fetched", defaultNode.API.ClockStatus())
+}
+
+// GetIdentityStatus 获取克隆检测结果
+// 数据目录被复制到另一台设备时 cloned 为 true，应提示用户并调用 Reregister
+// 返回：JSON 格式的状态信息，包含以下字段：
+//   - hardware_id: 当前设备的硬件标识
+//   - recorded: 身份创建时记录的硬件标识
+//   - cloned: 身份来自另一台设备
+//
+//export GetIdentityStatus
+func GetIdentityStatus() (ret *C.char) {
+	defer recoverAndLog("GetIdentityStatus", &ret)
+	if defaultNode == nil {
+		return replyError(errNotInitialized)
+	}
+	return reply(200, "Identity status fetched", defaultNode.Clone)
+}
+
+// RotateKey 轮换节点密钥（/api/liteNode/node/rotateKey）
+// 生成新密钥，用新旧两把密钥签名提交给后端，确认后替换 aro_rsa，旧密钥在宽限期内保留为 aro_rsa.old；
+// 中断后再次调用会继续提交同一把新密钥。期间暂停系统信息上报和心跳，结束后（包括失败时）恢复之前在运行的任务
+// 返回：JSON 格式的响应，data 包含 public_key、grace_until（旧密钥保留到的 Unix 时间戳）和 resumed
+//
+//export RotateKey
+func RotateKey() (ret *C.char) {
+	defer recoverAndLog("RotateKey", &ret)
+	log.Println("RotateKey called")
+	if defaultNode == nil {
+		return replyError(errNotInitialized)
+	}
+	return rotateKey(defaultNode)
+}
+
+func rotateKey(n *node.Node) *C.char {
+	res, err := n.RotateKey(context.Background())
+	if err != nil {
+		return replyError(err)
+	}
+	return reply(200, "Key rotated", res)
+}
+
+// Reregister 放弃当前身份，以新的客户端 ID 和密钥重新注册（/api/liteNode/signUp）
+// 用于 GetIdentityStatus 报告 cloned 的设备，原设备的身份不受影响
+// 期间暂停系统信息上报和心跳，成功后恢复之前在运行的，失败时保持暂停
+// 返回：与 NodeSignUp 相同的 JSON 响应
+//
+//export Reregister
+func Reregister() (ret *C.char) {
+	defer recoverAndLog("Reregister", &ret)
+	log.Println("Reregister called")
+	if defaultNode == nil {
+		return replyError(errNotInitialized)
+	}
+	return reregister(defaultNode)
+}
+
+func reregister(n *node.Node) *C.char {
+	resp, err := n.Reregister(context.Background())
+	if err != nil {
+		return replyError(err)
+	}
+	return replyBackend(resp)
+}
+
+// ExportIdentity 导出用 passphrase 加密的身份备份（私钥、客户端 ID、序列号和绑定用户）
+// 备份可以在重装或换设备后通过 ImportIdentity 恢复，口令丢失后无法恢复
+// 返回：JSON 格式的响应，data.backup 为 PEM 格式的备份文件内容
+//
+//export ExportIdentity
+func ExportIdentity(passphrase *C.char) (ret *C.char) {
+	defer recoverAndLog("ExportIdentity", &ret)
+	log.Println("ExportIdentity called")
+	if defaultNode == nil {
+		return replyError(errNotInitialized)
+	}
+	return exportIdentity(defaultNode, goStringFromC(passphrase))
+}
+
+func exportIdentity(n *node.Node, passphrase string) *C.char {
+	data, err := n.ExportIdentity(passphrase)
+	if err != nil {
+		return replyError(err)
+	}
+	return reply(200, "Identity exported", map[string]string{"backup": string(data)})
+}
+
+// importIdentityParams ImportIdentity 的参数
+type importIdentityParams struct {
+	Backup     string `json:"backup"`
+	Passphrase string `json:"passphrase"`
+	identity.ImportOptions
+}
+
+// ImportIdentity 用 ExportIdentity 导出的备份替换当前身份
+// 参数 paramsJSON: JSON 格式，包含以下字段：
+//   - backup: 备份文件内容
+//   - passphrase: 导出时使用的口令
+//   - overwrite: 替换本设备上已注册的另一个身份（可选，默认 false）
+//   - force: 后端无法确认身份是否在别处运行时仍然导入（可选，默认 false）
+//
+// 身份最近在另一台设备上发送过心跳时返回 IDENTITY_IN_USE，口令错误或备份损坏时返回 INVALID_BACKUP；
+// 期间暂停系统信息上报和心跳，导入成功后恢复之前在运行的，失败时保持暂停
+// 返回：JSON 格式的响应，data 包含 client_id、serial_number、email、key_type 和 created_at
+//
+//export ImportIdentity
+func ImportIdentity(paramsJSON *C.char) (ret *C.char) {
+	defer recoverAndLog("ImportIdentity", &ret)
+	log.Println("ImportIdentity called")
+	if defaultNode == nil {
+		return replyError(errNotInitialized)
+	}
+	return importIdentity(defaultNode, goStringFromC(paramsJSON))
+}
+
+func importIdentity(n *node.Node, paramsJSON string) *C.char {
+	var params importIdentityParams
+	if err := json.Unmarshal([]byte(paramsJSON), &params); err != nil {
+		return replyCode(errcode.InvalidParams, fmt.Sprintf("JSON parsing failed: %s", err.Error()), nil)
+	}
+	info, err := n.ImportIdentity(context.Background(), []byte(params.Backup), params.Passphrase, params.ImportOptions)
+	if err != nil {
+		return replyError(err)
+	}
+	return reply(200, "Identity imported", info)
+}
+
 // RestartProxyWorker 重启代理工作节点
 // 使用之前的配置重新启动 worker
 // 返回：JSON 格式的响应，包含成功状态和错误信息
 //
 //export RestartProxyWorker
-func RestartProxyWorker() *C.char {
-	defer recoverAndLog("RestartProxyWorker")
+func RestartProxyWorker() (ret *C.char) {
+	defer recoverAndLog("RestartProxyWorker", &ret)
 	log.Println("RestartProxyWorker called")
 	manager := proxy_worker.GetManager()
 
 	if err := manager.Restart(); err != nil {
-		return reply(500, err.Error(), nil)
+		return replyError(err)
 	}
 
 	// 获取新的状态
@@ -458,8 +997,8 @@ func RestartProxyWorker() *C.char {
 // 返回：JSON 格式的响应，包含运行状态
 //
 //export IsProxyWorkerRunning
-func IsProxyWorkerRunning() *C.char {
-	defer recoverAndLog("IsProxyWorkerRunning")
+func IsProxyWorkerRunning() (ret *C.char) {
+	defer recoverAndLog("IsProxyWorkerRunning", &ret)
 	log.Println("IsProxyWorkerRunning called")
 	manager := proxy_worker.GetManager()
 	isRunning := manager.IsRunning()
@@ -471,8 +1010,8 @@ func IsProxyWorkerRunning() *C.char {
 // 返回：JSON 格式的响应
 //
 //export Cleanup
-func Cleanup() *C.char {
-	defer recoverAndLog("Cleanup")
+func Cleanup() (ret *C.char) {
+	defer recoverAndLog("Cleanup", &ret)
 	log.Println("Cleanup called")
 
 	data := map[string]interface{}{}
@@ -488,10 +1027,22 @@ func Cleanup() *C.char {
 		}
 	}
 
-	// 清空全局变量
-	apiClient = nil
-	keyPair = nil
-	clientID = ""
+	// 关闭所有通过句柄创建的节点
+	for _, h := range node.Handles() {
+		if n, err := node.Release(h); err == nil {
+			if err := n.Close(); err != nil {
+				log.Printf("Cleanup: failed to close node %d: %v", h, err)
+			}
+		}
+	}
+
+	// 停止默认节点的后台任务和配置监视，清空全局变量
+	if defaultNode != nil {
+		if err := defaultNode.Close(); err != nil {
+			log.Printf("Cleanup: failed to close the default node: %v", err)
+		}
+	}
+	defaultNode = nil
 
 	log.Println("Cleanup: all resources cleaned")
 	os.Stderr.Sync() // 确保日志写入
@@ -0,0 +1,242 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"aro-ext-app/core/internal/api_client"
+	"aro-ext-app/core/internal/config"
+	"aro-ext-app/core/internal/errcode"
+	"aro-ext-app/core/internal/events"
+	"aro-ext-app/core/internal/updater"
+	"aro-ext-app/core/version"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// ======================
+// OTA 自更新导出函数
+// ======================
+// 更新流程：CheckForUpdate 下载校验并暂存新库 → 下次 InitLibstudy 时原子替换库文件
+// （当前进程仍使用已加载的旧库，需要重启应用）→ 新库的 InitLibstudy 完成首次健康检查
+// （GetNodeStat）后确认，失败则自动回滚到旧库
+
+// UpdateParams InitLibstudy 的 update 参数
+type UpdateParams struct {
+	// LibraryPath 当前加载的库文件路径（如 <app support>/libstudy.so），为空时不启用自更新
+	LibraryPath string `json:"library_path"`
+	// Dir 更新状态目录，默认与库文件同目录下的 updates/
+	Dir string `json:"dir"`
+}
+
+// libUpdater InitLibstudy 根据 UpdateParams 创建的更新器
+var libUpdater *updater.Updater
+
+var errUpdaterDisabled = errcode.New(errcode.NotInitialized, "updater not configured, pass update.library_path to InitLibstudy")
+
+// initUpdater 创建更新器，记录试运行启动次数并安装已暂存的更新，结果写入 details
+func initUpdater(params UpdateParams, details map[string]interface{}) {
+	libUpdater = nil
+	if params.LibraryPath == "" {
+		return
+	}
+	key, err := updater.ParsePublicKey(version.RELEASE_PUBLIC_KEY)
+	if err != nil {
+		details["update_error"] = err.Error()
+		return
+	}
+	u, err := updater.New(updater.Options{
+		Dir:            params.Dir,
+		Target:         params.LibraryPath,
+		CurrentVersion: Version,
+		PublicKey:      key,
+	})
+	if err != nil {
+		details["update_error"] = err.Error()
+		return
+	}
+	libUpdater = u
+
+	st, err := u.Startup()
+	if errors.Is(err, updater.ErrRolledBack) {
+		details["update_rolled_back"] = st.Version
+		details["restart_required"] = true
+		events.Publish(events.OTARolledBack, events.OTAEvent{
+			CurrentVersion: st.PreviousVersion,
+			LatestVersion:  st.Version,
+			Error:          st.LastError,
+		})
+		return
+	}
+	if err != nil {
+		details["update_error"] = err.Error()
+		return
+	}
+
+	applied, err := u.Apply()
+	if err != nil {
+		details["update_error"] = err.Error()
+		return
+	}
+	if applied {
+		st, _ = u.State()
+		details["update_applied"] = st.Version
+		details["restart_required"] = true
+		events.Publish(events.OTAApplied, events.OTAEvent{
+			CurrentVersion: st.PreviousVersion,
+			LatestVersion:  st.Version,
+		})
+		return
+	}
+	if st.Status == updater.StatusTrial {
+		go checkUpdateHealth(u, defaultNode.API)
+	}
+}
+
+// checkUpdateHealth 新版本首次健康检查：GetNodeStat 成功则确认，失败则回滚，
+// 后端不可达时无法判断，保持试运行到下次启动
+func checkUpdateHealth(u *updater.Updater, client *api_client.APIClient) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("panic in update health check: %v", r)
+		}
+	}()
+	_, statErr := client.GetNodeStatContext(context.Background())
+	if errcode.Of(statErr) == errcode.BackendUnreachable {
+		log.Printf("Update health check inconclusive: %v", statErr)
+		return
+	}
+	if err := u.HealthCheck(context.Background(), func(context.Context) error { return statErr }); errors.Is(err, updater.ErrRolledBack) {
+		st, _ := u.State()
+		events.Publish(events.OTARolledBack, events.OTAEvent{
+			CurrentVersion: st.PreviousVersion,
+			LatestVersion:  st.Version,
+			Error:          st.LastError,
+		})
+	} else if err != nil {
+		log.Printf("Update health check failed: %v", err)
+	}
+}
+
+// CheckForUpdate 按更新策略（渠道、灰度、最低支持版本、固定版本）查询最新版本，
+// 需要更新时下载（断点续传）、校验摘要和签名并暂存，下次启动时安装；
+// 下载可能耗时较长，请在 Dart 的后台 isolate 中调用
+// 返回：JSON 格式的响应，data 包含 update_available、decision（update、forced、reason 等）、latest、state
+// decision.forced 为 true 时当前版本已低于最低支持版本，应用应提示用户尽快重启完成更新
+//
+//export CheckForUpdate
+func CheckForUpdate() (ret *C.char) {
+	defer recoverAndLog("CheckForUpdate", &ret)
+	log.Println("CheckForUpdate called")
+	if defaultNode == nil {
+		return replyError(errNotInitialized)
+	}
+	if libUpdater == nil {
+		return replyError(errUpdaterDisabled)
+	}
+
+	policy := updater.PolicyFromConfig(defaultNode.Config, defaultNode.ClientID, Version)
+	rel, err := updater.FetchRelease(context.Background(), defaultNode.API, policy.Channel)
+	if err != nil {
+		return replyError(err)
+	}
+	decision := policy.Decide(rel)
+	available := decision.Update && libUpdater.Available(rel)
+	if available {
+		if err := libUpdater.Stage(context.Background(), rel); err != nil {
+			return replyError(err)
+		}
+		events.Publish(events.OTAStaged, events.OTAEvent{
+			CurrentVersion: Version,
+			LatestVersion:  rel.Version,
+			URL:            rel.URL,
+			ReleaseNotes:   rel.ReleaseNotes,
+			Forced:         decision.Forced,
+		})
+	}
+	st, err := libUpdater.State()
+	if err != nil {
+		return replyError(err)
+	}
+	return reply(200, "ok", map[string]interface{}{
+		"update_available": available,
+		"decision":         decision,
+		"policy":           policy,
+		"latest":           rel,
+		"state":            st,
+	})
+}
+
+// SetUpdatePolicy 设置更新渠道和固定版本并写入配置
+// 参数：policyJSON - JSON 格式参数：
+//   - channel: 更新渠道（dev/testnet/mainnet/beta），为空时不修改
+//   - pin_version: 固定版本，传空字符串取消固定
+//
+// 返回：JSON 格式的响应，data 为生效后的策略
+//
+//export SetUpdatePolicy
+func SetUpdatePolicy(policyJSON *C.char) (ret *C.char) {
+	defer recoverAndLog("SetUpdatePolicy", &ret)
+	log.Println("SetUpdatePolicy called")
+	if defaultNode == nil {
+		return replyError(errNotInitialized)
+	}
+	var params struct {
+		Channel    string  `json:"channel"`
+		PinVersion *string `json:"pin_version"`
+	}
+	if err := json.Unmarshal([]byte(goStringFromC(policyJSON)), &params); err != nil {
+		return replyCode(errcode.InvalidParams, fmt.Sprintf("JSON parsing failed: %s", err.Error()), nil)
+	}
+	// 渠道和固定版本一起保存，任一无效时都不保存
+	values := map[string]string{}
+	if params.Channel != "" {
+		if err := updater.ValidateChannel(params.Channel); err != nil {
+			return replyCode(errcode.InvalidConfig, err.Error(), nil)
+		}
+		values[config.KeyUpdateChannel] = params.Channel
+	}
+	if params.PinVersion != nil {
+		values[config.KeyUpdatePinVersion] = *params.PinVersion
+	}
+	if err := defaultNode.Config.SetAndSaveAll(values); err != nil {
+		return replyError(err)
+	}
+	return reply(200, "Update policy saved", updater.PolicyFromConfig(defaultNode.Config, defaultNode.ClientID, Version))
+}
+
+// GetUpdateStatus 返回更新状态（idle/staged/trial、版本、失败记录）
+//
+//export GetUpdateStatus
+func GetUpdateStatus() (ret *C.char) {
+	defer recoverAndLog("GetUpdateStatus", &ret)
+	if libUpdater == nil {
+		return replyError(errUpdaterDisabled)
+	}
+	st, err := libUpdater.State()
+	if err != nil {
+		return replyError(err)
+	}
+	return reply(200, "ok", st)
+}
+
+// RollbackUpdate 手动回滚试运行中的新版本，重启应用后生效
+//
+//export RollbackUpdate
+func RollbackUpdate() (ret *C.char) {
+	defer recoverAndLog("RollbackUpdate", &ret)
+	log.Println("RollbackUpdate called")
+	if libUpdater == nil {
+		return replyError(errUpdaterDisabled)
+	}
+	st, err := libUpdater.Rollback("requested by app")
+	if err != nil && !errors.Is(err, updater.ErrRolledBack) {
+		return replyError(err)
+	}
+	return reply(200, "Update rolled back, restart required", st)
+}
@@ -70,6 +70,7 @@ func (h *autoHandler) Init(md md.Metadata) error {
 				"kind":   "auther",
 				"plugin": "aro",
 			})),
+			auth_plugin.CacheDirOption(h.md.cacheDir),
 		)
 		h.options.Auther = aroAuther
 		h.options.Logger.Info("ARO auther enabled via metadata configuration")
@@ -8,10 +8,12 @@ import (
 type metadata struct {
 	enableAroAuther bool
 	backUrl         string
+	cacheDir        string
 }
 
 func (h *autoHandler) parseMetadata(md mdata.Metadata) error {
 	h.md.enableAroAuther = mdutil.GetBool(md, "enableAroAuther", "enable_aro_auther")
 	h.md.backUrl = mdutil.GetString(md, "backUrl", "back_url")
+	h.md.cacheDir = mdutil.GetString(md, "cacheDir", "cache_dir")
 	return nil
 }
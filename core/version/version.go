@@ -0,0 +1,13 @@
+package version
+
+// 版本信息，构建时由 scripts/build_go_libs.sh 通过 -ldflags -X 注入
+var (
+	VERSION   = "0.0.5"
+	BUILDTIME = ""
+	GITCOMMIT = ""
+	GITBRANCH = ""
+
+	// RELEASE_PUBLIC_KEY OTA 发布签名公钥（base64 Ed25519），由构建脚本从 ARO_RELEASE_PUBLIC_KEY 注入
+	// 为空时更新器拒绝安装任何更新
+	RELEASE_PUBLIC_KEY = ""
+)
@@ -9,6 +9,7 @@
 # 用法：
 #   ./scripts/build_go_libs.sh build          # 构建所有平台
 #   ./scripts/build_go_libs.sh build-linux    # 仅构建 Linux
+#   ./scripts/build_go_libs.sh build-node     # 构建无界面节点程序 aro-node（当前平台）
 #   ./scripts/build_go_libs.sh version        # 显示版本信息
 #   ./scripts/build_go_libs.sh clean          # 清理构建产物
 #   ./scripts/build_go_libs.sh ci             # GitHub Actions 构建
@@ -27,7 +28,7 @@ PLUGINS_DIR="$PROJECT_ROOT/plugins"
 VERSION_FILE="$PROJECT_ROOT/core/version/version.go"
 
 # 基础版本号
-BASE_VERSION="0.0.1"
+BASE_VERSION="0.0.5"
 BUILD_DATE=$(date +%Y%m%d)
 
 # 颜色输出
@@ -97,7 +98,8 @@ generate_ldflags() {
 -X aro-ext-app/core/version.VERSION=$BASE_VERSION \
 -X aro-ext-app/core/version.BUILDTIME=$buildtime \
 -X aro-ext-app/core/version.GITCOMMIT=$commit \
--X aro-ext-app/core/version.GITBRANCH=$branch"
+-X aro-ext-app/core/version.GITBRANCH=$branch \
+-X aro-ext-app/core/version.RELEASE_PUBLIC_KEY=${ARO_RELEASE_PUBLIC_KEY:-}"
 }
 
 # ============================================
@@ -384,6 +386,24 @@ show_build_output() {
     fi
 }
 
+# 构建无界面节点程序 aro-node（纯 Go，不需要 cgo）
+build_node() {
+    local goos=$(go env GOOS)
+    local goarch=$(go env GOARCH)
+    local git_info=$(get_git_info)
+    local ldflags=$(generate_ldflags "$git_info")
+    local output_dir="$PROJECT_ROOT/build/aro-node"
+
+    log_info "构建 aro-node ${goos}_${goarch}"
+    mkdir -p "$output_dir"
+
+    cd "$CORE_DIR"
+    go build -ldflags "$ldflags" \
+        -o "$output_dir/aro-node_${BASE_VERSION}_${goos}_${goarch}" \
+        ./cmd/aro-node
+    log_success "输出: $output_dir/aro-node_${BASE_VERSION}_${goos}_${goarch}"
+}
+
 # ============================================
 # GitHub Actions CI/CD 支持
 # ============================================
@@ -455,6 +475,10 @@ main() {
             log_success "Linux 构建完成"
             ;;
             
+        build-node)
+            build_node
+            ;;
+
         build-windows)
             log_info "构建 Windows 平台"
             build_for_platform "windows" "amd64" "libstudy_${BASE_VERSION}_windows_amd64"